@@ -0,0 +1,214 @@
+package api
+
+import (
+	"github.com/alfcope/checkouttest/api/requests"
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/errors"
+	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/pkg/auth"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+type CatalogueController struct {
+	catalogueService CatalogueService
+}
+
+func NewCatalogueController(router *mux.Router, service CatalogueService) *CatalogueController {
+	controller := &CatalogueController{
+		catalogueService: service,
+	}
+
+	controller.initializeRoutes(router)
+
+	return controller
+}
+
+func (c *CatalogueController) initializeRoutes(router *mux.Router) {
+
+	productsRouter := router.PathPrefix("/products").Subrouter()
+	productsRouter.Use(logging.AccessLoggingMiddleware)
+
+	productsRouter.Handle("/", auth.Require(auth.Shopper, c.GetProducts())).Methods("GET").Headers("Accept", "application/json")
+	productsRouter.Handle("/{code}", auth.Require(auth.Shopper, c.GetProduct())).Methods("GET").Headers("Accept", "application/json")
+	productsRouter.Handle("/", auth.Require(auth.Admin, c.AddProduct())).Methods("POST").Headers("Content-Type", "application/json")
+	productsRouter.Handle("/{code}", auth.Require(auth.Admin, c.UpdateProduct())).Methods("PUT").Headers("Content-Type", "application/json")
+	productsRouter.Handle("/{code}", auth.Require(auth.Admin, c.DeleteProduct())).Methods("DELETE")
+	productsRouter.Handle("/{code}/stock", auth.Require(auth.Admin, c.GetStock())).Methods("GET").Headers("Accept", "application/json")
+	productsRouter.Handle("/{code}/stock", auth.Require(auth.Admin, c.SetStock())).Methods("PUT").Headers("Content-Type", "application/json")
+}
+
+// GetProducts handles requests to list the whole product catalogue.
+// Http method: GET
+// Return: the list of products sorted by code.
+func (c *CatalogueController) GetProducts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		responses.Response(w, logger, http.StatusOK, c.catalogueService.GetProducts())
+	}
+}
+
+// GetProduct handles requests to read a product of the catalogue.
+// Http method: GET
+// Path parameter: product code
+// Return: the product resource if successful or a http error code otherwise.
+func (c *CatalogueController) GetProduct() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		productCode := pathParameters["code"]
+
+		product, err := c.catalogueService.GetProduct(model.ProductCode(productCode))
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+
+		responses.Response(w, logger, http.StatusOK, product)
+	}
+}
+
+// AddProduct handles requests to add a new product into the catalogue.
+// Http method: POST
+// Return: the new product resource if successful or a http error code otherwise.
+// Validation errors are described in the response payload.
+func (c *CatalogueController) AddProduct() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		request, err := requests.NewProductRequest(r.Body)
+		if err != nil {
+			responses.ResponseError(w, logger, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		err = c.catalogueService.AddProduct(*request)
+		if err != nil {
+			responses.ResponseErrorDetails(w, logger, responses.GetStatusByError(err), err)
+			return
+		}
+
+		responses.Response(w, logger, http.StatusCreated, request)
+	}
+}
+
+// UpdateProduct handles requests to replace a product of the catalogue. The product
+// code in the payload, if any, must match the one in the path.
+// Http method: PUT
+// Path parameter: product code
+// Return: the updated product resource if successful or a http error code otherwise.
+// Validation errors are described in the response payload.
+func (c *CatalogueController) UpdateProduct() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		productCode := model.ProductCode(pathParameters["code"])
+
+		request, err := requests.NewProductRequest(r.Body)
+		if err != nil {
+			responses.ResponseError(w, logger, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if request.Code == "" {
+			request.Code = productCode
+		}
+
+		if request.Code != productCode {
+			err = errors.NewValidationError([]*errors.ValidationErrorDescription{
+				errors.NewValidationErrorDescription("code", "Product code does not match the path")})
+			responses.ResponseErrorDetails(w, logger, http.StatusUnprocessableEntity, err)
+			return
+		}
+
+		err = c.catalogueService.UpdateProduct(*request)
+		if err != nil {
+			responses.ResponseErrorDetails(w, logger, responses.GetStatusByError(err), err)
+			return
+		}
+
+		responses.Response(w, logger, http.StatusOK, request)
+	}
+}
+
+// DeleteProduct handles requests to remove a product from the catalogue. Baskets
+// already holding the product are not modified.
+// Http method: DELETE
+// Path parameter: product code
+// Return: no content if successful or a http error code otherwise.
+func (c *CatalogueController) DeleteProduct() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		productCode := pathParameters["code"]
+
+		err := c.catalogueService.DeleteProduct(model.ProductCode(productCode))
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+
+		responses.Response(w, logger, http.StatusNoContent, nil)
+	}
+}
+
+// GetStock handles requests to read the stock of a product.
+// Http method: GET
+// Path parameter: product code
+// Return: the units on hand, reserved by baskets and available if successful or a
+// http error code otherwise.
+func (c *CatalogueController) GetStock() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		productCode := pathParameters["code"]
+
+		stock, err := c.catalogueService.GetStock(model.ProductCode(productCode))
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+
+		responses.Response(w, logger, http.StatusOK, responses.NewStockResponse(stock))
+	}
+}
+
+// SetStock handles requests to set the units on hand of a product. Products are not
+// limited by stock until their units are set.
+// Http method: PUT
+// Path parameter: product code
+// Return: the updated stock if successful or a http error code otherwise.
+// Validation errors are described in the response payload.
+func (c *CatalogueController) SetStock() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		productCode := pathParameters["code"]
+
+		request, err := requests.NewSetStockRequest(r.Body)
+		if err != nil {
+			responses.ResponseError(w, logger, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if request.Quantity == nil {
+			responses.ResponseError(w, logger, http.StatusUnprocessableEntity, "Empty stock quantity")
+			return
+		}
+
+		stock, err := c.catalogueService.SetStock(model.ProductCode(productCode), *request.Quantity)
+		if err != nil {
+			responses.ResponseErrorDetails(w, logger, responses.GetStatusByError(err), err)
+			return
+		}
+
+		responses.Response(w, logger, http.StatusOK, responses.NewStockResponse(stock))
+	}
+}
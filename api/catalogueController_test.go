@@ -0,0 +1,348 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/datasource"
+	"github.com/alfcope/checkouttest/errors"
+	"github.com/alfcope/checkouttest/internal/tests/mocks"
+	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type CatalogueControllerTestSuite struct {
+	suite.Suite
+
+	catalogueController CatalogueController
+	datasourceMock      datasource.Datasource
+}
+
+func TestCatalogueControllerSuite(t *testing.T) {
+	suite.Run(t, new(CatalogueControllerTestSuite))
+}
+
+func (suite *CatalogueControllerTestSuite) SetupSuite() {
+	apiRoute := mux.NewRouter().PathPrefix("/api/v1").Subrouter().StrictSlash(true)
+
+	taxes, err := model.NewTaxRates(map[model.TaxCategory]string{"standard": "21", "reduced": "10"}, model.PerLineRounding)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	suite.datasourceMock = datasource.Datasource(mocks.NewDatasourceMock())
+	suite.catalogueController = *NewCatalogueController(apiRoute, NewCatalogueService(suite.datasourceMock, taxes))
+}
+
+func (suite *CatalogueControllerTestSuite) TearDownTest() {
+	suite.datasourceMock.(*mocks.DatasourceMock).ExpectedCalls = nil
+	suite.datasourceMock.(*mocks.DatasourceMock).Calls = nil
+}
+
+func (suite *CatalogueControllerTestSuite) TestGetProducts() {
+	// Given
+	products := []model.Product{{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")}, {Code: "P2", Name: "Prod 2", Price: model.NewMoney(550, "EUR")}}
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProducts").Return(products)
+
+	// When
+	req, err := http.NewRequest("GET", "/products/", nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.catalogueController.GetProducts())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+
+	var response []model.Product
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	if err != nil {
+		suite.T().Errorf("Error unmarshalling products response: %v", err)
+	}
+	suite.Equal(products, response)
+}
+
+func (suite *CatalogueControllerTestSuite) TestGetNonExistingProduct() {
+	// Given
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct",
+		mock.AnythingOfType("model.ProductCode")).Return(*new(model.Product), errors.NewProductNotFound("FAKE"))
+
+	// When
+	req, err := http.NewRequest("GET", "/products/FAKE", nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"code": "FAKE"})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.catalogueController.GetProduct())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusNotFound, rr.Code)
+}
+
+func (suite *CatalogueControllerTestSuite) TestAddInvalidProduct() {
+	// When
+	req, err := http.NewRequest("POST", "/products/", bytes.NewBufferString(`{"code": "P1", "name": "Prod 1", "price": -5}`))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.catalogueController.AddProduct())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusUnprocessableEntity, rr.Code)
+
+	var response responses.ErrorResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	if err != nil {
+		suite.T().Errorf("Error unmarshalling error response: %v", err)
+	}
+	suite.Equal([]responses.FieldErrorResponse{{Field: "price", Message: "Invalid product price"}}, response.Errors)
+}
+
+func (suite *CatalogueControllerTestSuite) TestAddProductWithUnknownTaxCategory() {
+	// When
+	req, err := http.NewRequest("POST", "/products/",
+		bytes.NewBufferString(`{"code": "P1", "name": "Prod 1", "price": 500, "taxCategory": "luxury"}`))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.catalogueController.AddProduct())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusUnprocessableEntity, rr.Code)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "AddProduct", mock.AnythingOfType("model.Product"))
+
+	var response responses.ErrorResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	if err != nil {
+		suite.T().Errorf("Error unmarshalling error response: %v", err)
+	}
+	suite.Equal([]responses.FieldErrorResponse{{Field: "taxCategory", Message: "Invalid product tax category"}}, response.Errors)
+}
+
+func (suite *CatalogueControllerTestSuite) TestAddDuplicatedProduct() {
+	// Given
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddProduct",
+		mock.AnythingOfType("model.Product")).Return(errors.NewProductAlreadyExists("P1"))
+
+	// When
+	req, err := http.NewRequest("POST", "/products/", bytes.NewBufferString(`{"code": "P1", "name": "Prod 1", "price": 500}`))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.catalogueController.AddProduct())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusConflict, rr.Code)
+}
+
+func (suite *CatalogueControllerTestSuite) TestAddProduct() {
+	// Given
+	product := model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(500, "EUR")}
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddProduct", product).Return(nil)
+
+	// When
+	req, err := http.NewRequest("POST", "/products/", bytes.NewBufferString(`{"code": "P1", "name": "Prod 1", "price": 500}`))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.catalogueController.AddProduct())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusCreated, rr.Code)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertCalled(suite.T(), "AddProduct", product)
+}
+
+func (suite *CatalogueControllerTestSuite) TestUpdateProductCodeMismatch() {
+	// When
+	req, err := http.NewRequest("PUT", "/products/P1", bytes.NewBufferString(`{"code": "P2", "name": "Prod 2", "price": 500}`))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"code": "P1"})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.catalogueController.UpdateProduct())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusUnprocessableEntity, rr.Code)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "UpdateProduct", mock.AnythingOfType("model.Product"))
+}
+
+func (suite *CatalogueControllerTestSuite) TestUpdateProductWithUnknownTaxCategory() {
+	// When
+	req, err := http.NewRequest("PUT", "/products/P1",
+		bytes.NewBufferString(`{"name": "Prod 1", "price": 650, "taxCategory": "luxury"}`))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"code": "P1"})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.catalogueController.UpdateProduct())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusUnprocessableEntity, rr.Code)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "UpdateProduct", mock.AnythingOfType("model.Product"))
+}
+
+func (suite *CatalogueControllerTestSuite) TestUpdateProduct() {
+	// Given
+	product := model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(650, "EUR"), TaxCategory: "Reduced"}
+	suite.datasourceMock.(*mocks.DatasourceMock).On("UpdateProduct", product).Return(nil)
+
+	// When
+	req, err := http.NewRequest("PUT", "/products/P1", bytes.NewBufferString(`{"name": "Prod 1", "price": 650, "taxCategory": "Reduced"}`))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"code": "P1"})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.catalogueController.UpdateProduct())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertCalled(suite.T(), "UpdateProduct", product)
+}
+
+func (suite *CatalogueControllerTestSuite) TestDeleteProduct() {
+	// Given
+	suite.datasourceMock.(*mocks.DatasourceMock).On("DeleteProduct", model.ProductCode("P1")).Return(nil)
+
+	// When
+	req, err := http.NewRequest("DELETE", "/products/P1", nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"code": "P1"})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.catalogueController.DeleteProduct())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusNoContent, rr.Code)
+}
+
+func (suite *CatalogueControllerTestSuite) TestGetStock() {
+	// Given
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetStock", model.ProductCode("P1")).Return(
+		model.Stock{Code: "P1", Tracked: true, OnHand: 5, Reserved: 2}, nil)
+
+	// When
+	req, err := http.NewRequest("GET", "/products/P1/stock", nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"code": "P1"})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.catalogueController.GetStock())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+
+	var response responses.StockResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	if err != nil {
+		suite.T().Errorf("Error unmarshalling stock response: %v", err)
+	}
+	suite.Equal(responses.StockResponse{Code: "P1", Tracked: true, OnHand: 5, Reserved: 2, Available: 3}, response)
+}
+
+func (suite *CatalogueControllerTestSuite) TestSetStockBelowReserved() {
+	// Given
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetStock", model.ProductCode("P1")).Return(
+		model.Stock{Code: "P1", Tracked: true, OnHand: 5, Reserved: 2}, nil)
+
+	// When
+	req, err := http.NewRequest("PUT", "/products/P1/stock", bytes.NewBufferString(`{"quantity": 1}`))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"code": "P1"})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.catalogueController.SetStock())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusUnprocessableEntity, rr.Code)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "UpdateStock", mock.AnythingOfType("model.Stock"))
+}
+
+func (suite *CatalogueControllerTestSuite) TestSetStock() {
+	// Given
+	stock := model.Stock{Code: "P1", Tracked: true, OnHand: 10}
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetStock", model.ProductCode("P1")).Return(model.Stock{Code: "P1"}, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("UpdateStock", stock).Return(nil)
+
+	// When
+	req, err := http.NewRequest("PUT", "/products/P1/stock", bytes.NewBufferString(`{"quantity": 10}`))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"code": "P1"})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.catalogueController.SetStock())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertCalled(suite.T(), "UpdateStock", stock)
+}
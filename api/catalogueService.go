@@ -0,0 +1,108 @@
+package api
+
+import (
+	"github.com/alfcope/checkouttest/datasource"
+	"github.com/alfcope/checkouttest/errors"
+	"github.com/alfcope/checkouttest/model"
+)
+
+type catalogueService struct {
+	ds    datasource.Datasource
+	taxes model.TaxRates
+}
+
+type CatalogueService interface {
+	GetProducts() []model.Product
+	GetProduct(model.ProductCode) (model.Product, error)
+	AddProduct(model.Product) error
+	UpdateProduct(model.Product) error
+	DeleteProduct(model.ProductCode) error
+	GetStock(model.ProductCode) (model.Stock, error)
+	SetStock(model.ProductCode, int) (model.Stock, error)
+}
+
+// NewCatalogueService returns a service accepting only products of the categories
+// with a tax rate
+func NewCatalogueService(ds datasource.Datasource, taxes model.TaxRates) CatalogueService {
+	return &catalogueService{
+		ds:    ds,
+		taxes: taxes,
+	}
+}
+
+func (c *catalogueService) GetProducts() []model.Product {
+	return c.ds.GetProducts()
+}
+
+func (c *catalogueService) GetProduct(code model.ProductCode) (model.Product, error) {
+	return c.ds.GetProduct(code)
+}
+
+func (c *catalogueService) AddProduct(product model.Product) error {
+	err := c.validateProduct(product)
+	if err != nil {
+		return err
+	}
+
+	return c.ds.AddProduct(product)
+}
+
+// UpdateProduct replaces a product of the catalogue. Baskets already holding the
+// product keep the price it had when it was added
+func (c *catalogueService) UpdateProduct(product model.Product) error {
+	err := c.validateProduct(product)
+	if err != nil {
+		return err
+	}
+
+	return c.ds.UpdateProduct(product)
+}
+
+// validateProduct checks the product and that its tax category has a rate, so the
+// receipts of the baskets holding it can be taxed
+func (c *catalogueService) validateProduct(product model.Product) error {
+	var validationErrorDescriptions []*errors.ValidationErrorDescription
+
+	if err := product.Validate(); err != nil {
+		validationError, ok := err.(*errors.ValidationError)
+		if !ok {
+			return err
+		}
+		validationErrorDescriptions = validationError.Errors
+	}
+
+	if !c.taxes.Supports(product.TaxCategory) {
+		validationErrorDescriptions = append(validationErrorDescriptions,
+			errors.NewValidationErrorDescription("taxCategory", "Invalid product tax category"))
+	}
+
+	if len(validationErrorDescriptions) > 0 {
+		return errors.NewValidationError(validationErrorDescriptions)
+	}
+
+	return nil
+}
+
+func (c *catalogueService) DeleteProduct(code model.ProductCode) error {
+	return c.ds.DeleteProduct(code)
+}
+
+func (c *catalogueService) GetStock(code model.ProductCode) (model.Stock, error) {
+	return c.ds.GetStock(code)
+}
+
+// SetStock sets the units on hand of a product, which starts tracking its stock.
+// The units can not be set below those reserved by the baskets
+func (c *catalogueService) SetStock(code model.ProductCode, units int) (model.Stock, error) {
+	var stock model.Stock
+	err := c.ds.UpdateStock(code, func(s *model.Stock) error {
+		if err := s.SetOnHand(units); err != nil {
+			return err
+		}
+
+		stock = *s
+		return nil
+	})
+
+	return stock, err
+}
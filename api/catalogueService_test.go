@@ -0,0 +1,91 @@
+package api
+
+import (
+	"github.com/alfcope/checkouttest/datasource"
+	"github.com/alfcope/checkouttest/errors"
+	"github.com/alfcope/checkouttest/internal/tests/mocks"
+	"github.com/alfcope/checkouttest/model"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type CatalogueServiceTestSuite struct {
+	suite.Suite
+
+	datasourceMock   datasource.Datasource
+	catalogueService CatalogueService
+}
+
+func TestCatalogueServiceSuite(t *testing.T) {
+	suite.Run(t, new(CatalogueServiceTestSuite))
+}
+
+func (suite *CatalogueServiceTestSuite) SetupSuite() {
+	suite.datasourceMock = datasource.Datasource(mocks.NewDatasourceMock())
+	suite.catalogueService = NewCatalogueService(suite.datasourceMock, model.TaxRates{})
+}
+
+func (suite *CatalogueServiceTestSuite) TearDownTest() {
+	suite.datasourceMock.(*mocks.DatasourceMock).ExpectedCalls = nil
+	suite.datasourceMock.(*mocks.DatasourceMock).Calls = nil
+}
+
+func (suite *CatalogueServiceTestSuite) TestAddInvalidProduct() {
+	// Given
+	product := model.Product{Code: "", Name: "Prod 1", Price: model.NewMoney(-10, "EUR")}
+
+	// When
+	err := suite.catalogueService.AddProduct(product)
+
+	// Then
+	if validationError, ok := err.(*errors.ValidationError); ok {
+		suite.Equal(2, len(validationError.Errors))
+	} else {
+		suite.T().Error("Error should be a validation error")
+	}
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "AddProduct", mock.AnythingOfType("model.Product"))
+}
+
+func (suite *CatalogueServiceTestSuite) TestAddProduct() {
+	// Given
+	product := model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")}
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddProduct", product).Return(nil)
+
+	// When
+	err := suite.catalogueService.AddProduct(product)
+
+	// Then
+	suite.Nil(err)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertCalled(suite.T(), "AddProduct", product)
+}
+
+func (suite *CatalogueServiceTestSuite) TestUpdateInvalidProduct() {
+	// Given
+	product := model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(0, "EUR")}
+
+	// When
+	err := suite.catalogueService.UpdateProduct(product)
+
+	// Then
+	if _, ok := err.(*errors.ValidationError); !ok {
+		suite.T().Error("Error should be a validation error")
+	}
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "UpdateProduct", mock.AnythingOfType("model.Product"))
+}
+
+func (suite *CatalogueServiceTestSuite) TestDeleteNonExistingProduct() {
+	// Given
+	suite.datasourceMock.(*mocks.DatasourceMock).On("DeleteProduct",
+		mock.AnythingOfType("model.ProductCode")).Return(errors.NewProductNotFound("FAKE"))
+
+	// When
+	err := suite.catalogueService.DeleteProduct("FAKE")
+
+	// Then
+	if productNotFound, ok := err.(*errors.ProductNotFound); ok {
+		suite.Equal("FAKE", productNotFound.Code)
+	} else {
+		suite.T().Error("Error should be a product not found error")
+	}
+}
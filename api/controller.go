@@ -3,6 +3,8 @@ package api
 import (
 	"github.com/alfcope/checkouttest/api/requests"
 	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/pkg/auth"
 	"github.com/alfcope/checkouttest/pkg/logging"
 	"github.com/gorilla/mux"
 	"net/http"
@@ -28,13 +30,21 @@ func (c *CheckoutController) initializeRoutes(router *mux.Router) {
 	checkoutRouter.Use(logging.AccessLoggingMiddleware)
 
 	// swagger:route POST / payments postPayment
-	checkoutRouter.HandleFunc("/", c.CreateBasket()).Methods("POST").Headers("Accept", "application/json")
+	checkoutRouter.Handle("/", auth.Require(auth.Shopper, c.CreateBasket())).Methods("POST").Headers("Accept", "application/json")
 	// swagger:route GET /{id} payments getPayment
-	checkoutRouter.HandleFunc("/{id}/items/", c.AddItem()).Methods("POST").Headers("Content-Type", "application/json")
+	checkoutRouter.Handle("/{id}/items/", auth.Require(auth.Shopper, c.AddItem())).Methods("POST").Headers("Content-Type", "application/json")
+	checkoutRouter.Handle("/{id}/items/batch", auth.Require(auth.Shopper, c.AddItems())).Methods("POST").Headers("Content-Type", "application/json")
+	checkoutRouter.Handle("/{id}/items/{code}", auth.Require(auth.Shopper, c.SetItemQuantity())).Methods("PUT").Headers("Content-Type", "application/json")
+	checkoutRouter.Handle("/{id}/items/{code}", auth.Require(auth.Shopper, c.RemoveItem())).Methods("DELETE")
+	checkoutRouter.Handle("/{id}/coupons/", auth.Require(auth.Shopper, c.ApplyCoupon())).Methods("POST").Headers("Content-Type", "application/json")
+	checkoutRouter.Handle("/{id}/coupons/{code}", auth.Require(auth.Shopper, c.RemoveCoupon())).Methods("DELETE")
 	// swagger:route GET / payments getPaymentsPage
-	checkoutRouter.HandleFunc("/{id}", c.GetPrice()).Methods("GET").Queries("price", "").Headers("Accept", "application/json")
+	checkoutRouter.Handle("/{id}", auth.Require(auth.Shopper, c.GetPrice())).Methods("GET").Queries("price", "").Headers("Accept", "application/json")
+	checkoutRouter.Handle("/{id}", auth.Require(auth.Shopper, c.GetBasket())).Methods("GET").Headers("Accept", "application/json")
+	checkoutRouter.Handle("/{id}/receipt", auth.Require(auth.Shopper, c.GetReceipt())).Methods("GET").Headers("Accept", "application/json")
+	checkoutRouter.Handle("/{id}/checkout", auth.Require(auth.Shopper, c.Checkout())).Methods("POST").Headers("Accept", "application/json")
 	// swagger:route DELETE /{id} payments deletePayment
-	checkoutRouter.HandleFunc("/{id}", c.DeleteBasket()).Methods("DELETE")
+	checkoutRouter.Handle("/{id}", auth.Require(auth.Shopper, c.DeleteBasket())).Methods("DELETE")
 }
 
 // PostPayment handles requests to add a payment into the system. The new payment
@@ -46,7 +56,13 @@ func (c *CheckoutController) CreateBasket() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		logger := logging.GetLoggerWithFields(r)
 
-		basketId, err := c.checkoutService.CreateBasket()
+		request, err := requests.NewCreateBasketRequest(r.Body)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+
+		basketId, err := c.checkoutService.CreateBasket(requests.CustomerId(r), request.Currency)
 		if err != nil {
 			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
 			return
@@ -56,6 +72,28 @@ func (c *CheckoutController) CreateBasket() http.HandlerFunc {
 	}
 }
 
+// GetBasket handles requests to read the content of a basket: its lines with the
+// quantity of every product, and when it was created and last modified.
+// Http method: GET
+// Path parameter: basket id
+// Return: the basket resource if successful or a http error code otherwise.
+func (c *CheckoutController) GetBasket() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		basketId := pathParameters["id"]
+
+		basket, err := c.checkoutService.GetBasket(requests.CustomerId(r), basketId)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+
+		responses.Response(w, logger, http.StatusOK, responses.NewBasketContentResponse(basket))
+	}
+}
+
 // PostPayment handles requests to add a payment into the system. The new payment
 // will be linked to the organisation making the request.
 // Http method: POST
@@ -78,7 +116,54 @@ func (c *CheckoutController) AddItem() http.HandlerFunc {
 			responses.ResponseError(w, logger, http.StatusUnprocessableEntity, "Empty product code")
 		}
 
-		err = c.checkoutService.AddProduct(basketId, request.Code)
+		err = c.checkoutService.AddProduct(requests.CustomerId(r), basketId, request.Code)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+
+		responses.Response(w, logger, http.StatusCreated, nil)
+	}
+}
+
+// AddItems handles requests to add several units of different products to a basket
+// in a single call. If any of the products does not exist none of them is added.
+// Http method: POST
+// Path parameter: basket id
+// Return: created if successful or a http error code otherwise.
+func (c *CheckoutController) AddItems() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		basketId := pathParameters["id"]
+
+		request, err := requests.NewAddItemsRequest(r.Body)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+
+		if len(request) == 0 {
+			responses.ResponseError(w, logger, http.StatusUnprocessableEntity, "Empty items list")
+			return
+		}
+
+		amounts := make(map[model.ProductCode]int, len(request))
+		for _, item := range request {
+			if item.Code == "" {
+				responses.ResponseError(w, logger, http.StatusUnprocessableEntity, "Empty product code")
+				return
+			}
+			if item.Quantity <= 0 {
+				responses.ResponseError(w, logger, http.StatusUnprocessableEntity, "Invalid product quantity")
+				return
+			}
+
+			amounts[item.Code] += item.Quantity
+		}
+
+		err = c.checkoutService.AddProducts(requests.CustomerId(r), basketId, amounts)
 		if err != nil {
 			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
 			return
@@ -88,6 +173,119 @@ func (c *CheckoutController) AddItem() http.HandlerFunc {
 	}
 }
 
+// SetItemQuantity handles requests to set the number of units of a product in a basket.
+// A quantity of zero removes the product line from the basket.
+// Http method: PUT
+// Path parameters: basket id, product code
+// Return: no content if successful or a http error code otherwise.
+func (c *CheckoutController) SetItemQuantity() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		basketId := pathParameters["id"]
+		productCode := pathParameters["code"]
+
+		request, err := requests.NewSetItemQuantityRequest(r.Body)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+
+		if request.Quantity == nil {
+			responses.ResponseError(w, logger, http.StatusUnprocessableEntity, "Empty product quantity")
+			return
+		}
+
+		err = c.checkoutService.SetProductAmount(requests.CustomerId(r), basketId, model.ProductCode(productCode), *request.Quantity)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+
+		responses.Response(w, logger, http.StatusNoContent, nil)
+	}
+}
+
+// RemoveItem handles requests to remove a product line from a basket, whatever
+// the number of units it had.
+// Http method: DELETE
+// Path parameters: basket id, product code
+// Return: no content if successful or a http error code otherwise.
+func (c *CheckoutController) RemoveItem() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		basketId := pathParameters["id"]
+		productCode := pathParameters["code"]
+
+		err := c.checkoutService.RemoveProduct(requests.CustomerId(r), basketId, model.ProductCode(productCode))
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+
+		responses.Response(w, logger, http.StatusNoContent, nil)
+	}
+}
+
+// ApplyCoupon handles requests to apply a coupon code to a basket, so the promotions
+// gated by the code apply to it. Every coupon can be applied to a limited number of
+// baskets and until it expires.
+// Http method: POST
+// Path parameter: basket id
+// Return: created if successful or a http error code otherwise.
+func (c *CheckoutController) ApplyCoupon() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		basketId := pathParameters["id"]
+
+		request, err := requests.NewApplyCouponRequest(r.Body)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+
+		if request.Code == "" {
+			responses.ResponseError(w, logger, http.StatusUnprocessableEntity, "Empty coupon code")
+			return
+		}
+
+		err = c.checkoutService.ApplyCoupon(requests.CustomerId(r), basketId, request.Code)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+
+		responses.Response(w, logger, http.StatusCreated, nil)
+	}
+}
+
+// RemoveCoupon handles requests to remove a coupon code from a basket.
+// Http method: DELETE
+// Path parameters: basket id, coupon code
+// Return: no content if successful or a http error code otherwise.
+func (c *CheckoutController) RemoveCoupon() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		basketId := pathParameters["id"]
+		couponCode := pathParameters["code"]
+
+		err := c.checkoutService.RemoveCoupon(requests.CustomerId(r), basketId, couponCode)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+
+		responses.Response(w, logger, http.StatusNoContent, nil)
+	}
+}
+
 // PostPayment handles requests to add a payment into the system. The new payment
 // will be linked to the organisation making the request.
 // Http method: POST
@@ -100,12 +298,59 @@ func (c *CheckoutController) GetPrice() http.HandlerFunc {
 		pathParameters := mux.Vars(r)
 		basketId := pathParameters["id"]
 
-		total, err := c.checkoutService.GetBasketPrice(basketId)
+		receipt, err := c.checkoutService.GetBasketPrice(requests.CustomerId(r), basketId)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+		responses.Response(w, logger, http.StatusOK, responses.NewPriceBasketResponse(receipt))
+	}
+}
+
+// GetReceipt handles requests for the itemized price of a basket: every line with
+// the promotions applied to it and the discount they got, plus the basket total.
+// Http method: GET
+// Path parameter: basket id
+// Return: the basket receipt if successful or a http error code otherwise.
+func (c *CheckoutController) GetReceipt() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		basketId := pathParameters["id"]
+
+		receipt, err := c.checkoutService.GetBasketPrice(requests.CustomerId(r), basketId)
 		if err != nil {
 			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
 			return
 		}
-		responses.Response(w, logger, http.StatusOK, responses.PriceBasketResponse{Total: total})
+		responses.Response(w, logger, http.StatusOK, responses.NewReceiptResponse(receipt))
+	}
+}
+
+// Checkout handles requests to turn a basket into an order. The basket can not be
+// modified anymore, and the order keeps the prices and promotions it has now.
+// Http method: POST
+// Path parameter: basket id
+// Return: the id of the new order if successful or a http error code otherwise.
+// Empty baskets and failed payments are described in the response payload. After a
+// failed payment the basket can be checked out again. No order is left behind when
+// the payment is not authorized, but when it can not be captured the order is kept
+// as cancelled.
+func (c *CheckoutController) Checkout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		basketId := pathParameters["id"]
+
+		orderId, err := c.checkoutService.Checkout(requests.CustomerId(r), basketId)
+		if err != nil {
+			responses.ResponseErrorDetails(w, logger, responses.GetStatusByError(err), err)
+			return
+		}
+
+		responses.Response(w, logger, http.StatusCreated, responses.CheckoutResponse{Id: orderId})
 	}
 }
 
@@ -121,7 +366,11 @@ func (c *CheckoutController) DeleteBasket() http.HandlerFunc {
 		pathParameters := mux.Vars(r)
 		basketId := pathParameters["id"]
 
-		c.checkoutService.DeleteBasket(basketId)
+		err := c.checkoutService.DeleteBasket(requests.CustomerId(r), basketId)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
 
 		responses.Response(w, logger, http.StatusNoContent, nil)
 	}
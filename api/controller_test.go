@@ -10,6 +10,7 @@ import (
 	"github.com/alfcope/checkouttest/errors"
 	"github.com/alfcope/checkouttest/internal/tests/mocks"
 	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/payment"
 	"github.com/alfcope/checkouttest/pkg/logging"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -96,6 +97,164 @@ func (suite *CheckoutControllerTestSuite) TestCreateBasket() {
 	suite.NotEqual("", nbr.Id)
 }
 
+func (suite *CheckoutControllerTestSuite) TestCreateCustomerBasket() {
+	// Given
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddBasket", mock.MatchedBy(func(b *model.Basket) bool {
+		return b.Owner() == "C1"
+	})).Return(nil)
+
+	// When
+	req, err := http.NewRequest("POST", "/baskets/", nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req.Header.Set(requests.CustomerHeader, "C1")
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.CreateBasket())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusCreated, rr.Code)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertExpectations(suite.T())
+}
+
+func (suite *CheckoutControllerTestSuite) TestCreateBasketInUnsupportedCurrency() {
+	// When
+	reqBodyBytes := new(bytes.Buffer)
+	err := json.NewEncoder(reqBodyBytes).Encode(requests.CreateBasketRequest{Currency: "CHF"})
+	if err != nil {
+		suite.T().Errorf("Error encoding request: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", "/baskets/", bytes.NewBuffer(reqBodyBytes.Bytes()))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.CreateBasket())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusUnprocessableEntity, rr.Code)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "AddBasket", mock.Anything)
+}
+
+func (suite *CheckoutControllerTestSuite) TestGetNonExistingBasket() {
+	// Given
+	basketId := uuid.New().String()
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(new(model.Basket), errors.NewBasketNotFound(basketId))
+
+	// When
+	req, err := http.NewRequest("GET", fmt.Sprintf("/baskets/%s", basketId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.GetBasket())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusNotFound, rr.Code)
+}
+
+func (suite *CheckoutControllerTestSuite) TestGetExpiredBasket() {
+	// Given
+	basketId := uuid.New().String()
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(new(model.Basket), errors.NewBasketExpired(basketId))
+
+	// When
+	req, err := http.NewRequest("GET", fmt.Sprintf("/baskets/%s", basketId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.GetBasket())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusGone, rr.Code)
+}
+
+func (suite *CheckoutControllerTestSuite) TestGetBasketOfAnotherCustomer() {
+	// Given
+	basket := model.NewCustomerBasket(uuid.New().String(), "C1", model.DefaultCurrency)
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basket.Id).Return(basket, nil)
+
+	// When
+	req, err := http.NewRequest("GET", fmt.Sprintf("/baskets/%s", basket.Id), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req.Header.Set(requests.CustomerHeader, "C2")
+	req = mux.SetURLVars(req, map[string]string{"id": basket.Id})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.GetBasket())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusForbidden, rr.Code)
+}
+
+func (suite *CheckoutControllerTestSuite) TestGetBasket() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+	_ = basket.AddProduct(model.Product{Code: "P2", Name: "Prod 2", Price: model.NewMoney(1050, "EUR")})
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(500, "EUR")})
+	_ = basket.AddProduct(model.Product{Code: "P2", Name: "Prod 2", Price: model.NewMoney(1050, "EUR")})
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+
+	// When
+	req, err := http.NewRequest("GET", fmt.Sprintf("/baskets/%s", basket.Id), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.GetBasket())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+
+	var br = new(responses.BasketContentResponse)
+	err = json.Unmarshal(rr.Body.Bytes(), &br)
+
+	if err != nil {
+		suite.T().Errorf("Error unmarshalling basket response: %v", err)
+	}
+
+	suite.Equal(basket.Id, br.Id)
+	suite.Equal([]responses.BasketLineResponse{{Code: "P1", Name: "Prod 1", UnitPrice: "5.00", Currency: "EUR", Quantity: 1},
+		{Code: "P2", Name: "Prod 2", UnitPrice: "10.50", Currency: "EUR", Quantity: 2}}, br.Lines)
+	suite.True(basket.CreatedAt().Equal(br.CreatedAt))
+	suite.True(basket.UpdatedAt().Equal(br.UpdatedAt))
+}
+
 func (suite *CheckoutControllerTestSuite) TestAddNonExistingProduct() {
 	// Given
 	productCode := "FAKE"
@@ -194,7 +353,7 @@ func (suite *CheckoutControllerTestSuite) TestAddProduct() {
 	// Given
 	basketId := uuid.New().String()
 	var productCode model.ProductCode = "P1"
-	product := model.Product{Code: productCode, Name: "Prod 1", Price: 1000}
+	product := model.Product{Code: productCode, Name: "Prod 1", Price: model.NewMoney(1000, "EUR")}
 
 	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct",
 		mock.AnythingOfType("model.ProductCode")).Return(product, nil)
@@ -223,104 +382,754 @@ func (suite *CheckoutControllerTestSuite) TestAddProduct() {
 	suite.Equal(http.StatusCreated, rr.Code)
 }
 
-func (suite *CheckoutControllerTestSuite) TestGetPriceNonExistingBasket() {
+func (suite *CheckoutControllerTestSuite) TestAddItemsWrongPayload() {
 	// Given
 	basketId := uuid.New().String()
 
+	payloads := []string{`[]`, `[{"code": "P1", "quantity": 0}]`, `[{"code": "", "quantity": 2}]`,
+		`[{"code": "P1", "quantity": 2}, {"code": "P2", "quantity": -1}]`}
+
+	for _, payload := range payloads {
+		// When
+		req, err := http.NewRequest("POST", fmt.Sprintf("/baskets/%v/items/batch", basketId), bytes.NewBufferString(payload))
+		if err != nil {
+			suite.T().Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": basketId})
+
+		rr := httptest.NewRecorder()
+
+		handler := logging.AccessLoggingMiddleware(suite.checkoutController.AddItems())
+
+		handler.ServeHTTP(rr, req)
+
+		// Then
+		suite.Equal(http.StatusUnprocessableEntity, rr.Code, payload)
+	}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "GetProduct", mock.AnythingOfType("model.ProductCode"))
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "GetBasket", mock.AnythingOfType("string"))
+}
+
+func (suite *CheckoutControllerTestSuite) TestAddItemsNonExistingProduct() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct",
+		model.ProductCode("P1")).Return(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")}, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct",
+		model.ProductCode("FAKE")).Return(*new(model.Product), errors.NewProductNotFound("FAKE"))
 	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
-		mock.AnythingOfType("string")).Return(new(model.Basket), errors.NewBasketNotFound(basketId))
+		mock.AnythingOfType("string")).Return(basket, nil)
 
 	// When
-	req, err := http.NewRequest("GET", fmt.Sprintf("/baskets/%s?price", basketId), nil)
+	req, err := http.NewRequest("POST", fmt.Sprintf("/baskets/%v/items/batch", basket.Id),
+		bytes.NewBufferString(`[{"code": "P1", "quantity": 2}, {"code": "FAKE", "quantity": 1}]`))
 	if err != nil {
 		suite.T().Fatal(err)
 	}
+	req = mux.SetURLVars(req, map[string]string{"id": basket.Id})
 
 	rr := httptest.NewRecorder()
 
-	handler := logging.AccessLoggingMiddleware(suite.checkoutController.GetPrice())
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.AddItems())
 
 	handler.ServeHTTP(rr, req)
 
 	// Then
 	suite.Equal(http.StatusNotFound, rr.Code)
+	suite.Equal(0, len(basket.CalculatePrice(nil).Lines))
 }
 
-func (suite *CheckoutControllerTestSuite) TestGetPriceEmptyBasket() {
+func (suite *CheckoutControllerTestSuite) TestAddItems() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct",
+		model.ProductCode("P1")).Return(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")}, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+
+	// When
+	req, err := http.NewRequest("POST", fmt.Sprintf("/baskets/%v/items/batch", basket.Id),
+		bytes.NewBufferString(`[{"code": "P1", "quantity": 2}, {"code": "P1", "quantity": 8}]`))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": basket.Id})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.AddItems())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusCreated, rr.Code)
+	suite.Equal(model.NewMoney(10*1000, "EUR"), basket.CalculatePrice(nil).Total)
+}
+
+func (suite *CheckoutControllerTestSuite) TestSetItemQuantityWrongPayload() {
 	// Given
 	basketId := uuid.New().String()
-	promotions := []model.Promotion{model.NewBulkPromotion(map[model.ProductCode][]model.BulkOfferRule{"P1": {{Buy: 3, Price: 900}}}),
-		model.NewFreeItemsPromotion(map[model.ProductCode][]model.FreeItemsOfferRule{"P2": {{Buy: 3, Free: 1}}})}
 
+	// When
+	req, err := http.NewRequest("PUT", fmt.Sprintf("/baskets/%v/items/P1", basketId), bytes.NewBufferString("{}"))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": basketId, "code": "P1"})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.SetItemQuantity())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusUnprocessableEntity, rr.Code)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "GetBasket", mock.AnythingOfType("string"))
+}
+
+func (suite *CheckoutControllerTestSuite) TestSetItemNegativeQuantity() {
+	// Given
+	basketId := uuid.New().String()
+	product := model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct",
+		mock.AnythingOfType("model.ProductCode")).Return(product, nil)
 	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
 		mock.AnythingOfType("string")).Return(model.NewBasket(basketId), nil)
-	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return(promotions)
 
 	// When
-	req, err := http.NewRequest("GET", fmt.Sprintf("/baskets/%s?price", basketId), nil)
+	req, err := http.NewRequest("PUT", fmt.Sprintf("/baskets/%v/items/P1", basketId), bytes.NewBufferString(`{"quantity": -2}`))
 	if err != nil {
 		suite.T().Fatal(err)
 	}
+	req = mux.SetURLVars(req, map[string]string{"id": basketId, "code": "P1"})
 
 	rr := httptest.NewRecorder()
 
-	handler := logging.AccessLoggingMiddleware(suite.checkoutController.GetPrice())
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.SetItemQuantity())
 
 	handler.ServeHTTP(rr, req)
 
 	// Then
-	suite.Equal(http.StatusOK, rr.Code)
+	suite.Equal(http.StatusUnprocessableEntity, rr.Code)
+}
 
-	var pbr = new(responses.PriceBasketResponse)
-	err = json.Unmarshal(rr.Body.Bytes(), &pbr)
+func (suite *CheckoutControllerTestSuite) TestSetItemQuantity() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+	product := model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")}
 
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct",
+		mock.AnythingOfType("model.ProductCode")).Return(product, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+
+	// When
+	req, err := http.NewRequest("PUT", fmt.Sprintf("/baskets/%v/items/P1", basket.Id), bytes.NewBufferString(`{"quantity": 4}`))
 	if err != nil {
-		suite.T().Errorf("Error unmarshalling basket price response: %v", err)
+		suite.T().Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": basket.Id, "code": "P1"})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.SetItemQuantity())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusNoContent, rr.Code)
+	suite.Equal(model.NewMoney(4000, "EUR"), basket.CalculatePrice(nil).Total)
+}
+
+func (suite *CheckoutControllerTestSuite) TestRemoveItemNotInBasket() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+
+	// When
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("/baskets/%v/items/P1", basket.Id), nil)
+	if err != nil {
+		suite.T().Fatal(err)
 	}
+	req = mux.SetURLVars(req, map[string]string{"id": basket.Id, "code": "P1"})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.RemoveItem())
 
-	suite.Equal(float64(0), pbr.Total)
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusNotFound, rr.Code)
 }
 
-func (suite *CheckoutControllerTestSuite) TestDeleteNonExistingBasket() {
+func (suite *CheckoutControllerTestSuite) TestRemoveItem() {
 	// Given
-	basketId := uuid.New().String()
+	basket := model.NewBasket(uuid.New().String())
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")})
 
-	suite.datasourceMock.(*mocks.DatasourceMock).On("DeleteBasket", mock.AnythingOfType("string"))
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
 
 	// When
-	req, err := http.NewRequest("DELETE", fmt.Sprintf("/baskets/%s/", basketId), nil)
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("/baskets/%v/items/P1", basket.Id), nil)
 	if err != nil {
 		suite.T().Fatal(err)
 	}
+	req = mux.SetURLVars(req, map[string]string{"id": basket.Id, "code": "P1"})
 
 	rr := httptest.NewRecorder()
 
-	handler := logging.AccessLoggingMiddleware(suite.checkoutController.DeleteBasket())
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.RemoveItem())
 
 	handler.ServeHTTP(rr, req)
 
 	// Then
 	suite.Equal(http.StatusNoContent, rr.Code)
+	suite.Equal(0, len(basket.CalculatePrice(nil).Lines))
 }
 
-func (suite *CheckoutControllerTestSuite) TestDeleteBasket() {
+func (suite *CheckoutControllerTestSuite) TestApplyEmptyCoupon() {
 	// Given
 	basketId := uuid.New().String()
 
-	suite.datasourceMock.(*mocks.DatasourceMock).On("DeleteBasket", mock.AnythingOfType("string"))
+	// When
+	reqBodyBytes := new(bytes.Buffer)
+	err := json.NewEncoder(reqBodyBytes).Encode(requests.ApplyCouponRequest{})
+	if err != nil {
+		suite.T().Errorf("Error encoding request: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("/baskets/%v/coupons/", basketId), bytes.NewBuffer(reqBodyBytes.Bytes()))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": basketId})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.ApplyCoupon())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusUnprocessableEntity, rr.Code)
+}
+
+func (suite *CheckoutControllerTestSuite) TestApplyNonExistingCoupon() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("UseCoupon", "WINTER",
+		mock.AnythingOfType("time.Time")).Return(errors.NewCouponNotFound("WINTER"))
 
 	// When
-	req, err := http.NewRequest("DELETE", fmt.Sprintf("/baskets/%s", basketId), nil)
+	reqBodyBytes := new(bytes.Buffer)
+	err := json.NewEncoder(reqBodyBytes).Encode(requests.ApplyCouponRequest{Code: "WINTER"})
+	if err != nil {
+		suite.T().Errorf("Error encoding request: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("/baskets/%v/coupons/", basket.Id), bytes.NewBuffer(reqBodyBytes.Bytes()))
 	if err != nil {
 		suite.T().Fatal(err)
 	}
+	req = mux.SetURLVars(req, map[string]string{"id": basket.Id})
 
 	rr := httptest.NewRecorder()
 
-	handler := logging.AccessLoggingMiddleware(suite.checkoutController.DeleteBasket())
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.ApplyCoupon())
 
 	handler.ServeHTTP(rr, req)
 
 	// Then
-	suite.Equal(http.StatusNoContent, rr.Code)
+	suite.Equal(http.StatusNotFound, rr.Code)
+}
+
+func (suite *CheckoutControllerTestSuite) TestApplyCoupon() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("UseCoupon", "SUMMER",
+		mock.AnythingOfType("time.Time")).Return(nil)
+
+	// When
+	reqBodyBytes := new(bytes.Buffer)
+	err := json.NewEncoder(reqBodyBytes).Encode(requests.ApplyCouponRequest{Code: "SUMMER"})
+	if err != nil {
+		suite.T().Errorf("Error encoding request: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("/baskets/%v/coupons/", basket.Id), bytes.NewBuffer(reqBodyBytes.Bytes()))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": basket.Id})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.ApplyCoupon())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusCreated, rr.Code)
+	suite.Equal([]string{"SUMMER"}, basket.Coupons())
+}
+
+func (suite *CheckoutControllerTestSuite) TestRemoveCoupon() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+	_ = basket.AddCoupon("SUMMER")
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("ReleaseCoupon", "SUMMER")
+
+	// When
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("/baskets/%v/coupons/SUMMER", basket.Id), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": basket.Id, "code": "SUMMER"})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.RemoveCoupon())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusNoContent, rr.Code)
+	suite.Equal(0, len(basket.Coupons()))
+}
+
+func (suite *CheckoutControllerTestSuite) TestGetPriceNonExistingBasket() {
+	// Given
+	basketId := uuid.New().String()
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(new(model.Basket), errors.NewBasketNotFound(basketId))
+
+	// When
+	req, err := http.NewRequest("GET", fmt.Sprintf("/baskets/%s?price", basketId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.GetPrice())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusNotFound, rr.Code)
+}
+
+func (suite *CheckoutControllerTestSuite) TestGetPriceEmptyBasket() {
+	// Given
+	basketId := uuid.New().String()
+	promotions := []model.Promotion{model.NewBulkPromotion(map[model.ProductCode][]model.BulkOfferRule{"P1": {{Buy: 3, Price: 900}}}),
+		model.NewFreeItemsPromotion(map[model.ProductCode][]model.FreeItemsOfferRule{"P2": {{Buy: 3, Free: 1}}})}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(model.NewBasket(basketId), nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return(promotions)
+
+	// When
+	req, err := http.NewRequest("GET", fmt.Sprintf("/baskets/%s?price", basketId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.GetPrice())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+
+	var pbr = new(responses.PriceBasketResponse)
+	err = json.Unmarshal(rr.Body.Bytes(), &pbr)
+
+	if err != nil {
+		suite.T().Errorf("Error unmarshalling basket price response: %v", err)
+	}
+
+	suite.Equal("0.00", pbr.Total)
+}
+
+func (suite *CheckoutControllerTestSuite) TestGetReceiptNonExistingBasket() {
+	// Given
+	basketId := uuid.New().String()
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(new(model.Basket), errors.NewBasketNotFound(basketId))
+
+	// When
+	req, err := http.NewRequest("GET", fmt.Sprintf("/baskets/%s/receipt", basketId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.GetReceipt())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusNotFound, rr.Code)
+}
+
+func (suite *CheckoutControllerTestSuite) TestGetReceipt() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	for i := 0; i < 3; i++ {
+		_ = basket.AddProduct(model.Product{Code: "P2", Name: "Prod 2", Price: model.NewMoney(1000, "EUR")})
+	}
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(550, "EUR")})
+	promotions := []model.Promotion{model.NewBulkPromotion(map[model.ProductCode][]model.BulkOfferRule{"P1": {{Buy: 3, Price: 900}}}),
+		model.NewFreeItemsPromotion(map[model.ProductCode][]model.FreeItemsOfferRule{"P2": {{Buy: 3, Free: 1}}})}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return(promotions)
+
+	// When
+	req, err := http.NewRequest("GET", fmt.Sprintf("/baskets/%s/receipt", basketId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.GetReceipt())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+
+	var rbr = new(responses.ReceiptResponse)
+	err = json.Unmarshal(rr.Body.Bytes(), &rbr)
+
+	if err != nil {
+		suite.T().Errorf("Error unmarshalling basket receipt response: %v", err)
+	}
+
+	suite.Equal("25.50", rbr.Total)
+	suite.Equal(2, len(rbr.Lines))
+	suite.Equal(model.ProductCode("P1"), rbr.Lines[0].Code)
+	suite.Equal(0, len(rbr.Lines[0].Promotions))
+	suite.Equal(model.ProductCode("P2"), rbr.Lines[1].Code)
+	suite.Equal("30.00", rbr.Lines[1].Subtotal)
+	suite.Equal([]responses.AppliedPromotionResponse{{Type: "FREE_ITEMS", Units: 3, Discount: "10.00"}}, rbr.Lines[1].Promotions)
+	suite.Equal("20.00", rbr.Lines[1].Total)
+}
+
+func (suite *CheckoutControllerTestSuite) TestGetPriceWithBasketDiscount() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	for i := 0; i < 3; i++ {
+		_ = basket.AddProduct(model.Product{Code: "P2", Name: "Prod 2", Price: model.NewMoney(1000, "EUR")})
+	}
+	promotions := []model.Promotion{model.NewThresholdPromotion([]model.ThresholdRule{{Above: 2000, Amount: 500}})}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return(promotions)
+
+	// When
+	req, err := http.NewRequest("GET", fmt.Sprintf("/baskets/%s?price", basketId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.GetPrice())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+
+	var pbr = new(responses.PriceBasketResponse)
+	err = json.Unmarshal(rr.Body.Bytes(), &pbr)
+
+	if err != nil {
+		suite.T().Errorf("Error unmarshalling basket price response: %v", err)
+	}
+
+	suite.Equal("25.00", pbr.Total)
+	suite.Equal("5.00", pbr.Discount)
+	suite.Equal(model.Currency("EUR"), pbr.Currency)
+}
+
+func (suite *CheckoutControllerTestSuite) TestGetReceiptWithBasketDiscount() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	for i := 0; i < 3; i++ {
+		_ = basket.AddProduct(model.Product{Code: "P2", Name: "Prod 2", Price: model.NewMoney(1000, "EUR")})
+	}
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(550, "EUR")})
+	threshold := model.NewThresholdPromotion([]model.ThresholdRule{{Above: 2000, Amount: 500}})
+	threshold.Id = "over-20"
+	promotions := []model.Promotion{
+		model.NewFreeItemsPromotion(map[model.ProductCode][]model.FreeItemsOfferRule{"P2": {{Buy: 3, Free: 1}}}),
+		threshold}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return(promotions)
+
+	// When
+	req, err := http.NewRequest("GET", fmt.Sprintf("/baskets/%s/receipt", basketId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.GetReceipt())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+
+	var rbr = new(responses.ReceiptResponse)
+	err = json.Unmarshal(rr.Body.Bytes(), &rbr)
+
+	if err != nil {
+		suite.T().Errorf("Error unmarshalling basket receipt response: %v", err)
+	}
+
+	suite.Equal("25.50", rbr.Subtotal)
+	suite.Equal([]responses.AppliedDiscountResponse{{Id: "over-20", Type: "THRESHOLD", Discount: "5.00"}}, rbr.Discounts)
+	suite.Equal("20.50", rbr.Total)
+	suite.Equal("20.50", rbr.Net)
+	suite.Equal("0.00", rbr.Tax)
+	suite.Equal(model.DefaultTaxCategory, rbr.Lines[0].TaxCategory)
+}
+
+func (suite *CheckoutControllerTestSuite) TestCheckout() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(550, "EUR")})
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return([]model.Promotion{})
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddOrder", mock.AnythingOfType("model.Order")).Return(nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetOrder",
+		mock.AnythingOfType("string")).Return(model.Order{State: model.OrderPending}, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("UpdateOrder", mock.AnythingOfType("model.Order")).Return(nil)
+
+	// When
+	req, err := http.NewRequest("POST", fmt.Sprintf("/baskets/%s/checkout", basketId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.Checkout())
+
+	handler.ServeHTTP(rr, mux.SetURLVars(req, map[string]string{"id": basketId}))
+
+	// Then
+	suite.Equal(http.StatusCreated, rr.Code)
+
+	var cr = new(responses.CheckoutResponse)
+	err = json.Unmarshal(rr.Body.Bytes(), &cr)
+
+	if err != nil {
+		suite.T().Errorf("Error unmarshalling checkout response: %v", err)
+	}
+
+	suite.Equal(basket.OrderId(), cr.Id)
+}
+
+func (suite *CheckoutControllerTestSuite) TestCheckoutCheckedOutBasket() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(550, "EUR")})
+	_ = basket.CheckOut("O1")
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return([]model.Promotion{})
+
+	// When
+	req, err := http.NewRequest("POST", fmt.Sprintf("/baskets/%s/checkout", basketId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.Checkout())
+
+	handler.ServeHTTP(rr, mux.SetURLVars(req, map[string]string{"id": basketId}))
+
+	// Then
+	suite.Equal(http.StatusConflict, rr.Code)
+}
+
+func (suite *CheckoutControllerTestSuite) TestCheckoutPaymentDeclined() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(550, "EUR")})
+
+	apiRoute := mux.NewRouter().PathPrefix("/api/v1").Subrouter().StrictSlash(true)
+	controller := NewCheckoutController(apiRoute, NewCheckoutService(suite.datasourceMock,
+		WithPaymentProvider(payment.NewFakeProvider(payment.Decline))))
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return([]model.Promotion{})
+
+	// When
+	req, err := http.NewRequest("POST", fmt.Sprintf("/baskets/%s/checkout", basketId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(controller.Checkout())
+
+	handler.ServeHTTP(rr, mux.SetURLVars(req, map[string]string{"id": basketId}))
+
+	// Then
+	suite.Equal(http.StatusPaymentRequired, rr.Code)
+	suite.Equal("", basket.OrderId())
+}
+
+func (suite *CheckoutControllerTestSuite) TestAddItemToCheckedOutBasket() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	_ = basket.CheckOut("O1")
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct",
+		model.ProductCode("P1")).Return(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(550, "EUR")}, nil)
+
+	// When
+	body := new(bytes.Buffer)
+	_ = json.NewEncoder(body).Encode(requests.AddItemRequest{Code: "P1"})
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("/baskets/%s/items/", basketId), body)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.AddItem())
+
+	handler.ServeHTTP(rr, mux.SetURLVars(req, map[string]string{"id": basketId}))
+
+	// Then
+	suite.Equal(http.StatusConflict, rr.Code)
+	suite.Equal(0, len(basket.Lines()))
+}
+
+func (suite *CheckoutControllerTestSuite) TestDeleteNonExistingBasket() {
+	// Given
+	basketId := uuid.New().String()
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basketId).Return(new(model.Basket), errors.NewBasketNotFound(basketId))
+
+	// When
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("/baskets/%s/", basketId), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": basketId})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.DeleteBasket())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusNoContent, rr.Code)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "DeleteBasket", basketId)
+}
+
+func (suite *CheckoutControllerTestSuite) TestDeleteBasket() {
+	// Given
+	basket := model.NewCustomerBasket(uuid.New().String(), "C1", model.DefaultCurrency)
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basket.Id).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("DeleteBasket", basket.Id).Return(basket)
+
+	// When
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("/baskets/%s", basket.Id), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req.Header.Set(requests.CustomerHeader, "C1")
+	req = mux.SetURLVars(req, map[string]string{"id": basket.Id})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.DeleteBasket())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusNoContent, rr.Code)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertCalled(suite.T(), "DeleteBasket", basket.Id)
+}
+
+func (suite *CheckoutControllerTestSuite) TestDeleteBasketOfAnotherCustomer() {
+	// Given
+	basket := model.NewCustomerBasket(uuid.New().String(), "C1", model.DefaultCurrency)
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basket.Id).Return(basket, nil)
+
+	// When
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("/baskets/%s", basket.Id), nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req.Header.Set(requests.CustomerHeader, "C2")
+	req = mux.SetURLVars(req, map[string]string{"id": basket.Id})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.checkoutController.DeleteBasket())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusForbidden, rr.Code)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "DeleteBasket", basket.Id)
 }
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"github.com/alfcope/checkouttest/api/requests"
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/pkg/auth"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+type CustomerController struct {
+	checkoutService CheckoutService
+}
+
+func NewCustomerController(router *mux.Router, service CheckoutService) *CustomerController {
+	controller := &CustomerController{
+		checkoutService: service,
+	}
+
+	controller.initializeRoutes(router)
+
+	return controller
+}
+
+func (c *CustomerController) initializeRoutes(router *mux.Router) {
+
+	customersRouter := router.PathPrefix("/customers").Subrouter()
+	customersRouter.Use(logging.AccessLoggingMiddleware)
+
+	customersRouter.Handle("/{id}/baskets", auth.Require(auth.Shopper, c.GetBaskets())).Methods("GET").Headers("Accept", "application/json")
+}
+
+// GetBaskets handles requests to list the baskets of a customer, the most recent
+// first. Customers can only list their own baskets.
+// Http method: GET
+// Path parameter: customer id
+// Return: the list of baskets if successful or a http error code otherwise.
+func (c *CustomerController) GetBaskets() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		customerId := pathParameters["id"]
+
+		if customerId != requests.CustomerId(r) {
+			responses.ResponseError(w, logger, http.StatusForbidden, "Baskets of another customer")
+			return
+		}
+
+		baskets := c.checkoutService.GetCustomerBaskets(customerId)
+
+		responses.Response(w, logger, http.StatusOK, responses.NewBasketContentsResponse(baskets))
+	}
+}
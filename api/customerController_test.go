@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/alfcope/checkouttest/api/requests"
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/datasource"
+	"github.com/alfcope/checkouttest/internal/tests/mocks"
+	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type CustomerControllerTestSuite struct {
+	suite.Suite
+
+	customerController CustomerController
+	datasourceMock     datasource.Datasource
+}
+
+func TestCustomerControllerSuite(t *testing.T) {
+	suite.Run(t, new(CustomerControllerTestSuite))
+}
+
+func (suite *CustomerControllerTestSuite) SetupSuite() {
+	apiRoute := mux.NewRouter().PathPrefix("/api/v1").Subrouter().StrictSlash(true)
+
+	suite.datasourceMock = datasource.Datasource(mocks.NewDatasourceMock())
+	suite.customerController = *NewCustomerController(apiRoute, NewCheckoutService(suite.datasourceMock))
+}
+
+func (suite *CustomerControllerTestSuite) TearDownTest() {
+	suite.datasourceMock.(*mocks.DatasourceMock).ExpectedCalls = nil
+	suite.datasourceMock.(*mocks.DatasourceMock).Calls = nil
+}
+
+func (suite *CustomerControllerTestSuite) TestGetBasketsOfAnotherCustomer() {
+	// When
+	req, err := http.NewRequest("GET", "/customers/C1/baskets", nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req.Header.Set(requests.CustomerHeader, "C2")
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.customerController.GetBaskets())
+
+	handler.ServeHTTP(rr, mux.SetURLVars(req, map[string]string{"id": "C1"}))
+
+	// Then
+	suite.Equal(http.StatusForbidden, rr.Code)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "GetBasketsByOwner", mock.AnythingOfType("string"))
+}
+
+func (suite *CustomerControllerTestSuite) TestGetBaskets() {
+	// Given
+	basket := model.NewCustomerBasket("B1", "C1", model.DefaultCurrency)
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(500, "EUR")})
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasketsByOwner", "C1").Return([]*model.Basket{basket})
+
+	// When
+	req, err := http.NewRequest("GET", "/customers/C1/baskets", nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req.Header.Set(requests.CustomerHeader, "C1")
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.customerController.GetBaskets())
+
+	handler.ServeHTTP(rr, mux.SetURLVars(req, map[string]string{"id": "C1"}))
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+
+	var response []responses.BasketContentResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	if err != nil {
+		suite.T().Errorf("Error unmarshalling baskets response: %v", err)
+	}
+	suite.Equal(1, len(response))
+	suite.Equal("B1", response[0].Id)
+	suite.Equal("C1", response[0].Owner)
+	suite.Equal(1, len(response[0].Lines))
+}
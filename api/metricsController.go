@@ -0,0 +1,13 @@
+package api
+
+import (
+	"expvar"
+	"github.com/alfcope/checkouttest/pkg/auth"
+	"github.com/gorilla/mux"
+)
+
+// AddMetricsRoute exposes the metrics published with expvar, such as the
+// baskets evicted, as a JSON document. Only admins can read them
+func AddMetricsRoute(router *mux.Router) {
+	router.Handle("/metrics", auth.Require(auth.Admin, expvar.Handler())).Methods("GET")
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"github.com/alfcope/checkouttest/api/requests"
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/pkg/auth"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+type OrderController struct {
+	checkoutService CheckoutService
+}
+
+func NewOrderController(router *mux.Router, service CheckoutService) *OrderController {
+	controller := &OrderController{
+		checkoutService: service,
+	}
+
+	controller.initializeRoutes(router)
+
+	return controller
+}
+
+func (c *OrderController) initializeRoutes(router *mux.Router) {
+
+	ordersRouter := router.PathPrefix("/orders").Subrouter()
+	ordersRouter.Use(logging.AccessLoggingMiddleware)
+
+	ordersRouter.Handle("/", auth.Require(auth.Admin, c.GetOrders())).Methods("GET").Headers("Accept", "application/json")
+	ordersRouter.Handle("/{id}", auth.Require(auth.Shopper, c.GetOrder())).Methods("GET").Headers("Accept", "application/json")
+	ordersRouter.Handle("/{id}/refund", auth.Require(auth.Admin, c.RefundOrder())).Methods("POST").Headers("Accept", "application/json")
+}
+
+// GetOrders handles requests to list the orders, the most recent first. Orders are
+// pending, paid, refunding, refunded, or cancelled when their payment could not be
+// captured.
+// Http method: GET
+// Query parameters: page, from 1, and size, 20 by default
+// Return: the page of orders along with the total number of orders, or a http error
+// code otherwise. Invalid parameters are described in the response payload.
+func (c *OrderController) GetOrders() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		request, err := requests.NewPageRequest(r.URL.Query())
+		if err != nil {
+			responses.ResponseErrorDetails(w, logger, http.StatusUnprocessableEntity, err)
+			return
+		}
+
+		orders, total := c.checkoutService.GetOrders(request.Page, request.Size)
+
+		responses.Response(w, logger, http.StatusOK, responses.NewOrdersPageResponse(orders, request.Page, request.Size, total))
+	}
+}
+
+// GetOrder handles requests to read an order with the receipt of its basket.
+// Customers can only read their own orders, admins any of them.
+// Http method: GET
+// Path parameter: order id
+// Return: the order resource if successful or a http error code otherwise.
+func (c *OrderController) GetOrder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		orderId := pathParameters["id"]
+
+		order, err := c.checkoutService.GetOrder(orderId)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+
+		if !requests.IsAdmin(r) && !order.CanAccess(requests.CustomerId(r)) {
+			responses.ResponseError(w, logger, http.StatusForbidden, "Order of another customer")
+			return
+		}
+
+		responses.Response(w, logger, http.StatusOK, responses.NewOrderResponse(order))
+	}
+}
+
+// RefundOrder handles requests to give back the payment of a paid order.
+// Http method: POST
+// Path parameter: order id
+// Return: the refunded order resource if successful or a http error code otherwise.
+// Failed refunds are described in the response payload.
+func (c *OrderController) RefundOrder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		orderId := pathParameters["id"]
+
+		err := c.checkoutService.Refund(orderId)
+		if err != nil {
+			responses.ResponseErrorDetails(w, logger, responses.GetStatusByError(err), err)
+			return
+		}
+
+		order, err := c.checkoutService.GetOrder(orderId)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+
+		responses.Response(w, logger, http.StatusOK, responses.NewOrderResponse(order))
+	}
+}
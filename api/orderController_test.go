@@ -0,0 +1,241 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/datasource"
+	"github.com/alfcope/checkouttest/errors"
+	"github.com/alfcope/checkouttest/internal/tests/mocks"
+	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/pkg/auth"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type OrderControllerTestSuite struct {
+	suite.Suite
+
+	orderController OrderController
+	datasourceMock  datasource.Datasource
+}
+
+func TestOrderControllerSuite(t *testing.T) {
+	suite.Run(t, new(OrderControllerTestSuite))
+}
+
+func (suite *OrderControllerTestSuite) SetupSuite() {
+	apiRoute := mux.NewRouter().PathPrefix("/api/v1").Subrouter().StrictSlash(true)
+
+	suite.datasourceMock = datasource.Datasource(mocks.NewDatasourceMock())
+	suite.orderController = *NewOrderController(apiRoute, NewCheckoutService(suite.datasourceMock))
+}
+
+func (suite *OrderControllerTestSuite) TearDownTest() {
+	suite.datasourceMock.(*mocks.DatasourceMock).ExpectedCalls = nil
+	suite.datasourceMock.(*mocks.DatasourceMock).Calls = nil
+}
+
+func (suite *OrderControllerTestSuite) TestGetNonExistingOrder() {
+	// Given
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetOrder", "O1").Return(model.Order{}, errors.NewOrderNotFound("O1"))
+
+	// When
+	req, err := http.NewRequest("GET", "/orders/O1", nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.orderController.GetOrder())
+
+	handler.ServeHTTP(rr, mux.SetURLVars(req, map[string]string{"id": "O1"}))
+
+	// Then
+	suite.Equal(http.StatusNotFound, rr.Code)
+}
+
+func (suite *OrderControllerTestSuite) TestGetOrder() {
+	// Given
+	receipt := model.Receipt{
+		Lines: []model.ReceiptLine{{
+			Product:  model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(550, "EUR")},
+			Quantity: 2,
+			Subtotal: model.NewMoney(1100, "EUR"),
+			Total:    model.NewMoney(1100, "EUR"),
+		}},
+		Subtotal: model.NewMoney(1100, "EUR"),
+		Total:    model.NewMoney(1100, "EUR"),
+	}
+	createdAt := time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC)
+	order := model.NewOrder("O1", "B1", "", nil, receipt, "A1", createdAt)
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetOrder", "O1").Return(order, nil)
+
+	// When
+	req, err := http.NewRequest("GET", "/orders/O1", nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.orderController.GetOrder())
+
+	handler.ServeHTTP(rr, mux.SetURLVars(req, map[string]string{"id": "O1"}))
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+
+	var or = new(responses.OrderResponse)
+	err = json.Unmarshal(rr.Body.Bytes(), &or)
+
+	if err != nil {
+		suite.T().Errorf("Error unmarshalling order response: %v", err)
+	}
+
+	suite.Equal("O1", or.Id)
+	suite.Equal("B1", or.BasketId)
+	suite.Equal(model.OrderPending, or.State)
+	suite.Equal([]string{}, or.Coupons)
+	suite.True(createdAt.Equal(or.CreatedAt))
+	suite.Equal("11.00", or.Receipt.Total)
+	suite.Equal(model.Currency("EUR"), or.Receipt.Currency)
+	suite.Equal(1, len(or.Receipt.Lines))
+}
+
+func (suite *OrderControllerTestSuite) TestGetOrderOfAnotherCustomer() {
+	// Given
+	order := model.NewOrder("O1", "B1", "C1", nil, model.Receipt{}, "A1", time.Now())
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetOrder", "O1").Return(order, nil)
+
+	cases := []struct {
+		name     string
+		identity auth.Identity
+		status   int
+	}{
+		{"owner", auth.Identity{Subject: "C1", Scopes: []auth.Scope{auth.Shopper}}, http.StatusOK},
+		{"another customer", auth.Identity{Subject: "C2", Scopes: []auth.Scope{auth.Shopper}}, http.StatusForbidden},
+		{"admin", auth.Identity{Subject: "ops", Scopes: []auth.Scope{auth.Admin}}, http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		// When
+		req, err := http.NewRequest("GET", "/orders/O1", nil)
+		if err != nil {
+			suite.T().Fatal(err)
+		}
+		req = auth.WithIdentity(mux.SetURLVars(req, map[string]string{"id": "O1"}), tc.identity)
+
+		rr := httptest.NewRecorder()
+
+		handler := logging.AccessLoggingMiddleware(suite.orderController.GetOrder())
+
+		handler.ServeHTTP(rr, req)
+
+		// Then
+		suite.Equal(tc.status, rr.Code, tc.name)
+	}
+}
+
+func (suite *OrderControllerTestSuite) TestGetOrders() {
+	// Given
+	orders := []model.Order{{Id: "O3"}, {Id: "O2"}}
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetOrders", 2, 2).Return(orders, 5)
+
+	// When
+	req, err := http.NewRequest("GET", "/orders/?page=2&size=2", nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.orderController.GetOrders())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+
+	var opr = new(responses.OrdersPageResponse)
+	err = json.Unmarshal(rr.Body.Bytes(), &opr)
+
+	if err != nil {
+		suite.T().Errorf("Error unmarshalling orders page response: %v", err)
+	}
+
+	suite.Equal(2, opr.Page)
+	suite.Equal(2, opr.Size)
+	suite.Equal(5, opr.Total)
+	suite.Equal(2, len(opr.Orders))
+	suite.Equal("O3", opr.Orders[0].Id)
+}
+
+func (suite *OrderControllerTestSuite) TestGetOrdersDefaultPage() {
+	// Given
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetOrders", 0, 20).Return([]model.Order{}, 0)
+
+	// When
+	req, err := http.NewRequest("GET", "/orders/", nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.orderController.GetOrders())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+	suite.JSONEq(`{"orders":[],"page":1,"size":20,"total":0}`, rr.Body.String())
+}
+
+func (suite *OrderControllerTestSuite) TestGetOrdersInvalidPage() {
+	// When
+	req, err := http.NewRequest("GET", "/orders/?page=0&size=500", nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.orderController.GetOrders())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusUnprocessableEntity, rr.Code)
+
+	var er = new(responses.ErrorResponse)
+	_ = json.Unmarshal(rr.Body.Bytes(), &er)
+	suite.Equal(2, len(er.Errors))
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "GetOrders", 0, 500)
+}
+
+func (suite *OrderControllerTestSuite) TestRefundPendingOrder() {
+	// Given
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetOrder", "O1").Return(model.Order{Id: "O1", State: model.OrderPending}, nil)
+
+	// When
+	req, err := http.NewRequest("POST", "/orders/O1/refund", nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.orderController.RefundOrder())
+
+	handler.ServeHTTP(rr, mux.SetURLVars(req, map[string]string{"id": "O1"}))
+
+	// Then
+	suite.Equal(http.StatusConflict, rr.Code)
+}
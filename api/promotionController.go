@@ -0,0 +1,154 @@
+package api
+
+import (
+	"github.com/alfcope/checkouttest/api/requests"
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/errors"
+	"github.com/alfcope/checkouttest/pkg/auth"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+type PromotionController struct {
+	promotionService PromotionService
+}
+
+func NewPromotionController(router *mux.Router, service PromotionService) *PromotionController {
+	controller := &PromotionController{
+		promotionService: service,
+	}
+
+	controller.initializeRoutes(router)
+
+	return controller
+}
+
+func (c *PromotionController) initializeRoutes(router *mux.Router) {
+
+	promotionsRouter := router.PathPrefix("/promotions").Subrouter()
+	promotionsRouter.Use(logging.AccessLoggingMiddleware)
+
+	promotionsRouter.Handle("/", auth.Require(auth.Shopper, c.GetPromotions())).Methods("GET").Headers("Accept", "application/json")
+	promotionsRouter.Handle("/{id}", auth.Require(auth.Shopper, c.GetPromotion())).Methods("GET").Headers("Accept", "application/json")
+	promotionsRouter.Handle("/", auth.Require(auth.Admin, c.AddPromotion())).Methods("POST").Headers("Content-Type", "application/json")
+	promotionsRouter.Handle("/{id}", auth.Require(auth.Admin, c.UpdatePromotion())).Methods("PUT").Headers("Content-Type", "application/json")
+	promotionsRouter.Handle("/{id}", auth.Require(auth.Admin, c.DeletePromotion())).Methods("DELETE")
+}
+
+// GetPromotions handles requests to list the active promotions.
+// Http method: GET
+// Return: the definitions of the promotions in the order they are applied.
+func (c *PromotionController) GetPromotions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		responses.Response(w, logger, http.StatusOK, c.promotionService.GetPromotions())
+	}
+}
+
+// GetPromotion handles requests to read the definition of a promotion.
+// Http method: GET
+// Path parameter: promotion id
+// Return: the promotion definition if successful or a http error code otherwise.
+func (c *PromotionController) GetPromotion() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		promotionId := pathParameters["id"]
+
+		definition, err := c.promotionService.GetPromotion(promotionId)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+
+		responses.Response(w, logger, http.StatusOK, definition)
+	}
+}
+
+// AddPromotion handles requests to add a new promotion. The payload has the same
+// format as the entries of the promotions file; the id is assigned by the server
+// unless one not in use is given. Unlike in the file, a definition with any
+// invalid entry is rejected as a whole.
+// Http method: POST
+// Return: the new promotion definition if successful or a http error code otherwise.
+// Invalid promotions are described in the response payload.
+func (c *PromotionController) AddPromotion() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		request, err := requests.NewPromotionRequest(r.Body)
+		if err != nil {
+			responses.ResponseError(w, logger, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		definition, err := c.promotionService.AddPromotion(request)
+		if err != nil {
+			responses.ResponseErrorDetails(w, logger, responses.GetStatusByError(err), err)
+			return
+		}
+
+		responses.Response(w, logger, http.StatusCreated, definition)
+	}
+}
+
+// UpdatePromotion handles requests to replace a promotion keeping its id. The id
+// in the payload, if any, must match the one in the path.
+// Http method: PUT
+// Path parameter: promotion id
+// Return: the updated promotion definition if successful or a http error code otherwise.
+// Invalid promotions are described in the response payload.
+func (c *PromotionController) UpdatePromotion() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		promotionId := pathParameters["id"]
+
+		request, err := requests.NewPromotionRequest(r.Body)
+		if err != nil {
+			responses.ResponseError(w, logger, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if id, ok := request["id"]; ok && id != promotionId {
+			err = errors.NewValidationError([]*errors.ValidationErrorDescription{
+				errors.NewValidationErrorDescription("id", "Promotion id does not match the path")})
+			responses.ResponseErrorDetails(w, logger, http.StatusUnprocessableEntity, err)
+			return
+		}
+
+		definition, err := c.promotionService.UpdatePromotion(promotionId, request)
+		if err != nil {
+			responses.ResponseErrorDetails(w, logger, responses.GetStatusByError(err), err)
+			return
+		}
+
+		responses.Response(w, logger, http.StatusOK, definition)
+	}
+}
+
+// DeletePromotion handles requests to remove a promotion. Prices calculated from
+// then on do not apply it.
+// Http method: DELETE
+// Path parameter: promotion id
+// Return: no content if successful or a http error code otherwise.
+func (c *PromotionController) DeletePromotion() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetLoggerWithFields(r)
+
+		pathParameters := mux.Vars(r)
+		promotionId := pathParameters["id"]
+
+		err := c.promotionService.DeletePromotion(promotionId)
+		if err != nil {
+			responses.ResponseError(w, logger, responses.GetStatusByError(err), err.Error())
+			return
+		}
+
+		responses.Response(w, logger, http.StatusNoContent, nil)
+	}
+}
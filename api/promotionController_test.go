@@ -0,0 +1,211 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/alfcope/checkouttest/api/responses"
+	"github.com/alfcope/checkouttest/datasource"
+	"github.com/alfcope/checkouttest/errors"
+	"github.com/alfcope/checkouttest/internal/tests/mocks"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type PromotionControllerTestSuite struct {
+	suite.Suite
+
+	promotionController PromotionController
+	datasourceMock      datasource.Datasource
+}
+
+func TestPromotionControllerSuite(t *testing.T) {
+	suite.Run(t, new(PromotionControllerTestSuite))
+}
+
+func (suite *PromotionControllerTestSuite) SetupSuite() {
+	apiRoute := mux.NewRouter().PathPrefix("/api/v1").Subrouter().StrictSlash(true)
+
+	suite.datasourceMock = datasource.Datasource(mocks.NewDatasourceMock())
+	suite.promotionController = *NewPromotionController(apiRoute, NewPromotionService(suite.datasourceMock))
+}
+
+func (suite *PromotionControllerTestSuite) TearDownTest() {
+	suite.datasourceMock.(*mocks.DatasourceMock).ExpectedCalls = nil
+	suite.datasourceMock.(*mocks.DatasourceMock).Calls = nil
+}
+
+func (suite *PromotionControllerTestSuite) TestGetPromotions() {
+	// Given
+	definitions := []map[string]interface{}{{"id": "P1", "code": "BULK"}, {"id": "P2", "code": "FREE_ITEMS"}}
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotionDefinitions").Return(definitions)
+
+	// When
+	req, err := http.NewRequest("GET", "/promotions/", nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.promotionController.GetPromotions())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusOK, rr.Code)
+
+	var response []map[string]interface{}
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	if err != nil {
+		suite.T().Errorf("Error unmarshalling promotions response: %v", err)
+	}
+	suite.Equal(definitions, response)
+}
+
+func (suite *PromotionControllerTestSuite) TestGetNonExistingPromotion() {
+	// Given
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotionDefinition",
+		mock.AnythingOfType("string")).Return(map[string]interface{}(nil), errors.NewPromotionNotFound("FAKE"))
+
+	// When
+	req, err := http.NewRequest("GET", "/promotions/FAKE", nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": "FAKE"})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.promotionController.GetPromotion())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusNotFound, rr.Code)
+}
+
+func (suite *PromotionControllerTestSuite) TestAddInvalidPromotion() {
+	// Given
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddPromotion",
+		mock.Anything).Return("", errors.NewPromotionInvalid("FAKE", "unknown promotion type"))
+
+	// When
+	req, err := http.NewRequest("POST", "/promotions/", bytes.NewBufferString(`{"code": "FAKE", "promos": []}`))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.promotionController.AddPromotion())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusUnprocessableEntity, rr.Code)
+
+	var response responses.ErrorResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	if err != nil {
+		suite.T().Errorf("Error unmarshalling error response: %v", err)
+	}
+	suite.Equal("Promotion FAKE invalid: unknown promotion type", response.Message)
+}
+
+func (suite *PromotionControllerTestSuite) TestAddPromotion() {
+	// Given
+	definition := map[string]interface{}{"code": "BULK", "promos": []interface{}{}}
+	stored := map[string]interface{}{"id": "P1", "code": "BULK", "promos": []interface{}{}}
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddPromotion", definition).Return("P1", nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotionDefinition", "P1").Return(stored, nil)
+
+	// When
+	req, err := http.NewRequest("POST", "/promotions/", bytes.NewBufferString(`{"code": "BULK", "promos": []}`))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.promotionController.AddPromotion())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusCreated, rr.Code)
+
+	var response map[string]interface{}
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	if err != nil {
+		suite.T().Errorf("Error unmarshalling promotion response: %v", err)
+	}
+	suite.Equal(stored, response)
+}
+
+func (suite *PromotionControllerTestSuite) TestUpdatePromotionIdMismatch() {
+	// When
+	req, err := http.NewRequest("PUT", "/promotions/P1", bytes.NewBufferString(`{"id": "P2", "code": "BULK", "promos": []}`))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": "P1"})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.promotionController.UpdatePromotion())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusUnprocessableEntity, rr.Code)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "UpdatePromotion", mock.Anything, mock.Anything)
+}
+
+func (suite *PromotionControllerTestSuite) TestUpdateNonExistingPromotion() {
+	// Given
+	suite.datasourceMock.(*mocks.DatasourceMock).On("UpdatePromotion",
+		"FAKE", mock.Anything).Return(errors.NewPromotionNotFound("FAKE"))
+
+	// When
+	req, err := http.NewRequest("PUT", "/promotions/FAKE", bytes.NewBufferString(`{"code": "BULK", "promos": []}`))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": "FAKE"})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.promotionController.UpdatePromotion())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusNotFound, rr.Code)
+}
+
+func (suite *PromotionControllerTestSuite) TestDeletePromotion() {
+	// Given
+	suite.datasourceMock.(*mocks.DatasourceMock).On("DeletePromotion", "P1").Return(nil)
+
+	// When
+	req, err := http.NewRequest("DELETE", "/promotions/P1", nil)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": "P1"})
+
+	rr := httptest.NewRecorder()
+
+	handler := logging.AccessLoggingMiddleware(suite.promotionController.DeletePromotion())
+
+	handler.ServeHTTP(rr, req)
+
+	// Then
+	suite.Equal(http.StatusNoContent, rr.Code)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertCalled(suite.T(), "DeletePromotion", "P1")
+}
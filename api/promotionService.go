@@ -0,0 +1,55 @@
+package api
+
+import (
+	"github.com/alfcope/checkouttest/datasource"
+)
+
+type promotionService struct {
+	ds datasource.Datasource
+}
+
+// PromotionService manages the active promotions. Promotions are handled by their
+// definitions, which have the same format as the promotions file plus the id.
+type PromotionService interface {
+	GetPromotions() []map[string]interface{}
+	GetPromotion(string) (map[string]interface{}, error)
+	AddPromotion(map[string]interface{}) (map[string]interface{}, error)
+	UpdatePromotion(string, map[string]interface{}) (map[string]interface{}, error)
+	DeletePromotion(string) error
+}
+
+func NewPromotionService(ds datasource.Datasource) PromotionService {
+	return &promotionService{
+		ds: ds,
+	}
+}
+
+func (p *promotionService) GetPromotions() []map[string]interface{} {
+	return p.ds.GetPromotionDefinitions()
+}
+
+func (p *promotionService) GetPromotion(id string) (map[string]interface{}, error) {
+	return p.ds.GetPromotionDefinition(id)
+}
+
+func (p *promotionService) AddPromotion(definition map[string]interface{}) (map[string]interface{}, error) {
+	id, err := p.ds.AddPromotion(definition)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.ds.GetPromotionDefinition(id)
+}
+
+func (p *promotionService) UpdatePromotion(id string, definition map[string]interface{}) (map[string]interface{}, error) {
+	err := p.ds.UpdatePromotion(id, definition)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.ds.GetPromotionDefinition(id)
+}
+
+func (p *promotionService) DeletePromotion(id string) error {
+	return p.ds.DeletePromotion(id)
+}
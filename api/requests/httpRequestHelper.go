@@ -2,10 +2,100 @@ package requests
 
 import (
 	"encoding/json"
+	"github.com/alfcope/checkouttest/errors"
 	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/pkg/auth"
 	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 )
 
+// CustomerHeader carries the id of the customer making the request when
+// authentication is disabled. Requests without it are anonymous
+const CustomerHeader = auth.CustomerHeader
+
+// CustomerId returns the id of the customer making the request, empty if anonymous.
+// It is the subject of the credentials of authenticated requests
+func CustomerId(r *http.Request) string {
+	if identity, ok := auth.FromRequest(r); ok {
+		return identity.Subject
+	}
+
+	return strings.TrimSpace(r.Header.Get(CustomerHeader))
+}
+
+// IsAdmin tells if the request was made by an admin, who can read the resources of
+// every customer
+func IsAdmin(r *http.Request) bool {
+	identity, ok := auth.FromRequest(r)
+	return ok && identity.HasScope(auth.Admin)
+}
+
+type CreateBasketRequest struct {
+	Currency model.Currency `json:"currency"`
+}
+
+// NewCreateBasketRequest decodes the optional body creating a basket. An empty body
+// creates it in the default currency
+func NewCreateBasketRequest(body io.Reader) (*CreateBasketRequest, error) {
+	var createBasketRequest CreateBasketRequest
+
+	if body == nil {
+		return &createBasketRequest, nil
+	}
+
+	decoder := json.NewDecoder(body)
+
+	if err := decoder.Decode(&createBasketRequest); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return &createBasketRequest, nil
+}
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// PageRequest selects a page of a listing. Pages start at 1
+type PageRequest struct {
+	Page int
+	Size int
+}
+
+// NewPageRequest reads the optional page and size query parameters, defaulting to
+// the first page of DefaultPageSize elements
+func NewPageRequest(query url.Values) (*PageRequest, error) {
+	pageRequest := PageRequest{Page: 1, Size: DefaultPageSize}
+	descriptions := make([]*errors.ValidationErrorDescription, 0)
+
+	if value := query.Get("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		if err != nil || page < 1 {
+			descriptions = append(descriptions, errors.NewValidationErrorDescription("page", "Page must be a positive number"))
+		}
+		pageRequest.Page = page
+	}
+
+	if value := query.Get("size"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 1 || size > MaxPageSize {
+			descriptions = append(descriptions, errors.NewValidationErrorDescription("size",
+				"Size must be a number from 1 to "+strconv.Itoa(MaxPageSize)))
+		}
+		pageRequest.Size = size
+	}
+
+	if len(descriptions) > 0 {
+		return nil, errors.NewValidationError(descriptions)
+	}
+
+	return &pageRequest, nil
+}
+
 type AddItemRequest struct {
 	Code model.ProductCode `json:"code"`
 }
@@ -21,3 +111,96 @@ func NewAddItemRequest(body io.Reader) (*AddItemRequest, error) {
 
 	return &addItemRequest, nil
 }
+
+type AddItemsRequest []AddItemsRequestItem
+
+type AddItemsRequestItem struct {
+	Code     model.ProductCode `json:"code"`
+	Quantity int               `json:"quantity"`
+}
+
+func NewAddItemsRequest(body io.Reader) (AddItemsRequest, error) {
+	var addItemsRequest AddItemsRequest
+
+	decoder := json.NewDecoder(body)
+
+	if err := decoder.Decode(&addItemsRequest); err != nil {
+		return nil, err
+	}
+
+	return addItemsRequest, nil
+}
+
+type SetItemQuantityRequest struct {
+	Quantity *int `json:"quantity"`
+}
+
+func NewSetItemQuantityRequest(body io.Reader) (*SetItemQuantityRequest, error) {
+	var setItemQuantityRequest SetItemQuantityRequest
+
+	decoder := json.NewDecoder(body)
+
+	if err := decoder.Decode(&setItemQuantityRequest); err != nil {
+		return nil, err
+	}
+
+	return &setItemQuantityRequest, nil
+}
+
+type SetStockRequest struct {
+	Quantity *int `json:"quantity"`
+}
+
+func NewSetStockRequest(body io.Reader) (*SetStockRequest, error) {
+	var setStockRequest SetStockRequest
+
+	decoder := json.NewDecoder(body)
+
+	if err := decoder.Decode(&setStockRequest); err != nil {
+		return nil, err
+	}
+
+	return &setStockRequest, nil
+}
+
+type ApplyCouponRequest struct {
+	Code string `json:"code"`
+}
+
+func NewApplyCouponRequest(body io.Reader) (*ApplyCouponRequest, error) {
+	var applyCouponRequest ApplyCouponRequest
+
+	decoder := json.NewDecoder(body)
+
+	if err := decoder.Decode(&applyCouponRequest); err != nil {
+		return nil, err
+	}
+
+	return &applyCouponRequest, nil
+}
+
+func NewProductRequest(body io.Reader) (*model.Product, error) {
+	var product model.Product
+
+	decoder := json.NewDecoder(body)
+
+	if err := decoder.Decode(&product); err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+// NewPromotionRequest decodes a promotion definition, which has the same format
+// as the promotions file
+func NewPromotionRequest(body io.Reader) (map[string]interface{}, error) {
+	var definition map[string]interface{}
+
+	decoder := json.NewDecoder(body)
+
+	if err := decoder.Decode(&definition); err != nil {
+		return nil, err
+	}
+
+	return definition, nil
+}
@@ -3,16 +3,283 @@ package responses
 import (
 	"encoding/json"
 	"github.com/alfcope/checkouttest/errors"
+	"github.com/alfcope/checkouttest/model"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"time"
 )
 
 type NewBasketResponse struct {
 	Id string `json:"id"`
 }
 
+type CheckoutResponse struct {
+	Id string `json:"id"`
+}
+
+type BasketContentResponse struct {
+	Id        string               `json:"id"`
+	Owner     string               `json:"owner,omitempty"`
+	Currency  model.Currency       `json:"currency"`
+	Lines     []BasketLineResponse `json:"lines"`
+	Coupons   []string             `json:"coupons"`
+	CreatedAt time.Time            `json:"createdAt"`
+	UpdatedAt time.Time            `json:"updatedAt"`
+}
+
+// BasketLineResponse shows the unit price of the product in the currency of the
+// catalogue, as a decimal string
+type BasketLineResponse struct {
+	Code      model.ProductCode `json:"code"`
+	Name      string            `json:"name"`
+	UnitPrice string            `json:"unitPrice"`
+	Currency  model.Currency    `json:"currency"`
+	Quantity  int               `json:"quantity"`
+}
+
+// PriceBasketResponse shows the amounts in the currency of the basket, as decimal strings
 type PriceBasketResponse struct {
-	Total float64 `json:"total"`
+	Total    string         `json:"total"`
+	Discount string         `json:"discount,omitempty"`
+	Currency model.Currency `json:"currency"`
+}
+
+// ReceiptResponse shows the amounts in the currency of the basket, as decimal strings
+type ReceiptResponse struct {
+	Currency  model.Currency            `json:"currency"`
+	Lines     []ReceiptLineResponse     `json:"lines"`
+	Subtotal  string                    `json:"subtotal"`
+	Discounts []AppliedDiscountResponse `json:"discounts"`
+	Total     string                    `json:"total"`
+	Net       string                    `json:"net"`
+	Tax       string                    `json:"tax"`
+}
+
+type ReceiptLineResponse struct {
+	Code        model.ProductCode          `json:"code"`
+	Name        string                     `json:"name"`
+	Quantity    int                        `json:"quantity"`
+	UnitPrice   string                     `json:"unitPrice"`
+	Subtotal    string                     `json:"subtotal"`
+	Promotions  []AppliedPromotionResponse `json:"promotions"`
+	Total       string                     `json:"total"`
+	TaxCategory model.TaxCategory          `json:"taxCategory"`
+	// Price of the line once its share of the basket discounts is taken, split into
+	// net and tax
+	Gross string `json:"gross"`
+	Net   string `json:"net"`
+	Tax   string `json:"tax"`
+}
+
+type AppliedPromotionResponse struct {
+	Id       string              `json:"id,omitempty"`
+	Type     model.PromotionType `json:"type"`
+	Units    int                 `json:"units"`
+	Discount string              `json:"discount"`
+}
+
+type AppliedDiscountResponse struct {
+	Id       string              `json:"id,omitempty"`
+	Type     model.PromotionType `json:"type"`
+	Discount string              `json:"discount"`
+}
+
+func NewBasketContentResponse(basket *model.Basket) BasketContentResponse {
+	lines := basket.Lines()
+
+	response := BasketContentResponse{
+		Id:        basket.Id,
+		Owner:     basket.Owner(),
+		Currency:  basket.Currency(),
+		Lines:     make([]BasketLineResponse, 0, len(lines)),
+		Coupons:   basket.Coupons(),
+		CreatedAt: basket.CreatedAt(),
+		UpdatedAt: basket.UpdatedAt(),
+	}
+
+	for _, line := range lines {
+		response.Lines = append(response.Lines, BasketLineResponse{
+			Code:      line.Code,
+			Name:      line.Name,
+			UnitPrice: line.Price.Decimal(),
+			Currency:  line.Price.Currency,
+			Quantity:  line.Amount(),
+		})
+	}
+
+	return response
+}
+
+func NewBasketContentsResponse(baskets []*model.Basket) []BasketContentResponse {
+	response := make([]BasketContentResponse, 0, len(baskets))
+	for _, basket := range baskets {
+		response = append(response, NewBasketContentResponse(basket))
+	}
+
+	return response
+}
+
+func NewPriceBasketResponse(receipt model.Receipt) PriceBasketResponse {
+	response := PriceBasketResponse{
+		Total:    receipt.Total.Decimal(),
+		Currency: receipt.Total.Currency,
+	}
+
+	if discount := receipt.Subtotal.Amount - receipt.Total.Amount; discount != 0 {
+		response.Discount = model.NewMoney(discount, receipt.Total.Currency).Decimal()
+	}
+
+	return response
+}
+
+func NewReceiptResponse(receipt model.Receipt) ReceiptResponse {
+	response := ReceiptResponse{
+		Currency:  receipt.Total.Currency,
+		Lines:     make([]ReceiptLineResponse, 0, len(receipt.Lines)),
+		Subtotal:  receipt.Subtotal.Decimal(),
+		Discounts: make([]AppliedDiscountResponse, 0, len(receipt.Discounts)),
+		Total:     receipt.Total.Decimal(),
+		Net:       receipt.Net.Decimal(),
+		Tax:       receipt.Tax.Decimal(),
+	}
+
+	for _, line := range receipt.Lines {
+		lineResponse := ReceiptLineResponse{
+			Code:        line.Code,
+			Name:        line.Name,
+			Quantity:    line.Quantity,
+			UnitPrice:   line.Price.Decimal(),
+			Subtotal:    line.Subtotal.Decimal(),
+			Promotions:  make([]AppliedPromotionResponse, 0, len(line.Promotions)),
+			Total:       line.Total.Decimal(),
+			TaxCategory: line.TaxCategory,
+			Gross:       line.Gross.Decimal(),
+			Net:         line.Net.Decimal(),
+			Tax:         line.Tax.Decimal(),
+		}
+
+		if lineResponse.TaxCategory == "" {
+			lineResponse.TaxCategory = model.DefaultTaxCategory
+		}
+
+		for _, applied := range line.Promotions {
+			lineResponse.Promotions = append(lineResponse.Promotions, AppliedPromotionResponse{
+				Id:       applied.Id,
+				Type:     applied.Type,
+				Units:    applied.Units,
+				Discount: applied.Discount.Decimal(),
+			})
+		}
+
+		response.Lines = append(response.Lines, lineResponse)
+	}
+
+	for _, applied := range receipt.Discounts {
+		response.Discounts = append(response.Discounts, AppliedDiscountResponse{
+			Id:       applied.Id,
+			Type:     applied.Type,
+			Discount: applied.Discount.Decimal(),
+		})
+	}
+
+	return response
+}
+
+// StockResponse shows the units of a product. Untracked products have no stock
+// limit
+type StockResponse struct {
+	Code      model.ProductCode `json:"code"`
+	Tracked   bool              `json:"tracked"`
+	OnHand    int               `json:"onHand"`
+	Reserved  int               `json:"reserved"`
+	Available int               `json:"available"`
+}
+
+func NewStockResponse(stock model.Stock) StockResponse {
+	return StockResponse{
+		Code:      stock.Code,
+		Tracked:   stock.Tracked,
+		OnHand:    stock.OnHand,
+		Reserved:  stock.Reserved,
+		Available: stock.Available(),
+	}
+}
+
+// OrderResponse shows the receipt of the basket as it was checked out
+type OrderResponse struct {
+	Id        string           `json:"id"`
+	BasketId  string           `json:"basketId"`
+	Customer  string           `json:"customer,omitempty"`
+	Coupons   []string         `json:"coupons"`
+	Receipt   ReceiptResponse  `json:"receipt"`
+	State     model.OrderState `json:"state"`
+	CreatedAt time.Time        `json:"createdAt"`
+	UpdatedAt time.Time        `json:"updatedAt"`
+}
+
+type OrdersPageResponse struct {
+	Orders []OrderResponse `json:"orders"`
+	Page   int             `json:"page"`
+	Size   int             `json:"size"`
+	Total  int             `json:"total"`
+}
+
+func NewOrderResponse(order model.Order) OrderResponse {
+	coupons := order.Coupons
+	if coupons == nil {
+		coupons = []string{}
+	}
+
+	return OrderResponse{
+		Id:        order.Id,
+		BasketId:  order.BasketId,
+		Customer:  order.Customer,
+		Coupons:   coupons,
+		Receipt:   NewReceiptResponse(order.Receipt),
+		State:     order.State,
+		CreatedAt: order.CreatedAt,
+		UpdatedAt: order.UpdatedAt,
+	}
+}
+
+func NewOrdersPageResponse(orders []model.Order, page, size, total int) OrdersPageResponse {
+	response := OrdersPageResponse{
+		Orders: make([]OrderResponse, 0, len(orders)),
+		Page:   page,
+		Size:   size,
+		Total:  total,
+	}
+
+	for _, order := range orders {
+		response.Orders = append(response.Orders, NewOrderResponse(order))
+	}
+
+	return response
+}
+
+type ErrorResponse struct {
+	Message string               `json:"message"`
+	Errors  []FieldErrorResponse `json:"errors,omitempty"`
+}
+
+type FieldErrorResponse struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func NewErrorResponse(err error) ErrorResponse {
+	response := ErrorResponse{Message: err.Error()}
+
+	if validationError, ok := err.(*errors.ValidationError); ok {
+		for _, description := range validationError.Errors {
+			response.Errors = append(response.Errors, FieldErrorResponse{
+				Field:   description.Field,
+				Message: description.Message,
+			})
+		}
+	}
+
+	return response
 }
 
 // Sends a response error
@@ -24,6 +291,15 @@ func ResponseError(w http.ResponseWriter, log *logrus.Entry, status int, msg str
 	w.WriteHeader(status)
 }
 
+// Sends a response error with a payload describing what went wrong
+func ResponseErrorDetails(w http.ResponseWriter, log *logrus.Entry, status int, err error) {
+	if log != nil {
+		log.Error(err.Error())
+	}
+
+	Response(w, log, status, NewErrorResponse(err))
+}
+
 func Response(w http.ResponseWriter, log *logrus.Entry, status int, payload interface{}) {
 	w.WriteHeader(status)
 
@@ -44,8 +320,22 @@ func Response(w http.ResponseWriter, log *logrus.Entry, status int, payload inte
 
 func GetStatusByError(err error) int {
 	switch err.(type) {
-	case *errors.BasketNotFound, *errors.ProductNotFound, *errors.PromotionNotFound:
+	case *errors.BasketNotFound, *errors.ProductNotFound, *errors.PromotionNotFound, *errors.ProductNotInBasket,
+		*errors.CouponNotFound, *errors.CouponNotInBasket, *errors.OrderNotFound:
 		return http.StatusNotFound
+	case *errors.BasketExpired, *errors.CouponExpired:
+		return http.StatusGone
+	case *errors.BasketForbidden:
+		return http.StatusForbidden
+	case *errors.ProductAlreadyExists, *errors.CouponAlreadyApplied, *errors.CouponExhausted, *errors.BasketCheckedOut,
+		*errors.OrderStateInvalid, *errors.OutOfStock:
+		return http.StatusConflict
+	case *errors.PaymentDeclined:
+		return http.StatusPaymentRequired
+	case *errors.PaymentTimeout:
+		return http.StatusGatewayTimeout
+	case *errors.ValidationError, *errors.PromotionInvalid:
+		return http.StatusUnprocessableEntity
 	}
 
 	return http.StatusInternalServerError
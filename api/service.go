@@ -1,33 +1,153 @@
 package api
 
 import (
+	"expvar"
+	"fmt"
 	"github.com/alfcope/checkouttest/datasource"
+	"github.com/alfcope/checkouttest/errors"
 	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/payment"
 	"github.com/google/uuid"
+	"sort"
+	"sync"
+	"time"
 )
 
+// basketMetrics counts the baskets evicted by the sweeper and the requests
+// for expired baskets
+var basketMetrics = expvar.NewMap("baskets")
+
+// errAmountChanged aborts the update of the amount of a product changed meanwhile
+var errAmountChanged = fmt.Errorf("product amount changed")
+
 type checkoutService struct {
 	ds datasource.Datasource
+
+	ttl      time.Duration
+	now      func() time.Time
+	strategy model.PricingStrategy
+	currency model.Currency
+	rates    model.ExchangeRates
+	taxes    model.TaxRates
+	payments payment.PaymentProvider
+
+	// Evicted baskets are remembered for another ttl, so they are reported as
+	// expired instead of not found
+	evicted    map[string]time.Time
+	evictedMux sync.Mutex
+}
+
+// ServiceOption configures optional behaviour of the checkout service
+type ServiceOption func(*checkoutService)
+
+// WithBasketTTL makes baskets expire when they are not modified for the given time
+func WithBasketTTL(ttl time.Duration) ServiceOption {
+	return func(c *checkoutService) {
+		c.ttl = ttl
+	}
+}
+
+// WithClock replaces the clock used to check the expiry of baskets and the schedule
+// of promotions
+func WithClock(now func() time.Time) ServiceOption {
+	return func(c *checkoutService) {
+		c.now = now
+	}
+}
+
+// WithPricingStrategy selects how competing promotions are applied to the baskets
+func WithPricingStrategy(strategy model.PricingStrategy) ServiceOption {
+	return func(c *checkoutService) {
+		c.strategy = strategy
+	}
+}
+
+// WithCurrency sets the currency of the baskets created without one
+func WithCurrency(currency model.Currency) ServiceOption {
+	return func(c *checkoutService) {
+		c.currency = currency
+	}
+}
+
+// WithExchangeRates sets the rates converting the prices of the catalogue to the
+// currency of the baskets. Baskets can only be created in the currencies they support
+func WithExchangeRates(rates model.ExchangeRates) ServiceOption {
+	return func(c *checkoutService) {
+		c.rates = rates
+	}
+}
+
+// WithTaxRates sets the rates splitting the prices into net and tax
+func WithTaxRates(taxes model.TaxRates) ServiceOption {
+	return func(c *checkoutService) {
+		c.taxes = taxes
+	}
+}
+
+// WithPaymentProvider sets the provider collecting the payments of the orders. A
+// fake provider accepting every payment is used without it
+func WithPaymentProvider(payments payment.PaymentProvider) ServiceOption {
+	return func(c *checkoutService) {
+		c.payments = payments
+	}
 }
 
 type CheckoutService interface {
-	CreateBasket() (string, error)
-	AddProduct(string, model.ProductCode) error
-	GetBasketPrice(string) (float64, error)
-	DeleteBasket(string)
+	// Baskets are accessed on behalf of a customer, empty when anonymous. Customers
+	// can not access the baskets owned by others
+	CreateBasket(customer string, currency model.Currency) (string, error)
+	GetBasket(customer string, id string) (*model.Basket, error)
+	GetCustomerBaskets(customer string) []*model.Basket
+	AddProduct(customer string, id string, code model.ProductCode) error
+	AddProducts(customer string, id string, amounts map[model.ProductCode]int) error
+	SetProductAmount(customer string, id string, code model.ProductCode, amount int) error
+	RemoveProduct(customer string, id string, code model.ProductCode) error
+	ApplyCoupon(customer string, id string, code string) error
+	RemoveCoupon(customer string, id string, code string) error
+	GetBasketPrice(customer string, id string) (model.Receipt, error)
+	DeleteBasket(customer string, id string) error
+	DeleteExpiredBaskets() int
+	Checkout(customer string, id string) (string, error)
+	GetOrder(string) (model.Order, error)
+	GetOrders(page, size int) ([]model.Order, int)
+	Refund(string) error
 }
 
-func NewCheckoutService(ds datasource.Datasource) CheckoutService {
-	return &checkoutService{
-		ds: ds,
+func NewCheckoutService(ds datasource.Datasource, options ...ServiceOption) CheckoutService {
+	service := &checkoutService{
+		ds:         ds,
+		now:        time.Now,
+		strategy:   model.PriorityOrdered,
+		currency:   model.DefaultCurrency,
+		payments:   payment.NewFakeProvider(payment.Succeed),
+		evicted:    make(map[string]time.Time),
+		evictedMux: sync.Mutex{},
+	}
+
+	for _, option := range options {
+		option(service)
 	}
+
+	return service
 }
 
-func (c *checkoutService) CreateBasket() (string, error) {
+// CreateBasket creates an empty basket owned by the customer, priced in the given
+// currency or in the default one when empty. Baskets created without a customer are
+// anonymous
+func (c *checkoutService) CreateBasket(customer string, currency model.Currency) (string, error) {
+	if currency == "" {
+		currency = c.currency
+	}
+
+	if currency != c.currency && !c.rates.Supports(currency) {
+		return "", errors.NewValidationError([]*errors.ValidationErrorDescription{
+			errors.NewValidationErrorDescription("currency", "Unsupported currency")})
+	}
+
 	//TODO: unlikely hash collision could happen!! Use distributed id generator
 	id := uuid.New().String()
 
-	basket := model.NewBasket(id)
+	basket := model.NewCustomerBasket(id, customer, currency)
 
 	err := c.ds.AddBasket(basket)
 	if err != nil {
@@ -37,33 +157,472 @@ func (c *checkoutService) CreateBasket() (string, error) {
 	return id, nil
 }
 
-func (c *checkoutService) AddProduct(id string, pCode model.ProductCode) error {
+func (c *checkoutService) GetBasket(customer string, id string) (*model.Basket, error) {
+	basket, err := c.ds.GetBasket(id)
+	if err != nil {
+		return basket, c.basketError(id, err)
+	}
+
+	if !basket.CanAccess(customer) {
+		return new(model.Basket), errors.NewBasketForbidden(id, customer)
+	}
+
+	if basket.IsExpired(c.now(), c.ttl) {
+		return new(model.Basket), c.basketError(id, errors.NewBasketExpired(id))
+	}
+
+	return basket, nil
+}
+
+// GetCustomerBaskets returns the baskets owned by the customer that have not
+// expired, the most recent first
+func (c *checkoutService) GetCustomerBaskets(customer string) []*model.Basket {
+	baskets := make([]*model.Basket, 0)
+	if customer == "" {
+		return baskets
+	}
+
+	for _, basket := range c.ds.GetBasketsByOwner(customer) {
+		if !basket.IsExpired(c.now(), c.ttl) {
+			baskets = append(baskets, basket)
+		}
+	}
+
+	return baskets
+}
+
+func (c *checkoutService) AddProduct(customer string, id string, pCode model.ProductCode) error {
 
 	p, err := c.ds.GetProduct(pCode)
 	if err != nil {
 		return err
 	}
 
-	basket, err := c.ds.GetBasket(id)
+	return c.updateBasketReserving(customer, id, []model.Line{model.NewLine(p, 1)}, func(basket *model.Basket) error {
+		return basket.AddProduct(p)
+	})
+}
+
+// AddProducts adds all the products to the basket, or none of them if any is
+// not found in the catalogue
+func (c *checkoutService) AddProducts(customer string, id string, amounts map[model.ProductCode]int) error {
+	codes := make([]string, 0, len(amounts))
+	for pCode := range amounts {
+		codes = append(codes, string(pCode))
+	}
+	sort.Strings(codes)
+
+	lines := make([]model.Line, 0, len(codes))
+	for _, code := range codes {
+		p, err := c.ds.GetProduct(model.ProductCode(code))
+		if err != nil {
+			return err
+		}
+
+		lines = append(lines, model.NewLine(p, amounts[p.Code]))
+	}
+
+	return c.updateBasketReserving(customer, id, lines, func(basket *model.Basket) error {
+		return basket.AddProducts(lines)
+	})
+}
+
+func (c *checkoutService) SetProductAmount(customer string, id string, pCode model.ProductCode, amount int) error {
+	if amount == 0 {
+		return c.RemoveProduct(customer, id, pCode)
+	}
+
+	p, err := c.ds.GetProduct(pCode)
 	if err != nil {
 		return err
 	}
 
-	return basket.AddProduct(p)
+	for {
+		basket, err := c.GetBasket(customer, id)
+		if err != nil {
+			return err
+		}
+
+		// Only the units added are reserved, and the units taken out released once the
+		// basket is updated. The basket is only updated if no other update changed the
+		// amount the units were counted from, otherwise they are counted again
+		current := basket.ProductAmount(pCode)
+		delta := amount - current
+		update := func(basket *model.Basket) error {
+			if basket.ProductAmount(pCode) != current {
+				return errAmountChanged
+			}
+			return basket.SetProductAmount(p, amount)
+		}
+
+		if delta <= 0 {
+			err = c.updateBasket(customer, id, update)
+			if err == nil {
+				c.releaseStock([]model.Line{model.NewLine(p, -delta)})
+			}
+		} else {
+			err = c.updateBasketReserving(customer, id, []model.Line{model.NewLine(p, delta)}, update)
+		}
+
+		if err != errAmountChanged {
+			return err
+		}
+	}
 }
 
-func (c *checkoutService) GetBasketPrice(id string) (float64, error) {
+// RemoveProduct removes the whole line of a product, releasing its units
+func (c *checkoutService) RemoveProduct(customer string, id string, pCode model.ProductCode) error {
+	var removed int
+	err := c.updateBasket(customer, id, func(basket *model.Basket) error {
+		removed = basket.ProductAmount(pCode)
+		return basket.RemoveProduct(pCode)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.releaseStock([]model.Line{model.NewLine(model.Product{Code: pCode}, removed)})
+
+	return nil
+}
 
+// ApplyCoupon applies a coupon to the basket, taking one of its uses. The use is
+// given back if the coupon can not be applied
+func (c *checkoutService) ApplyCoupon(customer string, id string, code string) error {
+	if _, err := c.GetBasket(customer, id); err != nil {
+		return err
+	}
+
+	if err := c.ds.UseCoupon(code, c.now()); err != nil {
+		return err
+	}
+
+	err := c.updateBasket(customer, id, func(basket *model.Basket) error {
+		return basket.AddCoupon(code)
+	})
+	if err != nil {
+		c.ds.ReleaseCoupon(code)
+	}
+
+	return err
+}
+
+// RemoveCoupon removes a coupon from the basket, giving back its use
+func (c *checkoutService) RemoveCoupon(customer string, id string, code string) error {
+	err := c.updateBasket(customer, id, func(basket *model.Basket) error {
+		return basket.RemoveCoupon(code)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.ds.ReleaseCoupon(code)
+
+	return nil
+}
+
+func (c *checkoutService) GetBasketPrice(customer string, id string) (model.Receipt, error) {
+
+	basket, err := c.GetBasket(customer, id)
+	if err != nil {
+		return model.Receipt{}, err
+	}
+
+	return c.price(basket)
+}
+
+// price prices the basket with the promotions active now, in the currency of the
+// basket and with its taxes
+func (c *checkoutService) price(basket *model.Basket) (model.Receipt, error) {
+	promotions := model.ActivePromotions(c.ds.GetPromotions(), c.now())
+	receipt, err := c.rates.ConvertReceipt(basket.CalculatePriceWithStrategy(promotions, c.strategy), basket.Currency())
+	if err != nil {
+		return model.Receipt{}, err
+	}
+
+	return c.taxes.Apply(receipt)
+}
+
+// Checkout freezes the basket and places an order with the prices and promotions
+// it has now, returning the order id. The payment is authorized before the order is
+// placed, and the basket unfrozen again if it is not authorized or the order can
+// not be stored. The order is paid once the payment is captured, and the units
+// reserved by the basket taken out of the stock. If the capture fails the
+// authorization is voided, the order cancelled and the basket unfrozen, so it can
+// be checked out again
+func (c *checkoutService) Checkout(customer string, id string) (string, error) {
+	orderId := uuid.New().String()
+
+	var receipt model.Receipt
+	var owner string
+	var coupons []string
+	var lines []model.Line
+	err := c.updateBasket(customer, id, func(basket *model.Basket) error {
+		// Frozen first, so the lines priced are the ones ordered and no unit can be
+		// added meanwhile
+		if err := basket.CheckOut(orderId); err != nil {
+			return err
+		}
+
+		lines = basket.Lines()
+		if len(lines) == 0 {
+			basket.CancelCheckOut()
+			return errors.NewValidationError([]*errors.ValidationErrorDescription{
+				errors.NewValidationErrorDescription("lines", "Basket is empty")})
+		}
+
+		var err error
+		receipt, err = c.price(basket)
+		if err != nil {
+			basket.CancelCheckOut()
+			return err
+		}
+		owner = basket.Owner()
+		coupons = basket.Coupons()
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	authorization, err := c.payments.Authorize(orderId, receipt.Total)
+	if err != nil {
+		c.cancelCheckout(customer, id)
+		return "", err
+	}
+
+	if err := c.ds.AddOrder(model.NewOrder(orderId, id, owner, coupons, receipt, authorization, c.now())); err != nil {
+		_ = c.payments.Void(authorization)
+		c.cancelCheckout(customer, id)
+		return "", err
+	}
+
+	if err := c.payments.Capture(authorization, receipt.Total); err != nil {
+		_ = c.payments.Void(authorization)
+		_ = c.ds.UpdateOrder(orderId, func(order *model.Order) error {
+			return order.Cancel(c.now())
+		})
+		c.cancelCheckout(customer, id)
+		return "", err
+	}
+	c.commitStock(lines)
+
+	return orderId, c.ds.UpdateOrder(orderId, func(order *model.Order) error {
+		return order.Pay(c.now())
+	})
+}
+
+// cancelCheckout unfreezes a basket whose order could not be placed
+func (c *checkoutService) cancelCheckout(customer string, id string) {
+	_ = c.updateBasket(customer, id, func(basket *model.Basket) error {
+		basket.CancelCheckOut()
+		return nil
+	})
+}
+
+// Refund gives back the payment of a paid order. The order is marked as refunding
+// before asking the provider for the refund, so concurrent refunds of the same order
+// are rejected, and marked as paid again if the provider fails
+func (c *checkoutService) Refund(id string) error {
+	var order model.Order
+	err := c.ds.UpdateOrder(id, func(refunding *model.Order) error {
+		if err := refunding.StartRefund(c.now()); err != nil {
+			return err
+		}
+
+		order = *refunding
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := c.payments.Refund(order.Payment, order.Receipt.Total); err != nil {
+		_ = c.ds.UpdateOrder(id, func(order *model.Order) error {
+			return order.CancelRefund(c.now())
+		})
+		return err
+	}
+
+	return c.ds.UpdateOrder(id, func(order *model.Order) error {
+		return order.Refund(c.now())
+	})
+}
+
+func (c *checkoutService) GetOrder(id string) (model.Order, error) {
+	return c.ds.GetOrder(id)
+}
+
+// GetOrders returns the given page of orders, the most recent first, along with
+// the total number of orders. Pages start at 1
+func (c *checkoutService) GetOrders(page, size int) ([]model.Order, int) {
+	return c.ds.GetOrders((page-1)*size, size)
+}
+
+// DeleteBasket deletes the basket, releasing the units of its lines and the uses of
+// its coupons unless it was checked out. Deleting a basket not found is not an error
+func (c *checkoutService) DeleteBasket(customer string, id string) error {
 	basket, err := c.ds.GetBasket(id)
+	if _, ok := err.(*errors.BasketNotFound); ok {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !basket.CanAccess(customer) {
+		return errors.NewBasketForbidden(id, customer)
+	}
+
+	if basket := c.ds.DeleteBasket(id); basket != nil {
+		c.releaseBasket(basket)
+	}
+
+	return nil
+}
+
+// DeleteExpiredBaskets evicts the baskets not modified within the ttl, releasing
+// the units of their lines and the uses of their coupons, and returns how many were
+// evicted
+func (c *checkoutService) DeleteExpiredBaskets() int {
+	if c.ttl <= 0 {
+		return 0
+	}
+
+	now := c.now()
+	deleted := c.ds.DeleteBasketsUpdatedBefore(now.Add(-c.ttl))
+	for _, basket := range deleted {
+		c.releaseBasket(basket)
+	}
+
+	c.evictedMux.Lock()
+	defer c.evictedMux.Unlock()
+
+	for id, evictedAt := range c.evicted {
+		if now.Sub(evictedAt) > c.ttl {
+			delete(c.evicted, id)
+		}
+	}
+	for _, basket := range deleted {
+		c.evicted[basket.Id] = now
+	}
+
+	basketMetrics.Add("evicted", int64(len(deleted)))
+
+	return len(deleted)
+}
+
+// releaseBasket releases the units of a deleted basket and gives back the uses of
+// its coupons. Checked out baskets already took them out of the stock and coupons
+func (c *checkoutService) releaseBasket(basket *model.Basket) {
+	if basket.OrderId() != "" {
+		return
+	}
+
+	c.releaseStock(basket.Lines())
+	for _, code := range basket.Coupons() {
+		c.ds.ReleaseCoupon(code)
+	}
+}
+
+// updateBasketReserving reserves the units of the lines before updating the basket,
+// and releases them if the basket can not be updated
+func (c *checkoutService) updateBasketReserving(customer string, id string, lines []model.Line, update func(*model.Basket) error) error {
+	if err := c.reserveStock(lines); err != nil {
+		return err
+	}
+
+	err := c.updateBasket(customer, id, update)
 	if err != nil {
-		return 0, err
+		c.releaseStock(lines)
+	}
+
+	return err
+}
+
+// reserveStock reserves the units of every line, or none of them if any product is
+// out of stock
+func (c *checkoutService) reserveStock(lines []model.Line) error {
+	for i, line := range lines {
+		if line.Amount() <= 0 {
+			continue
+		}
+
+		err := c.ds.UpdateStock(line.Code, func(stock *model.Stock) error {
+			return stock.Reserve(line.Amount())
+		})
+		if err != nil {
+			c.releaseStock(lines[:i])
+			return err
+		}
 	}
 
-	promotions := c.ds.GetPromotions()
+	return nil
+}
+
+// releaseStock gives back the units of the lines. Products no longer in the
+// catalogue are ignored
+func (c *checkoutService) releaseStock(lines []model.Line) {
+	c.updateStock(lines, func(stock *model.Stock, units int) {
+		stock.Release(units)
+	})
+}
 
-	return basket.CalculatePrice(promotions), nil
+// commitStock takes the units of the lines out of the stock once they are sold
+func (c *checkoutService) commitStock(lines []model.Line) {
+	c.updateStock(lines, func(stock *model.Stock, units int) {
+		stock.Commit(units)
+	})
 }
 
-func (c *checkoutService) DeleteBasket(id string) {
-	c.ds.DeleteBasket(id)
+func (c *checkoutService) updateStock(lines []model.Line, update func(*model.Stock, int)) {
+	for _, line := range lines {
+		if line.Amount() <= 0 {
+			continue
+		}
+
+		_ = c.ds.UpdateStock(line.Code, func(stock *model.Stock) error {
+			update(stock, line.Amount())
+			return nil
+		})
+	}
+}
+
+// updateBasket applies the update to the basket unless the customer can not access
+// it or it has expired
+func (c *checkoutService) updateBasket(customer string, id string, update func(*model.Basket) error) error {
+	err := c.ds.UpdateBasket(id, func(basket *model.Basket) error {
+		if !basket.CanAccess(customer) {
+			return errors.NewBasketForbidden(id, customer)
+		}
+
+		if basket.IsExpired(c.now(), c.ttl) {
+			return errors.NewBasketExpired(id)
+		}
+
+		return update(basket)
+	})
+
+	return c.basketError(id, err)
+}
+
+// basketError reports baskets recently evicted as expired, and counts the
+// requests for expired baskets
+func (c *checkoutService) basketError(id string, err error) error {
+	if _, ok := err.(*errors.BasketNotFound); ok {
+		c.evictedMux.Lock()
+		_, evicted := c.evicted[id]
+		c.evictedMux.Unlock()
+
+		if evicted {
+			err = errors.NewBasketExpired(id)
+		}
+	}
+
+	if _, ok := err.(*errors.BasketExpired); ok {
+		basketMetrics.Add("expired", 1)
+	}
+
+	return err
 }
@@ -1,14 +1,18 @@
 package api
 
 import (
+	"github.com/alfcope/checkouttest/config"
 	"github.com/alfcope/checkouttest/datasource"
 	"github.com/alfcope/checkouttest/errors"
 	"github.com/alfcope/checkouttest/internal/tests/mocks"
 	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/payment"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type CheckoutServiceTestSuite struct {
@@ -38,7 +42,7 @@ func (suite *CheckoutServiceTestSuite) TestCreateBasketDuplicatedId() {
 	suite.datasourceMock.(*mocks.DatasourceMock).On("AddBasket", mock.AnythingOfType("*model.Basket")).Return(errors.NewPrimaryKeyError(basketId))
 
 	// When
-	b, err := suite.checkoutService.CreateBasket()
+	b, err := suite.checkoutService.CreateBasket("", "")
 
 	// Then
 	suite.Equal("", b)
@@ -54,13 +58,64 @@ func (suite *CheckoutServiceTestSuite) TestCreateBasket() {
 	suite.datasourceMock.(*mocks.DatasourceMock).On("AddBasket", mock.AnythingOfType("*model.Basket")).Return(nil)
 
 	// When
-	b, err := suite.checkoutService.CreateBasket()
+	b, err := suite.checkoutService.CreateBasket("", "")
 
 	// Then
 	suite.NotEqual("", b)
 	suite.Nil(err)
 }
 
+func (suite *CheckoutServiceTestSuite) TestCreateBasketInCurrency() {
+	// Given
+	rates, _ := model.NewExchangeRates("EUR", map[model.Currency]string{"USD": "1.0825"})
+	checkoutService := NewCheckoutService(suite.datasourceMock, WithExchangeRates(rates))
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddBasket", mock.MatchedBy(func(b *model.Basket) bool {
+		return b.Currency() == "USD"
+	})).Return(nil)
+
+	// When
+	b, err := checkoutService.CreateBasket("", "USD")
+
+	// Then
+	suite.NotEqual("", b)
+	suite.Nil(err)
+}
+
+func (suite *CheckoutServiceTestSuite) TestCreateBasketInUnsupportedCurrency() {
+	// Given
+	rates, _ := model.NewExchangeRates("EUR", map[model.Currency]string{"USD": "1.0825"})
+	checkoutService := NewCheckoutService(suite.datasourceMock, WithExchangeRates(rates))
+
+	// When
+	b, err := checkoutService.CreateBasket("", "CHF")
+
+	// Then
+	suite.Equal("", b)
+	if _, ok := err.(*errors.ValidationError); !ok {
+		suite.T().Errorf("Error should be a validation error, got %T", err)
+	}
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "AddBasket", mock.Anything)
+}
+
+func (suite *CheckoutServiceTestSuite) TestGetNonExistingBasket() {
+	// Given
+	basketId := uuid.New().String()
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(new(model.Basket), errors.NewBasketNotFound(basketId))
+
+	// When
+	_, err := suite.checkoutService.GetBasket("", basketId)
+
+	// Then
+	if basketNotFound, ok := err.(*errors.BasketNotFound); ok {
+		suite.Equal(basketId, basketNotFound.Id)
+	} else {
+		suite.T().Error("Error should be a basket not found error ")
+	}
+}
+
 func (suite *CheckoutServiceTestSuite) TestAddNonExistingProduct() {
 	// Given
 	productCode := "FAKE"
@@ -68,7 +123,7 @@ func (suite *CheckoutServiceTestSuite) TestAddNonExistingProduct() {
 		mock.AnythingOfType("model.ProductCode")).Return(*new(model.Product), errors.NewProductNotFound(productCode))
 
 	// When
-	err := suite.checkoutService.AddProduct(uuid.New().String(), model.ProductCode(productCode))
+	err := suite.checkoutService.AddProduct("", uuid.New().String(), model.ProductCode(productCode))
 
 	// Then
 	if productNotFound, ok := err.(*errors.ProductNotFound); ok {
@@ -85,7 +140,7 @@ func (suite *CheckoutServiceTestSuite) TestAddProductToNonExistingBasket() {
 	// Given
 	basketId := uuid.New().String()
 	var productCode model.ProductCode = "P1"
-	product := model.Product{Code: productCode, Name: "Prod 1", Price: 1000}
+	product := model.Product{Code: productCode, Name: "Prod 1", Price: model.NewMoney(1000, "EUR")}
 
 	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct",
 		mock.AnythingOfType("model.ProductCode")).Return(product, nil)
@@ -93,7 +148,7 @@ func (suite *CheckoutServiceTestSuite) TestAddProductToNonExistingBasket() {
 		mock.AnythingOfType("string")).Return(new(model.Basket), errors.NewBasketNotFound(basketId))
 
 	// When
-	err := suite.checkoutService.AddProduct(uuid.New().String(), productCode)
+	err := suite.checkoutService.AddProduct("", uuid.New().String(), productCode)
 
 	// Then
 	if basketNotFound, ok := err.(*errors.BasketNotFound); ok {
@@ -107,7 +162,7 @@ func (suite *CheckoutServiceTestSuite) TestAddProduct() {
 	// Given
 	basketId := uuid.New().String()
 	var productCode model.ProductCode = "P1"
-	product := model.Product{Code: productCode, Name: "Prod 1", Price: 1000}
+	product := model.Product{Code: productCode, Name: "Prod 1", Price: model.NewMoney(1000, "EUR")}
 
 	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct",
 		mock.AnythingOfType("model.ProductCode")).Return(product, nil)
@@ -115,45 +170,1093 @@ func (suite *CheckoutServiceTestSuite) TestAddProduct() {
 		mock.AnythingOfType("string")).Return(model.NewBasket(basketId), nil)
 
 	// When
-	err := suite.checkoutService.AddProduct(uuid.New().String(), productCode)
+	err := suite.checkoutService.AddProduct("", uuid.New().String(), productCode)
 
 	// Then
 	suite.Nil(err)
 }
 
-func (suite *CheckoutServiceTestSuite) TestGetPriceNonExistingBasket() {
+func (suite *CheckoutServiceTestSuite) TestAddProductsNonExistingProduct() {
 	// Given
-	basketId := uuid.New().String()
+	product := model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct", product.Code).Return(product, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct",
+		model.ProductCode("FAKE")).Return(*new(model.Product), errors.NewProductNotFound("FAKE"))
+
+	// When
+	err := suite.checkoutService.AddProducts("", uuid.New().String(), map[model.ProductCode]int{"P1": 2, "FAKE": 1})
+
+	// Then
+	if productNotFound, ok := err.(*errors.ProductNotFound); ok {
+		suite.Equal("FAKE", productNotFound.Code)
+	} else {
+		suite.T().Error("Error should be a product not found error ")
+	}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "GetBasket", mock.AnythingOfType("string"))
+}
+
+func (suite *CheckoutServiceTestSuite) TestAddProducts() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+	p1 := model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")}
+	p2 := model.Product{Code: "P2", Name: "Prod 2", Price: model.NewMoney(250, "EUR")}
 
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct", p1.Code).Return(p1, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct", p2.Code).Return(p2, nil)
 	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
-		mock.AnythingOfType("string")).Return(new(model.Basket), errors.NewBasketNotFound(basketId))
+		mock.AnythingOfType("string")).Return(basket, nil)
 
 	// When
-	price, err := suite.checkoutService.GetBasketPrice(uuid.New().String())
+	err := suite.checkoutService.AddProducts("", basket.Id, map[model.ProductCode]int{"P1": 2, "P2": 10})
 
 	// Then
-	if basketNotFound, ok := err.(*errors.BasketNotFound); ok {
-		suite.Equal(basketId, basketNotFound.Id)
+	suite.Nil(err)
+	suite.Equal(model.NewMoney(2*1000+10*250, "EUR"), basket.CalculatePrice(nil).Total)
+}
+
+func (suite *CheckoutServiceTestSuite) TestSetProductAmountNonExistingProduct() {
+	// Given
+	productCode := "FAKE"
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct",
+		mock.AnythingOfType("model.ProductCode")).Return(*new(model.Product), errors.NewProductNotFound(productCode))
+
+	// When
+	err := suite.checkoutService.SetProductAmount("", uuid.New().String(), model.ProductCode(productCode), 3)
+
+	// Then
+	if productNotFound, ok := err.(*errors.ProductNotFound); ok {
+		suite.Equal(productCode, productNotFound.Code)
 	} else {
-		suite.T().Error("Error should be a basket not found error ")
+		suite.T().Error("Error should be a product not found error ")
 	}
-	suite.Equal(float64(0), price)
+
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "GetBasket", mock.AnythingOfType("string"))
 }
 
-func (suite *CheckoutServiceTestSuite) TestGetPriceEmptyBasket() {
+func (suite *CheckoutServiceTestSuite) TestSetProductAmount() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+	product := model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct",
+		mock.AnythingOfType("model.ProductCode")).Return(product, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+
+	// When
+	err := suite.checkoutService.SetProductAmount("", basket.Id, product.Code, 3)
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(model.NewMoney(3000, "EUR"), basket.CalculatePrice(nil).Total)
+}
+
+func (suite *CheckoutServiceTestSuite) TestSetProductAmountToZero() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+	product := model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")}
+	_ = basket.AddProduct(product)
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+
+	// When
+	err := suite.checkoutService.SetProductAmount("", basket.Id, product.Code, 0)
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(0, len(basket.CalculatePrice(nil).Lines))
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "GetProduct", mock.AnythingOfType("model.ProductCode"))
+}
+
+func (suite *CheckoutServiceTestSuite) TestRemoveProductNotInBasket() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+
+	// When
+	err := suite.checkoutService.RemoveProduct("", basket.Id, "P1")
+
+	// Then
+	if productNotInBasket, ok := err.(*errors.ProductNotInBasket); ok {
+		suite.Equal(basket.Id, productNotInBasket.BasketId)
+		suite.Equal("P1", productNotInBasket.Code)
+	} else {
+		suite.T().Error("Error should be a product not in basket error ")
+	}
+}
+
+func (suite *CheckoutServiceTestSuite) TestAddProductOutOfStock() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+	product := model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct", product.Code).Return(product, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetStock", product.Code).Return(
+		model.Stock{Code: product.Code, Tracked: true, OnHand: 2, Reserved: 2}, nil)
+
+	// When
+	err := suite.checkoutService.AddProduct("", basket.Id, product.Code)
+
+	// Then
+	if outOfStock, ok := err.(*errors.OutOfStock); ok {
+		suite.Equal("P1", outOfStock.Code)
+		suite.Equal(0, outOfStock.Available)
+	} else {
+		suite.T().Errorf("Wanted out of stock error, got %T", err)
+	}
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "GetBasket", mock.AnythingOfType("string"))
+}
+
+func (suite *CheckoutServiceTestSuite) TestAddProductsOutOfStock() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+	p1 := model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")}
+	p2 := model.Product{Code: "P2", Name: "Prod 2", Price: model.NewMoney(250, "EUR")}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct", p1.Code).Return(p1, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct", p2.Code).Return(p2, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetStock", p1.Code).Return(
+		model.Stock{Code: p1.Code, Tracked: true, OnHand: 5, Reserved: 2}, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetStock", p2.Code).Return(
+		model.Stock{Code: p2.Code, Tracked: true, OnHand: 5}, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("UpdateStock", mock.AnythingOfType("model.Stock")).Return(nil)
+
+	// When
+	err := suite.checkoutService.AddProducts("", basket.Id, map[model.ProductCode]int{"P1": 2, "P2": 10})
+
+	// Then
+	if _, ok := err.(*errors.OutOfStock); !ok {
+		suite.T().Errorf("Wanted out of stock error, got %T", err)
+	}
+
+	// The units of the products in stock are given back
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertCalled(suite.T(), "UpdateStock",
+		model.Stock{Code: p1.Code, Tracked: true, OnHand: 5, Reserved: 4})
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertCalled(suite.T(), "UpdateStock",
+		model.Stock{Code: p1.Code, Tracked: true, OnHand: 5, Reserved: 0})
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "GetBasket", mock.AnythingOfType("string"))
+}
+
+func (suite *CheckoutServiceTestSuite) TestSetProductAmountReservesAddedUnits() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+	product := model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")}
+	_ = basket.AddProducts([]model.Line{model.NewLine(product, 2)})
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct", product.Code).Return(product, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetStock", product.Code).Return(
+		model.Stock{Code: product.Code, Tracked: true, OnHand: 5, Reserved: 2}, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("UpdateStock", mock.AnythingOfType("model.Stock")).Return(nil)
+
+	// When
+	err := suite.checkoutService.SetProductAmount("", basket.Id, product.Code, 5)
+	failed := suite.checkoutService.SetProductAmount("", basket.Id, product.Code, 9)
+
+	// Then
+	suite.Nil(err)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertCalled(suite.T(), "UpdateStock",
+		model.Stock{Code: product.Code, Tracked: true, OnHand: 5, Reserved: 5})
+	if _, ok := failed.(*errors.OutOfStock); !ok {
+		suite.T().Errorf("Wanted out of stock error, got %T", failed)
+	}
+	suite.Equal(5, basket.ProductAmount(product.Code))
+}
+
+// memoryDatasource returns a datasource in memory, for the tests needing the state
+// the mock does not keep
+func (suite *CheckoutServiceTestSuite) memoryDatasource() *datasource.InMemoryDatasource {
+	configuration, err := config.LoadConfiguration("../internal/tests/config", "service_config_test")
+	suite.Nil(err)
+	ds, err := datasource.InitInMemoryDatasource(configuration.Data)
+	suite.Nil(err)
+
+	return ds
+}
+
+// interleavedDatasource runs another request right before the next basket update,
+// as if both had read the basket at the same time
+type interleavedDatasource struct {
+	*datasource.InMemoryDatasource
+	interleave func()
+}
+
+func (d *interleavedDatasource) UpdateBasket(id string, update func(*model.Basket) error) error {
+	if interleave := d.interleave; interleave != nil {
+		d.interleave = nil
+		interleave()
+	}
+
+	return d.InMemoryDatasource.UpdateBasket(id, update)
+}
+
+func (suite *CheckoutServiceTestSuite) TestConcurrentSetProductAmountReservations() {
+	// Given
+	ds := &interleavedDatasource{InMemoryDatasource: suite.memoryDatasource()}
+	service := NewCheckoutService(ds)
+	_ = ds.UpdateStock("MUG", func(stock *model.Stock) error { return stock.SetOnHand(100) })
+	basketId, _ := service.CreateBasket("", "")
+	_ = service.AddProduct("", basketId, "MUG")
+
+	// When
+	ds.interleave = func() {
+		_ = service.SetProductAmount("", basketId, "MUG", 5)
+	}
+	err := service.SetProductAmount("", basketId, "MUG", 5)
+
+	// Then
+	suite.Nil(err)
+	basket, _ := service.GetBasket("", basketId)
+	stock, _ := ds.GetStock("MUG")
+	suite.Equal(5, basket.ProductAmount("MUG"))
+	suite.Equal(5, stock.Reserved)
+}
+
+func (suite *CheckoutServiceTestSuite) TestRemoveProductReleasesStock() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+	product := model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")}
+	_ = basket.AddProducts([]model.Line{model.NewLine(product, 3)})
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetStock", product.Code).Return(
+		model.Stock{Code: product.Code, Tracked: true, OnHand: 5, Reserved: 4}, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("UpdateStock", mock.AnythingOfType("model.Stock")).Return(nil)
+
+	// When
+	err := suite.checkoutService.RemoveProduct("", basket.Id, product.Code)
+
+	// Then
+	suite.Nil(err)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertCalled(suite.T(), "UpdateStock",
+		model.Stock{Code: product.Code, Tracked: true, OnHand: 5, Reserved: 1})
+}
+
+func (suite *CheckoutServiceTestSuite) TestDeleteBasketReleasesStock() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+	checkedOut := model.NewBasket(uuid.New().String())
+	product := model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")}
+	_ = basket.AddProducts([]model.Line{model.NewLine(product, 3)})
+	_ = checkedOut.AddProducts([]model.Line{model.NewLine(product, 1)})
+	_ = checkedOut.CheckOut("O1")
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basket.Id).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", checkedOut.Id).Return(checkedOut, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("DeleteBasket", basket.Id).Return(basket)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("DeleteBasket", checkedOut.Id).Return(checkedOut)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetStock", product.Code).Return(
+		model.Stock{Code: product.Code, Tracked: true, OnHand: 5, Reserved: 4}, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("UpdateStock", mock.AnythingOfType("model.Stock")).Return(nil)
+
+	// When
+	suite.checkoutService.DeleteBasket("", basket.Id)
+	suite.checkoutService.DeleteBasket("", checkedOut.Id)
+
+	// Then
+	// The units of checked out baskets were already sold
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNumberOfCalls(suite.T(), "UpdateStock", 1)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertCalled(suite.T(), "UpdateStock",
+		model.Stock{Code: product.Code, Tracked: true, OnHand: 5, Reserved: 1})
+}
+
+func (suite *CheckoutServiceTestSuite) TestDeleteBasketReleasesCoupons() {
+	// Given
+	ds := suite.memoryDatasource()
+	_, err := ds.AddPromotion(map[string]interface{}{"code": "PERCENTAGE",
+		"coupon": map[string]interface{}{"code": "SUMMER", "maxUses": float64(1)},
+		"promos": []interface{}{map[string]interface{}{"product": "MUG", "rules": []interface{}{
+			map[string]interface{}{"buy": float64(1), "percentage": float64(10)}}}}})
+	suite.Nil(err)
+
+	// Baskets are stamped with the time they are updated at
+	clock := time.Now()
+	service := NewCheckoutService(ds, WithBasketTTL(time.Hour), WithClock(func() time.Time { return clock }))
+	deleted, _ := service.CreateBasket("", "")
+	evicted, _ := service.CreateBasket("", "")
+
+	// When
+	errDeleted := service.ApplyCoupon("", deleted, "SUMMER")
+	_ = service.DeleteBasket("", deleted)
+	errEvicted := service.ApplyCoupon("", evicted, "SUMMER")
+	clock = clock.Add(2 * time.Hour)
+	service.DeleteExpiredBaskets()
+	clock = time.Now()
+	applied, _ := service.CreateBasket("", "")
+	errApplied := service.ApplyCoupon("", applied, "SUMMER")
+
+	// Then
+	suite.Nil(errDeleted)
+	suite.Nil(errEvicted)
+	suite.Nil(errApplied)
+}
+
+func (suite *CheckoutServiceTestSuite) TestAddProductToBasketOfAnotherCustomer() {
+	// Given
+	basket := model.NewCustomerBasket(uuid.New().String(), "C1", model.DefaultCurrency)
+	product := model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct", product.Code).Return(product, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basket.Id).Return(basket, nil)
+
+	// When
+	err := suite.checkoutService.AddProduct("C2", basket.Id, product.Code)
+	anonymous := suite.checkoutService.AddProduct("", basket.Id, product.Code)
+
+	// Then
+	if forbidden, ok := err.(*errors.BasketForbidden); ok {
+		suite.Equal(basket.Id, forbidden.Id)
+		suite.Equal("C2", forbidden.Customer)
+	} else {
+		suite.T().Errorf("Wanted basket forbidden error, got %T", err)
+	}
+	_, ok := anonymous.(*errors.BasketForbidden)
+	suite.True(ok, "Wanted basket forbidden error, got %T", anonymous)
+	suite.Equal(0, len(basket.Lines()))
+
+	// The owner can change it
+	suite.Nil(suite.checkoutService.AddProduct("C1", basket.Id, product.Code))
+}
+
+func (suite *CheckoutServiceTestSuite) TestGetCustomerBaskets() {
+	// Given
+	now := time.Now().UTC()
+	recent := model.RestoreBasket(uuid.New().String(), "C1", model.DefaultCurrency, []model.Line{}, nil, "", now, now)
+	expired := model.RestoreBasket(uuid.New().String(), "C1", model.DefaultCurrency, []model.Line{}, nil, "", now.Add(-2*time.Hour), now.Add(-2*time.Hour))
+	checkoutService := NewCheckoutService(suite.datasourceMock, WithBasketTTL(time.Hour))
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasketsByOwner", "C1").Return([]*model.Basket{recent, expired})
+
+	// When
+	baskets := checkoutService.GetCustomerBaskets("C1")
+	anonymous := checkoutService.GetCustomerBaskets("")
+
+	// Then
+	suite.Equal([]*model.Basket{recent}, baskets)
+	suite.Equal(0, len(anonymous))
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "GetBasketsByOwner", "")
+}
+
+func (suite *CheckoutServiceTestSuite) TestApplyCouponToNonExistingBasket() {
 	// Given
 	basketId := uuid.New().String()
-	promotions := []model.Promotion{model.NewBulkPromotion(map[model.ProductCode][]model.BulkOfferRule{"P1": {{Buy: 3, Price: 900}}}),
-		model.NewFreeItemsPromotion(map[model.ProductCode][]model.FreeItemsOfferRule{"P2": {{Buy: 3, Free: 1}}})}
 
 	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
-		mock.AnythingOfType("string")).Return(model.NewBasket(basketId), nil)
-	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return(promotions)
+		mock.AnythingOfType("string")).Return(new(model.Basket), errors.NewBasketNotFound(basketId))
+
+	// When
+	err := suite.checkoutService.ApplyCoupon("", basketId, "SUMMER")
+
+	// Then
+	if _, ok := err.(*errors.BasketNotFound); !ok {
+		suite.T().Errorf("Wanted basket not found error, got %T", err)
+	}
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "UseCoupon", "SUMMER", mock.Anything)
+}
+
+func (suite *CheckoutServiceTestSuite) TestApplyExhaustedCoupon() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("UseCoupon", "SUMMER",
+		mock.AnythingOfType("time.Time")).Return(errors.NewCouponExhausted("SUMMER"))
+
+	// When
+	err := suite.checkoutService.ApplyCoupon("", basket.Id, "SUMMER")
+
+	// Then
+	if _, ok := err.(*errors.CouponExhausted); !ok {
+		suite.T().Errorf("Wanted coupon exhausted error, got %T", err)
+	}
+	suite.Equal(0, len(basket.Coupons()))
+}
+
+func (suite *CheckoutServiceTestSuite) TestApplyCouponTwice() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+	_ = basket.AddCoupon("SUMMER")
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("UseCoupon", "SUMMER",
+		mock.AnythingOfType("time.Time")).Return(nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("ReleaseCoupon", "SUMMER")
+
+	// When
+	err := suite.checkoutService.ApplyCoupon("", basket.Id, "SUMMER")
+
+	// Then
+	if _, ok := err.(*errors.CouponAlreadyApplied); !ok {
+		suite.T().Errorf("Wanted coupon already applied error, got %T", err)
+	}
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertCalled(suite.T(), "ReleaseCoupon", "SUMMER")
+}
+
+func (suite *CheckoutServiceTestSuite) TestApplyCoupon() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")})
+	summer := model.NewPercentagePromotion(map[model.ProductCode][]model.PercentageOfferRule{"P1": {{Buy: 1, Percentage: 10}}})
+	summer.Coupon = model.Coupon{Code: "SUMMER"}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("UseCoupon", "SUMMER",
+		mock.AnythingOfType("time.Time")).Return(nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return([]model.Promotion{summer})
 
 	// When
-	price, err := suite.checkoutService.GetBasketPrice(uuid.New().String())
+	err := suite.checkoutService.ApplyCoupon("", basket.Id, "SUMMER")
 
 	// Then
 	suite.Nil(err)
-	suite.Equal(float64(0), price)
+	suite.Equal([]string{"SUMMER"}, basket.Coupons())
+	receipt, _ := suite.checkoutService.GetBasketPrice("", basket.Id)
+	suite.Equal(model.NewMoney(900, "EUR"), receipt.Total)
+}
+
+func (suite *CheckoutServiceTestSuite) TestRemoveCouponNotInBasket() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+
+	// When
+	err := suite.checkoutService.RemoveCoupon("", basket.Id, "SUMMER")
+
+	// Then
+	if _, ok := err.(*errors.CouponNotInBasket); !ok {
+		suite.T().Errorf("Wanted coupon not in basket error, got %T", err)
+	}
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "ReleaseCoupon", "SUMMER")
+}
+
+func (suite *CheckoutServiceTestSuite) TestRemoveCoupon() {
+	// Given
+	basket := model.NewBasket(uuid.New().String())
+	_ = basket.AddCoupon("SUMMER")
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("ReleaseCoupon", "SUMMER")
+
+	// When
+	err := suite.checkoutService.RemoveCoupon("", basket.Id, "SUMMER")
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(0, len(basket.Coupons()))
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertCalled(suite.T(), "ReleaseCoupon", "SUMMER")
+}
+
+func (suite *CheckoutServiceTestSuite) TestGetPriceNonExistingBasket() {
+	// Given
+	basketId := uuid.New().String()
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(new(model.Basket), errors.NewBasketNotFound(basketId))
+
+	// When
+	receipt, err := suite.checkoutService.GetBasketPrice("", uuid.New().String())
+
+	// Then
+	if basketNotFound, ok := err.(*errors.BasketNotFound); ok {
+		suite.Equal(basketId, basketNotFound.Id)
+	} else {
+		suite.T().Error("Error should be a basket not found error ")
+	}
+	suite.Equal(model.Receipt{}, receipt)
+}
+
+func (suite *CheckoutServiceTestSuite) TestGetPriceEmptyBasket() {
+	// Given
+	basketId := uuid.New().String()
+	promotions := []model.Promotion{model.NewBulkPromotion(map[model.ProductCode][]model.BulkOfferRule{"P1": {{Buy: 3, Price: 900}}}),
+		model.NewFreeItemsPromotion(map[model.ProductCode][]model.FreeItemsOfferRule{"P2": {{Buy: 3, Free: 1}}})}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(model.NewBasket(basketId), nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return(promotions)
+
+	// When
+	receipt, err := suite.checkoutService.GetBasketPrice("", uuid.New().String())
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(model.NewMoney(0, "EUR"), receipt.Total)
+	suite.Equal(0, len(receipt.Lines))
+}
+
+func (suite *CheckoutServiceTestSuite) TestGetPrice() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	for i := 0; i < 4; i++ {
+		_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")})
+	}
+	promotions := []model.Promotion{model.NewBulkPromotion(map[model.ProductCode][]model.BulkOfferRule{"P1": {{Buy: 3, Price: 900}}})}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return(promotions)
+
+	// When
+	receipt, err := suite.checkoutService.GetBasketPrice("", basketId)
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(model.NewMoney(3600, "EUR"), receipt.Total)
+	suite.Equal(1, len(receipt.Lines))
+	suite.Equal(model.NewMoney(4000, "EUR"), receipt.Lines[0].Subtotal)
+	suite.Equal([]model.AppliedPromotion{{Type: "BULK", Units: 4, Discount: model.NewMoney(400, "EUR")}}, receipt.Lines[0].Promotions)
+}
+
+func (suite *CheckoutServiceTestSuite) TestGetBestPrice() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	for i := 0; i < 4; i++ {
+		_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")})
+	}
+	promotions := []model.Promotion{model.NewBulkPromotion(map[model.ProductCode][]model.BulkOfferRule{"P1": {{Buy: 3, Price: 900}}}),
+		model.NewFreeItemsPromotion(map[model.ProductCode][]model.FreeItemsOfferRule{"P1": {{Buy: 2, Free: 1}}})}
+
+	checkoutService := NewCheckoutService(suite.datasourceMock, WithPricingStrategy(model.BestForCustomer))
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return(promotions)
+
+	// When
+	receipt, err := checkoutService.GetBasketPrice("", basketId)
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(model.NewMoney(2000, "EUR"), receipt.Total)
+	suite.Equal([]model.AppliedPromotion{{Type: "FREE_ITEMS", Units: 4, Discount: model.NewMoney(2000, "EUR")}}, receipt.Lines[0].Promotions)
+}
+
+func (suite *CheckoutServiceTestSuite) TestGetPriceInBasketCurrency() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasketInCurrency(basketId, "USD")
+	for i := 0; i < 4; i++ {
+		_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")})
+	}
+	promotions := []model.Promotion{model.NewBulkPromotion(map[model.ProductCode][]model.BulkOfferRule{"P1": {{Buy: 3, Price: 900}}})}
+
+	rates, _ := model.NewExchangeRates("EUR", map[model.Currency]string{"USD": "1.0825"})
+	checkoutService := NewCheckoutService(suite.datasourceMock, WithExchangeRates(rates))
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return(promotions)
+
+	// When
+	receipt, err := checkoutService.GetBasketPrice("", basketId)
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(model.NewMoney(1083, "USD"), receipt.Lines[0].Price)
+	suite.Equal(model.NewMoney(4332, "USD"), receipt.Lines[0].Subtotal)
+	suite.Equal([]model.AppliedPromotion{{Type: "BULK", Units: 4, Discount: model.NewMoney(433, "USD")}}, receipt.Lines[0].Promotions)
+	suite.Equal(model.NewMoney(3899, "USD"), receipt.Total)
+}
+
+func (suite *CheckoutServiceTestSuite) TestGetPriceWithTaxes() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	for i := 0; i < 3; i++ {
+		_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")})
+	}
+	_ = basket.AddProduct(model.Product{Code: "P2", Name: "Prod 2", Price: model.NewMoney(550, "EUR"), TaxCategory: "reduced"})
+	promotions := []model.Promotion{model.NewFreeItemsPromotion(map[model.ProductCode][]model.FreeItemsOfferRule{"P1": {{Buy: 3, Free: 1}}})}
+
+	taxes, _ := model.NewTaxRates(map[model.TaxCategory]string{"standard": "21", "reduced": "10"}, model.PerLineRounding)
+	checkoutService := NewCheckoutService(suite.datasourceMock, WithTaxRates(taxes))
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return(promotions)
+
+	// When
+	receipt, err := checkoutService.GetBasketPrice("", basketId)
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(model.NewMoney(2000, "EUR"), receipt.Lines[0].Gross)
+	suite.Equal(model.NewMoney(347, "EUR"), receipt.Lines[0].Tax)
+	suite.Equal(model.NewMoney(1653, "EUR"), receipt.Lines[0].Net)
+	suite.Equal(model.NewMoney(50, "EUR"), receipt.Lines[1].Tax)
+	suite.Equal(model.NewMoney(397, "EUR"), receipt.Tax)
+	suite.Equal(model.NewMoney(2153, "EUR"), receipt.Net)
+	suite.Equal(model.NewMoney(2550, "EUR"), receipt.Total)
+}
+
+func (suite *CheckoutServiceTestSuite) TestCheckout() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewCustomerBasket(basketId, "C1", model.DefaultCurrency)
+	for i := 0; i < 3; i++ {
+		_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")})
+	}
+	_ = basket.AddCoupon("SUMMER")
+	promotions := []model.Promotion{model.NewFreeItemsPromotion(map[model.ProductCode][]model.FreeItemsOfferRule{"P1": {{Buy: 3, Free: 1}}})}
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return(promotions)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddOrder", mock.MatchedBy(func(o model.Order) bool {
+		return o.BasketId == basketId && o.Customer == "C1" && o.Receipt.Total == model.NewMoney(2000, "EUR") &&
+			len(o.Receipt.Lines[0].Promotions) == 1 && len(o.Coupons) == 1 &&
+			o.State == model.OrderPending && o.Payment != ""
+	})).Return(nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetOrder",
+		mock.AnythingOfType("string")).Return(model.Order{State: model.OrderPending}, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("UpdateOrder", mock.MatchedBy(func(o model.Order) bool {
+		return o.State == model.OrderPaid
+	})).Return(nil)
+	// The reserved units are taken out of the stock once sold
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetStock", model.ProductCode("P1")).Return(
+		model.Stock{Code: "P1", Tracked: true, OnHand: 5, Reserved: 3}, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("UpdateStock",
+		model.Stock{Code: "P1", Tracked: true, OnHand: 2, Reserved: 0}).Return(nil)
+
+	// When
+	orderId, err := suite.checkoutService.Checkout("C1", basketId)
+
+	// Then
+	suite.Nil(err)
+	suite.NotEqual("", orderId)
+	suite.Equal(orderId, basket.OrderId())
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertExpectations(suite.T())
+}
+
+func (suite *CheckoutServiceTestSuite) TestCheckoutEmptyBasket() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+
+	// When
+	orderId, err := suite.checkoutService.Checkout("", basketId)
+
+	// Then
+	suite.Equal("", orderId)
+	_, ok := err.(*errors.ValidationError)
+	suite.True(ok, "An empty basket should not be checked out")
+	suite.Equal("", basket.OrderId())
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "AddOrder", mock.Anything)
+}
+
+func (suite *CheckoutServiceTestSuite) TestCheckoutNotPriced() {
+	// Given
+	// No exchange rate to price the basket in its currency
+	basketId := uuid.New().String()
+	basket := model.NewBasketInCurrency(basketId, "USD")
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")})
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return([]model.Promotion{})
+
+	// When
+	orderId, err := suite.checkoutService.Checkout("", basketId)
+
+	// Then
+	suite.Equal("", orderId)
+	suite.NotNil(err)
+	suite.Equal("", basket.OrderId(), "A basket not priced should be unfrozen")
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "AddOrder", mock.Anything)
+}
+
+func (suite *CheckoutServiceTestSuite) TestCheckoutTwice() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")})
+	_ = basket.CheckOut("O1")
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return([]model.Promotion{})
+
+	// When
+	_, err := suite.checkoutService.Checkout("", basketId)
+
+	// Then
+	if checkedOut, ok := err.(*errors.BasketCheckedOut); ok {
+		suite.Equal("O1", checkedOut.OrderId)
+	} else {
+		suite.T().Errorf("Wanted basket checked out error, got %T", err)
+	}
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "AddOrder", mock.Anything)
+}
+
+func (suite *CheckoutServiceTestSuite) TestCheckoutOrderNotStored() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")})
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return([]model.Promotion{})
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddOrder",
+		mock.AnythingOfType("model.Order")).Return(errors.NewPrimaryKeyError("O1"))
+
+	// When
+	orderId, err := suite.checkoutService.Checkout("", basketId)
+
+	// Then
+	suite.Equal("", orderId)
+	suite.NotNil(err)
+	suite.Equal("", basket.OrderId(), "The basket should be unfrozen when the order is not stored")
+}
+
+func (suite *CheckoutServiceTestSuite) TestCheckoutPaymentDeclined() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")})
+	checkoutService := NewCheckoutService(suite.datasourceMock, WithPaymentProvider(payment.NewFakeProvider(payment.Decline)))
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return([]model.Promotion{})
+
+	// When
+	orderId, err := checkoutService.Checkout("", basketId)
+
+	// Then
+	suite.Equal("", orderId)
+	_, ok := err.(*errors.PaymentDeclined)
+	suite.True(ok, "Wanted payment declined error, got %T", err)
+	suite.Equal("", basket.OrderId(), "The basket should be unfrozen when the payment is declined")
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "AddOrder", mock.Anything)
+}
+
+// failOnCapture authorizes every payment but fails capturing them
+type failOnCapture struct {
+	*payment.FakeProvider
+	err error
+}
+
+func (f failOnCapture) Capture(string, model.Money) error {
+	return f.err
+}
+
+// checkoutFailingCapture checks out a basket whose payment fails to be captured with
+// the error, returning the error of the checkout
+func (suite *CheckoutServiceTestSuite) checkoutFailingCapture(captureErr error) error {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")})
+	provider := payment.NewFakeProvider(payment.Succeed)
+	checkoutService := NewCheckoutService(suite.datasourceMock,
+		WithPaymentProvider(failOnCapture{provider, captureErr}))
+
+	var authorization string
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return([]model.Promotion{})
+	suite.datasourceMock.(*mocks.DatasourceMock).On("AddOrder", mock.MatchedBy(func(o model.Order) bool {
+		authorization = o.Payment
+		return true
+	})).Return(nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetOrder",
+		mock.AnythingOfType("string")).Return(model.Order{State: model.OrderPending}, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("UpdateOrder", mock.MatchedBy(func(o model.Order) bool {
+		return o.State == model.OrderCancelled
+	})).Return(nil)
+
+	// When
+	orderId, err := checkoutService.Checkout("", basketId)
+
+	// Then
+	suite.Equal("", orderId)
+	suite.Equal("", basket.OrderId(), "The basket should be unfrozen when the capture fails")
+	// The order is cancelled
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertExpectations(suite.T())
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "UpdateStock", mock.Anything)
+	_, voided := provider.Capture(authorization, model.NewMoney(1000, "EUR")).(*errors.PaymentDeclined)
+	suite.True(voided, "The authorization should be voided")
+
+	return err
+}
+
+func (suite *CheckoutServiceTestSuite) TestCheckoutCaptureDeclined() {
+	err := suite.checkoutFailingCapture(errors.NewPaymentDeclined("O1", "Card declined"))
+
+	_, ok := err.(*errors.PaymentDeclined)
+	suite.True(ok, "Wanted payment declined error, got %T", err)
+}
+
+func (suite *CheckoutServiceTestSuite) TestCheckoutCaptureTimeout() {
+	err := suite.checkoutFailingCapture(errors.NewPaymentTimeout("O1"))
+
+	_, ok := err.(*errors.PaymentTimeout)
+	suite.True(ok, "Wanted payment timeout error, got %T", err)
+}
+
+// paidOrder stores a paid order of the given total, authorized and captured by the
+// provider
+func (suite *CheckoutServiceTestSuite) paidOrder(ds datasource.Datasource, provider payment.PaymentProvider, total model.Money) {
+	authorization, _ := provider.Authorize("O1", total)
+	_ = provider.Capture(authorization, total)
+
+	order := model.NewOrder("O1", "B1", "", nil, model.Receipt{Total: total}, authorization, time.Now())
+	_ = order.Pay(time.Now())
+	suite.Nil(ds.AddOrder(order))
+}
+
+func (suite *CheckoutServiceTestSuite) TestRefund() {
+	// Given
+	ds := suite.memoryDatasource()
+	provider := payment.NewFakeProvider(payment.Succeed)
+	total := model.NewMoney(1000, "EUR")
+	suite.paidOrder(ds, provider, total)
+	checkoutService := NewCheckoutService(ds, WithPaymentProvider(provider))
+
+	// When
+	err := checkoutService.Refund("O1")
+
+	// Then
+	suite.Nil(err)
+	order, _ := ds.GetOrder("O1")
+	suite.Equal(model.OrderRefunded, order.State)
+	suite.NotNil(provider.Refund(order.Payment, total), "The payment should have been refunded")
+}
+
+func (suite *CheckoutServiceTestSuite) TestRefundDeclined() {
+	// Given
+	ds := suite.memoryDatasource()
+	provider := payment.NewFakeProvider(payment.Succeed)
+	total := model.NewMoney(1000, "EUR")
+	suite.paidOrder(ds, provider, total)
+	order, _ := ds.GetOrder("O1")
+	_ = provider.Refund(order.Payment, total)
+	checkoutService := NewCheckoutService(ds, WithPaymentProvider(provider))
+
+	// When
+	err := checkoutService.Refund("O1")
+
+	// Then
+	_, ok := err.(*errors.PaymentDeclined)
+	suite.True(ok, "Wanted payment declined error, got %T", err)
+	// The order is paid again, so the refund can be retried
+	order, _ = ds.GetOrder("O1")
+	suite.Equal(model.OrderPaid, order.State)
+}
+
+// blockingRefunds counts the refunds asked for, holding the first one until
+// released. Every refund succeeds, as a provider not tracking them would do
+type blockingRefunds struct {
+	*payment.FakeProvider
+	refunds  int32
+	started  chan struct{}
+	released chan struct{}
+}
+
+func (b *blockingRefunds) Refund(string, model.Money) error {
+	if atomic.AddInt32(&b.refunds, 1) == 1 {
+		close(b.started)
+		<-b.released
+	}
+
+	return nil
+}
+
+func (suite *CheckoutServiceTestSuite) TestConcurrentRefunds() {
+	// Given
+	ds := suite.memoryDatasource()
+	provider := &blockingRefunds{FakeProvider: payment.NewFakeProvider(payment.Succeed),
+		started: make(chan struct{}), released: make(chan struct{})}
+	suite.paidOrder(ds, provider, model.NewMoney(1000, "EUR"))
+	checkoutService := NewCheckoutService(ds, WithPaymentProvider(provider))
+
+	// When
+	first := make(chan error)
+	go func() {
+		first <- checkoutService.Refund("O1")
+	}()
+	<-provider.started
+
+	err := checkoutService.Refund("O1")
+	close(provider.released)
+
+	// Then
+	if invalid, ok := err.(*errors.OrderStateInvalid); ok {
+		suite.Equal("refunding", invalid.State)
+	} else {
+		suite.T().Errorf("Wanted order state invalid error, got %T", err)
+	}
+	suite.Nil(<-first)
+	suite.Equal(int32(1), atomic.LoadInt32(&provider.refunds))
+	order, _ := ds.GetOrder("O1")
+	suite.Equal(model.OrderRefunded, order.State)
+}
+
+func (suite *CheckoutServiceTestSuite) TestRefundPendingOrder() {
+	// Given
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetOrder", "O1").Return(model.Order{Id: "O1", State: model.OrderPending}, nil)
+
+	// When
+	err := suite.checkoutService.Refund("O1")
+
+	// Then
+	if invalid, ok := err.(*errors.OrderStateInvalid); ok {
+		suite.Equal("pending", invalid.State)
+	} else {
+		suite.T().Errorf("Wanted order state invalid error, got %T", err)
+	}
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "UpdateOrder", mock.Anything)
+}
+
+func (suite *CheckoutServiceTestSuite) TestGetOrders() {
+	// Given
+	orders := []model.Order{{Id: "O3"}, {Id: "O2"}}
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetOrders", 2, 2).Return(orders, 5)
+
+	// When
+	page, total := suite.checkoutService.GetOrders(2, 2)
+
+	// Then
+	suite.Equal(orders, page)
+	suite.Equal(5, total)
+}
+
+func (suite *CheckoutServiceTestSuite) TestGetPriceWithScheduledPromotions() {
+	// Given
+	basketId := uuid.New().String()
+	basket := model.NewBasket(basketId)
+	for i := 0; i < 3; i++ {
+		_ = basket.AddProduct(model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")})
+	}
+	blackFriday := model.NewPercentagePromotion(map[model.ProductCode][]model.PercentageOfferRule{"P1": {{Buy: 1, Percentage: 50}}})
+	blackFriday.Schedule = model.Schedule{
+		ValidFrom:  time.Date(2021, time.November, 26, 0, 0, 0, 0, time.UTC),
+		ValidUntil: time.Date(2021, time.November, 27, 0, 0, 0, 0, time.UTC),
+	}
+	promotions := []model.Promotion{blackFriday}
+
+	clock := time.Date(2021, time.November, 25, 23, 59, 0, 0, time.UTC)
+	checkoutService := NewCheckoutService(suite.datasourceMock, WithClock(func() time.Time { return clock }))
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		mock.AnythingOfType("string")).Return(basket, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetPromotions").Return(promotions)
+
+	// When
+	before, errBefore := checkoutService.GetBasketPrice("", basketId)
+	clock = clock.Add(time.Minute)
+	during, errDuring := checkoutService.GetBasketPrice("", basketId)
+	clock = clock.Add(24 * time.Hour)
+	after, errAfter := checkoutService.GetBasketPrice("", basketId)
+
+	// Then
+	suite.Nil(errBefore)
+	suite.Nil(errDuring)
+	suite.Nil(errAfter)
+	suite.Equal(model.NewMoney(3000, "EUR"), before.Total)
+	suite.Equal(model.NewMoney(1500, "EUR"), during.Total)
+	suite.Equal(model.NewMoney(3000, "EUR"), after.Total)
+}
+
+func (suite *CheckoutServiceTestSuite) TestGetExpiredBasket() {
+	// Given
+	now := time.Now().UTC()
+	basket := model.RestoreBasket(uuid.New().String(), "", model.DefaultCurrency, []model.Line{}, nil, "", now.Add(-2*time.Hour), now.Add(-2*time.Hour))
+	checkoutService := NewCheckoutService(suite.datasourceMock, WithBasketTTL(time.Hour))
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basket.Id).Return(basket, nil)
+
+	// When
+	_, err := checkoutService.GetBasket("", basket.Id)
+
+	// Then
+	if basketExpired, ok := err.(*errors.BasketExpired); ok {
+		suite.Equal(basket.Id, basketExpired.Id)
+	} else {
+		suite.T().Errorf("Wanted basket expired error, got %T", err)
+	}
+}
+
+func (suite *CheckoutServiceTestSuite) TestAddProductToExpiredBasket() {
+	// Given
+	now := time.Now().UTC()
+	basket := model.RestoreBasket(uuid.New().String(), "", model.DefaultCurrency, []model.Line{}, nil, "", now.Add(-2*time.Hour), now.Add(-2*time.Hour))
+	product := model.Product{Code: "P1", Name: "Prod 1", Price: model.NewMoney(1000, "EUR")}
+	checkoutService := NewCheckoutService(suite.datasourceMock, WithBasketTTL(time.Hour))
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetProduct", product.Code).Return(product, nil)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket", basket.Id).Return(basket, nil)
+
+	// When
+	err := checkoutService.AddProduct("", basket.Id, product.Code)
+
+	// Then
+	if _, ok := err.(*errors.BasketExpired); !ok {
+		suite.T().Errorf("Wanted basket expired error, got %T", err)
+	}
+	suite.Equal(0, len(basket.Lines()))
+}
+
+func (suite *CheckoutServiceTestSuite) TestDeleteExpiredBaskets() {
+	// Given
+	now := time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC)
+	clock := now
+	basketId := uuid.New().String()
+	checkoutService := NewCheckoutService(suite.datasourceMock, WithBasketTTL(time.Hour),
+		WithClock(func() time.Time { return clock }))
+
+	suite.datasourceMock.(*mocks.DatasourceMock).On("DeleteBasketsUpdatedBefore",
+		now.Add(-time.Hour)).Return([]*model.Basket{model.NewBasket(basketId)})
+	suite.datasourceMock.(*mocks.DatasourceMock).On("GetBasket",
+		basketId).Return(new(model.Basket), errors.NewBasketNotFound(basketId))
+
+	// When
+	evicted := checkoutService.DeleteExpiredBaskets()
+
+	// Then
+	suite.Equal(1, evicted)
+
+	// Evicted baskets are reported as expired for another ttl
+	_, err := checkoutService.GetBasket("", basketId)
+	if _, ok := err.(*errors.BasketExpired); !ok {
+		suite.T().Errorf("Wanted basket expired error, got %T", err)
+	}
+
+	clock = now.Add(2*time.Hour + time.Second)
+	suite.datasourceMock.(*mocks.DatasourceMock).On("DeleteBasketsUpdatedBefore",
+		clock.Add(-time.Hour)).Return([]*model.Basket{})
+	checkoutService.DeleteExpiredBaskets()
+
+	_, err = checkoutService.GetBasket("", basketId)
+	if _, ok := err.(*errors.BasketNotFound); !ok {
+		suite.T().Errorf("Wanted basket not found error, got %T", err)
+	}
+}
+
+func (suite *CheckoutServiceTestSuite) TestDeleteExpiredBasketsWithoutTTL() {
+	// When
+	evicted := suite.checkoutService.DeleteExpiredBaskets()
+
+	// Then
+	suite.Equal(0, evicted)
+	suite.datasourceMock.(*mocks.DatasourceMock).AssertNotCalled(suite.T(), "DeleteBasketsUpdatedBefore", mock.Anything)
 }
@@ -8,27 +8,198 @@ import (
 	"github.com/alfcope/checkouttest/api/requests"
 	"github.com/alfcope/checkouttest/api/responses"
 	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/pkg/auth"
+	"github.com/alfcope/checkouttest/pkg/idempotency"
+	"github.com/google/uuid"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
+const (
+	// defaultRetries of the requests rejected for exceeding the rate limit, or failed
+	// by the network
+	defaultRetries = 3
+	// maxRetryWait is the longest the client waits to retry a request
+	maxRetryWait = time.Minute
+	// retryBackoff is the wait before the first retry of a network failure, doubled
+	// after every attempt
+	retryBackoff = 500 * time.Millisecond
+)
+
 type CheckoutClient struct {
 	serverUrl  string
 	apiVersion int
 	httpClient *http.Client
+
+	// Credentials sent with every request, if any
+	credentialsHeader string
+	credentials       string
+
+	// Retries of the requests rejected with 429, after the wait told by the server,
+	// and of the idempotent requests failed by the network
+	retries int
+	sleep   func(time.Duration)
+}
+
+// ClientOption configures a CheckoutClient
+type ClientOption func(*CheckoutClient)
+
+// WithBearerToken authenticates the requests with a signed token
+func WithBearerToken(token string) ClientOption {
+	return func(c *CheckoutClient) {
+		c.credentialsHeader = "Authorization"
+		c.credentials = "Bearer " + token
+	}
+}
+
+// WithApiKey authenticates the requests with a static api key
+func WithApiKey(key string) ClientOption {
+	return func(c *CheckoutClient) {
+		c.credentialsHeader = auth.ApiKeyHeader
+		c.credentials = key
+	}
 }
 
-func NewCheckoutClient(serverUrl string, version int) *CheckoutClient {
-	return &CheckoutClient{
+// WithRetries sets how many times the requests rejected for exceeding the rate
+// limit, or failed by the network, are retried. Zero disables retrying them
+func WithRetries(retries int) ClientOption {
+	return func(c *CheckoutClient) {
+		c.retries = retries
+	}
+}
+
+func NewCheckoutClient(serverUrl string, version int, options ...ClientOption) *CheckoutClient {
+	client := &CheckoutClient{
 		serverUrl:  serverUrl,
 		apiVersion: version,
 		httpClient: &http.Client{
 			Timeout: time.Second * 5,
 		},
+		retries: defaultRetries,
+		sleep:   time.Sleep,
+	}
+
+	for _, option := range options {
+		option(client)
+	}
+
+	return client
+}
+
+// do sends the request along with the credentials of the client. Requests rejected
+// for exceeding the rate limit are sent again once the wait told by the server is over.
+// Requests the server deduplicates, those with an idempotency key, and reads are also
+// sent again when the network fails
+func (c *CheckoutClient) do(req *http.Request) (*http.Response, error) {
+	if c.credentials != "" {
+		req.Header.Set(c.credentialsHeader, c.credentials)
 	}
+
+	idempotent := req.Method == "GET" || req.Header.Get(idempotency.KeyHeader) != ""
+	rewindable := req.Body == nil || req.GetBody != nil
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.httpClient.Do(req)
+		if attempt >= c.retries || !rewindable {
+			return resp, err
+		}
+
+		var wait time.Duration
+		if err != nil {
+			// The request may have been processed before the network failed
+			if !idempotent {
+				return nil, err
+			}
+			wait = retryBackoff << uint(attempt)
+		} else {
+			// Duplicates of a request still in progress are rejected until it is done
+			inProgress := idempotent && resp.StatusCode == http.StatusConflict && resp.Header.Get("Retry-After") != ""
+			if resp.StatusCode != http.StatusTooManyRequests && !inProgress {
+				return resp, nil
+			}
+
+			var ok bool
+			if wait, ok = retryAfter(resp.Header.Get("Retry-After"), time.Now()); !ok || wait > maxRetryWait {
+				return resp, nil
+			}
+			resp.Body.Close()
+		}
+
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+
+		c.sleep(wait)
+	}
+}
+
+// setIdempotencyKey identifies a request and its retries, so the server adds only once
+// what the request adds
+func setIdempotencyKey(req *http.Request) {
+	req.Header.Set(idempotency.KeyHeader, uuid.New().String())
+}
+
+// retryAfter reads the wait of a Retry-After header, given in seconds or as a date
+func retryAfter(header string, now time.Time) (time.Duration, bool) {
+	if seconds, err := strconv.Atoi(strings.TrimSpace(header)); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(header)
+	if err != nil {
+		return 0, false
+	}
+	if wait := date.Sub(now); wait > 0 {
+		return wait, true
+	}
+
+	return 0, true
+}
+
+func (c *CheckoutClient) GetProducts() ([]model.Product, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v%d/products/", c.serverUrl, c.apiVersion), nil)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error creating http request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+
+	if resp.Body != nil {
+		responseBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching response body: %v", err)
+		}
+
+		var products []model.Product
+		err = json.Unmarshal(responseBody, &products)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching response body: %v", err)
+		}
+
+		return products, nil
+	}
+
+	return nil, errors.New("empty response")
 }
 
 func (c *CheckoutClient) AddBasket() (string, error) {
@@ -37,8 +208,9 @@ func (c *CheckoutClient) AddBasket() (string, error) {
 		return "", fmt.Errorf("there was an error creating http request: %v", err)
 	}
 	req.Header.Set("Accept", "application/json")
+	setIdempotencyKey(req)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return "", err
 	}
@@ -67,6 +239,45 @@ func (c *CheckoutClient) AddBasket() (string, error) {
 	return "", errors.New("empty response")
 }
 
+func (c *CheckoutClient) GetBasket(basketId string) (*responses.BasketContentResponse, error) {
+	if strings.TrimSpace(basketId) == "" {
+		return nil, errors.New("invalid request")
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v%d/baskets/%s", c.serverUrl, c.apiVersion, strings.TrimSpace(basketId)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error creating http request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+
+	if resp.Body != nil {
+		responseBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching response body: %v", err)
+		}
+
+		br := responses.BasketContentResponse{}
+		err = json.Unmarshal(responseBody, &br)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching response body: %v", err)
+		}
+
+		return &br, nil
+	}
+
+	return nil, errors.New("empty response")
+}
+
 func (c *CheckoutClient) AddItem(basketId, productCode string) error {
 	if strings.TrimSpace(basketId) == "" || strings.TrimSpace(productCode) == "" {
 		return errors.New("invalid request")
@@ -82,8 +293,53 @@ func (c *CheckoutClient) AddItem(basketId, productCode string) error {
 		return fmt.Errorf("there was an error creating http request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	setIdempotencyKey(req)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("%s", resp.Status)
+	}
+
+	return nil
+}
+
+// AddItems adds several units of different products in a single request.
+// Items is a map of product codes to the number of units to add
+func (c *CheckoutClient) AddItems(basketId string, items map[string]int) error {
+	if strings.TrimSpace(basketId) == "" || len(items) == 0 {
+		return errors.New("invalid request")
+	}
+
+	codes := make([]string, 0, len(items))
+	for code := range items {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	ir := make(requests.AddItemsRequest, 0, len(items))
+	for _, code := range codes {
+		if strings.TrimSpace(code) == "" || items[code] <= 0 {
+			return errors.New("invalid request")
+		}
+		ir = append(ir, requests.AddItemsRequestItem{Code: model.ProductCode(strings.TrimSpace(code)), Quantity: items[code]})
+	}
+
+	jsonRequest, err := json.Marshal(ir)
+	if err != nil {
+		return fmt.Errorf("there was an error creating http request: %v", err)
+	}
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/v%d/baskets/%s/items/batch", c.serverUrl, c.apiVersion, strings.TrimSpace(basketId)), bytes.NewBuffer(jsonRequest))
+	if err != nil {
+		return fmt.Errorf("there was an error creating http request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
@@ -96,43 +352,307 @@ func (c *CheckoutClient) AddItem(basketId, productCode string) error {
 	return nil
 }
 
-func (c *CheckoutClient) GetPrice(basketId string) (float64, error) {
+func (c *CheckoutClient) SetItemQuantity(basketId, productCode string, quantity int) error {
+	if strings.TrimSpace(basketId) == "" || strings.TrimSpace(productCode) == "" || quantity < 0 {
+		return errors.New("invalid request")
+	}
+
+	sr := requests.SetItemQuantityRequest{Quantity: &quantity}
+	jsonRequest, err := json.Marshal(sr)
+	if err != nil {
+		return fmt.Errorf("there was an error creating http request: %v", err)
+	}
+	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/api/v%d/baskets/%s/items/%s", c.serverUrl, c.apiVersion,
+		strings.TrimSpace(basketId), url.PathEscape(strings.TrimSpace(productCode))), bytes.NewBuffer(jsonRequest))
+	if err != nil {
+		return fmt.Errorf("there was an error creating http request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("%s", resp.Status)
+	}
+
+	return nil
+}
+
+func (c *CheckoutClient) RemoveItem(basketId, productCode string) error {
+	if strings.TrimSpace(basketId) == "" || strings.TrimSpace(productCode) == "" {
+		return errors.New("invalid request")
+	}
+
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/api/v%d/baskets/%s/items/%s", c.serverUrl, c.apiVersion,
+		strings.TrimSpace(basketId), url.PathEscape(strings.TrimSpace(productCode))), nil)
+	if err != nil {
+		return fmt.Errorf("there was an error creating http request: %v", err)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("%s", resp.Status)
+	}
+
+	return nil
+}
+
+// ApplyCoupon applies a coupon code to a basket
+func (c *CheckoutClient) ApplyCoupon(basketId, couponCode string) error {
+	if strings.TrimSpace(basketId) == "" || strings.TrimSpace(couponCode) == "" {
+		return errors.New("invalid request")
+	}
+
+	cr := requests.ApplyCouponRequest{Code: strings.TrimSpace(couponCode)}
+	jsonRequest, err := json.Marshal(cr)
+	if err != nil {
+		return fmt.Errorf("there was an error creating http request: %v", err)
+	}
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/v%d/baskets/%s/coupons/", c.serverUrl, c.apiVersion, strings.TrimSpace(basketId)), bytes.NewBuffer(jsonRequest))
+	if err != nil {
+		return fmt.Errorf("there was an error creating http request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("%s", resp.Status)
+	}
+
+	return nil
+}
+
+func (c *CheckoutClient) RemoveCoupon(basketId, couponCode string) error {
+	if strings.TrimSpace(basketId) == "" || strings.TrimSpace(couponCode) == "" {
+		return errors.New("invalid request")
+	}
+
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/api/v%d/baskets/%s/coupons/%s", c.serverUrl, c.apiVersion,
+		strings.TrimSpace(basketId), url.PathEscape(strings.TrimSpace(couponCode))), nil)
+	if err != nil {
+		return fmt.Errorf("there was an error creating http request: %v", err)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("%s", resp.Status)
+	}
+
+	return nil
+}
+
+func (c *CheckoutClient) GetPrice(basketId string) (model.Money, error) {
 	if strings.TrimSpace(basketId) == "" {
-		return float64(-1), errors.New("invalid request")
+		return model.Money{}, errors.New("invalid request")
 	}
 
 	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v%d/baskets/%s?price", c.serverUrl, c.apiVersion, strings.TrimSpace(basketId)), nil)
 	if err != nil {
-		return float64(-1), fmt.Errorf("there was an error creating http request: %v", err)
+		return model.Money{}, fmt.Errorf("there was an error creating http request: %v", err)
 	}
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return float64(-1), err
+		return model.Money{}, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return float64(-1), fmt.Errorf("%s", resp.Status)
+		return model.Money{}, fmt.Errorf("%s", resp.Status)
 	}
 
 	if resp.Body != nil {
 		responseBody, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			return float64(-1), fmt.Errorf("error fetching response body: %v", err)
+			return model.Money{}, fmt.Errorf("error fetching response body: %v", err)
 		}
 
 		pb := responses.PriceBasketResponse{}
 		err = json.Unmarshal(responseBody, &pb)
 		if err != nil {
-			return float64(-1), fmt.Errorf("error fetching response body: %v", err)
+			return model.Money{}, fmt.Errorf("error fetching response body: %v", err)
+		}
+
+		return model.ParseMoney(pb.Total, pb.Currency)
+	}
+
+	return model.Money{}, errors.New("empty response")
+}
+
+func (c *CheckoutClient) GetReceipt(basketId string) (*responses.ReceiptResponse, error) {
+	if strings.TrimSpace(basketId) == "" {
+		return nil, errors.New("invalid request")
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v%d/baskets/%s/receipt", c.serverUrl, c.apiVersion, strings.TrimSpace(basketId)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error creating http request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+
+	if resp.Body != nil {
+		responseBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching response body: %v", err)
+		}
+
+		rb := responses.ReceiptResponse{}
+		err = json.Unmarshal(responseBody, &rb)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching response body: %v", err)
+		}
+
+		return &rb, nil
+	}
+
+	return nil, errors.New("empty response")
+}
+
+func (c *CheckoutClient) Checkout(basketId string) (string, error) {
+	if strings.TrimSpace(basketId) == "" {
+		return "", errors.New("invalid request")
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/v%d/baskets/%s/checkout", c.serverUrl, c.apiVersion, strings.TrimSpace(basketId)), nil)
+	if err != nil {
+		return "", fmt.Errorf("there was an error creating http request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("%s", resp.Status)
+	}
+
+	if resp.Body != nil {
+		responseBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return "", fmt.Errorf("error fetching response body: %v", err)
+		}
+
+		cr := responses.CheckoutResponse{}
+		err = json.Unmarshal(responseBody, &cr)
+		if err != nil {
+			return "", fmt.Errorf("error fetching response body: %v", err)
+		}
+
+		return cr.Id, nil
+	}
+
+	return "", errors.New("empty response")
+}
+
+func (c *CheckoutClient) GetOrder(orderId string) (*responses.OrderResponse, error) {
+	if strings.TrimSpace(orderId) == "" {
+		return nil, errors.New("invalid request")
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v%d/orders/%s", c.serverUrl, c.apiVersion, strings.TrimSpace(orderId)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error creating http request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+
+	if resp.Body != nil {
+		responseBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching response body: %v", err)
+		}
+
+		or := responses.OrderResponse{}
+		err = json.Unmarshal(responseBody, &or)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching response body: %v", err)
+		}
+
+		return &or, nil
+	}
+
+	return nil, errors.New("empty response")
+}
+
+func (c *CheckoutClient) RefundOrder(orderId string) (*responses.OrderResponse, error) {
+	if strings.TrimSpace(orderId) == "" {
+		return nil, errors.New("invalid request")
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/v%d/orders/%s/refund", c.serverUrl, c.apiVersion, strings.TrimSpace(orderId)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("there was an error creating http request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+
+	if resp.Body != nil {
+		responseBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching response body: %v", err)
+		}
+
+		or := responses.OrderResponse{}
+		err = json.Unmarshal(responseBody, &or)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching response body: %v", err)
 		}
 
-		return pb.Total, nil
+		return &or, nil
 	}
 
-	return float64(0), errors.New("empty response")
+	return nil, errors.New("empty response")
 }
 
 func (c *CheckoutClient) DeleteBasket(basketId string) error {
@@ -145,7 +665,7 @@ func (c *CheckoutClient) DeleteBasket(basketId string) error {
 		return fmt.Errorf("there was an error creating http request: %v", err)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
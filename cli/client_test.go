@@ -5,10 +5,14 @@ import (
 	"github.com/alfcope/checkouttest/api/responses"
 	"github.com/alfcope/checkouttest/errors"
 	"github.com/alfcope/checkouttest/internal/tests/mocks"
+	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/pkg/auth"
+	"github.com/alfcope/checkouttest/pkg/idempotency"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/suite"
 	"net/http"
 	"testing"
+	"time"
 )
 
 type CheckoutClientTestSuite struct {
@@ -31,6 +35,162 @@ func (suite *CheckoutClientTestSuite) TearDownTest() {
 	suite.server.StubResponse(0, nil)
 }
 
+func (suite *CheckoutClientTestSuite) TestGetProducts() {
+	// Given
+	products := []model.Product{{Code: "MUG", Name: "Mug", Price: model.NewMoney(750, "EUR")}, {Code: "TSHIRT", Name: "T-Shirt", Price: model.NewMoney(2000, "EUR")}}
+	suite.server.StubResponse(http.StatusOK, products)
+
+	// When
+	response, err := suite.client.GetProducts()
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(products, response)
+}
+
+func (suite *CheckoutClientTestSuite) TestCredentials() {
+	// Given
+	suite.server.StubResponse(http.StatusOK, []model.Product{})
+	anonymous := NewCheckoutClient(suite.server.GetUrl(), 1)
+	withToken := NewCheckoutClient(suite.server.GetUrl(), 1, WithBearerToken("token"))
+	withApiKey := NewCheckoutClient(suite.server.GetUrl(), 1, WithApiKey("key"))
+
+	// When
+	_, _ = anonymous.GetProducts()
+	anonymousAuthorization := suite.server.RequestHeader("Authorization")
+	_, _ = withToken.GetProducts()
+	tokenAuthorization := suite.server.RequestHeader("Authorization")
+	_, _ = withApiKey.GetProducts()
+
+	// Then
+	suite.Equal("", anonymousAuthorization)
+	suite.Equal("Bearer token", tokenAuthorization)
+	suite.Equal("key", suite.server.RequestHeader(auth.ApiKeyHeader))
+}
+
+func (suite *CheckoutClientTestSuite) TestRetryRateLimited() {
+	// Given
+	var waits []time.Duration
+	client := NewCheckoutClient(suite.server.GetUrl(), 1, WithApiKey("key"))
+	client.sleep = func(wait time.Duration) { waits = append(waits, wait) }
+	suite.server.StubResponse(http.StatusCreated, nil)
+	suite.server.StubThrottled(2, "3")
+
+	// When
+	err := client.AddItem("B1", "VOUCHER")
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(3, suite.server.Requests())
+	suite.Equal([]time.Duration{3 * time.Second, 3 * time.Second}, waits)
+	suite.Equal("key", suite.server.RequestHeader(auth.ApiKeyHeader))
+}
+
+func (suite *CheckoutClientTestSuite) TestRetriesExhausted() {
+	// Given
+	client := NewCheckoutClient(suite.server.GetUrl(), 1, WithRetries(1))
+	client.sleep = func(time.Duration) {}
+	suite.server.StubResponse(http.StatusOK, []model.Product{})
+	suite.server.StubThrottled(2, "1")
+
+	// When
+	_, err := client.GetProducts()
+
+	// Then
+	suite.Equal(2, suite.server.Requests())
+	suite.Equal(fmt.Sprintf("%d %s", http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests)), err.Error())
+}
+
+// droppingTransport sends the requests to the server, failing the first ones as if
+// the network dropped before the response arrived
+type droppingTransport struct {
+	drops int
+	keys  []string
+}
+
+func (t *droppingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.keys = append(t.keys, req.Header.Get(idempotency.KeyHeader))
+
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err == nil && t.drops > 0 {
+		t.drops--
+		resp.Body.Close()
+		return nil, fmt.Errorf("connection reset by peer")
+	}
+
+	return resp, err
+}
+
+func (suite *CheckoutClientTestSuite) TestRetryNetworkFailureWithSameKey() {
+	// Given
+	transport := &droppingTransport{drops: 1}
+	client := NewCheckoutClient(suite.server.GetUrl(), 1)
+	client.httpClient.Transport = transport
+	client.sleep = func(time.Duration) {}
+	suite.server.StubResponse(http.StatusCreated, nil)
+	suite.server.StubThrottled(0, "")
+
+	// When
+	err := client.AddItem("B1", "VOUCHER")
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(2, suite.server.Requests())
+	suite.Len(transport.keys, 2)
+	suite.NotEqual("", transport.keys[0])
+	suite.Equal(transport.keys[0], transport.keys[1])
+}
+
+func (suite *CheckoutClientTestSuite) TestNoRetryNetworkFailureWithoutKey() {
+	// Given
+	transport := &droppingTransport{drops: 1}
+	client := NewCheckoutClient(suite.server.GetUrl(), 1)
+	client.httpClient.Transport = transport
+	client.sleep = func(time.Duration) {}
+	suite.server.StubResponse(http.StatusCreated, nil)
+	suite.server.StubThrottled(0, "")
+
+	// When
+	err := client.ApplyCoupon("B1", "PROMO")
+
+	// Then
+	suite.NotNil(err)
+	suite.Equal(1, suite.server.Requests())
+}
+
+func (suite *CheckoutClientTestSuite) TestNewKeyPerBasket() {
+	// Given
+	client := NewCheckoutClient(suite.server.GetUrl(), 1)
+	suite.server.StubResponse(http.StatusCreated, responses.NewBasketResponse{Id: "B1"})
+	suite.server.StubThrottled(0, "")
+	first, _ := client.AddBasket()
+	firstKey := suite.server.RequestHeader(idempotency.KeyHeader)
+
+	// When
+	second, _ := client.AddBasket()
+
+	// Then
+	suite.Equal("B1", first)
+	suite.Equal("B1", second)
+	suite.NotEqual("", firstKey)
+	suite.NotEqual(firstKey, suite.server.RequestHeader(idempotency.KeyHeader))
+}
+
+func (suite *CheckoutClientTestSuite) TestRetryAfter() {
+	now := time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	wait, ok := retryAfter("120", now)
+	suite.True(ok)
+	suite.Equal(2*time.Minute, wait)
+
+	wait, ok = retryAfter(now.Add(time.Minute).Format(http.TimeFormat), now)
+	suite.True(ok)
+	suite.Equal(time.Minute, wait)
+
+	_, ok = retryAfter("soon", now)
+	suite.False(ok)
+}
+
 func (suite *CheckoutClientTestSuite) TestCreateBasketDuplicatedId() {
 	// Given
 	suite.server.StubResponse(responses.GetStatusByError(errors.NewPrimaryKeyError(uuid.New().String())), nil)
@@ -56,6 +216,40 @@ func (suite *CheckoutClientTestSuite) TestCreateBasket() {
 	suite.Equal(basketId, idResponse)
 }
 
+func (suite *CheckoutClientTestSuite) TestGetBasketNotFoundError() {
+	// Given
+	suite.server.StubResponse(http.StatusNotFound, nil)
+
+	// When
+	basket, err := suite.client.GetBasket(uuid.New().String())
+
+	// Then
+	suite.Nil(basket)
+	suite.EqualError(err, fmt.Sprintf("%d %s", http.StatusNotFound, http.StatusText(http.StatusNotFound)))
+}
+
+func (suite *CheckoutClientTestSuite) TestGetBasket() {
+	// Given
+	now := time.Now().UTC()
+	expected := responses.BasketContentResponse{
+		Id:        uuid.New().String(),
+		Lines:     []responses.BasketLineResponse{{Code: "MUG", Name: "Mug", UnitPrice: "7.50", Currency: "EUR", Quantity: 2}},
+		CreatedAt: now.Add(-time.Minute),
+		UpdatedAt: now,
+	}
+	suite.server.StubResponse(http.StatusOK, expected)
+
+	// When
+	basket, err := suite.client.GetBasket(expected.Id)
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(expected.Id, basket.Id)
+	suite.Equal(expected.Lines, basket.Lines)
+	suite.True(expected.CreatedAt.Equal(basket.CreatedAt))
+	suite.True(expected.UpdatedAt.Equal(basket.UpdatedAt))
+}
+
 func (suite *CheckoutClientTestSuite) TestAddItemBasketEmptyBasketId() {
 	// Given
 	basketId := "    "
@@ -106,6 +300,134 @@ func (suite *CheckoutClientTestSuite) TestAddItemBasket() {
 	suite.Nil(err)
 }
 
+func (suite *CheckoutClientTestSuite) TestAddItemsInvalidQuantity() {
+	// When
+	err := suite.client.AddItems(uuid.New().String(), map[string]int{"TSHIRT": 2, "MUG": 0})
+
+	// Then
+	suite.EqualError(err, "invalid request")
+}
+
+func (suite *CheckoutClientTestSuite) TestAddItemsNotFoundError() {
+	// Given
+	suite.server.StubResponse(http.StatusNotFound, nil)
+
+	// When
+	err := suite.client.AddItems(uuid.New().String(), map[string]int{"TSHIRT": 2, "FAKE": 1})
+
+	// Then
+	suite.EqualError(err, fmt.Sprintf("%d %s", http.StatusNotFound, http.StatusText(http.StatusNotFound)))
+}
+
+func (suite *CheckoutClientTestSuite) TestAddItems() {
+	// Given
+	suite.server.StubResponse(http.StatusCreated, nil)
+
+	// When
+	err := suite.client.AddItems(uuid.New().String(), map[string]int{"TSHIRT": 2, "VOUCHER": 10})
+
+	// Then
+	suite.Nil(err)
+}
+
+func (suite *CheckoutClientTestSuite) TestSetItemQuantityInvalidQuantity() {
+	// When
+	err := suite.client.SetItemQuantity(uuid.New().String(), "TSHIRT", -1)
+
+	// Then
+	suite.EqualError(err, "invalid request")
+}
+
+func (suite *CheckoutClientTestSuite) TestSetItemQuantityNotFoundError() {
+	// Given
+	suite.server.StubResponse(http.StatusNotFound, nil)
+
+	// When
+	err := suite.client.SetItemQuantity(uuid.New().String(), "TSHIRT", 2)
+
+	// Then
+	suite.EqualError(err, fmt.Sprintf("%d %s", http.StatusNotFound, http.StatusText(http.StatusNotFound)))
+}
+
+func (suite *CheckoutClientTestSuite) TestSetItemQuantity() {
+	// Given
+	suite.server.StubResponse(http.StatusNoContent, nil)
+
+	// When
+	err := suite.client.SetItemQuantity(uuid.New().String(), "TSHIRT", 2)
+
+	// Then
+	suite.Nil(err)
+}
+
+func (suite *CheckoutClientTestSuite) TestRemoveItemEmptyProductCode() {
+	// When
+	err := suite.client.RemoveItem(uuid.New().String(), " ")
+
+	// Then
+	suite.EqualError(err, "invalid request")
+}
+
+func (suite *CheckoutClientTestSuite) TestRemoveItem() {
+	// Given
+	suite.server.StubResponse(http.StatusNoContent, nil)
+
+	// When
+	err := suite.client.RemoveItem(uuid.New().String(), "TSHIRT")
+
+	// Then
+	suite.Nil(err)
+}
+
+func (suite *CheckoutClientTestSuite) TestApplyCouponEmptyCode() {
+	// When
+	err := suite.client.ApplyCoupon(uuid.New().String(), " ")
+
+	// Then
+	suite.EqualError(err, "invalid request")
+}
+
+func (suite *CheckoutClientTestSuite) TestApplyCouponExhaustedError() {
+	// Given
+	suite.server.StubResponse(http.StatusConflict, nil)
+
+	// When
+	err := suite.client.ApplyCoupon(uuid.New().String(), "SUMMER")
+
+	// Then
+	suite.EqualError(err, fmt.Sprintf("%d %s", http.StatusConflict, http.StatusText(http.StatusConflict)))
+}
+
+func (suite *CheckoutClientTestSuite) TestApplyCoupon() {
+	// Given
+	suite.server.StubResponse(http.StatusCreated, nil)
+
+	// When
+	err := suite.client.ApplyCoupon(uuid.New().String(), "SUMMER")
+
+	// Then
+	suite.Nil(err)
+}
+
+func (suite *CheckoutClientTestSuite) TestRemoveCouponEmptyCode() {
+	// When
+	err := suite.client.RemoveCoupon(uuid.New().String(), " ")
+
+	// Then
+	suite.EqualError(err, "invalid request")
+}
+
+func (suite *CheckoutClientTestSuite) TestRemoveCoupon() {
+	// Given
+	suite.server.StubResponse(http.StatusNoContent, nil)
+
+	// When
+	err := suite.client.RemoveCoupon(uuid.New().String(), "SUMMER")
+
+	// Then
+	suite.Nil(err)
+}
+
 func (suite *CheckoutClientTestSuite) TestGetBasketPriceNotFoundError() {
 	// Given
 	suite.server.StubResponse(http.StatusNotFound, nil)
@@ -114,21 +436,129 @@ func (suite *CheckoutClientTestSuite) TestGetBasketPriceNotFoundError() {
 	price, err := suite.client.GetPrice(uuid.New().String())
 
 	// Then
-	suite.Equal(float64(-1), price)
+	suite.Equal(model.Money{}, price)
 	suite.NotNil(err)
 	suite.EqualError(err, fmt.Sprintf("%d %s", http.StatusNotFound, http.StatusText(http.StatusNotFound)))
 }
 
 func (suite *CheckoutClientTestSuite) TestGetBasketPrice() {
 	// Given
-	suite.server.StubResponse(http.StatusOK, responses.PriceBasketResponse{Total: float64(6580) / 100})
+	suite.server.StubResponse(http.StatusOK, responses.PriceBasketResponse{Total: "65.80", Currency: "EUR"})
 
 	// When
 	price, err := suite.client.GetPrice(uuid.New().String())
 
 	// Then
 	suite.Nil(err)
-	suite.Equal(float64(6580)/100, price)
+	suite.Equal(model.NewMoney(6580, "EUR"), price)
+}
+
+func (suite *CheckoutClientTestSuite) TestGetBasketReceiptNotFoundError() {
+	// Given
+	suite.server.StubResponse(http.StatusNotFound, nil)
+
+	// When
+	receipt, err := suite.client.GetReceipt(uuid.New().String())
+
+	// Then
+	suite.Nil(receipt)
+	suite.EqualError(err, fmt.Sprintf("%d %s", http.StatusNotFound, http.StatusText(http.StatusNotFound)))
+}
+
+func (suite *CheckoutClientTestSuite) TestGetBasketReceipt() {
+	// Given
+	expected := responses.ReceiptResponse{
+		Currency: "EUR",
+		Lines: []responses.ReceiptLineResponse{{Code: "VOUCHER", Name: "Voucher", Quantity: 3, UnitPrice: "5.00",
+			Subtotal: "15.00", Promotions: []responses.AppliedPromotionResponse{{Type: "FREE_ITEMS", Units: 2, Discount: "5.00"}}, Total: "10.00"}},
+		Subtotal:  "10.00",
+		Discounts: []responses.AppliedDiscountResponse{},
+		Total:     "10.00",
+	}
+	suite.server.StubResponse(http.StatusOK, expected)
+
+	// When
+	receipt, err := suite.client.GetReceipt(uuid.New().String())
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(expected, *receipt)
+}
+
+func (suite *CheckoutClientTestSuite) TestCheckoutConflictError() {
+	// Given
+	suite.server.StubResponse(http.StatusConflict, nil)
+
+	// When
+	orderId, err := suite.client.Checkout(uuid.New().String())
+
+	// Then
+	suite.Equal("", orderId)
+	suite.EqualError(err, fmt.Sprintf("%d %s", http.StatusConflict, http.StatusText(http.StatusConflict)))
+}
+
+func (suite *CheckoutClientTestSuite) TestCheckout() {
+	// Given
+	orderId := uuid.New().String()
+	suite.server.StubResponse(http.StatusCreated, responses.CheckoutResponse{Id: orderId})
+
+	// When
+	id, err := suite.client.Checkout(uuid.New().String())
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(orderId, id)
+}
+
+func (suite *CheckoutClientTestSuite) TestGetOrder() {
+	// Given
+	expected := responses.OrderResponse{
+		Id:       uuid.New().String(),
+		BasketId: uuid.New().String(),
+		Coupons:  []string{},
+		Receipt: responses.ReceiptResponse{
+			Currency:  "EUR",
+			Lines:     []responses.ReceiptLineResponse{},
+			Subtotal:  "0.00",
+			Discounts: []responses.AppliedDiscountResponse{},
+			Total:     "0.00",
+		},
+		CreatedAt: time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC),
+	}
+	suite.server.StubResponse(http.StatusOK, expected)
+
+	// When
+	order, err := suite.client.GetOrder(expected.Id)
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(expected, *order)
+}
+
+func (suite *CheckoutClientTestSuite) TestRefundOrderConflictError() {
+	// Given
+	suite.server.StubResponse(http.StatusConflict, nil)
+
+	// When
+	order, err := suite.client.RefundOrder(uuid.New().String())
+
+	// Then
+	suite.Nil(order)
+	suite.EqualError(err, fmt.Sprintf("%d %s", http.StatusConflict, http.StatusText(http.StatusConflict)))
+}
+
+func (suite *CheckoutClientTestSuite) TestRefundOrder() {
+	// Given
+	orderId := uuid.New().String()
+	suite.server.StubResponse(http.StatusOK, responses.OrderResponse{Id: orderId, State: model.OrderRefunded})
+
+	// When
+	order, err := suite.client.RefundOrder(orderId)
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(orderId, order.Id)
+	suite.Equal(model.OrderRefunded, order.State)
 }
 
 func (suite *CheckoutClientTestSuite) TestDeleteBasketNotFoundError() {
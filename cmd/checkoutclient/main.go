@@ -1,15 +1,15 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/alfcope/checkouttest/cli"
-	"github.com/alfcope/checkouttest/model"
 	"github.com/chzyer/readline"
 	"github.com/manifoldco/promptui"
-	"io/ioutil"
 	"os"
+	"strconv"
+	"time"
 )
 
 // https://github.com/manifoldco/promptui/issues/49
@@ -42,9 +42,13 @@ type RequestType int
 const (
 	GoBack RequestType = iota
 	AddBasket
+	ShowBasket
 	AddProduct
+	SetProductQuantity
+	RemoveProduct
 	GetPrice
 	DeleteBasket
+	CheckoutBasket
 )
 
 type Operation struct {
@@ -62,42 +66,54 @@ type CheckoutCmd struct {
 	// Basket user is working with
 	basketId string
 
-	waitExitSignal            chan struct{}
-	showMainMenuHandler       chan struct{}
-	addBasketHandler          chan struct{}
-	showBasketListHandler     chan RequestType
-	showProductListHandler    chan struct{}
-	addProductToBasketHandler chan string
+	waitExitSignal                 chan struct{}
+	showMainMenuHandler            chan struct{}
+	addBasketHandler               chan struct{}
+	showBasketListHandler          chan RequestType
+	showProductListHandler         chan RequestType
+	addProductToBasketHandler      chan string
+	setProductQuantityHandler      chan string
+	removeProductFromBasketHandler chan string
 }
 
-func NewCheckoutCmd(productsPath, serverAddress string, apiVersion int) *CheckoutCmd {
+func NewCheckoutCmd(serverAddress string, apiVersion int, options ...cli.ClientOption) *CheckoutCmd {
 	operations := []Operation{{
 		GoBack, "Exit",
 	}, {
 		AddBasket, "Add new basket",
+	}, {
+		ShowBasket, "Show a basket",
 	}, {
 		AddProduct, "Add new product to a basket",
+	}, {
+		SetProductQuantity, "Set a product quantity in a basket",
+	}, {
+		RemoveProduct, "Remove a product from a basket",
 	}, {
 		GetPrice, "Get a basket price",
 	}, {
 		DeleteBasket, "Delete a basket",
+	}, {
+		CheckoutBasket, "Check out a basket",
 	}}
 
 	cmd := CheckoutCmd{
 		operations:   operations,
 		basketIds:    []string{operations[0].Description},
 		productCodes: []string{operations[0].Description},
-		client:       cli.NewCheckoutClient(serverAddress, apiVersion),
-
-		waitExitSignal:            make(chan struct{}),
-		showMainMenuHandler:       make(chan struct{}),
-		addBasketHandler:          make(chan struct{}),
-		showBasketListHandler:     make(chan RequestType),
-		showProductListHandler:    make(chan struct{}),
-		addProductToBasketHandler: make(chan string),
+		client:       cli.NewCheckoutClient(serverAddress, apiVersion, options...),
+
+		waitExitSignal:                 make(chan struct{}),
+		showMainMenuHandler:            make(chan struct{}),
+		addBasketHandler:               make(chan struct{}),
+		showBasketListHandler:          make(chan RequestType),
+		showProductListHandler:         make(chan RequestType),
+		addProductToBasketHandler:      make(chan string),
+		setProductQuantityHandler:      make(chan string),
+		removeProductFromBasketHandler: make(chan string),
 	}
 
-	err := cmd.loadProducts(fmt.Sprintf("%s%sproducts.json", productsPath, string(os.PathSeparator)))
+	err := cmd.loadProducts()
 	if err != nil {
 		fmt.Printf("Error loading products: %v", err.Error())
 		return nil
@@ -107,13 +123,22 @@ func NewCheckoutCmd(productsPath, serverAddress string, apiVersion int) *Checkou
 }
 
 func main() {
-	productsPath := flag.String("products", "./config", "path to folder containing the available list of products file")
 	serverAddress := flag.String("server", "http://localhost:7070", "server http address")
 	apiVersion := flag.Int("version", 1, "api version to request")
+	token := flag.String("token", "", "bearer token authenticating the requests")
+	apiKey := flag.String("apikey", "", "api key authenticating the requests")
 
 	flag.Parse()
 
-	cmd := NewCheckoutCmd(*productsPath, *serverAddress, *apiVersion)
+	options := make([]cli.ClientOption, 0)
+	if *token != "" {
+		options = append(options, cli.WithBearerToken(*token))
+	}
+	if *apiKey != "" {
+		options = append(options, cli.WithApiKey(*apiKey))
+	}
+
+	cmd := NewCheckoutCmd(*serverAddress, *apiVersion, options...)
 	if cmd == nil {
 		return
 	}
@@ -123,28 +148,22 @@ func main() {
 	go cmd.showBasketsList()
 	go cmd.showProductLists()
 	go cmd.addProductToBasket()
+	go cmd.setProductQuantity()
+	go cmd.removeProductFromBasket()
 
 	<-cmd.waitExitSignal
 }
 
-func (c *CheckoutCmd) loadProducts(filePath string) error {
-	var products []model.Product
-
-	file, err := ioutil.ReadFile(filePath)
-	if err != nil {
-		return err
-	}
-
-	err = json.Unmarshal(file, &products)
+// loadProducts fetches the product catalogue from the server
+func (c *CheckoutCmd) loadProducts() error {
+	products, err := c.client.GetProducts()
 	if err != nil {
 		return err
 	}
 
+	c.productCodes = []string{c.operations[0].Description}
 	for _, p := range products {
-		err := p.Validate()
-		if err == nil {
-			c.productCodes = append(c.productCodes, string(p.Code))
-		}
+		c.productCodes = append(c.productCodes, string(p.Code))
 	}
 
 	return nil
@@ -178,11 +197,19 @@ func (c *CheckoutCmd) showMainMenu() {
 		case 1:
 			c.addBasketHandler <- signal
 		case 2:
-			c.showBasketListHandler <- AddProduct
+			c.showBasketListHandler <- ShowBasket
 		case 3:
-			c.showBasketListHandler <- GetPrice
+			c.showBasketListHandler <- AddProduct
 		case 4:
+			c.showBasketListHandler <- SetProductQuantity
+		case 5:
+			c.showBasketListHandler <- RemoveProduct
+		case 6:
+			c.showBasketListHandler <- GetPrice
+		case 7:
 			c.showBasketListHandler <- DeleteBasket
+		case 8:
+			c.showBasketListHandler <- CheckoutBasket
 		}
 
 		<-c.showMainMenuHandler
@@ -219,12 +246,26 @@ func (c *CheckoutCmd) showBasketsList() {
 		}
 
 		switch requestType {
+		case ShowBasket:
+			basket, err := c.client.GetBasket(c.basketIds[i])
+			if err != nil {
+				fmt.Printf("Error getting basket: %v\n", err)
+			} else {
+				fmt.Printf("Basket %v (created %v, updated %v)\n", basket.Id,
+					basket.CreatedAt.Format(time.RFC3339), basket.UpdatedAt.Format(time.RFC3339))
+				for _, line := range basket.Lines {
+					fmt.Printf("\t%-10v %-25v %3d x %v %v\n", line.Code, line.Name, line.Quantity, line.UnitPrice, line.Currency)
+				}
+			}
+
+			c.showMainMenuHandler <- signal
+
 		case GetPrice:
 			price, err := c.client.GetPrice(c.basketIds[i])
 			if err != nil {
 				fmt.Printf("Error getting price: %v\n", err)
 			} else {
-				fmt.Printf("Basket %v price: %.2f\n", c.basketIds[i], price)
+				fmt.Printf("Basket %v price: %v\n", c.basketIds[i], price)
 			}
 
 			c.showMainMenuHandler <- signal
@@ -239,9 +280,22 @@ func (c *CheckoutCmd) showBasketsList() {
 			}
 			c.showMainMenuHandler <- signal
 
+		case CheckoutBasket:
+			orderId, err := c.client.Checkout(c.basketIds[i])
+			if err != nil {
+				fmt.Printf("Error checking out basket %v: %v\n", c.basketIds[i], err)
+			} else if order, err := c.client.GetOrder(orderId); err != nil {
+				fmt.Printf("Error getting order %v: %v\n", orderId, err)
+			} else {
+				fmt.Printf("Basket %v checked out as order %v (%v): %v %v\n", c.basketIds[i], order.Id, order.State,
+					order.Receipt.Total, order.Receipt.Currency)
+				c.basketIds = remove(c.basketIds, i)
+			}
+			c.showMainMenuHandler <- signal
+
 		default:
 			c.basketId = c.basketIds[i]
-			c.showProductListHandler <- signal
+			c.showProductListHandler <- requestType
 		}
 	}
 }
@@ -260,7 +314,14 @@ func (c *CheckoutCmd) showProductLists() {
 	}
 
 	for {
-		<-c.showProductListHandler
+		requestType := <-c.showProductListHandler
+
+		// The catalogue may have changed since the last time it was shown
+		err := c.loadProducts()
+		if err != nil {
+			fmt.Printf("Error loading products: %v\n", err)
+		}
+		productListSelect.Items = c.productCodes
 
 		i, _, err := productListSelect.Run()
 		if err != nil {
@@ -273,13 +334,18 @@ func (c *CheckoutCmd) showProductLists() {
 			continue
 		}
 
-		c.addProductToBasketHandler <- c.productCodes[i]
+		switch requestType {
+		case SetProductQuantity:
+			c.setProductQuantityHandler <- c.productCodes[i]
+		case RemoveProduct:
+			c.removeProductFromBasketHandler <- c.productCodes[i]
+		default:
+			c.addProductToBasketHandler <- c.productCodes[i]
+		}
 	}
 }
 
 func (c *CheckoutCmd) addProductToBasket() {
-	signal := struct{}{}
-
 	for {
 		productCode := <-c.addProductToBasketHandler
 		err := c.client.AddItem(c.basketId, productCode)
@@ -288,7 +354,60 @@ func (c *CheckoutCmd) addProductToBasket() {
 		}
 		fmt.Printf("%v added to basket %v", productCode, c.basketId)
 
-		c.showProductListHandler <- signal
+		c.showProductListHandler <- AddProduct
+	}
+}
+
+func (c *CheckoutCmd) setProductQuantity() {
+	signal := struct{}{}
+
+	prompt := promptui.Prompt{
+		Label: "Quantity",
+		Validate: func(input string) error {
+			quantity, err := strconv.Atoi(input)
+			if err != nil || quantity < 0 {
+				return errors.New("invalid quantity")
+			}
+			return nil
+		},
+	}
+
+	for {
+		productCode := <-c.setProductQuantityHandler
+
+		input, err := prompt.Run()
+		if err != nil {
+			fmt.Printf("Prompt failed %v\n", err)
+			c.showMainMenuHandler <- signal
+			continue
+		}
+		quantity, _ := strconv.Atoi(input)
+
+		err = c.client.SetItemQuantity(c.basketId, productCode, quantity)
+		if err != nil {
+			fmt.Printf("Error setting product quantity: %v\n", err)
+		} else {
+			fmt.Printf("%v quantity set to %v in basket %v\n", productCode, quantity, c.basketId)
+		}
+
+		c.showMainMenuHandler <- signal
+	}
+}
+
+func (c *CheckoutCmd) removeProductFromBasket() {
+	signal := struct{}{}
+
+	for {
+		productCode := <-c.removeProductFromBasketHandler
+
+		err := c.client.RemoveItem(c.basketId, productCode)
+		if err != nil {
+			fmt.Printf("Error removing product: %v\n", err)
+		} else {
+			fmt.Printf("%v removed from basket %v\n", productCode, c.basketId)
+		}
+
+		c.showMainMenuHandler <- signal
 	}
 }
 
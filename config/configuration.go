@@ -2,16 +2,110 @@ package config
 
 import (
 	"github.com/spf13/viper"
+	"time"
 )
 
 type Configuration struct {
-	Server ServerConfig
-	Data   DataConfig
+	Server      ServerConfig
+	Data        DataConfig
+	Baskets     BasketsConfig
+	Pricing     PricingConfig
+	Tax         TaxConfig
+	Payment     PaymentConfig
+	Auth        AuthConfig
+	RateLimit   RateLimitConfig
+	Idempotency IdempotencyConfig
 }
 
 type DataConfig struct {
+	// Driver selects the datasource implementation: memory (default) or bolt
+	Driver string
+	// Database is the file used by the bolt driver
+	Database   string
 	Products   string
 	Promotions string
+	// ExchangeRates is the file with the rates of the currencies baskets can be priced
+	// in, baskets are only priced in the currency of the catalogue without it
+	ExchangeRates string
+}
+
+type BasketsConfig struct {
+	// TTL is how long a basket is kept since its last modification. Zero keeps them forever
+	TTL time.Duration
+	// SweepInterval is how often expired baskets are evicted
+	SweepInterval time.Duration
+}
+
+type PricingConfig struct {
+	// Strategy applying competing promotions: priority (default) or best
+	Strategy string
+	// Currency of the baskets created without one, EUR by default
+	Currency string
+}
+
+type TaxConfig struct {
+	// Region whose rates apply to the baskets, prices are not taxed without it
+	Region string
+	// Rounding of the taxes: line (default) or total
+	Rounding string
+	// Regions holds the tax rates of every region by product category, as percentages
+	Regions map[string]map[string]string
+}
+
+type PaymentConfig struct {
+	// Provider collecting the payments: fake (default), a local gateway for tests
+	Provider string
+	// Outcome of every request to the fake provider: succeed (default), decline or timeout
+	Outcome string
+}
+
+type AuthConfig struct {
+	// Enabled requires credentials on the api. Without it every request is granted
+	// every scope, and customers are read from the X-Customer-Id header
+	Enabled bool
+	// Secret signing the bearer tokens with HMAC SHA-256, at least 32 bytes long
+	Secret string
+	// ApiKeys are static credentials sent in the X-Api-Key header
+	ApiKeys []ApiKeyConfig
+}
+
+type ApiKeyConfig struct {
+	Key string
+	// Subject is the customer or client the key was issued to
+	Subject string
+	// Scopes granted to the key: shopper or admin
+	Scopes []string
+}
+
+type RateLimitConfig struct {
+	// Enabled limits the requests of every client, identified by its api key or
+	// otherwise by its address
+	Enabled bool
+	// Requests a client can make every Period, in bursts of up to Burst requests.
+	// Burst defaults to Requests
+	Requests int
+	Period   time.Duration
+	Burst    int
+	// TrustProxy reads the address of the clients from the last entry of the
+	// X-Forwarded-For header, the one appended by the proxy
+	TrustProxy bool
+	// Routes with their own limits, counted apart from the rest of requests
+	Routes []RouteLimitConfig
+}
+
+type RouteLimitConfig struct {
+	// Method and path template of the route, as registered: POST /api/v1/baskets/
+	Method   string
+	Path     string
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+type IdempotencyConfig struct {
+	// Window is how long the response to a request with an idempotency key is replayed
+	// to its duplicates. Zero disables replaying them
+	Window time.Duration
 }
 
 type ServerConfig struct {
@@ -0,0 +1,834 @@
+package datasource
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"github.com/alfcope/checkouttest/config"
+	"github.com/alfcope/checkouttest/errors"
+	"github.com/alfcope/checkouttest/model"
+	bolt "go.etcd.io/bbolt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	metaBucket       = []byte("meta")
+	productsBucket   = []byte("products")
+	promotionsBucket = []byte("promotions")
+	basketsBucket    = []byte("baskets")
+	couponsBucket    = []byte("coupons")
+	ordersBucket     = []byte("orders")
+	orderIdsBucket   = []byte("orderIds")
+	stockBucket      = []byte("stock")
+	// Holds a bucket per customer with the ids of their baskets
+	ownersBucket = []byte("owners")
+
+	seededKey = []byte("seeded")
+)
+
+// BoltDatasource stores products, promotions and baskets in an embedded bolt
+// database, so they survive restarts. Products and promotions are read from the
+// data files only when the database is created.
+type BoltDatasource struct {
+	db *bolt.DB
+
+	// Parsed promotions are kept in memory and rebuilt from the database after every
+	// change, as they are read on every price calculation
+	promotions           []model.Promotion
+	promotionDefinitions []map[string]interface{}
+	promotionsMux        sync.RWMutex
+}
+
+type basketRecord struct {
+	Id        string
+	Owner     string
+	Currency  model.Currency
+	Lines     []basketLineRecord
+	Coupons   []string
+	OrderId   string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type basketLineRecord struct {
+	Product  model.Product
+	Quantity int
+}
+
+func InitBoltDatasource(config config.DataConfig) (*BoltDatasource, error) {
+	db, err := bolt.Open(config.Database, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	ds := BoltDatasource{
+		db:            db,
+		promotionsMux: sync.RWMutex{},
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{metaBucket, productsBucket, promotionsBucket, basketsBucket, couponsBucket, ordersBucket, orderIdsBucket, stockBucket, ownersBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+
+		if tx.Bucket(metaBucket).Get(seededKey) != nil {
+			return nil
+		}
+
+		return ds.seed(tx, config)
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	err = db.View(ds.refreshPromotions)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &ds, nil
+}
+
+func (d *BoltDatasource) Close() error {
+	return d.db.Close()
+}
+
+func (d *BoltDatasource) seed(tx *bolt.Tx, config config.DataConfig) error {
+	products, err := readProducts(config.Products, false)
+	if err != nil {
+		return err
+	}
+
+	_, definitions, err := readPromotions(config.Promotions, false)
+	if err != nil {
+		return err
+	}
+
+	err = putCatalogue(tx, products, definitions)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(metaBucket).Put(seededKey, []byte(time.Now().UTC().Format(time.RFC3339)))
+}
+
+func (d *BoltDatasource) GetProduct(code model.ProductCode) (model.Product, error) {
+	var product model.Product
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(productsBucket).Get([]byte(code))
+		if value == nil {
+			return errors.NewProductNotFound(string(code))
+		}
+
+		return json.Unmarshal(value, &product)
+	})
+
+	return product, err
+}
+
+// GetProducts returns the whole catalogue sorted by product code
+func (d *BoltDatasource) GetProducts() []model.Product {
+	products := make([]model.Product, 0)
+
+	_ = d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(productsBucket).ForEach(func(_, value []byte) error {
+			var product model.Product
+			if err := json.Unmarshal(value, &product); err != nil {
+				return err
+			}
+
+			products = append(products, product)
+			return nil
+		})
+	})
+
+	return products
+}
+
+func (d *BoltDatasource) AddProduct(product model.Product) error {
+	err := product.Validate()
+	if err != nil {
+		return err
+	}
+
+	return d.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(productsBucket).Get([]byte(product.Code)) != nil {
+			return errors.NewProductAlreadyExists(string(product.Code))
+		}
+
+		return putJSON(tx.Bucket(productsBucket), []byte(product.Code), product)
+	})
+}
+
+func (d *BoltDatasource) UpdateProduct(product model.Product) error {
+	err := product.Validate()
+	if err != nil {
+		return err
+	}
+
+	return d.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(productsBucket).Get([]byte(product.Code)) == nil {
+			return errors.NewProductNotFound(string(product.Code))
+		}
+
+		return putJSON(tx.Bucket(productsBucket), []byte(product.Code), product)
+	})
+}
+
+func (d *BoltDatasource) DeleteProduct(code model.ProductCode) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(productsBucket).Get([]byte(code)) == nil {
+			return errors.NewProductNotFound(string(code))
+		}
+
+		if err := tx.Bucket(stockBucket).Delete([]byte(code)); err != nil {
+			return err
+		}
+
+		return tx.Bucket(productsBucket).Delete([]byte(code))
+	})
+}
+
+// GetPromotions returns the active set of promotions. The slice must not be modified
+func (d *BoltDatasource) GetPromotions() []model.Promotion {
+	d.promotionsMux.RLock()
+	defer d.promotionsMux.RUnlock()
+
+	return d.promotions
+}
+
+// GetPromotionDefinitions returns the definitions of the active promotions
+// in the same format they are received. The definitions must not be modified
+func (d *BoltDatasource) GetPromotionDefinitions() []map[string]interface{} {
+	d.promotionsMux.RLock()
+	defer d.promotionsMux.RUnlock()
+
+	return d.promotionDefinitions
+}
+
+func (d *BoltDatasource) GetPromotionDefinition(id string) (map[string]interface{}, error) {
+	d.promotionsMux.RLock()
+	defer d.promotionsMux.RUnlock()
+
+	for i, promotion := range d.promotions {
+		if promotion.GetId() == id {
+			return d.promotionDefinitions[i], nil
+		}
+	}
+
+	return nil, errors.NewPromotionNotFound(id)
+}
+
+// AddPromotion parses and adds a new promotion, returning its id. The id of the
+// definition is kept, or a new one is assigned if it has none
+func (d *BoltDatasource) AddPromotion(definition map[string]interface{}) (string, error) {
+	definition, promotion, err := newPromotion(newPromotionId(definition), definition, true)
+	if err != nil {
+		return "", invalidDefinitionError(err)
+	}
+
+	err = d.updatePromotions(func(bucket *bolt.Bucket) error {
+		if _, err := promotionKey(bucket, promotion.GetId()); err == nil {
+			return errors.NewPromotionInvalid(promotion.GetId(), "duplicated id")
+		}
+
+		return putPromotion(bucket, definition)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return promotion.GetId(), nil
+}
+
+// UpdatePromotion replaces a promotion keeping its id and its position in the active set
+func (d *BoltDatasource) UpdatePromotion(id string, definition map[string]interface{}) error {
+	definition, _, err := newPromotion(id, definition, true)
+	if err != nil {
+		return invalidDefinitionError(err)
+	}
+
+	return d.updatePromotions(func(bucket *bolt.Bucket) error {
+		key, err := promotionKey(bucket, id)
+		if err != nil {
+			return err
+		}
+
+		return putJSON(bucket, key, definition)
+	})
+}
+
+func (d *BoltDatasource) DeletePromotion(id string) error {
+	return d.updatePromotions(func(bucket *bolt.Bucket) error {
+		key, err := promotionKey(bucket, id)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Delete(key)
+	})
+}
+
+func (d *BoltDatasource) GetBasket(id string) (*model.Basket, error) {
+	var basket *model.Basket
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		var err error
+		basket, err = getBasket(tx, id)
+		return err
+	})
+	if err != nil {
+		return new(model.Basket), err
+	}
+
+	return basket, nil
+}
+
+func (d *BoltDatasource) AddBasket(basket *model.Basket) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(basketsBucket).Get([]byte(basket.Id)) != nil {
+			return errors.NewPrimaryKeyError(basket.Id)
+		}
+
+		if owner := basket.Owner(); owner != "" {
+			ownerBucket, err := tx.Bucket(ownersBucket).CreateBucketIfNotExists([]byte(owner))
+			if err != nil {
+				return err
+			}
+			if err := ownerBucket.Put([]byte(basket.Id), []byte{}); err != nil {
+				return err
+			}
+		}
+
+		return putBasket(tx, basket)
+	})
+}
+
+// UpdateBasket applies the update to the stored basket and saves it in the same
+// transaction, so concurrent updates of a basket are never lost. The basket is not
+// saved if the update fails
+func (d *BoltDatasource) UpdateBasket(id string, update func(*model.Basket) error) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		basket, err := getBasket(tx, id)
+		if err != nil {
+			return err
+		}
+
+		err = update(basket)
+		if err != nil {
+			return err
+		}
+
+		return putBasket(tx, basket)
+	})
+}
+
+func (d *BoltDatasource) DeleteBasket(basketId string) *model.Basket {
+	var deleted *model.Basket
+
+	_ = d.db.Update(func(tx *bolt.Tx) error {
+		basket, err := getBasket(tx, basketId)
+		if err != nil {
+			return err
+		}
+
+		deleted = basket
+		return deleteBasket(tx, basket)
+	})
+
+	return deleted
+}
+
+// DeleteBasketsUpdatedBefore deletes the baskets not modified since the given
+// time, returning them
+func (d *BoltDatasource) DeleteBasketsUpdatedBefore(updatedBefore time.Time) []*model.Basket {
+	deleted := make([]*model.Basket, 0)
+
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(basketsBucket)
+
+		expired := make([]*model.Basket, 0)
+		err := bucket.ForEach(func(key, value []byte) error {
+			var record basketRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+
+			if record.UpdatedAt.Before(updatedBefore) {
+				basket, err := getBasket(tx, string(key))
+				if err != nil {
+					return err
+				}
+				expired = append(expired, basket)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Keys can not be deleted while iterating the bucket
+		for _, basket := range expired {
+			if err := deleteBasket(tx, basket); err != nil {
+				return err
+			}
+			deleted = append(deleted, basket)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return []*model.Basket{}
+	}
+
+	return deleted
+}
+
+func (d *BoltDatasource) GetBasketsByOwner(owner string) []*model.Basket {
+	baskets := make([]*model.Basket, 0)
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		ownerBucket := tx.Bucket(ownersBucket).Bucket([]byte(owner))
+		if ownerBucket == nil {
+			return nil
+		}
+
+		return ownerBucket.ForEach(func(key, _ []byte) error {
+			basket, err := getBasket(tx, string(key))
+			if err != nil {
+				return err
+			}
+			baskets = append(baskets, basket)
+			return nil
+		})
+	})
+	if err != nil {
+		return []*model.Basket{}
+	}
+	sortBaskets(baskets)
+
+	return baskets
+}
+
+// UseCoupon counts a new use of the coupon, failing if it is unknown, expired at
+// the given time or all its uses are taken. Uses are stored by coupon code
+func (d *BoltDatasource) UseCoupon(code string, now time.Time) error {
+	coupon, ok := model.FindCoupon(d.GetPromotions(), code)
+	if !ok {
+		return errors.NewCouponNotFound(code)
+	}
+
+	return d.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(couponsBucket)
+
+		uses := couponUses(bucket, code)
+		if err := checkCoupon(coupon, uses, now); err != nil {
+			return err
+		}
+
+		return bucket.Put([]byte(code), []byte(strconv.Itoa(uses+1)))
+	})
+}
+
+// ReleaseCoupon gives back a use of the coupon
+func (d *BoltDatasource) ReleaseCoupon(code string) {
+	_ = d.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(couponsBucket)
+
+		uses := couponUses(bucket, code)
+		if uses <= 1 {
+			return bucket.Delete([]byte(code))
+		}
+
+		return bucket.Put([]byte(code), []byte(strconv.Itoa(uses-1)))
+	})
+}
+
+func (d *BoltDatasource) GetStock(code model.ProductCode) (model.Stock, error) {
+	var stock model.Stock
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		var err error
+		stock, err = getStock(tx, code)
+		return err
+	})
+	if err != nil {
+		return model.Stock{}, err
+	}
+
+	return stock, nil
+}
+
+// UpdateStock applies the update to the stock of a product of the catalogue and
+// saves it in the same transaction. The stock is only saved if the update succeeds
+// and leaves it tracked
+func (d *BoltDatasource) UpdateStock(code model.ProductCode, update func(*model.Stock) error) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		stock, err := getStock(tx, code)
+		if err != nil {
+			return err
+		}
+
+		if err := update(&stock); err != nil {
+			return err
+		}
+		if !stock.Tracked {
+			return nil
+		}
+
+		return putJSON(tx.Bucket(stockBucket), []byte(code), stock)
+	})
+}
+
+func getStock(tx *bolt.Tx, code model.ProductCode) (model.Stock, error) {
+	if tx.Bucket(productsBucket).Get([]byte(code)) == nil {
+		return model.Stock{}, errors.NewProductNotFound(string(code))
+	}
+
+	value := tx.Bucket(stockBucket).Get([]byte(code))
+	if value == nil {
+		return model.Stock{Code: code}, nil
+	}
+
+	var stock model.Stock
+	if err := json.Unmarshal(value, &stock); err != nil {
+		return model.Stock{}, err
+	}
+
+	return stock, nil
+}
+
+// AddOrder stores the order under the next key of the orders bucket, so they are
+// kept in the order they were placed, and indexes its key by order id
+func (d *BoltDatasource) AddOrder(order model.Order) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		index := tx.Bucket(orderIdsBucket)
+		if index.Get([]byte(order.Id)) != nil {
+			return errors.NewPrimaryKeyError(order.Id)
+		}
+
+		bucket := tx.Bucket(ordersBucket)
+		sequence, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, sequence)
+
+		if err := index.Put([]byte(order.Id), key); err != nil {
+			return err
+		}
+
+		return putJSON(bucket, key, order)
+	})
+}
+
+func (d *BoltDatasource) GetOrder(id string) (model.Order, error) {
+	var order model.Order
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		key := tx.Bucket(orderIdsBucket).Get([]byte(id))
+		if key == nil {
+			return errors.NewOrderNotFound(id)
+		}
+
+		return json.Unmarshal(tx.Bucket(ordersBucket).Get(key), &order)
+	})
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return order, nil
+}
+
+// UpdateOrder applies the update to the stored order and saves it in the same
+// transaction. The order is not saved if the update fails
+func (d *BoltDatasource) UpdateOrder(id string, update func(*model.Order) error) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		key := tx.Bucket(orderIdsBucket).Get([]byte(id))
+		if key == nil {
+			return errors.NewOrderNotFound(id)
+		}
+
+		bucket := tx.Bucket(ordersBucket)
+
+		var order model.Order
+		if err := json.Unmarshal(bucket.Get(key), &order); err != nil {
+			return err
+		}
+
+		if err := update(&order); err != nil {
+			return err
+		}
+
+		return putJSON(bucket, key, order)
+	})
+}
+
+// GetOrders walks the orders bucket backwards, as keys grow with every order placed
+func (d *BoltDatasource) GetOrders(offset, limit int) ([]model.Order, int) {
+	orders := make([]model.Order, 0)
+	total := 0
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(ordersBucket)
+		total = bucket.Stats().KeyN
+
+		cursor := bucket.Cursor()
+		skipped := 0
+		for key, value := cursor.Last(); key != nil && len(orders) < limit; key, value = cursor.Prev() {
+			if skipped < offset {
+				skipped++
+				continue
+			}
+
+			var order model.Order
+			if err := json.Unmarshal(value, &order); err != nil {
+				return err
+			}
+			orders = append(orders, order)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return []model.Order{}, 0
+	}
+
+	return orders, total
+}
+
+func couponUses(bucket *bolt.Bucket, code string) int {
+	uses, _ := strconv.Atoi(string(bucket.Get([]byte(code))))
+	return uses
+}
+
+// Reload reads again the products and promotions files and replaces the whole
+// catalogue and the active promotions with their content. Nothing is replaced
+// unless both files are fully valid. Baskets are kept.
+func (d *BoltDatasource) Reload(config config.DataConfig) (CatalogueDiff, error) {
+	products, err := readProducts(config.Products, true)
+	if err != nil {
+		return CatalogueDiff{}, err
+	}
+
+	_, definitions, err := readPromotions(config.Promotions, true)
+	if err != nil {
+		return CatalogueDiff{}, err
+	}
+
+	diff := CatalogueDiff{}
+
+	d.promotionsMux.Lock()
+	defer d.promotionsMux.Unlock()
+
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		current := make(map[model.ProductCode]model.Product)
+		err := tx.Bucket(productsBucket).ForEach(func(_, value []byte) error {
+			var product model.Product
+			if err := json.Unmarshal(value, &product); err != nil {
+				return err
+			}
+
+			current[product.Code] = product
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		diffProducts(&diff, current, products)
+		diffPromotions(&diff, d.promotionDefinitions, definitions)
+
+		for _, bucket := range [][]byte{productsBucket, promotionsBucket} {
+			if err := tx.DeleteBucket(bucket); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(bucket); err != nil {
+				return err
+			}
+		}
+
+		err = putCatalogue(tx, products, definitions)
+		if err != nil {
+			return err
+		}
+
+		return d.loadPromotions(tx)
+	})
+	if err != nil {
+		return CatalogueDiff{}, err
+	}
+
+	return diff, nil
+}
+
+// updatePromotions applies a change to the stored promotions and rebuilds the
+// active set from them
+func (d *BoltDatasource) updatePromotions(update func(*bolt.Bucket) error) error {
+	d.promotionsMux.Lock()
+	defer d.promotionsMux.Unlock()
+
+	return d.db.Update(func(tx *bolt.Tx) error {
+		err := update(tx.Bucket(promotionsBucket))
+		if err != nil {
+			return err
+		}
+
+		return d.loadPromotions(tx)
+	})
+}
+
+func (d *BoltDatasource) refreshPromotions(tx *bolt.Tx) error {
+	d.promotionsMux.Lock()
+	defer d.promotionsMux.Unlock()
+
+	return d.loadPromotions(tx)
+}
+
+// loadPromotions parses the stored promotions and makes them the active set.
+// Must be called holding the promotions lock
+func (d *BoltDatasource) loadPromotions(tx *bolt.Tx) error {
+	promotions := make([]model.Promotion, 0)
+	definitions := make([]map[string]interface{}, 0)
+
+	err := tx.Bucket(promotionsBucket).ForEach(func(_, value []byte) error {
+		var definition map[string]interface{}
+		if err := json.Unmarshal(value, &definition); err != nil {
+			return err
+		}
+
+		id, _ := definition["id"].(string)
+		definition, promotion, err := newPromotion(id, definition, false)
+		if err != nil {
+			return err
+		}
+
+		promotions = append(promotions, promotion)
+		definitions = append(definitions, definition)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	d.promotions, d.promotionDefinitions = promotions, definitions
+
+	return nil
+}
+
+func putCatalogue(tx *bolt.Tx, products map[model.ProductCode]model.Product, definitions []map[string]interface{}) error {
+	for code, product := range products {
+		if err := putJSON(tx.Bucket(productsBucket), []byte(code), product); err != nil {
+			return err
+		}
+	}
+
+	for _, definition := range definitions {
+		if err := putPromotion(tx.Bucket(promotionsBucket), definition); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Promotions are stored under a sequence number to keep the order they were added in
+func putPromotion(bucket *bolt.Bucket, definition map[string]interface{}) error {
+	sequence, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, sequence)
+
+	return putJSON(bucket, key, definition)
+}
+
+func promotionKey(bucket *bolt.Bucket, id string) ([]byte, error) {
+	cursor := bucket.Cursor()
+	for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+		var definition map[string]interface{}
+		if err := json.Unmarshal(value, &definition); err != nil {
+			return nil, err
+		}
+
+		if definition["id"] == id {
+			return key, nil
+		}
+	}
+
+	return nil, errors.NewPromotionNotFound(id)
+}
+
+func getBasket(tx *bolt.Tx, id string) (*model.Basket, error) {
+	value := tx.Bucket(basketsBucket).Get([]byte(id))
+	if value == nil {
+		return nil, errors.NewBasketNotFound(id)
+	}
+
+	var record basketRecord
+	if err := json.Unmarshal(value, &record); err != nil {
+		return nil, err
+	}
+
+	lines := make([]model.Line, 0, len(record.Lines))
+	for _, l := range record.Lines {
+		lines = append(lines, model.NewLine(l.Product, l.Quantity))
+	}
+
+	// Baskets stored before they had a currency were priced in the default one
+	if record.Currency == "" {
+		record.Currency = model.DefaultCurrency
+	}
+
+	return model.RestoreBasket(record.Id, record.Owner, record.Currency, lines, record.Coupons, record.OrderId, record.CreatedAt, record.UpdatedAt), nil
+}
+
+func putBasket(tx *bolt.Tx, basket *model.Basket) error {
+	record := basketRecord{
+		Id:        basket.Id,
+		Owner:     basket.Owner(),
+		Currency:  basket.Currency(),
+		Lines:     make([]basketLineRecord, 0),
+		Coupons:   basket.Coupons(),
+		OrderId:   basket.OrderId(),
+		CreatedAt: basket.CreatedAt(),
+		UpdatedAt: basket.UpdatedAt(),
+	}
+
+	for _, l := range basket.Lines() {
+		record.Lines = append(record.Lines, basketLineRecord{Product: l.Product, Quantity: l.Amount()})
+	}
+
+	return putJSON(tx.Bucket(basketsBucket), []byte(basket.Id), record)
+}
+
+// deleteBasket deletes the basket and removes it from the baskets of its owner
+func deleteBasket(tx *bolt.Tx, basket *model.Basket) error {
+	if owner := basket.Owner(); owner != "" {
+		if ownerBucket := tx.Bucket(ownersBucket).Bucket([]byte(owner)); ownerBucket != nil {
+			if err := ownerBucket.Delete([]byte(basket.Id)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Bucket(basketsBucket).Delete([]byte(basket.Id))
+}
+
+func putJSON(bucket *bolt.Bucket, key []byte, value interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return bucket.Put(key, encoded)
+}
@@ -0,0 +1,121 @@
+package datasource
+
+import (
+	"github.com/alfcope/checkouttest/model"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBoltDatasourceSurvivesRestart(t *testing.T) {
+	// Given
+	dir, err := ioutil.TempDir("", "bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dataConfig := writeDataFiles(t, dir, reloadProducts, reloadPromotions)
+	dataConfig.Driver = "bolt"
+	dataConfig.Database = filepath.Join(dir, "checkout.db")
+
+	ds, err := InitBoltDatasource(dataConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	basket := model.NewBasket("B1")
+	_ = ds.AddBasket(basket)
+	tshirt, _ := ds.GetProduct("TSHIRT")
+	_ = ds.UpdateBasket("B1", func(b *model.Basket) error {
+		return b.AddProducts([]model.Line{model.NewLine(tshirt, 3)})
+	})
+	_ = ds.AddProduct(model.Product{Code: "MUG", Name: "Cabify Coffee Mug", Price: model.NewMoney(750, "EUR")})
+	_ = ds.DeletePromotion("free")
+
+	// Files changed while the server is down are not read again on start
+	writeDataFiles(t, dir, `[]`, `[]`)
+
+	// When
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ds, err = InitBoltDatasource(dataConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	// Then
+	b, err := ds.GetBasket("B1")
+	if err != nil {
+		t.Fatalf("Basket should survive a restart: %v", err)
+	}
+	if lines := b.Lines(); len(lines) != 1 || lines[0].Amount() != 3 {
+		t.Errorf("Wanted 3 TSHIRT in the basket, got %v", lines)
+	}
+	if products := ds.GetProducts(); len(products) != 3 {
+		t.Errorf("Wanted 3 products, got %v", products)
+	}
+
+	promotions := ds.GetPromotions()
+	if len(promotions) != 1 || promotions[0].GetId() != "bulk" {
+		t.Fatalf("Wanted only the bulk promotion, got %v", promotions)
+	}
+	if total := b.CalculatePrice(promotions).Total; total.Amount != 5700 {
+		t.Errorf("Wanted total 5700, got %v", total)
+	}
+}
+
+func TestBoltDatasourceReload(t *testing.T) {
+	// Given
+	dir, err := ioutil.TempDir("", "bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dataConfig := writeDataFiles(t, dir, reloadProducts, reloadPromotions)
+	dataConfig.Database = filepath.Join(dir, "checkout.db")
+
+	ds, err := InitBoltDatasource(dataConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+	_ = ds.AddBasket(model.NewBasket("B1"))
+
+	writeDataFiles(t, dir, `[{"code": "TSHIRT", "name": "Cabify T-Shirt", "price": 2200}]`, `[
+  {"id": "bulk", "code": "BULK", "promos": [{"product": "TSHIRT", "rules": [{"buy": 3, "price": 1900}]}]}
+]`)
+
+	// When
+	diff, err := ds.Reload(dataConfig)
+
+	// Then
+	if err != nil {
+		t.Fatalf("Unexpected error reloading: %v", err)
+	}
+	if len(diff.RemovedProducts) != 1 || len(diff.ChangedProducts) != 1 || len(diff.RemovedPromotions) != 1 {
+		t.Errorf("Unexpected diff %+v", diff)
+	}
+	if product, _ := ds.GetProduct("TSHIRT"); product.Price.Amount != 2200 {
+		t.Errorf("Wanted new TSHIRT price 2200, got %v", product.Price)
+	}
+	if promotions := ds.GetPromotions(); len(promotions) != 1 {
+		t.Errorf("Wanted 1 promotion, got %v", promotions)
+	}
+	if _, err := ds.GetBasket("B1"); err != nil {
+		t.Errorf("Baskets should be kept on reload")
+	}
+
+	// An invalid file keeps the current data
+	writeDataFiles(t, dir, `[{"code": "TSHIRT", "name": "Cabify T-Shirt", "price": -1}]`, `[]`)
+	if _, err := ds.Reload(dataConfig); err == nil {
+		t.Errorf("Wanted an error reloading invalid files")
+	}
+	if products := ds.GetProducts(); len(products) != 1 {
+		t.Errorf("Wanted 1 product, got %v", products)
+	}
+}
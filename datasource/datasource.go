@@ -2,38 +2,115 @@ package datasource
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/alfcope/checkouttest/config"
 	"github.com/alfcope/checkouttest/datasource/parser"
 	"github.com/alfcope/checkouttest/errors"
 	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/google/uuid"
 	"io/ioutil"
+	"sort"
+	"strconv"
 	"sync"
+	"time"
 )
 
 type Datasource interface {
 	GetProduct(model.ProductCode) (model.Product, error)
+	GetProducts() []model.Product
+	AddProduct(model.Product) error
+	UpdateProduct(model.Product) error
+	DeleteProduct(model.ProductCode) error
 	GetPromotions() []model.Promotion
+	GetPromotionDefinitions() []map[string]interface{}
+	GetPromotionDefinition(string) (map[string]interface{}, error)
+	AddPromotion(map[string]interface{}) (string, error)
+	UpdatePromotion(string, map[string]interface{}) error
+	DeletePromotion(string) error
 	GetBasket(string) (*model.Basket, error)
 	AddBasket(*model.Basket) error
-	DeleteBasket(string)
+	UpdateBasket(string, func(*model.Basket) error) error
+	// DeleteBasket returns the basket deleted, nil if it is not found
+	DeleteBasket(string) *model.Basket
+	DeleteBasketsUpdatedBefore(time.Time) []*model.Basket
+	// GetBasketsByOwner returns the baskets of a customer, the most recent first
+	GetBasketsByOwner(string) []*model.Basket
+	UseCoupon(string, time.Time) error
+	ReleaseCoupon(string)
+	// GetStock returns the stock of a product of the catalogue, not tracked unless it
+	// has been set
+	GetStock(model.ProductCode) (model.Stock, error)
+	UpdateStock(model.ProductCode, func(*model.Stock) error) error
+	AddOrder(model.Order) error
+	GetOrder(string) (model.Order, error)
+	UpdateOrder(string, func(*model.Order) error) error
+	// GetOrders returns a page of orders, the most recent first, along with the
+	// total number of orders
+	GetOrders(offset, limit int) ([]model.Order, int)
+}
+
+// NewDatasource initializes the datasource implementation selected in the configuration
+func NewDatasource(config config.DataConfig) (Datasource, error) {
+	switch config.Driver {
+	case "", "memory":
+		return InitInMemoryDatasource(config)
+	case "bolt":
+		return InitBoltDatasource(config)
+	}
+
+	return nil, fmt.Errorf("unknown datasource driver %v", config.Driver)
 }
 
 type InMemoryDatasource struct {
-	// products and promotions do not need mutex as they do not
-	// change its state. Just once at startup
-	products   map[model.ProductCode]model.Product
-	promotions []model.Promotion
+	products    map[model.ProductCode]model.Product
+	productsMux sync.RWMutex
+
+	// promotions and their definitions, as they were received, are never modified
+	// in place: every change builds new slices and swaps them under the mutex, so
+	// a reader always gets a complete and consistent set
+	promotions           []model.Promotion
+	promotionDefinitions []map[string]interface{}
+	promotionsMux        sync.RWMutex
 
 	baskets    map[string]*model.Basket
 	basketsMux sync.RWMutex
+	// Ids of the baskets of every customer, guarded by the baskets mutex
+	owners map[string]map[string]struct{}
+	// updatesMux serializes the updates of baskets, as bolt transactions do
+	updatesMux sync.Mutex
+
+	// Number of baskets every coupon is applied to
+	couponUses map[string]int
+	couponsMux sync.Mutex
+
+	// Stock of the products whose stock is tracked
+	stock    map[model.ProductCode]model.Stock
+	stockMux sync.Mutex
+
+	// Orders in the order they were placed, and their positions by id
+	orders     []model.Order
+	orderIndex map[string]int
+	ordersMux  sync.RWMutex
 }
 
 func InitInMemoryDatasource(config config.DataConfig) (*InMemoryDatasource, error) {
 	ds := InMemoryDatasource{
-		products:   make(map[model.ProductCode]model.Product),
-		promotions: make([]model.Promotion, 0),
-		baskets:    make(map[string]*model.Basket),
-		basketsMux: sync.RWMutex{},
+		products:             make(map[model.ProductCode]model.Product),
+		productsMux:          sync.RWMutex{},
+		promotions:           make([]model.Promotion, 0),
+		promotionDefinitions: make([]map[string]interface{}, 0),
+		promotionsMux:        sync.RWMutex{},
+		baskets:              make(map[string]*model.Basket),
+		basketsMux:           sync.RWMutex{},
+		owners:               make(map[string]map[string]struct{}),
+		couponUses:           make(map[string]int),
+		couponsMux:           sync.Mutex{},
+		stock:                make(map[model.ProductCode]model.Stock),
+		stockMux:             sync.Mutex{},
+		orders:               make([]model.Order, 0),
+		orderIndex:           make(map[string]int),
+		ordersMux:            sync.RWMutex{},
 	}
 
 	err := ds.loadProducts(config.Products)
@@ -50,6 +127,9 @@ func InitInMemoryDatasource(config config.DataConfig) (*InMemoryDatasource, erro
 }
 
 func (d *InMemoryDatasource) GetProduct(code model.ProductCode) (model.Product, error) {
+	d.productsMux.RLock()
+	defer d.productsMux.RUnlock()
+
 	if product, ok := d.products[code]; ok {
 		return product, nil
 	}
@@ -57,11 +137,181 @@ func (d *InMemoryDatasource) GetProduct(code model.ProductCode) (model.Product,
 	return *new(model.Product), errors.NewProductNotFound(string(code))
 }
 
+// GetProducts returns the whole catalogue sorted by product code
+func (d *InMemoryDatasource) GetProducts() []model.Product {
+	d.productsMux.RLock()
+	defer d.productsMux.RUnlock()
+
+	products := make([]model.Product, 0, len(d.products))
+	for _, product := range d.products {
+		products = append(products, product)
+	}
+
+	sort.Slice(products, func(i, j int) bool {
+		return products[i].Code < products[j].Code
+	})
+
+	return products
+}
+
+func (d *InMemoryDatasource) AddProduct(product model.Product) error {
+	err := product.Validate()
+	if err != nil {
+		return err
+	}
+
+	d.productsMux.Lock()
+	defer d.productsMux.Unlock()
+
+	if _, ok := d.products[product.Code]; ok {
+		return errors.NewProductAlreadyExists(string(product.Code))
+	}
+
+	d.products[product.Code] = product
+
+	return nil
+}
+
+func (d *InMemoryDatasource) UpdateProduct(product model.Product) error {
+	err := product.Validate()
+	if err != nil {
+		return err
+	}
+
+	d.productsMux.Lock()
+	defer d.productsMux.Unlock()
+
+	if _, ok := d.products[product.Code]; !ok {
+		return errors.NewProductNotFound(string(product.Code))
+	}
+
+	d.products[product.Code] = product
+
+	return nil
+}
+
+func (d *InMemoryDatasource) DeleteProduct(code model.ProductCode) error {
+	d.productsMux.Lock()
+	defer d.productsMux.Unlock()
+
+	if _, ok := d.products[code]; !ok {
+		return errors.NewProductNotFound(string(code))
+	}
+
+	delete(d.products, code)
+
+	d.stockMux.Lock()
+	delete(d.stock, code)
+	d.stockMux.Unlock()
+
+	return nil
+}
+
+// GetPromotions returns the active set of promotions. The slice must not be modified
 func (d *InMemoryDatasource) GetPromotions() []model.Promotion {
-	return d.promotions[:]
+	d.promotionsMux.RLock()
+	defer d.promotionsMux.RUnlock()
+
+	return d.promotions
+}
+
+// GetPromotionDefinitions returns the definitions of the active promotions
+// in the same format they are received. The definitions must not be modified
+func (d *InMemoryDatasource) GetPromotionDefinitions() []map[string]interface{} {
+	d.promotionsMux.RLock()
+	defer d.promotionsMux.RUnlock()
+
+	return d.promotionDefinitions
+}
+
+func (d *InMemoryDatasource) GetPromotionDefinition(id string) (map[string]interface{}, error) {
+	d.promotionsMux.RLock()
+	defer d.promotionsMux.RUnlock()
+
+	for i, promotion := range d.promotions {
+		if promotion.GetId() == id {
+			return d.promotionDefinitions[i], nil
+		}
+	}
+
+	return nil, errors.NewPromotionNotFound(id)
+}
+
+// AddPromotion parses and adds a new promotion, returning its id. The id of the
+// definition is kept, or a new one is assigned if it has none
+func (d *InMemoryDatasource) AddPromotion(definition map[string]interface{}) (string, error) {
+	definition, promotion, err := newPromotion(newPromotionId(definition), definition, true)
+	if err != nil {
+		return "", invalidDefinitionError(err)
+	}
+
+	d.promotionsMux.Lock()
+	defer d.promotionsMux.Unlock()
+
+	for _, current := range d.promotions {
+		if current.GetId() == promotion.GetId() {
+			return "", errors.NewPromotionInvalid(promotion.GetId(), "duplicated id")
+		}
+	}
+
+	d.promotions = append(d.promotions[:len(d.promotions):len(d.promotions)], promotion)
+	d.promotionDefinitions = append(d.promotionDefinitions[:len(d.promotionDefinitions):len(d.promotionDefinitions)], definition)
+
+	return promotion.GetId(), nil
+}
+
+// UpdatePromotion replaces a promotion keeping its id and its position in the active set
+func (d *InMemoryDatasource) UpdatePromotion(id string, definition map[string]interface{}) error {
+	definition, promotion, err := newPromotion(id, definition, true)
+	if err != nil {
+		return invalidDefinitionError(err)
+	}
+
+	d.promotionsMux.Lock()
+	defer d.promotionsMux.Unlock()
+
+	for i, current := range d.promotions {
+		if current.GetId() == id {
+			promotions := make([]model.Promotion, len(d.promotions))
+			copy(promotions, d.promotions)
+			promotions[i] = promotion
+
+			definitions := make([]map[string]interface{}, len(d.promotionDefinitions))
+			copy(definitions, d.promotionDefinitions)
+			definitions[i] = definition
+
+			d.promotions, d.promotionDefinitions = promotions, definitions
+			return nil
+		}
+	}
+
+	return errors.NewPromotionNotFound(id)
+}
+
+func (d *InMemoryDatasource) DeletePromotion(id string) error {
+	d.promotionsMux.Lock()
+	defer d.promotionsMux.Unlock()
+
+	for i, current := range d.promotions {
+		if current.GetId() == id {
+			promotions := make([]model.Promotion, 0, len(d.promotions)-1)
+			promotions = append(append(promotions, d.promotions[:i]...), d.promotions[i+1:]...)
+
+			definitions := make([]map[string]interface{}, 0, len(d.promotionDefinitions)-1)
+			definitions = append(append(definitions, d.promotionDefinitions[:i]...), d.promotionDefinitions[i+1:]...)
+
+			d.promotions, d.promotionDefinitions = promotions, definitions
+			return nil
+		}
+	}
+
+	return errors.NewPromotionNotFound(id)
 }
 
 func (d *InMemoryDatasource) GetBasket(id string) (*model.Basket, error) {
+	d.basketsMux.RLock()
+	defer d.basketsMux.RUnlock()
+
 	if basket, ok := d.baskets[id]; ok {
 		return basket, nil
 	}
@@ -75,65 +325,411 @@ func (d *InMemoryDatasource) AddBasket(basket *model.Basket) error {
 
 	if _, ok := d.baskets[basket.Id]; !ok {
 		d.baskets[basket.Id] = basket
+		d.indexOwner(basket)
 		return nil
 	}
 
 	return errors.NewPrimaryKeyError(basket.Id)
 }
 
-func (d *InMemoryDatasource) DeleteBasket(basketId string) {
+// UpdateBasket applies the update to the stored basket. Baskets in memory are
+// modified in place, and updates run one at a time, so an update sees no other
+// change between its reads and writes
+func (d *InMemoryDatasource) UpdateBasket(id string, update func(*model.Basket) error) error {
+	d.updatesMux.Lock()
+	defer d.updatesMux.Unlock()
+
+	basket, err := d.GetBasket(id)
+	if err != nil {
+		return err
+	}
+
+	return update(basket)
+}
+
+func (d *InMemoryDatasource) DeleteBasket(basketId string) *model.Basket {
 	d.basketsMux.Lock()
 	defer d.basketsMux.Unlock()
 
+	basket, ok := d.baskets[basketId]
+	if !ok {
+		return nil
+	}
 	delete(d.baskets, basketId)
+	d.unindexOwner(basket)
+
+	return basket
+}
+
+// DeleteBasketsUpdatedBefore deletes the baskets not modified since the given
+// time, returning them
+func (d *InMemoryDatasource) DeleteBasketsUpdatedBefore(updatedBefore time.Time) []*model.Basket {
+	d.basketsMux.Lock()
+	defer d.basketsMux.Unlock()
+
+	deleted := make([]*model.Basket, 0)
+	for id, basket := range d.baskets {
+		if basket.UpdatedAt().Before(updatedBefore) {
+			delete(d.baskets, id)
+			d.unindexOwner(basket)
+			deleted = append(deleted, basket)
+		}
+	}
+
+	return deleted
+}
+
+func (d *InMemoryDatasource) GetBasketsByOwner(owner string) []*model.Basket {
+	d.basketsMux.RLock()
+	defer d.basketsMux.RUnlock()
+
+	baskets := make([]*model.Basket, 0, len(d.owners[owner]))
+	for id := range d.owners[owner] {
+		baskets = append(baskets, d.baskets[id])
+	}
+	sortBaskets(baskets)
+
+	return baskets
+}
+
+// indexOwner adds the basket to the index of its owner. It must be called holding
+// the baskets mutex
+func (d *InMemoryDatasource) indexOwner(basket *model.Basket) {
+	owner := basket.Owner()
+	if owner == "" {
+		return
+	}
+
+	if _, ok := d.owners[owner]; !ok {
+		d.owners[owner] = make(map[string]struct{})
+	}
+	d.owners[owner][basket.Id] = struct{}{}
+}
+
+// unindexOwner removes the basket from the index of its owner. It must be called
+// holding the baskets mutex
+func (d *InMemoryDatasource) unindexOwner(basket *model.Basket) {
+	owner := basket.Owner()
+	if owner == "" {
+		return
+	}
+
+	delete(d.owners[owner], basket.Id)
+	if len(d.owners[owner]) == 0 {
+		delete(d.owners, owner)
+	}
+}
+
+// UseCoupon counts a new use of the coupon, failing if it is unknown, expired at
+// the given time or all its uses are taken
+func (d *InMemoryDatasource) UseCoupon(code string, now time.Time) error {
+	coupon, ok := model.FindCoupon(d.GetPromotions(), code)
+	if !ok {
+		return errors.NewCouponNotFound(code)
+	}
+
+	d.couponsMux.Lock()
+	defer d.couponsMux.Unlock()
+
+	if err := checkCoupon(coupon, d.couponUses[code], now); err != nil {
+		return err
+	}
+	d.couponUses[code]++
+
+	return nil
+}
+
+// ReleaseCoupon gives back a use of the coupon
+func (d *InMemoryDatasource) ReleaseCoupon(code string) {
+	d.couponsMux.Lock()
+	defer d.couponsMux.Unlock()
+
+	if d.couponUses[code] > 0 {
+		d.couponUses[code]--
+	}
+}
+
+func (d *InMemoryDatasource) GetStock(code model.ProductCode) (model.Stock, error) {
+	d.productsMux.RLock()
+	defer d.productsMux.RUnlock()
+
+	if _, ok := d.products[code]; !ok {
+		return model.Stock{}, errors.NewProductNotFound(string(code))
+	}
+
+	d.stockMux.Lock()
+	defer d.stockMux.Unlock()
+
+	return d.stockOf(code), nil
+}
+
+// UpdateStock applies the update to the stock of a product of the catalogue. The
+// stock is only kept if the update succeeds and leaves it tracked
+func (d *InMemoryDatasource) UpdateStock(code model.ProductCode, update func(*model.Stock) error) error {
+	d.productsMux.RLock()
+	defer d.productsMux.RUnlock()
+
+	if _, ok := d.products[code]; !ok {
+		return errors.NewProductNotFound(string(code))
+	}
+
+	d.stockMux.Lock()
+	defer d.stockMux.Unlock()
+
+	stock := d.stockOf(code)
+	if err := update(&stock); err != nil {
+		return err
+	}
+	if stock.Tracked {
+		d.stock[code] = stock
+	}
+
+	return nil
+}
+
+func (d *InMemoryDatasource) stockOf(code model.ProductCode) model.Stock {
+	if stock, ok := d.stock[code]; ok {
+		return stock
+	}
+
+	return model.Stock{Code: code}
+}
+
+func (d *InMemoryDatasource) AddOrder(order model.Order) error {
+	d.ordersMux.Lock()
+	defer d.ordersMux.Unlock()
+
+	if _, ok := d.orderIndex[order.Id]; ok {
+		return errors.NewPrimaryKeyError(order.Id)
+	}
+
+	d.orderIndex[order.Id] = len(d.orders)
+	d.orders = append(d.orders, order)
+
+	return nil
+}
+
+func (d *InMemoryDatasource) GetOrder(id string) (model.Order, error) {
+	d.ordersMux.RLock()
+	defer d.ordersMux.RUnlock()
+
+	if i, ok := d.orderIndex[id]; ok {
+		return d.orders[i], nil
+	}
+
+	return model.Order{}, errors.NewOrderNotFound(id)
+}
+
+// UpdateOrder applies the update to a copy of the stored order, which is replaced
+// only if the update succeeds
+func (d *InMemoryDatasource) UpdateOrder(id string, update func(*model.Order) error) error {
+	d.ordersMux.Lock()
+	defer d.ordersMux.Unlock()
+
+	i, ok := d.orderIndex[id]
+	if !ok {
+		return errors.NewOrderNotFound(id)
+	}
+
+	order := d.orders[i]
+	if err := update(&order); err != nil {
+		return err
+	}
+	d.orders[i] = order
+
+	return nil
+}
+
+// GetOrders returns a page of orders, the most recent first, along with the total
+// number of orders
+func (d *InMemoryDatasource) GetOrders(offset, limit int) ([]model.Order, int) {
+	d.ordersMux.RLock()
+	defer d.ordersMux.RUnlock()
+
+	page := make([]model.Order, 0)
+	for i := len(d.orders) - 1 - offset; i >= 0 && len(page) < limit; i-- {
+		page = append(page, d.orders[i])
+	}
+
+	return page, len(d.orders)
+}
+
+// sortBaskets sorts the baskets by creation time, the most recent first
+func sortBaskets(baskets []*model.Basket) {
+	sort.SliceStable(baskets, func(i, j int) bool {
+		if baskets[i].CreatedAt().Equal(baskets[j].CreatedAt()) {
+			return baskets[i].Id < baskets[j].Id
+		}
+		return baskets[i].CreatedAt().After(baskets[j].CreatedAt())
+	})
+}
+
+// checkCoupon tells whether a coupon with the given uses can be used once more
+func checkCoupon(coupon model.Coupon, uses int, now time.Time) error {
+	if coupon.IsExpired(now) {
+		return errors.NewCouponExpired(coupon.Code)
+	}
+	if coupon.MaxUses > 0 && uses >= coupon.MaxUses {
+		return errors.NewCouponExhausted(coupon.Code)
+	}
+
+	return nil
 }
 
 func (d *InMemoryDatasource) loadProducts(filePath string) error {
+	products, err := readProducts(filePath, false)
+	if err != nil {
+		return err
+	}
+
+	d.products = products
+
+	return nil
+}
+
+func (d *InMemoryDatasource) loadPromotions(filePath string) error {
+	promotions, definitions, err := readPromotions(filePath, false)
+	if err != nil {
+		return err
+	}
+
+	d.promotions, d.promotionDefinitions = promotions, definitions
+
+	return nil
+}
+
+// readProducts reads a products file. Invalid products are skipped unless strict
+// is set, in which case the first one found fails the whole file
+func readProducts(filePath string, strict bool) (map[model.ProductCode]model.Product, error) {
 	var products []model.Product
 
 	file, err := ioutil.ReadFile(filePath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	err = json.Unmarshal(file, &products)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	productsByCode := make(map[model.ProductCode]model.Product, len(products))
 	for _, p := range products {
 		err := p.Validate()
-		if err == nil {
-			d.products[p.Code] = p
+		if err != nil {
+			if strict {
+				return nil, err
+			}
+			continue
+		}
+
+		if _, ok := productsByCode[p.Code]; ok && strict {
+			return nil, errors.NewProductAlreadyExists(string(p.Code))
 		}
+		productsByCode[p.Code] = p
 	}
 
-	return nil
+	return productsByCode, nil
 }
 
-func (d *InMemoryDatasource) loadPromotions(filePath string) error {
+// readPromotions reads a promotions file. Promotions of unknown types, invalid
+// entries of a promotion and promotions with a duplicated id are skipped unless
+// strict is set, any other invalid promotion fails the whole file
+func readPromotions(filePath string, strict bool) ([]model.Promotion, []map[string]interface{}, error) {
 	file, err := ioutil.ReadFile(filePath)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	var nodes []map[string]interface{}
 	err = json.Unmarshal(file, &nodes)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
+	promotions := make([]model.Promotion, 0, len(nodes))
+	definitions := make([]map[string]interface{}, 0, len(nodes))
+	ids := make(map[string]bool, len(nodes))
+	occurrences := make(map[string]int)
 	for _, promotionNode := range nodes {
-		promotion, err := parser.ParsePromotion(promotionNode)
+		// Promotions without id in the file get one derived from their definition, so
+		// they keep it across restarts and reloads. Identical definitions are told
+		// apart by how many of them come before
+		id, _ := promotionNode["id"].(string)
+		if id == "" {
+			content, err := json.Marshal(promotionNode)
+			if err != nil {
+				return nil, nil, err
+			}
+			occurrence := occurrences[string(content)]
+			occurrences[string(content)]++
+			if occurrence > 0 {
+				content = append(content, strconv.Itoa(occurrence)...)
+			}
+			id = uuid.NewSHA1(uuid.Nil, content).String()
+		}
+
+		if ids[id] {
+			if strict {
+				return nil, nil, errors.NewPromotionInvalid(id, "duplicated id")
+			}
+			logging.Logger.WithField("id", id).Warn("Promotion with a duplicated id skipped")
+			continue
+		}
+
+		definition, promotion, err := newPromotion(id, promotionNode, strict)
 		if err != nil {
-			if _, ok := err.(*errors.PromotionNotFound); !ok {
-				return err
+			if _, ok := err.(*errors.PromotionNotFound); !ok || strict {
+				return nil, nil, invalidDefinitionError(err)
 			}
 			continue
 		}
+		ids[id] = true
 
-		d.promotions = append(d.promotions, promotion)
+		promotions = append(promotions, promotion)
+		definitions = append(definitions, definition)
 	}
 
-	return nil
+	return promotions, definitions, nil
+}
+
+// newPromotion parses a promotion definition, setting on it the given id. Invalid
+// entries of the definition fail it when strict is set, otherwise they are skipped.
+// The definition received is not modified, a copy with the id is returned instead
+func newPromotion(id string, definition map[string]interface{}, strict bool) (map[string]interface{}, model.Promotion, error) {
+	withId := make(map[string]interface{}, len(definition)+1)
+	for key, value := range definition {
+		withId[key] = value
+	}
+	withId["id"] = id
+
+	parse := parser.ParsePromotion
+	if strict {
+		parse = parser.ParseStrictPromotion
+	}
+
+	promotion, err := parse(withId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return withId, promotion, nil
+}
+
+// newPromotionId returns the id of a definition, or a new one if it has none
+func newPromotionId(definition map[string]interface{}) string {
+	if id, _ := definition["id"].(string); id != "" {
+		return id
+	}
+
+	return uuid.New().String()
+}
+
+// Unknown promotion types are not a missing resource when they come in a definition
+func invalidDefinitionError(err error) error {
+	if promotionNotFound, ok := err.(*errors.PromotionNotFound); ok {
+		return errors.NewPromotionInvalid(promotionNotFound.Code, "unknown promotion type")
+	}
+
+	return err
 }
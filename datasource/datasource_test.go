@@ -1,49 +1,92 @@
 package datasource
 
 import (
+	"fmt"
 	"github.com/alfcope/checkouttest/config"
 	"github.com/alfcope/checkouttest/errors"
 	"github.com/alfcope/checkouttest/model"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/suite"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 )
 
+// DatasourceTestSuite is run against every datasource implementation
 type DatasourceTestSuite struct {
 	suite.Suite
-	inMemoryDatasource InMemoryDatasource
+	ds Datasource
+
+	// newDatasource initializes a datasource of the implementation under test,
+	// which must not share any data with the ones previously initialized
+	newDatasource func(config.DataConfig) (Datasource, error)
+	closers       []io.Closer
+}
+
+func TestInMemoryDatasourceTestSuite(t *testing.T) {
+	suite.Run(t, &DatasourceTestSuite{
+		newDatasource: func(dataConfig config.DataConfig) (Datasource, error) {
+			return InitInMemoryDatasource(dataConfig)
+		},
+	})
 }
 
-func TestDatasourceTestSuite(t *testing.T) {
-	suite.Run(t, new(DatasourceTestSuite))
+func TestBoltDatasourceTestSuite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	suite.Run(t, &DatasourceTestSuite{
+		newDatasource: func(dataConfig config.DataConfig) (Datasource, error) {
+			dataConfig.Driver = "bolt"
+			dataConfig.Database = filepath.Join(dir, uuid.New().String()+".db")
+			return NewDatasource(dataConfig)
+		},
+	})
 }
 
 func (suite *DatasourceTestSuite) SetupTest() {
-	suite.inMemoryDatasource = *suite.initializeDataSource()
+	suite.ds = suite.initializeDataSource()
 }
 
-func (suite *DatasourceTestSuite) initializeDataSource() *InMemoryDatasource {
+func (suite *DatasourceTestSuite) TearDownTest() {
+	for _, closer := range suite.closers {
+		_ = closer.Close()
+	}
+	suite.closers = nil
+}
+
+func (suite *DatasourceTestSuite) initializeDataSource() Datasource {
 	configuration, err := config.LoadConfiguration("../internal/tests/config", "service_config_test")
 	if err != nil {
-		suite.T().Errorf("Error loading configuration: %v", err.Error())
+		suite.T().Fatalf("Error loading configuration: %v", err.Error())
 	}
 
-	inMemoryDatasource, err := InitInMemoryDatasource(configuration.Data)
+	ds, err := suite.newDatasource(configuration.Data)
 	if err != nil {
-		suite.T().Errorf("Error initializing datasource: %s", err.Error())
+		suite.T().Fatalf("Error initializing datasource: %s", err.Error())
+	}
+	if closer, ok := ds.(io.Closer); ok {
+		suite.closers = append(suite.closers, closer)
 	}
-	suite.Equal(3, len(inMemoryDatasource.products))
-	suite.Equal(2, len(inMemoryDatasource.promotions))
+	suite.Equal(3, len(ds.GetProducts()))
+	suite.Equal(2, len(ds.GetPromotions()))
 
-	return inMemoryDatasource
+	return ds
 }
 
-func (suite *DatasourceTestSuite) TestInMemoryDatasource_GetNonExistingProduct() {
+func (suite *DatasourceTestSuite) TestDatasource_GetNonExistingProduct() {
 	// Given
 	var fakeProductCode model.ProductCode = "FAKE"
 
 	// When
-	_, err := suite.inMemoryDatasource.GetProduct(fakeProductCode)
+	_, err := suite.ds.GetProduct(fakeProductCode)
 
 	// Then
 	suite.NotNil(err)
@@ -54,25 +97,164 @@ func (suite *DatasourceTestSuite) TestInMemoryDatasource_GetNonExistingProduct()
 	}
 }
 
-func (suite *DatasourceTestSuite) TestInMemoryDatasource_GetProduct() {
+func (suite *DatasourceTestSuite) TestDatasource_GetProduct() {
 	// Given
 	var fakeProductCode model.ProductCode = "TSHIRT"
 
 	// When
-	p, err := suite.inMemoryDatasource.GetProduct(fakeProductCode)
+	p, err := suite.ds.GetProduct(fakeProductCode)
 
 	// Then
 	suite.Nil(err)
 	suite.Equal(fakeProductCode, model.ProductCode(p.Code))
-	suite.Equal(2000, p.Price)
+	suite.Equal(model.NewMoney(2000, "EUR"), p.Price)
 	suite.Equal("Cabify T-Shirt", p.Name)
 }
 
-func (suite *DatasourceTestSuite) TestInMemoryDatasource_GetPromotions() {
+func (suite *DatasourceTestSuite) TestDatasource_GetProducts() {
+	// Given
+
+	// When
+	products := suite.ds.GetProducts()
+
+	// Then
+	suite.Equal(3, len(products))
+	suite.Equal(model.ProductCode("MUG"), products[0].Code)
+	suite.Equal(model.ProductCode("TSHIRT"), products[1].Code)
+	suite.Equal(model.ProductCode("VOUCHER"), products[2].Code)
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_AddInvalidProduct() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+
+	// When
+	err := ds.AddProduct(model.Product{Code: "CAP", Name: "Cap", Price: model.NewMoney(0, "EUR")})
+
+	// Then
+	if _, ok := err.(*errors.ValidationError); !ok {
+		suite.T().Errorf("Wanted validation error, got %T", err)
+	}
+	suite.Equal(3, len(ds.GetProducts()))
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_AddDuplicatedProduct() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+
+	// When
+	err := ds.AddProduct(model.Product{Code: "MUG", Name: "Mug", Price: model.NewMoney(100, "EUR")})
+
+	// Then
+	if alreadyExists, ok := err.(*errors.ProductAlreadyExists); ok {
+		suite.Equal("MUG", alreadyExists.Code)
+	} else {
+		suite.T().Errorf("Wanted product already exists error, got %T", err)
+	}
+	p, _ := ds.GetProduct("MUG")
+	suite.Equal(model.NewMoney(750, "EUR"), p.Price)
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_AddProduct() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+	product := model.Product{Code: "CAP", Name: "Cabify Cap", Price: model.NewMoney(1200, "EUR")}
+
+	// When
+	err := ds.AddProduct(product)
+
+	// Then
+	suite.Nil(err)
+	p, err := ds.GetProduct("CAP")
+	suite.Nil(err)
+	suite.Equal(product, p)
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_UpdateNonExistingProduct() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+
+	// When
+	err := ds.UpdateProduct(model.Product{Code: "CAP", Name: "Cabify Cap", Price: model.NewMoney(1200, "EUR")})
+
+	// Then
+	if _, ok := err.(*errors.ProductNotFound); !ok {
+		suite.T().Errorf("Wanted product not found error, got %T", err)
+	}
+	suite.Equal(3, len(ds.GetProducts()))
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_UpdateProduct() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+	product := model.Product{Code: "MUG", Name: "Cabify Mug", Price: model.NewMoney(800, "EUR")}
+
+	// When
+	err := ds.UpdateProduct(product)
+
+	// Then
+	suite.Nil(err)
+	p, err := ds.GetProduct("MUG")
+	suite.Nil(err)
+	suite.Equal(product, p)
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_DeleteProduct() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+
+	// When
+	err := ds.DeleteProduct("MUG")
+
+	// Then
+	suite.Nil(err)
+	_, err = ds.GetProduct("MUG")
+	suite.NotNil(err)
+
+	err = ds.DeleteProduct("MUG")
+	if _, ok := err.(*errors.ProductNotFound); !ok {
+		suite.T().Errorf("Wanted product not found error, got %T", err)
+	}
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_ConcurrentProductUpdates() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+	var wg sync.WaitGroup
+
+	// When
+	for i := 1; i <= 50; i++ {
+		wg.Add(2)
+		go func(price int) {
+			defer wg.Done()
+			_ = ds.UpdateProduct(model.Product{Code: "MUG", Name: "Cabify Mug", Price: model.NewMoney(price, "EUR")})
+		}(i)
+		go func() {
+			defer wg.Done()
+			_, _ = ds.GetProduct("MUG")
+			_ = ds.GetProducts()
+		}()
+	}
+	wg.Wait()
+
+	// Then
+	p, err := ds.GetProduct("MUG")
+	suite.Nil(err)
+	suite.True(p.Price.Amount > 0 && p.Price.Amount <= 50)
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_GetPromotions() {
 	// Given
 
 	// When
-	p := suite.inMemoryDatasource.GetPromotions()
+	p := suite.ds.GetPromotions()
 
 	// Then
 	suite.Equal(2, len(p))
@@ -80,12 +262,207 @@ func (suite *DatasourceTestSuite) TestInMemoryDatasource_GetPromotions() {
 	suite.Equal(model.PromotionType("FREE_ITEMS"), p[1].GetType())
 }
 
-func (suite *DatasourceTestSuite) TestInMemoryDatasource_GetNonExistingBasket() {
+func (suite *DatasourceTestSuite) TestDatasource_GetPromotionDefinitions() {
+	// Given
+
+	// When
+	definitions := suite.ds.GetPromotionDefinitions()
+	promotions := suite.ds.GetPromotions()
+
+	// Then
+	suite.Equal(2, len(definitions))
+	for i, definition := range definitions {
+		suite.NotEqual("", promotions[i].GetId())
+		suite.Equal(promotions[i].GetId(), definition["id"])
+
+		d, err := suite.ds.GetPromotionDefinition(promotions[i].GetId())
+		suite.Nil(err)
+		suite.Equal(definition, d)
+	}
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_AddInvalidPromotion() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+
+	// When
+	_, errUnknown := ds.AddPromotion(map[string]interface{}{"code": "FAKE", "promos": []interface{}{}})
+	_, errEmpty := ds.AddPromotion(map[string]interface{}{"code": "BULK", "promos": []interface{}{}})
+
+	// Then
+	suite.EqualError(errUnknown, errors.NewPromotionInvalid("FAKE", "unknown promotion type").Error())
+	suite.EqualError(errEmpty, errors.NewPromotionInvalid("BULK", "empty items list").Error())
+	suite.Equal(2, len(ds.GetPromotions()))
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_AddPartlyInvalidPromotion() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+	id := ds.GetPromotions()[0].GetId()
+	definition := map[string]interface{}{"code": "BULK", "promos": []interface{}{
+		map[string]interface{}{"product": "MUG", "rules": []interface{}{
+			map[string]interface{}{"buy": float64(2), "price": float64(600)},
+			map[string]interface{}{"buy": float64(0), "price": float64(500)}}}}}
+
+	// When
+	_, errAdd := ds.AddPromotion(definition)
+	errUpdate := ds.UpdatePromotion(id, definition)
+
+	// Then
+	wanted := errors.NewPromotionInvalid("BULK", "promos[0].rules[1]: invalid amount to buy 0").Error()
+	suite.EqualError(errAdd, wanted)
+	suite.EqualError(errUpdate, wanted)
+	suite.Equal(2, len(ds.GetPromotions()))
+	suite.Equal(model.PromotionType("BULK"), ds.GetPromotions()[0].GetType())
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_AddPromotion() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+	before := ds.GetPromotions()
+	definition := map[string]interface{}{"code": "BULK", "promos": []interface{}{
+		map[string]interface{}{"product": "MUG", "rules": []interface{}{map[string]interface{}{"buy": float64(2), "price": float64(600)}}}}}
+
+	// When
+	id, err := ds.AddPromotion(definition)
+
+	// Then
+	suite.Nil(err)
+	suite.NotEmpty(id)
+	suite.Nil(definition["id"])
+
+	promotions := ds.GetPromotions()
+	suite.Equal(3, len(promotions))
+	suite.Equal(id, promotions[2].GetId())
+	suite.Equal(2, len(before))
+
+	stored, err := ds.GetPromotionDefinition(id)
+	suite.Nil(err)
+	suite.Equal(id, stored["id"])
+	suite.Equal(definition["promos"], stored["promos"])
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_AddPromotionWithId() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+	definition := map[string]interface{}{"id": "bulk-mug", "code": "BULK", "promos": []interface{}{
+		map[string]interface{}{"product": "MUG", "rules": []interface{}{map[string]interface{}{"buy": float64(2), "price": float64(600)}}}}}
+
+	// When
+	id, err := ds.AddPromotion(definition)
+	_, errDuplicated := ds.AddPromotion(definition)
+
+	// Then
+	suite.Nil(err)
+	suite.Equal("bulk-mug", id)
+	suite.EqualError(errDuplicated, errors.NewPromotionInvalid("bulk-mug", "duplicated id").Error())
+	suite.Equal(3, len(ds.GetPromotions()))
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_UpdateNonExistingPromotion() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+	definition := map[string]interface{}{"code": "BULK", "promos": []interface{}{
+		map[string]interface{}{"product": "MUG", "rules": []interface{}{map[string]interface{}{"buy": float64(2), "price": float64(600)}}}}}
+
+	// When
+	err := ds.UpdatePromotion("FAKE", definition)
+
+	// Then
+	if _, ok := err.(*errors.PromotionNotFound); !ok {
+		suite.T().Errorf("Wanted promotion not found error, got %T", err)
+	}
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_UpdatePromotion() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+	before := ds.GetPromotions()
+	id := before[0].GetId()
+	definition := map[string]interface{}{"code": "FREE_ITEMS", "promos": []interface{}{
+		map[string]interface{}{"product": "MUG", "rules": []interface{}{map[string]interface{}{"buy": float64(2), "free": float64(1)}}}}}
+
+	// When
+	err := ds.UpdatePromotion(id, definition)
+
+	// Then
+	suite.Nil(err)
+	promotions := ds.GetPromotions()
+	suite.Equal(2, len(promotions))
+	suite.Equal(id, promotions[0].GetId())
+	suite.Equal(model.PromotionType("FREE_ITEMS"), promotions[0].GetType())
+	// Previous snapshots are not modified
+	suite.Equal(model.PromotionType("BULK"), before[0].GetType())
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_DeletePromotion() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+	before := ds.GetPromotions()
+	id := before[0].GetId()
+
+	// When
+	err := ds.DeletePromotion(id)
+
+	// Then
+	suite.Nil(err)
+	promotions := ds.GetPromotions()
+	suite.Equal(1, len(promotions))
+	suite.Equal(model.PromotionType("FREE_ITEMS"), promotions[0].GetType())
+	suite.Equal(1, len(ds.GetPromotionDefinitions()))
+	suite.Equal(2, len(before))
+	suite.Equal(id, before[0].GetId())
+
+	_, err = ds.GetPromotionDefinition(id)
+	if _, ok := err.(*errors.PromotionNotFound); !ok {
+		suite.T().Errorf("Wanted promotion not found error, got %T", err)
+	}
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_ConcurrentPromotionUpdates() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+	basket := model.NewBasket(uuid.New().String())
+	_ = basket.AddProducts([]model.Line{model.NewLine(model.Product{Code: "MUG", Name: "Mug", Price: model.NewMoney(750, "EUR")}, 4)})
+	var wg sync.WaitGroup
+
+	// When
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			id, err := ds.AddPromotion(map[string]interface{}{"code": "BULK", "promos": []interface{}{
+				map[string]interface{}{"product": "MUG", "rules": []interface{}{map[string]interface{}{"buy": float64(2), "price": float64(600)}}}}})
+			if err == nil {
+				_ = ds.DeletePromotion(id)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			basket.CalculatePrice(ds.GetPromotions())
+		}()
+	}
+	wg.Wait()
+
+	// Then
+	suite.Equal(2, len(ds.GetPromotions()))
+	suite.Equal(2, len(ds.GetPromotionDefinitions()))
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_GetNonExistingBasket() {
 	// Given
 	basketId := uuid.New().String()
 
 	// When
-	_, err := suite.inMemoryDatasource.GetBasket(basketId)
+	_, err := suite.ds.GetBasket(basketId)
 
 	// Then
 	suite.NotNil(err)
@@ -96,30 +473,33 @@ func (suite *DatasourceTestSuite) TestInMemoryDatasource_GetNonExistingBasket()
 	}
 }
 
-func (suite *DatasourceTestSuite) TestInMemoryDatasource_GetBasket() {
+func (suite *DatasourceTestSuite) TestDatasource_GetBasket() {
 	// Given
-	// Not using the in-memory datasource from the suite to avoid concurrency errors
-	inMemoryDatasource := suite.initializeDataSource()
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
 	basket := model.NewBasket(uuid.New().String())
-	inMemoryDatasource.baskets = map[string]*model.Basket{basket.Id: basket}
+	_ = basket.AddProducts([]model.Line{model.NewLine(model.Product{Code: "MUG", Name: "Mug", Price: model.NewMoney(750, "EUR")}, 2)})
+	_ = ds.AddBasket(basket)
 
 	// When
-	b, err := inMemoryDatasource.GetBasket(basket.Id)
+	b, err := ds.GetBasket(basket.Id)
 
 	// Then
 	suite.Nil(err)
-	suite.Equal(basket, b)
+	suite.Equal(basket.Id, b.Id)
+	suite.Equal(basket.Lines(), b.Lines())
+	suite.True(basket.CreatedAt().Equal(b.CreatedAt()))
 }
 
-func (suite *DatasourceTestSuite) TestInMemoryDatasource_AddBasketDuplicated() {
+func (suite *DatasourceTestSuite) TestDatasource_AddBasketDuplicated() {
 	// Given
-	// Not using the in-memory datasource from the suite to avoid concurrency errors
-	inMemoryDatasource := suite.initializeDataSource()
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
 	basket := model.NewBasket(uuid.New().String())
-	inMemoryDatasource.baskets = map[string]*model.Basket{basket.Id: basket}
+	_ = ds.AddBasket(basket)
 
 	// When
-	err := inMemoryDatasource.AddBasket(basket)
+	err := ds.AddBasket(basket)
 
 	// Then
 	suite.NotNil(err)
@@ -128,46 +508,442 @@ func (suite *DatasourceTestSuite) TestInMemoryDatasource_AddBasketDuplicated() {
 	} else {
 		suite.T().Errorf("Wanted primary key error, got %T", err)
 	}
-	suite.Equal(1, len(inMemoryDatasource.baskets))
 }
 
-func (suite *DatasourceTestSuite) TestInMemoryDatasource_AddBasket() {
+func (suite *DatasourceTestSuite) TestDatasource_AddBasket() {
 	// Given
-	// Not using the in-memory datasource from the suite to avoid concurrency errors
-	inMemoryDatasource := suite.initializeDataSource()
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
 	basket := model.NewBasket(uuid.New().String())
 
 	// When
-	err := inMemoryDatasource.AddBasket(basket)
+	err := ds.AddBasket(basket)
 
 	// Then
 	suite.Nil(err)
-	suite.Equal(1, len(inMemoryDatasource.baskets))
+	_, err = ds.GetBasket(basket.Id)
+	suite.Nil(err)
 }
 
-func (suite *DatasourceTestSuite) TestInMemoryDatasource_DeleteNonExistingBasket() {
+func (suite *DatasourceTestSuite) TestDatasource_UpdateNonExistingBasket() {
+	// Given
+	basketId := uuid.New().String()
+
+	// When
+	err := suite.ds.UpdateBasket(basketId, func(basket *model.Basket) error {
+		suite.T().Error("Update should not be called for a non existing basket")
+		return nil
+	})
+
+	// Then
+	if _, ok := err.(*errors.BasketNotFound); !ok {
+		suite.T().Errorf("Wanted basket not found error, got %T", err)
+	}
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_UpdateBasket() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+	basket := model.NewBasket(uuid.New().String())
+	_ = ds.AddBasket(basket)
+	mug, _ := ds.GetProduct("MUG")
+
+	// When
+	err := ds.UpdateBasket(basket.Id, func(b *model.Basket) error {
+		return b.AddProducts([]model.Line{model.NewLine(mug, 3)})
+	})
+
+	// Then
+	suite.Nil(err)
+	b, err := ds.GetBasket(basket.Id)
+	suite.Nil(err)
+	suite.Equal([]model.Line{model.NewLine(mug, 3)}, b.Lines())
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_FailedBasketUpdate() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+	basket := model.NewBasket(uuid.New().String())
+	_ = ds.AddBasket(basket)
+	mug, _ := ds.GetProduct("MUG")
+
+	// When
+	err := ds.UpdateBasket(basket.Id, func(b *model.Basket) error {
+		return b.AddProducts([]model.Line{model.NewLine(mug, 1), model.NewLine(mug, -1)})
+	})
+
+	// Then
+	suite.NotNil(err)
+	b, _ := ds.GetBasket(basket.Id)
+	suite.Equal(0, len(b.Lines()))
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_ConcurrentBasketUpdates() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+	basket := model.NewBasket(uuid.New().String())
+	_ = ds.AddBasket(basket)
+	mug, _ := ds.GetProduct("MUG")
+	var wg sync.WaitGroup
+
+	// When
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = ds.UpdateBasket(basket.Id, func(b *model.Basket) error {
+				return b.AddProduct(mug)
+			})
+		}()
+	}
+	wg.Wait()
+
+	// Then
+	b, _ := ds.GetBasket(basket.Id)
+	suite.Equal([]model.Line{model.NewLine(mug, 20)}, b.Lines())
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_DeleteBasketsUpdatedBefore() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+	now := time.Now().UTC()
+	old := model.RestoreBasket(uuid.New().String(), "", model.DefaultCurrency, []model.Line{}, nil, "", now.Add(-2*time.Hour), now.Add(-2*time.Hour))
+	recent := model.RestoreBasket(uuid.New().String(), "", model.DefaultCurrency, []model.Line{}, nil, "", now.Add(-2*time.Hour), now.Add(-time.Minute))
+	_ = ds.AddBasket(old)
+	_ = ds.AddBasket(recent)
+
+	// When
+	deleted := ds.DeleteBasketsUpdatedBefore(now.Add(-time.Hour))
+
+	// Then
+	suite.Equal(1, len(deleted))
+	suite.Equal(old.Id, deleted[0].Id)
+	_, err := ds.GetBasket(old.Id)
+	if _, ok := err.(*errors.BasketNotFound); !ok {
+		suite.T().Errorf("Wanted basket not found error, got %T", err)
+	}
+	_, err = ds.GetBasket(recent.Id)
+	suite.Nil(err)
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_DeleteNonExistingBasket() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+	basket := model.NewBasket(uuid.New().String())
+	_ = ds.AddBasket(basket)
+
+	// When
+	deleted := ds.DeleteBasket(uuid.New().String())
+
+	// Then
+	suite.Nil(deleted)
+	_, err := ds.GetBasket(basket.Id)
+	suite.Nil(err)
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_DeleteBasket() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+	basket := model.NewBasket(uuid.New().String())
+	_ = ds.AddBasket(basket)
+
+	// When
+	deleted := ds.DeleteBasket(basket.Id)
+
+	// Then
+	suite.Equal(basket.Id, deleted.Id)
+	_, err := ds.GetBasket(basket.Id)
+	if _, ok := err.(*errors.BasketNotFound); !ok {
+		suite.T().Errorf("Wanted basket not found error, got %T", err)
+	}
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_GetBasketsByOwner() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+	now := time.Now().UTC()
+	older := model.RestoreBasket(uuid.New().String(), "C1", model.DefaultCurrency, []model.Line{}, nil, "", now.Add(-time.Hour), now)
+	newer := model.RestoreBasket(uuid.New().String(), "C1", model.DefaultCurrency, []model.Line{}, nil, "", now, now)
+	_ = ds.AddBasket(older)
+	_ = ds.AddBasket(newer)
+	_ = ds.AddBasket(model.NewCustomerBasket(uuid.New().String(), "C2", model.DefaultCurrency))
+	_ = ds.AddBasket(model.NewBasket(uuid.New().String()))
+
+	// When
+	baskets := ds.GetBasketsByOwner("C1")
+
+	// Then
+	suite.Equal(2, len(baskets))
+	suite.Equal(newer.Id, baskets[0].Id)
+	suite.Equal("C1", baskets[0].Owner())
+	suite.Equal(older.Id, baskets[1].Id)
+	suite.Equal(0, len(ds.GetBasketsByOwner("C3")))
+
+	// Deleted baskets leave the index of their owner
+	ds.DeleteBasket(newer.Id)
+	ds.DeleteBasketsUpdatedBefore(now.Add(time.Minute))
+	suite.Equal(0, len(ds.GetBasketsByOwner("C1")))
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_UseUnknownCoupon() {
+	// When
+	err := suite.ds.UseCoupon("UNKNOWN", time.Now())
+
+	// Then
+	if _, ok := err.(*errors.CouponNotFound); !ok {
+		suite.T().Errorf("Wanted coupon not found error, got %T", err)
+	}
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_UseCoupon() {
+	// Given
+	ds := suite.initializeDataSource()
+	expiresAt := time.Date(2021, time.September, 1, 0, 0, 0, 0, time.UTC)
+	_, err := ds.AddPromotion(map[string]interface{}{"code": "PERCENTAGE",
+		"coupon": map[string]interface{}{"code": "SUMMER", "maxUses": float64(2), "expiresAt": expiresAt.Format(time.RFC3339)},
+		"promos": []interface{}{map[string]interface{}{"product": "MUG", "rules": []interface{}{
+			map[string]interface{}{"buy": float64(1), "percentage": float64(10)}}}}})
+	suite.Nil(err)
+	now := expiresAt.Add(-time.Hour)
+
+	// When
+	first := ds.UseCoupon("SUMMER", now)
+	second := ds.UseCoupon("SUMMER", now)
+	exhausted := ds.UseCoupon("SUMMER", now)
+	ds.ReleaseCoupon("SUMMER")
+	released := ds.UseCoupon("SUMMER", now)
+	ds.ReleaseCoupon("SUMMER")
+	expired := ds.UseCoupon("SUMMER", expiresAt)
+
+	// Then
+	suite.Nil(first)
+	suite.Nil(second)
+	if _, ok := exhausted.(*errors.CouponExhausted); !ok {
+		suite.T().Errorf("Wanted coupon exhausted error, got %T", exhausted)
+	}
+	suite.Nil(released)
+	if _, ok := expired.(*errors.CouponExpired); !ok {
+		suite.T().Errorf("Wanted coupon expired error, got %T", expired)
+	}
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_UpdateBasketCoupons() {
 	// Given
-	// Not using the in-memory datasource from the suite to avoid concurrency errors
-	inMemoryDatasource := suite.initializeDataSource()
 	basket := model.NewBasket(uuid.New().String())
-	inMemoryDatasource.AddBasket(basket)
+	_ = suite.ds.AddBasket(basket)
+
+	// When
+	err := suite.ds.UpdateBasket(basket.Id, func(b *model.Basket) error {
+		return b.AddCoupon("SUMMER")
+	})
+
+	// Then
+	suite.Nil(err)
+	b, err := suite.ds.GetBasket(basket.Id)
+	suite.Nil(err)
+	suite.Equal([]string{"SUMMER"}, b.Coupons())
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_AddBasketInCurrency() {
+	// Given
+	basket := model.NewBasketInCurrency(uuid.New().String(), "USD")
 
 	// When
-	inMemoryDatasource.DeleteBasket(uuid.New().String())
+	err := suite.ds.AddBasket(basket)
 
 	// Then
-	suite.Equal(1, len(inMemoryDatasource.baskets))
+	suite.Nil(err)
+	b, err := suite.ds.GetBasket(basket.Id)
+	suite.Nil(err)
+	suite.Equal(model.Currency("USD"), b.Currency())
 }
 
-func (suite *DatasourceTestSuite) TestInMemoryDatasource_DeleteBasket() {
+func (suite *DatasourceTestSuite) TestDatasource_UpdateBasketCheckOut() {
 	// Given
-	// Not using the in-memory datasource from the suite to avoid concurrency errors
-	inMemoryDatasource := suite.initializeDataSource()
 	basket := model.NewBasket(uuid.New().String())
+	_ = suite.ds.AddBasket(basket)
+
+	// When
+	err := suite.ds.UpdateBasket(basket.Id, func(b *model.Basket) error {
+		return b.CheckOut("O1")
+	})
+
+	// Then
+	suite.Nil(err)
+	b, err := suite.ds.GetBasket(basket.Id)
+	suite.Nil(err)
+	suite.Equal("O1", b.OrderId())
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_GetNonExistingOrder() {
+	// When
+	_, err := suite.ds.GetOrder("O1")
+
+	// Then
+	if _, ok := err.(*errors.OrderNotFound); !ok {
+		suite.T().Errorf("Wanted order not found error, got %T", err)
+	}
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_AddOrder() {
+	// Given
+	receipt := model.Receipt{
+		Lines: []model.ReceiptLine{{
+			Product:  model.Product{Code: "VOUCHER", Name: "Voucher", Price: model.NewMoney(500, "EUR")},
+			Quantity: 2,
+			Subtotal: model.NewMoney(1000, "EUR"),
+			Promotions: []model.AppliedPromotion{
+				{Id: "P1", Type: "FREE_ITEMS", Units: 1, Discount: model.NewMoney(500, "EUR")}},
+			Total: model.NewMoney(500, "EUR"),
+		}},
+		Subtotal: model.NewMoney(500, "EUR"),
+		Total:    model.NewMoney(500, "EUR"),
+	}
+	order := model.NewOrder("O1", "B1", "C1", []string{"SUMMER"}, receipt, "A1", time.Now())
+
+	// When
+	err := suite.ds.AddOrder(order)
+
+	// Then
+	suite.Nil(err)
+	o, err := suite.ds.GetOrder("O1")
+	suite.Nil(err)
+	suite.Equal(order.Id, o.Id)
+	suite.Equal(order.BasketId, o.BasketId)
+	suite.Equal(order.Coupons, o.Coupons)
+	suite.Equal(order.Receipt, o.Receipt)
+	suite.True(order.CreatedAt.Equal(o.CreatedAt))
+
+	_, ok := suite.ds.AddOrder(order).(*errors.PrimaryKeyError)
+	suite.True(ok, "An order should not be added twice")
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_GetOrders() {
+	// Given
+	createdAt := time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC)
+	for i := 1; i <= 5; i++ {
+		_ = suite.ds.AddOrder(model.NewOrder(fmt.Sprintf("O%d", i), "B1", "", nil, model.Receipt{}, "",
+			createdAt.Add(time.Duration(i)*time.Minute)))
+	}
+
+	// When
+	first, total := suite.ds.GetOrders(0, 2)
+	last, _ := suite.ds.GetOrders(4, 2)
+	beyond, _ := suite.ds.GetOrders(10, 2)
+
+	// Then
+	suite.Equal(5, total)
+	suite.Equal([]string{"O5", "O4"}, orderIds(first))
+	suite.Equal([]string{"O1"}, orderIds(last))
+	suite.Empty(beyond)
+}
+
+func orderIds(orders []model.Order) []string {
+	ids := make([]string, 0, len(orders))
+	for _, order := range orders {
+		ids = append(ids, order.Id)
+	}
+
+	return ids
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_UpdateOrder() {
+	// Given
+	_ = suite.ds.AddOrder(model.NewOrder("O1", "B1", "", nil, model.Receipt{}, "A1", time.Now()))
+
+	// When
+	err := suite.ds.UpdateOrder("O1", func(o *model.Order) error {
+		return o.Pay(time.Now())
+	})
+	failed := suite.ds.UpdateOrder("O1", func(o *model.Order) error {
+		o.Payment = "A2"
+		return o.Pay(time.Now())
+	})
+	missing := suite.ds.UpdateOrder("O2", func(o *model.Order) error { return nil })
+
+	// Then
+	suite.Nil(err)
+	suite.NotNil(failed)
+	_, ok := missing.(*errors.OrderNotFound)
+	suite.True(ok, "Wanted order not found error, got %T", missing)
+
+	o, _ := suite.ds.GetOrder("O1")
+	suite.Equal(model.OrderPaid, o.State)
+	suite.Equal("A1", o.Payment, "A failed update should not be saved")
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_GetStock() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+
+	// When
+	stock, err := ds.GetStock("MUG")
+	_, missing := ds.GetStock("FAKE")
+
+	// Then
+	suite.Nil(err)
+	suite.Equal(model.Stock{Code: "MUG"}, stock, "Products are not tracked until their stock is set")
+	_, ok := missing.(*errors.ProductNotFound)
+	suite.True(ok, "Wanted product not found error, got %T", missing)
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_UpdateStock() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+	_ = ds.UpdateStock("MUG", func(s *model.Stock) error { return s.SetOnHand(3) })
+
+	// When
+	err := ds.UpdateStock("MUG", func(s *model.Stock) error { return s.Reserve(2) })
+	failed := ds.UpdateStock("MUG", func(s *model.Stock) error { return s.Reserve(2) })
+
+	// Then
+	suite.Nil(err)
+	_, ok := failed.(*errors.OutOfStock)
+	suite.True(ok, "Wanted out of stock error, got %T", failed)
+	stock, _ := ds.GetStock("MUG")
+	suite.Equal(model.Stock{Code: "MUG", Tracked: true, OnHand: 3, Reserved: 2}, stock)
+
+	// The stock is dropped along with its product
+	_ = ds.DeleteProduct("MUG")
+	_ = ds.AddProduct(model.Product{Code: "MUG", Name: "Cabify Mug", Price: model.NewMoney(750, "EUR")})
+	stock, _ = ds.GetStock("MUG")
+	suite.False(stock.Tracked)
+}
+
+func (suite *DatasourceTestSuite) TestDatasource_ConcurrentStockReservations() {
+	// Given
+	// Not using the datasource from the suite to avoid concurrency errors
+	ds := suite.initializeDataSource()
+	_ = ds.UpdateStock("MUG", func(s *model.Stock) error { return s.SetOnHand(20) })
+	var wg sync.WaitGroup
+	var mux sync.Mutex
+	reserved := 0
 
 	// When
-	inMemoryDatasource.DeleteBasket(basket.Id)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ds.UpdateStock("MUG", func(s *model.Stock) error { return s.Reserve(1) }) == nil {
+				mux.Lock()
+				reserved++
+				mux.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
 
 	// Then
-	suite.Equal(0, len(inMemoryDatasource.baskets))
+	suite.Equal(20, reserved)
+	stock, _ := ds.GetStock("MUG")
+	suite.Equal(0, stock.Available())
 }
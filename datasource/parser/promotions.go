@@ -4,62 +4,318 @@ import (
 	"fmt"
 	"github.com/alfcope/checkouttest/errors"
 	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"time"
 )
 
+// invalidEntries collects why entries of a promotion definition were discarded
+type invalidEntries []string
+
+func (i *invalidEntries) add(format string, args ...interface{}) {
+	*i = append(*i, fmt.Sprintf(format, args...))
+}
+
+// ParsePromotion reads a promotion definition. Its invalid entries are skipped and
+// logged, the promotion failing only when none of them is left
 func ParsePromotion(nodes map[string]interface{}) (model.Promotion, error) {
+	var invalid invalidEntries
+
+	promotion, err := parsePromotion(nodes, &invalid)
+	for _, description := range invalid {
+		logging.Logger.WithFields(logrus.Fields{
+			"code": nodes["code"],
+			"id":   nodes["id"],
+		}).Warnf("Promotion entry skipped: %v", description)
+	}
+
+	return promotion, err
+}
+
+// ParseStrictPromotion reads a promotion definition like ParsePromotion, but fails
+// describing every invalid entry instead of skipping them
+func ParseStrictPromotion(nodes map[string]interface{}) (model.Promotion, error) {
+	var invalid invalidEntries
+
+	promotion, err := parsePromotion(nodes, &invalid)
+	if len(invalid) > 0 {
+		code, _ := nodes["code"].(string)
+		return nil, errors.NewPromotionInvalid(code, strings.Join(invalid, "; "))
+	}
+
+	return promotion, err
+}
+
+func parsePromotion(nodes map[string]interface{}, invalid *invalidEntries) (model.Promotion, error) {
 
 	if _, ok := nodes["code"]; !ok {
 		return nil, errors.NewPromotionNotFound("")
 	}
 
-	switch nodes["code"].(string) {
+	code, ok := nodes["code"].(string)
+	if !ok {
+		return nil, errors.NewPromotionInvalid(fmt.Sprint(nodes["code"]), "invalid promotion code")
+	}
+
+	settings, err := parseSettings(code, nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch code {
 	case "BULK":
-		return parseBulkPromotion(nodes)
+		promotion, err := parseBulkPromotion(nodes, invalid)
+		if err != nil {
+			return nil, err
+		}
+		promotion.PromotionSettings = settings
+		return promotion, nil
 
 	case "FREE_ITEMS":
-		return parseFreeItemsPromotion(nodes)
+		promotion, err := parseFreeItemsPromotion(nodes, invalid)
+		if err != nil {
+			return nil, err
+		}
+		promotion.PromotionSettings = settings
+		return promotion, nil
+
+	case "PERCENTAGE":
+		promotion, err := parsePercentagePromotion(nodes, invalid)
+		if err != nil {
+			return nil, err
+		}
+		promotion.PromotionSettings = settings
+		return promotion, nil
+
+	case "BUNDLE":
+		promotion, err := parseBundlePromotion(nodes, invalid)
+		if err != nil {
+			return nil, err
+		}
+		promotion.PromotionSettings = settings
+		return promotion, nil
+
+	case "THRESHOLD":
+		promotion, err := parseThresholdPromotion(nodes, invalid)
+		if err != nil {
+			return nil, err
+		}
+		promotion.PromotionSettings = settings
+		return promotion, nil
 
 	default:
-		return nil, errors.NewPromotionNotFound(nodes["code"].(string))
+		return nil, errors.NewPromotionNotFound(code)
 	}
 }
 
-func parseBulkPromotion(nodes map[string]interface{}) (*model.BulkPromotion, error) {
+// parseSettings reads the attributes shared by every type of promotion. Promotions
+// are stackable unless stated otherwise
+func parseSettings(code string, nodes map[string]interface{}) (model.PromotionSettings, error) {
+	settings := model.DefaultPromotionSettings()
+
+	if rawId, ok := nodes["id"]; ok {
+		id, ok := rawId.(string)
+		if !ok {
+			return settings, errors.NewPromotionInvalid(code, "invalid id")
+		}
+		settings.Id = id
+	}
+
+	if rawPriority, ok := nodes["priority"]; ok {
+		priority, ok := rawPriority.(float64)
+		if !ok || priority != float64(int(priority)) {
+			return settings, errors.NewPromotionInvalid(code, "invalid priority")
+		}
+		settings.Priority = int(priority)
+	}
+
+	if rawGroup, ok := nodes["group"]; ok {
+		group, ok := rawGroup.(string)
+		if !ok {
+			return settings, errors.NewPromotionInvalid(code, "invalid group")
+		}
+		settings.Group = group
+	}
+
+	if rawStackable, ok := nodes["stackable"]; ok {
+		stackable, ok := rawStackable.(bool)
+		if !ok {
+			return settings, errors.NewPromotionInvalid(code, "invalid stackable flag")
+		}
+		settings.Stackable = stackable
+	}
+
+	schedule, err := parseSchedule(code, nodes)
+	if err != nil {
+		return settings, err
+	}
+	settings.Schedule = schedule
+
+	if rawCoupon, ok := nodes["coupon"]; ok {
+		coupon, err := parseCoupon(code, rawCoupon)
+		if err != nil {
+			return settings, err
+		}
+		settings.Coupon = coupon
+	}
+
+	return settings, nil
+}
+
+// parseCoupon reads the coupon gating a promotion, like {"code": "SUMMER", "maxUses": 100,
+// "expiresAt": "2021-09-01T00:00:00Z"}. Only the code is required
+func parseCoupon(code string, rawCoupon interface{}) (model.Coupon, error) {
+	var coupon model.Coupon
+
+	nodes, ok := rawCoupon.(map[string]interface{})
+	if !ok {
+		return coupon, errors.NewPromotionInvalid(code, "invalid coupon")
+	}
+
+	coupon.Code, _ = nodes["code"].(string)
+	if coupon.Code == "" {
+		return coupon, errors.NewPromotionInvalid(code, "invalid coupon code")
+	}
+
+	if rawMaxUses, ok := nodes["maxUses"]; ok {
+		maxUses, ok := rawMaxUses.(float64)
+		if !ok || maxUses < 1 || maxUses != float64(int(maxUses)) {
+			return coupon, errors.NewPromotionInvalid(code, "invalid coupon maxUses")
+		}
+		coupon.MaxUses = int(maxUses)
+	}
+
+	if rawExpiresAt, ok := nodes["expiresAt"]; ok {
+		text, _ := rawExpiresAt.(string)
+		expiresAt, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			return coupon, errors.NewPromotionInvalid(code, "invalid coupon expiresAt")
+		}
+		coupon.ExpiresAt = expiresAt
+	}
+
+	return coupon, nil
+}
+
+// parseSchedule reads when the promotion is active, like {"validFrom": "2021-11-26T00:00:00Z",
+// "validUntil": "2021-11-27T00:00:00Z", "weekdays": ["friday"], "hours": {"from": 9, "until": 21}}.
+// Every attribute is optional
+func parseSchedule(code string, nodes map[string]interface{}) (model.Schedule, error) {
+	var schedule model.Schedule
+
+	validTimes := []struct {
+		key  string
+		time *time.Time
+	}{{"validFrom", &schedule.ValidFrom}, {"validUntil", &schedule.ValidUntil}}
+
+	for _, validTime := range validTimes {
+		rawTime, ok := nodes[validTime.key]
+		if !ok {
+			continue
+		}
+
+		text, _ := rawTime.(string)
+		parsed, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			return schedule, errors.NewPromotionInvalid(code, fmt.Sprintf("invalid %v", validTime.key))
+		}
+		*validTime.time = parsed
+	}
+
+	if !schedule.ValidFrom.IsZero() && !schedule.ValidUntil.IsZero() && !schedule.ValidFrom.Before(schedule.ValidUntil) {
+		return schedule, errors.NewPromotionInvalid(code, "validUntil must be after validFrom")
+	}
+
+	if rawWeekdays, ok := nodes["weekdays"]; ok {
+		names, _ := rawWeekdays.([]interface{})
+		if len(names) == 0 {
+			return schedule, errors.NewPromotionInvalid(code, "invalid weekdays")
+		}
+
+		for _, rawName := range names {
+			weekday, ok := parseWeekday(rawName)
+			if !ok {
+				return schedule, errors.NewPromotionInvalid(code, fmt.Sprintf("invalid weekday %v", rawName))
+			}
+			schedule.Weekdays = append(schedule.Weekdays, weekday)
+		}
+	}
+
+	if rawHours, ok := nodes["hours"]; ok {
+		hours, _ := rawHours.(map[string]interface{})
+		from, fromOk := hours["from"].(float64)
+		until, untilOk := hours["until"].(float64)
+
+		if !fromOk || !untilOk || !isHour(from) || !isHour(until) || from == until {
+			return schedule, errors.NewPromotionInvalid(code, "invalid hours")
+		}
+		schedule.FromHour = int(from)
+		schedule.UntilHour = int(until)
+	}
+
+	return schedule, nil
+}
+
+func parseWeekday(rawName interface{}) (time.Weekday, bool) {
+	name, ok := rawName.(string)
+	if !ok {
+		return 0, false
+	}
+
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		if strings.EqualFold(weekday.String(), name) {
+			return weekday, true
+		}
+	}
+
+	return 0, false
+}
+
+// isHour tells whether the number is a whole hour of the day, 24 being the midnight
+// ending the day
+func isHour(hour float64) bool {
+	return hour >= 0 && hour <= 24 && hour == float64(int(hour))
+}
+
+// parseBulkPromotion reads rules with a minimum amount to buy, at least one, and the
+// price of every unit when bought in bulk
+func parseBulkPromotion(nodes map[string]interface{}, invalid *invalidEntries) (*model.BulkPromotion, error) {
 	var promos map[model.ProductCode][]model.BulkOfferRule
 
-	rawPromos := nodes["promos"].([]interface{})
+	rawPromos, _ := nodes["promos"].([]interface{})
 	promos = make(map[model.ProductCode][]model.BulkOfferRule, len(rawPromos))
 
-	for _, rawPromo := range rawPromos {
+	for i, rawPromo := range rawPromos {
 		if _, ok := rawPromo.(map[string]interface{}); !ok {
-			fmt.Printf("Invalid map: %v", rawPromo)
+			invalid.add("promos[%v]: invalid map %v", i, rawPromo)
 			continue
 		}
 		promo := rawPromo.(map[string]interface{})
 
 		if _, ok := promo["product"].(string); !ok {
-			fmt.Printf("Invalid product code: %v %T\n", promo["product"], promo["product"])
+			invalid.add("promos[%v]: invalid product code %v", i, promo["product"])
 			continue
 		}
 
 		if _, ok := promo["rules"].([]interface{}); !ok {
-			fmt.Printf("Invalid offer conditions: %v %T\n", promo["rules"], promo["rules"])
+			invalid.add("promos[%v]: invalid offer conditions %v", i, promo["rules"])
 			continue
 		}
 
-		for _, rawRules := range promo["rules"].([]interface{}) {
+		for j, rawRules := range promo["rules"].([]interface{}) {
 			if _, ok := rawRules.(map[string]interface{}); !ok {
-				fmt.Printf("Invalid map: %v", rawRules)
+				invalid.add("promos[%v].rules[%v]: invalid map %v", i, j, rawRules)
 				continue
 			}
 			rule := rawRules.(map[string]interface{})
 
-			if _, ok := rule["buy"].(float64); !ok {
-				fmt.Printf("Invalid amount to buy: %v\n", rule["buy"])
+			if buy, ok := rule["buy"].(float64); !ok || buy < 1 {
+				invalid.add("promos[%v].rules[%v]: invalid amount to buy %v", i, j, rule["buy"])
 				continue
 			}
-			if _, ok := rule["price"].(float64); !ok {
-				fmt.Printf("Invalid price: %v\n", rule["price"])
+			if price, ok := rule["price"].(float64); !ok || price < 0 {
+				invalid.add("promos[%v].rules[%v]: invalid price %v", i, j, rule["price"])
 				continue
 			}
 
@@ -83,42 +339,46 @@ func parseBulkPromotion(nodes map[string]interface{}) (*model.BulkPromotion, err
 	return model.NewBulkPromotion(promos), nil
 }
 
-func parseFreeItemsPromotion(nodes map[string]interface{}) (*model.FreeItemsPromotion, error) {
+// parseFreeItemsPromotion reads rules giving away some of every group of units
+// bought. Groups of at least one unit are expected, with fewer free units than units
+func parseFreeItemsPromotion(nodes map[string]interface{}, invalid *invalidEntries) (*model.FreeItemsPromotion, error) {
 	var promos map[model.ProductCode][]model.FreeItemsOfferRule
 
-	rawPromos := nodes["promos"].([]interface{})
+	rawPromos, _ := nodes["promos"].([]interface{})
 	promos = make(map[model.ProductCode][]model.FreeItemsOfferRule, len(rawPromos))
 
-	for _, rawPromo := range rawPromos {
+	for i, rawPromo := range rawPromos {
 		if _, ok := rawPromo.(map[string]interface{}); !ok {
-			fmt.Printf("Invalid map: %v", rawPromo)
+			invalid.add("promos[%v]: invalid map %v", i, rawPromo)
 			continue
 		}
 		promo := rawPromo.(map[string]interface{})
 
 		if _, ok := promo["product"].(string); !ok {
-			fmt.Printf("Invalid product code: %v %T\n", promo["product"], promo["product"])
+			invalid.add("promos[%v]: invalid product code %v", i, promo["product"])
 			continue
 		}
 
 		if _, ok := promo["rules"].([]interface{}); !ok {
-			fmt.Printf("Invalid offer conditions: %v %T\n", promo["rules"], promo["rules"])
+			invalid.add("promos[%v]: invalid offer conditions %v", i, promo["rules"])
 			continue
 		}
 
-		for _, rawRules := range promo["rules"].([]interface{}) {
+		for j, rawRules := range promo["rules"].([]interface{}) {
 			if _, ok := rawRules.(map[string]interface{}); !ok {
-				fmt.Printf("Invalid map: %v", rawRules)
+				invalid.add("promos[%v].rules[%v]: invalid map %v", i, j, rawRules)
 				continue
 			}
 			rule := rawRules.(map[string]interface{})
 
-			if _, ok := rule["buy"].(float64); !ok {
-				fmt.Printf("Invalid amount to buy: %v\n", rule["buy"])
+			buy, ok := rule["buy"].(float64)
+			if !ok || buy < 1 {
+				invalid.add("promos[%v].rules[%v]: invalid amount to buy %v", i, j, rule["buy"])
 				continue
 			}
-			if _, ok := rule["free"].(float64); !ok {
-				fmt.Printf("Invalid amount: %v\n", rule["free"])
+			// At least one of the units bought must be paid
+			if free, ok := rule["free"].(float64); !ok || free < 0 || free >= buy {
+				invalid.add("promos[%v].rules[%v]: invalid amount of free units %v", i, j, rule["free"])
 				continue
 			}
 
@@ -141,3 +401,182 @@ func parseFreeItemsPromotion(nodes map[string]interface{}) (*model.FreeItemsProm
 
 	return model.NewFreeItemsPromotion(promos), nil
 }
+
+// parsePercentagePromotion reads rules with a minimum amount to buy and a whole
+// percentage between 1 and 100
+func parsePercentagePromotion(nodes map[string]interface{}, invalid *invalidEntries) (*model.PercentagePromotion, error) {
+	var promos map[model.ProductCode][]model.PercentageOfferRule
+
+	rawPromos, _ := nodes["promos"].([]interface{})
+	promos = make(map[model.ProductCode][]model.PercentageOfferRule, len(rawPromos))
+
+	for i, rawPromo := range rawPromos {
+		if _, ok := rawPromo.(map[string]interface{}); !ok {
+			invalid.add("promos[%v]: invalid map %v", i, rawPromo)
+			continue
+		}
+		promo := rawPromo.(map[string]interface{})
+
+		if _, ok := promo["product"].(string); !ok {
+			invalid.add("promos[%v]: invalid product code %v", i, promo["product"])
+			continue
+		}
+
+		if _, ok := promo["rules"].([]interface{}); !ok {
+			invalid.add("promos[%v]: invalid offer conditions %v", i, promo["rules"])
+			continue
+		}
+
+		for j, rawRules := range promo["rules"].([]interface{}) {
+			if _, ok := rawRules.(map[string]interface{}); !ok {
+				invalid.add("promos[%v].rules[%v]: invalid map %v", i, j, rawRules)
+				continue
+			}
+			rule := rawRules.(map[string]interface{})
+
+			if buy, ok := rule["buy"].(float64); !ok || buy < 1 {
+				invalid.add("promos[%v].rules[%v]: invalid amount to buy %v", i, j, rule["buy"])
+				continue
+			}
+			if percentage, ok := rule["percentage"].(float64); !ok || percentage < 1 || percentage > 100 ||
+				percentage != float64(int(percentage)) {
+				invalid.add("promos[%v].rules[%v]: invalid percentage %v", i, j, rule["percentage"])
+				continue
+			}
+
+			promoRule := model.PercentageOfferRule{
+				Buy:        int(rule["buy"].(float64)),
+				Percentage: int(rule["percentage"].(float64)),
+			}
+
+			if promosProduct, ok := promos[model.ProductCode(promo["product"].(string))]; ok {
+				promos[model.ProductCode(promo["product"].(string))] = append(promosProduct, promoRule)
+			} else {
+				promos[model.ProductCode(promo["product"].(string))] = []model.PercentageOfferRule{promoRule}
+			}
+		}
+	}
+
+	if len(promos) == 0 {
+		return nil, errors.NewPromotionInvalid(nodes["code"].(string), "empty items list")
+	}
+
+	return model.NewPercentagePromotion(promos), nil
+}
+
+// parseBundlePromotion reads bundles of the form
+// {"items": [{"product": "TSHIRT", "quantity": 1}, {"product": "MUG", "quantity": 1}], "price": 2500}
+func parseBundlePromotion(nodes map[string]interface{}, invalid *invalidEntries) (*model.BundlePromotion, error) {
+	rawPromos, _ := nodes["promos"].([]interface{})
+	bundles := make([]model.Bundle, 0, len(rawPromos))
+
+	for i, rawPromo := range rawPromos {
+		if _, ok := rawPromo.(map[string]interface{}); !ok {
+			invalid.add("promos[%v]: invalid map %v", i, rawPromo)
+			continue
+		}
+		promo := rawPromo.(map[string]interface{})
+
+		if price, ok := promo["price"].(float64); !ok || price < 0 {
+			invalid.add("promos[%v]: invalid price %v", i, promo["price"])
+			continue
+		}
+
+		if _, ok := promo["items"].([]interface{}); !ok {
+			invalid.add("promos[%v]: invalid bundle items %v", i, promo["items"])
+			continue
+		}
+
+		bundle := model.Bundle{
+			Items: make(map[model.ProductCode]int),
+			Price: int(promo["price"].(float64)),
+		}
+
+		valid := true
+		for j, rawItem := range promo["items"].([]interface{}) {
+			item, ok := rawItem.(map[string]interface{})
+			if !ok {
+				invalid.add("promos[%v].items[%v]: invalid map %v", i, j, rawItem)
+				valid = false
+				break
+			}
+
+			if _, ok := item["product"].(string); !ok {
+				invalid.add("promos[%v].items[%v]: invalid product code %v", i, j, item["product"])
+				valid = false
+				break
+			}
+			if quantity, ok := item["quantity"].(float64); !ok || quantity < 1 {
+				invalid.add("promos[%v].items[%v]: invalid quantity %v", i, j, item["quantity"])
+				valid = false
+				break
+			}
+
+			bundle.Items[model.ProductCode(item["product"].(string))] += int(item["quantity"].(float64))
+		}
+
+		// A bundle missing any of its items would be a different offer, so it is discarded
+		if !valid {
+			continue
+		}
+		if len(bundle.Items) == 0 {
+			invalid.add("promos[%v]: empty bundle", i)
+			continue
+		}
+
+		bundles = append(bundles, bundle)
+	}
+
+	if len(bundles) == 0 {
+		return nil, errors.NewPromotionInvalid(nodes["code"].(string), "empty items list")
+	}
+
+	return model.NewBundlePromotion(bundles), nil
+}
+
+// parseThresholdPromotion reads rules discounting either a fixed amount or a whole
+// percentage when the basket is above a total, like {"above": 5000, "amount": 1000}
+func parseThresholdPromotion(nodes map[string]interface{}, invalid *invalidEntries) (*model.ThresholdPromotion, error) {
+	rawPromos, _ := nodes["promos"].([]interface{})
+	rules := make([]model.ThresholdRule, 0, len(rawPromos))
+
+	for i, rawPromo := range rawPromos {
+		if _, ok := rawPromo.(map[string]interface{}); !ok {
+			invalid.add("promos[%v]: invalid map %v", i, rawPromo)
+			continue
+		}
+		promo := rawPromo.(map[string]interface{})
+
+		if above, ok := promo["above"].(float64); !ok || above < 0 {
+			invalid.add("promos[%v]: invalid threshold %v", i, promo["above"])
+			continue
+		}
+
+		amount, withAmount := promo["amount"].(float64)
+		percentage, withPercentage := promo["percentage"].(float64)
+		if withAmount == withPercentage {
+			invalid.add("promos[%v]: either an amount or a percentage expected", i)
+			continue
+		}
+		if withAmount && amount <= 0 {
+			invalid.add("promos[%v]: invalid amount %v", i, promo["amount"])
+			continue
+		}
+		if withPercentage && (percentage < 1 || percentage > 100 || percentage != float64(int(percentage))) {
+			invalid.add("promos[%v]: invalid percentage %v", i, promo["percentage"])
+			continue
+		}
+
+		rules = append(rules, model.ThresholdRule{
+			Above:      int(promo["above"].(float64)),
+			Amount:     int(amount),
+			Percentage: int(percentage),
+		})
+	}
+
+	if len(rules) == 0 {
+		return nil, errors.NewPromotionInvalid(nodes["code"].(string), "empty items list")
+	}
+
+	return model.NewThresholdPromotion(rules), nil
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"reflect"
 	"testing"
+	"time"
 )
 
 var promotionsParsersCases = []struct {
@@ -18,6 +19,112 @@ var promotionsParsersCases = []struct {
 		nil,
 		errors.NewPromotionNotFound("FAKE"),
 	},
+	{ // Promotion with a wrong code
+		map[string]interface{}{"code": float64(3), "promos": []interface{}{}},
+		nil,
+		errors.NewPromotionInvalid("3", "invalid promotion code"),
+	}, { // Promotion with a wrong id
+		map[string]interface{}{"id": float64(3), "code": "BULK", "promos": []interface{}{}},
+		nil,
+		errors.NewPromotionInvalid("BULK", "invalid id"),
+	}, { // Promotion with a wrong priority
+		map[string]interface{}{"code": "BULK", "priority": 1.5, "promos": []interface{}{}},
+		nil,
+		errors.NewPromotionInvalid("BULK", "invalid priority"),
+	}, { // Promotion with a wrong group
+		map[string]interface{}{"code": "BULK", "group": float64(1), "promos": []interface{}{}},
+		nil,
+		errors.NewPromotionInvalid("BULK", "invalid group"),
+	}, { // Promotion with a wrong stackable flag
+		map[string]interface{}{"code": "BULK", "stackable": "no", "promos": []interface{}{}},
+		nil,
+		errors.NewPromotionInvalid("BULK", "invalid stackable flag"),
+	}, { // Promotion with a wrong validFrom
+		map[string]interface{}{"code": "BULK", "validFrom": "yesterday", "promos": []interface{}{}},
+		nil,
+		errors.NewPromotionInvalid("BULK", "invalid validFrom"),
+	}, { // Promotion with a wrong validUntil
+		map[string]interface{}{"code": "BULK", "validUntil": float64(3), "promos": []interface{}{}},
+		nil,
+		errors.NewPromotionInvalid("BULK", "invalid validUntil"),
+	}, { // Promotion ending before it starts
+		map[string]interface{}{"code": "BULK", "validFrom": "2021-11-27T00:00:00Z", "validUntil": "2021-11-26T00:00:00Z",
+			"promos": []interface{}{}},
+		nil,
+		errors.NewPromotionInvalid("BULK", "validUntil must be after validFrom"),
+	}, { // Promotion with a wrong weekday
+		map[string]interface{}{"code": "BULK", "weekdays": []interface{}{"friday", "someday"}, "promos": []interface{}{}},
+		nil,
+		errors.NewPromotionInvalid("BULK", "invalid weekday someday"),
+	}, { // Promotion with an empty weekdays list
+		map[string]interface{}{"code": "BULK", "weekdays": []interface{}{}, "promos": []interface{}{}},
+		nil,
+		errors.NewPromotionInvalid("BULK", "invalid weekdays"),
+	}, { // Promotion with wrong hours
+		map[string]interface{}{"code": "BULK", "hours": map[string]interface{}{"from": float64(9), "until": float64(25)},
+			"promos": []interface{}{}},
+		nil,
+		errors.NewPromotionInvalid("BULK", "invalid hours"),
+	}, { // Promotion with a wrong coupon
+		map[string]interface{}{"code": "BULK", "coupon": "SUMMER", "promos": []interface{}{}},
+		nil,
+		errors.NewPromotionInvalid("BULK", "invalid coupon"),
+	}, { // Promotion with a coupon without code
+		map[string]interface{}{"code": "BULK", "coupon": map[string]interface{}{"maxUses": float64(10)}, "promos": []interface{}{}},
+		nil,
+		errors.NewPromotionInvalid("BULK", "invalid coupon code"),
+	}, { // Promotion with a coupon with wrong uses
+		map[string]interface{}{"code": "BULK", "coupon": map[string]interface{}{"code": "SUMMER", "maxUses": float64(0)},
+			"promos": []interface{}{}},
+		nil,
+		errors.NewPromotionInvalid("BULK", "invalid coupon maxUses"),
+	}, { // Promotion with a coupon with a wrong expiry
+		map[string]interface{}{"code": "BULK", "coupon": map[string]interface{}{"code": "SUMMER", "expiresAt": "tomorrow"},
+			"promos": []interface{}{}},
+		nil,
+		errors.NewPromotionInvalid("BULK", "invalid coupon expiresAt"),
+	}, { // Promotion with a coupon
+		map[string]interface{}{"code": "BULK", "coupon": map[string]interface{}{"code": "SUMMER", "maxUses": float64(100),
+			"expiresAt": "2021-09-01T00:00:00Z"},
+			"promos": []interface{}{
+				map[string]interface{}{"product": "PR1", "rules": []interface{}{map[string]interface{}{"buy": float64(3), "price": float64(1000)}}},
+			}},
+		func() model.Promotion {
+			promotion := model.NewBulkPromotion(map[model.ProductCode][]model.BulkOfferRule{"PR1": {{Buy: 3, Price: 1000}}})
+			promotion.Coupon = model.Coupon{Code: "SUMMER", MaxUses: 100, ExpiresAt: time.Date(2021, time.September, 1, 0, 0, 0, 0, time.UTC)}
+			return promotion
+		}(),
+		nil,
+	}, { // Promotion with a schedule
+		map[string]interface{}{"code": "BULK", "validFrom": "2021-11-26T00:00:00Z", "validUntil": "2021-11-27T00:00:00Z",
+			"weekdays": []interface{}{"Friday", "saturday"}, "hours": map[string]interface{}{"from": float64(22), "until": float64(6)},
+			"promos": []interface{}{
+				map[string]interface{}{"product": "PR1", "rules": []interface{}{map[string]interface{}{"buy": float64(3), "price": float64(1000)}}},
+			}},
+		func() model.Promotion {
+			promotion := model.NewBulkPromotion(map[model.ProductCode][]model.BulkOfferRule{"PR1": {{Buy: 3, Price: 1000}}})
+			promotion.Schedule = model.Schedule{
+				ValidFrom:  time.Date(2021, time.November, 26, 0, 0, 0, 0, time.UTC),
+				ValidUntil: time.Date(2021, time.November, 27, 0, 0, 0, 0, time.UTC),
+				Weekdays:   []time.Weekday{time.Friday, time.Saturday},
+				FromHour:   22,
+				UntilHour:  6,
+			}
+			return promotion
+		}(),
+		nil,
+	}, { // Promotion with priority, group and stackable flag
+		map[string]interface{}{"code": "FREE_ITEMS", "priority": float64(10), "group": "tshirts", "stackable": false,
+			"promos": []interface{}{
+				map[string]interface{}{"product": "PR1", "rules": []interface{}{map[string]interface{}{"buy": float64(3), "free": float64(1)}}},
+			}},
+		func() model.Promotion {
+			promotion := model.NewFreeItemsPromotion(map[model.ProductCode][]model.FreeItemsOfferRule{"PR1": {{Buy: 3, Free: 1}}})
+			promotion.PromotionSettings = model.PromotionSettings{Priority: 10, Group: "tshirts", Stackable: false}
+			return promotion
+		}(),
+		nil,
+	},
 	// ---- BULK PROMOTION CASES
 	{ // Empty promotion
 		map[string]interface{}{},
@@ -27,6 +134,20 @@ var promotionsParsersCases = []struct {
 		map[string]interface{}{"code": "BULK", "promos": []interface{}{}},
 		nil,
 		errors.NewPromotionInvalid("BULK", "empty items list"),
+	}, { // Promotion with a wrong promos list
+		map[string]interface{}{"code": "BULK", "promos": "aaaa"},
+		nil,
+		errors.NewPromotionInvalid("BULK", "empty items list"),
+	}, { // Promotion with id
+		map[string]interface{}{"id": "bulk-tshirt", "code": "BULK", "promos": []interface{}{
+			map[string]interface{}{"product": "PR1", "rules": []interface{}{map[string]interface{}{"buy": float64(3), "price": float64(1000)}}},
+		}},
+		func() model.Promotion {
+			promotion := model.NewBulkPromotion(map[model.ProductCode][]model.BulkOfferRule{"PR1": {{Buy: 3, Price: 1000}}})
+			promotion.Id = "bulk-tshirt"
+			return promotion
+		}(),
+		nil,
 	}, { // Promotion with a wrong product code
 		map[string]interface{}{"code": "BULK", "promos": []interface{}{
 			map[string]interface{}{"product": []interface{}{}, "rules": []interface{}{map[string]interface{}{"buy": float64(3), "price": float64(1000)},
@@ -62,6 +183,23 @@ var promotionsParsersCases = []struct {
 			"PR2": {{Buy: 3, Price: 500}},
 		}),
 		nil,
+	}, { // Promotion with out of bounds values
+		map[string]interface{}{"code": "BULK", "promos": []interface{}{
+			map[string]interface{}{"product": "PR1", "rules": []interface{}{map[string]interface{}{"buy": float64(0), "price": float64(1000)},
+				map[string]interface{}{"buy": float64(5), "price": float64(-1)},
+				map[string]interface{}{"buy": float64(5), "price": float64(0)}},
+			},
+		}},
+		model.NewBulkPromotion(map[model.ProductCode][]model.BulkOfferRule{
+			"PR1": {{Buy: 5, Price: 0}},
+		}),
+		nil,
+	}, { // Promotion with only out of bounds values
+		map[string]interface{}{"code": "BULK", "promos": []interface{}{
+			map[string]interface{}{"product": "PR1", "rules": []interface{}{map[string]interface{}{"buy": float64(0), "price": float64(1000)}}},
+		}},
+		nil,
+		errors.NewPromotionInvalid("BULK", "empty items list"),
 	}, { // Promotion with a promotion without rules
 		map[string]interface{}{"code": "BULK", "promos": []interface{}{
 			map[string]interface{}{"product": "PR1", "rules": []interface{}{}},
@@ -127,6 +265,24 @@ var promotionsParsersCases = []struct {
 			"PR2": {{Buy: 3, Free: 1}},
 		}),
 		nil,
+	}, { // Promotion with out of bounds values
+		map[string]interface{}{"code": "FREE_ITEMS", "promos": []interface{}{
+			map[string]interface{}{"product": "PR1", "rules": []interface{}{map[string]interface{}{"buy": float64(0), "free": float64(1)},
+				map[string]interface{}{"buy": float64(3), "free": float64(-1)},
+				map[string]interface{}{"buy": float64(3), "free": float64(3)},
+				map[string]interface{}{"buy": float64(2), "free": float64(1)}},
+			},
+		}},
+		model.NewFreeItemsPromotion(map[model.ProductCode][]model.FreeItemsOfferRule{
+			"PR1": {{Buy: 2, Free: 1}},
+		}),
+		nil,
+	}, { // Promotion with only out of bounds values
+		map[string]interface{}{"code": "FREE_ITEMS", "promos": []interface{}{
+			map[string]interface{}{"product": "VOUCHER", "rules": []interface{}{map[string]interface{}{"buy": float64(0), "free": float64(1)}}},
+		}},
+		nil,
+		errors.NewPromotionInvalid("FREE_ITEMS", "empty items list"),
 	}, { // Promotion with a promotion without rules
 		map[string]interface{}{"code": "FREE_ITEMS", "promos": []interface{}{
 			map[string]interface{}{"product": "PR1", "rules": []interface{}{}},
@@ -148,6 +304,102 @@ var promotionsParsersCases = []struct {
 			"PR2": {{Buy: 3, Free: 1}},
 		}),
 		nil,
+	}, // ---- PERCENTAGE PROMOTION CASES
+	{ // Promotion without promos
+		map[string]interface{}{"code": "PERCENTAGE", "promos": []interface{}{}},
+		nil,
+		errors.NewPromotionInvalid("PERCENTAGE", "empty items list"),
+	}, { // Promotion with wrong percentages
+		map[string]interface{}{"code": "PERCENTAGE", "promos": []interface{}{
+			map[string]interface{}{"product": "PR1", "rules": []interface{}{map[string]interface{}{"buy": float64(1), "percentage": float64(0)},
+				map[string]interface{}{"buy": float64(1), "percentage": float64(120)},
+				map[string]interface{}{"buy": float64(1), "percentage": float64(12.5)},
+				map[string]interface{}{"buy": float64(1), "percentage": "aaaa"}},
+			},
+			map[string]interface{}{"product": "PR2", "rules": []interface{}{map[string]interface{}{"buy": float64(1), "percentage": float64(100)}}},
+		}},
+		model.NewPercentagePromotion(map[model.ProductCode][]model.PercentageOfferRule{
+			"PR2": {{Buy: 1, Percentage: 100}},
+		}),
+		nil,
+	}, { // Promotion with a wrong buy value
+		map[string]interface{}{"code": "PERCENTAGE", "promos": []interface{}{
+			map[string]interface{}{"product": "PR1", "rules": []interface{}{map[string]interface{}{"buy": float64(0), "percentage": float64(20)},
+				map[string]interface{}{"buy": float64(2), "percentage": float64(20)}},
+			},
+		}},
+		model.NewPercentagePromotion(map[model.ProductCode][]model.PercentageOfferRule{
+			"PR1": {{Buy: 2, Percentage: 20}},
+		}),
+		nil,
+	}, { // Correct promotion
+		map[string]interface{}{"id": "mugs", "code": "PERCENTAGE", "promos": []interface{}{
+			map[string]interface{}{"product": "PR1", "rules": []interface{}{map[string]interface{}{"buy": float64(5), "percentage": float64(30)},
+				map[string]interface{}{"buy": float64(2), "percentage": float64(20)}},
+			},
+		}},
+		func() model.Promotion {
+			promotion := model.NewPercentagePromotion(map[model.ProductCode][]model.PercentageOfferRule{
+				"PR1": {{Buy: 5, Percentage: 30}, {Buy: 2, Percentage: 20}},
+			})
+			promotion.Id = "mugs"
+			return promotion
+		}(),
+		nil,
+	}, // ---- BUNDLE PROMOTION CASES
+	{ // Promotion without promos
+		map[string]interface{}{"code": "BUNDLE", "promos": []interface{}{}},
+		nil,
+		errors.NewPromotionInvalid("BUNDLE", "empty items list"),
+	}, { // Bundles with wrong items or prices
+		map[string]interface{}{"code": "BUNDLE", "promos": []interface{}{
+			map[string]interface{}{"price": "aaaa", "items": []interface{}{map[string]interface{}{"product": "PR1", "quantity": float64(1)}}},
+			map[string]interface{}{"price": float64(1000), "items": "aaaa"},
+			map[string]interface{}{"price": float64(1000), "items": []interface{}{}},
+			map[string]interface{}{"price": float64(1000), "items": []interface{}{map[string]interface{}{"product": "PR1", "quantity": float64(1)},
+				map[string]interface{}{"product": "PR2", "quantity": float64(0)}}},
+			map[string]interface{}{"price": float64(1000), "items": []interface{}{map[string]interface{}{"product": "PR1", "quantity": float64(1)},
+				map[string]interface{}{"product": float64(2), "quantity": float64(1)}}},
+			map[string]interface{}{"price": float64(2500), "items": []interface{}{map[string]interface{}{"product": "PR1", "quantity": float64(1)},
+				map[string]interface{}{"product": "PR2", "quantity": float64(1)}}},
+		}},
+		model.NewBundlePromotion([]model.Bundle{{Items: map[model.ProductCode]int{"PR1": 1, "PR2": 1}, Price: 2500}}),
+		nil,
+	}, { // Correct promotion
+		map[string]interface{}{"code": "BUNDLE", "promos": []interface{}{
+			map[string]interface{}{"price": float64(2500), "items": []interface{}{map[string]interface{}{"product": "PR1", "quantity": float64(1)},
+				map[string]interface{}{"product": "PR2", "quantity": float64(1)}}},
+			map[string]interface{}{"price": float64(1200), "items": []interface{}{map[string]interface{}{"product": "PR3", "quantity": float64(2)},
+				map[string]interface{}{"product": "PR2", "quantity": float64(1)}, map[string]interface{}{"product": "PR3", "quantity": float64(1)}}},
+		}},
+		model.NewBundlePromotion([]model.Bundle{
+			{Items: map[model.ProductCode]int{"PR1": 1, "PR2": 1}, Price: 2500},
+			{Items: map[model.ProductCode]int{"PR2": 1, "PR3": 3}, Price: 1200},
+		}),
+		nil,
+	}, // ---- THRESHOLD PROMOTION CASES
+	{ // Promotion without promos
+		map[string]interface{}{"code": "THRESHOLD", "promos": []interface{}{}},
+		nil,
+		errors.NewPromotionInvalid("THRESHOLD", "empty items list"),
+	}, { // Promotion with wrong rules
+		map[string]interface{}{"code": "THRESHOLD", "promos": []interface{}{
+			map[string]interface{}{"above": "aaaa", "amount": float64(1000)},
+			map[string]interface{}{"above": float64(5000)},
+			map[string]interface{}{"above": float64(5000), "amount": float64(1000), "percentage": float64(5)},
+			map[string]interface{}{"above": float64(5000), "amount": float64(-1000)},
+			map[string]interface{}{"above": float64(5000), "percentage": float64(101)},
+			map[string]interface{}{"above": float64(10000), "percentage": float64(5)},
+		}},
+		model.NewThresholdPromotion([]model.ThresholdRule{{Above: 10000, Percentage: 5}}),
+		nil,
+	}, { // Correct promotion
+		map[string]interface{}{"code": "THRESHOLD", "promos": []interface{}{
+			map[string]interface{}{"above": float64(5000), "amount": float64(1000)},
+			map[string]interface{}{"above": float64(10000), "percentage": float64(5)},
+		}},
+		model.NewThresholdPromotion([]model.ThresholdRule{{Above: 5000, Amount: 1000}, {Above: 10000, Percentage: 5}}),
+		nil,
 	},
 }
 
@@ -175,3 +427,100 @@ func TestBasketPrices(t *testing.T) {
 		}
 	}
 }
+
+var strictPromotionsParsersCases = []struct {
+	nodes     map[string]interface{}
+	promotion model.Promotion
+	err       error
+}{
+	{ // Bulk promotion with wrong rules
+		map[string]interface{}{"code": "BULK", "promos": []interface{}{
+			map[string]interface{}{"product": "MUG", "rules": []interface{}{
+				map[string]interface{}{"buy": float64(0), "price": float64(600)},
+				map[string]interface{}{"buy": float64(3), "price": float64(500)},
+			}},
+			map[string]interface{}{"product": "TSHIRT", "rules": []interface{}{
+				map[string]interface{}{"buy": float64(3), "price": float64(-1)},
+			}},
+		}},
+		nil,
+		errors.NewPromotionInvalid("BULK",
+			"promos[0].rules[0]: invalid amount to buy 0; promos[1].rules[0]: invalid price -1"),
+	}, { // Free items promotion with a wrong product
+		map[string]interface{}{"code": "FREE_ITEMS", "promos": []interface{}{
+			map[string]interface{}{"product": float64(1), "rules": []interface{}{}},
+			map[string]interface{}{"product": "MUG", "rules": []interface{}{
+				map[string]interface{}{"buy": float64(2), "free": float64(2)},
+			}},
+		}},
+		nil,
+		errors.NewPromotionInvalid("FREE_ITEMS",
+			"promos[0]: invalid product code 1; promos[1].rules[0]: invalid amount of free units 2"),
+	}, { // Percentage promotion with wrong rules
+		map[string]interface{}{"code": "PERCENTAGE", "promos": []interface{}{
+			map[string]interface{}{"product": "MUG", "rules": []interface{}{
+				map[string]interface{}{"buy": float64(1), "percentage": float64(20)},
+				map[string]interface{}{"buy": float64(2), "percentage": 12.5},
+			}},
+		}},
+		nil,
+		errors.NewPromotionInvalid("PERCENTAGE", "promos[0].rules[1]: invalid percentage 12.5"),
+	}, { // Bundle promotion with wrong bundles
+		map[string]interface{}{"code": "BUNDLE", "promos": []interface{}{
+			map[string]interface{}{"price": float64(2500), "items": []interface{}{
+				map[string]interface{}{"product": "TSHIRT", "quantity": float64(1)},
+				map[string]interface{}{"product": "MUG", "quantity": float64(0)},
+			}},
+			map[string]interface{}{"price": float64(1000), "items": []interface{}{}},
+			map[string]interface{}{"price": float64(1200), "items": []interface{}{
+				map[string]interface{}{"product": "MUG", "quantity": float64(3)},
+			}},
+		}},
+		nil,
+		errors.NewPromotionInvalid("BUNDLE", "promos[0].items[1]: invalid quantity 0; promos[1]: empty bundle"),
+	}, { // Threshold promotion with wrong rules
+		map[string]interface{}{"code": "THRESHOLD", "promos": []interface{}{
+			map[string]interface{}{"above": float64(5000), "amount": float64(1000), "percentage": float64(5)},
+			map[string]interface{}{"above": float64(10000), "percentage": float64(5)},
+			map[string]interface{}{"above": float64(-1), "amount": float64(500)},
+		}},
+		nil,
+		errors.NewPromotionInvalid("THRESHOLD",
+			"promos[0]: either an amount or a percentage expected; promos[2]: invalid threshold -1"),
+	}, { // Promotion without promos
+		map[string]interface{}{"code": "BULK", "promos": []interface{}{}},
+		nil,
+		errors.NewPromotionInvalid("BULK", "empty items list"),
+	}, { // Correct promotion
+		map[string]interface{}{"code": "FREE_ITEMS", "promos": []interface{}{
+			map[string]interface{}{"product": "MUG", "rules": []interface{}{
+				map[string]interface{}{"buy": float64(3), "free": float64(1)},
+			}},
+		}},
+		model.NewFreeItemsPromotion(map[model.ProductCode][]model.FreeItemsOfferRule{"MUG": {{Buy: 3, Free: 1}}}),
+		nil,
+	},
+}
+
+func TestStrictPromotions(t *testing.T) {
+	for _, pc := range strictPromotionsParsersCases {
+
+		promotion, err := ParseStrictPromotion(pc.nodes)
+		if err != nil {
+			if pc.err == nil {
+				t.Errorf("Unexpected error: %v", err.Error())
+			} else if err.Error() != pc.err.Error() {
+				t.Errorf("Got error: %v, wanted: %v", err.Error(), pc.err.Error())
+			}
+			continue
+		}
+
+		if pc.err != nil {
+			t.Errorf("Did not get expected error: %v", pc.err.Error())
+		}
+
+		if !reflect.DeepEqual(promotion, pc.promotion) {
+			t.Errorf("Got promotion %v, wanted %v", promotion, pc.promotion)
+		}
+	}
+}
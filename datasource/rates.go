@@ -0,0 +1,31 @@
+package datasource
+
+import (
+	"encoding/json"
+	"github.com/alfcope/checkouttest/model"
+	"io/ioutil"
+)
+
+// exchangeRatesFile is the format of the exchange rates file, for example
+// {"base": "EUR", "rates": {"USD": "1.0825", "GBP": "0.8560"}}
+type exchangeRatesFile struct {
+	Base  model.Currency            `json:"base"`
+	Rates map[model.Currency]string `json:"rates"`
+}
+
+// ReadExchangeRates reads the rates of the currencies against a base currency. Rates
+// are exact decimal strings, the units of every currency a unit of the base is worth
+func ReadExchangeRates(filePath string) (model.ExchangeRates, error) {
+	file, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return model.ExchangeRates{}, err
+	}
+
+	var rates exchangeRatesFile
+	err = json.Unmarshal(file, &rates)
+	if err != nil {
+		return model.ExchangeRates{}, err
+	}
+
+	return model.NewExchangeRates(rates.Base, rates.Rates)
+}
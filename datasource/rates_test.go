@@ -0,0 +1,61 @@
+package datasource
+
+import (
+	"github.com/alfcope/checkouttest/model"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadExchangeRates(t *testing.T) {
+	var ratesCases = []struct {
+		name  string
+		file  string
+		valid bool
+	}{
+		{"Valid rates", `{"base": "EUR", "rates": {"USD": "1.0825", "GBP": "0.856"}}`, true},
+		{"Base only", `{"base": "EUR"}`, true},
+		{"Missing base", `{"rates": {"USD": "1.0825"}}`, false},
+		{"Invalid rate", `{"base": "EUR", "rates": {"USD": "-1"}}`, false},
+		{"Rate as a number", `{"base": "EUR", "rates": {"USD": 1.0825}}`, false},
+		{"Malformed file", `{"base": "EUR"`, false},
+	}
+
+	dir, err := ioutil.TempDir("", "rates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, test := range ratesCases {
+		t.Run(test.name, func(t *testing.T) {
+			// Given
+			filePath := filepath.Join(dir, "rates.json")
+			if err := ioutil.WriteFile(filePath, []byte(test.file), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			// When
+			rates, err := ReadExchangeRates(filePath)
+
+			// Then
+			if (err == nil) != test.valid {
+				t.Fatalf("Wanted valid %v but got error %v", test.valid, err)
+			}
+			if test.valid && (rates.Base != "EUR" || !rates.Supports("EUR")) {
+				t.Errorf("Wanted base currency EUR but got %v", rates.Base)
+			}
+		})
+	}
+
+	// Then
+	if _, err := ReadExchangeRates(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("A missing file should fail")
+	}
+
+	rates, _ := ReadExchangeRates("../config/exchange_rates.json")
+	if converted, err := rates.Convert(model.NewMoney(1000, "EUR"), "USD"); err != nil || converted.Currency != "USD" {
+		t.Errorf("The rates shipped with the service should convert to USD, got %v, %v", converted, err)
+	}
+}
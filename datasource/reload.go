@@ -0,0 +1,117 @@
+package datasource
+
+import (
+	"github.com/alfcope/checkouttest/config"
+	"github.com/alfcope/checkouttest/model"
+	"reflect"
+	"sort"
+)
+
+// Reloader is implemented by datasources able to refresh their catalogue and
+// promotions from the files they were initialized with
+type Reloader interface {
+	Reload(config.DataConfig) (CatalogueDiff, error)
+}
+
+// CatalogueDiff describes the changes applied by a reload
+type CatalogueDiff struct {
+	AddedProducts   []model.ProductCode
+	RemovedProducts []model.ProductCode
+	ChangedProducts []ProductChange
+
+	AddedPromotions   []string
+	RemovedPromotions []string
+	ChangedPromotions []string
+}
+
+type ProductChange struct {
+	Before model.Product
+	After  model.Product
+}
+
+func (c CatalogueDiff) IsEmpty() bool {
+	return len(c.AddedProducts) == 0 && len(c.RemovedProducts) == 0 && len(c.ChangedProducts) == 0 &&
+		len(c.AddedPromotions) == 0 && len(c.RemovedPromotions) == 0 && len(c.ChangedPromotions) == 0
+}
+
+// Reload reads again the products and promotions files and replaces the whole
+// catalogue and the active promotions with their content, including products and
+// promotions added through the api since the last load. Nothing is replaced unless
+// both files are fully valid. Baskets are kept.
+func (d *InMemoryDatasource) Reload(config config.DataConfig) (CatalogueDiff, error) {
+	products, err := readProducts(config.Products, true)
+	if err != nil {
+		return CatalogueDiff{}, err
+	}
+
+	promotions, definitions, err := readPromotions(config.Promotions, true)
+	if err != nil {
+		return CatalogueDiff{}, err
+	}
+
+	// Both locks are held so no reader sees the new catalogue with the old promotions
+	d.productsMux.Lock()
+	defer d.productsMux.Unlock()
+	d.promotionsMux.Lock()
+	defer d.promotionsMux.Unlock()
+
+	diff := CatalogueDiff{}
+	diffProducts(&diff, d.products, products)
+	diffPromotions(&diff, d.promotionDefinitions, definitions)
+
+	d.products = products
+	d.promotions, d.promotionDefinitions = promotions, definitions
+
+	return diff, nil
+}
+
+func diffProducts(diff *CatalogueDiff, before, after map[model.ProductCode]model.Product) {
+	for code, product := range after {
+		previous, ok := before[code]
+		if !ok {
+			diff.AddedProducts = append(diff.AddedProducts, code)
+		} else if previous != product {
+			diff.ChangedProducts = append(diff.ChangedProducts, ProductChange{Before: previous, After: product})
+		}
+	}
+
+	for code := range before {
+		if _, ok := after[code]; !ok {
+			diff.RemovedProducts = append(diff.RemovedProducts, code)
+		}
+	}
+
+	sort.Slice(diff.AddedProducts, func(i, j int) bool { return diff.AddedProducts[i] < diff.AddedProducts[j] })
+	sort.Slice(diff.RemovedProducts, func(i, j int) bool { return diff.RemovedProducts[i] < diff.RemovedProducts[j] })
+	sort.Slice(diff.ChangedProducts, func(i, j int) bool {
+		return diff.ChangedProducts[i].After.Code < diff.ChangedProducts[j].After.Code
+	})
+}
+
+// Promotions are matched by id. Promotions without id in the file have one derived
+// from their definition, so editing them shows up as a removal and an addition
+func diffPromotions(diff *CatalogueDiff, before, after []map[string]interface{}) {
+	previous := make(map[string]map[string]interface{}, len(before))
+	for _, definition := range before {
+		previous[definition["id"].(string)] = definition
+	}
+
+	for _, definition := range after {
+		id := definition["id"].(string)
+		if old, ok := previous[id]; !ok {
+			diff.AddedPromotions = append(diff.AddedPromotions, id)
+		} else {
+			if !reflect.DeepEqual(old, definition) {
+				diff.ChangedPromotions = append(diff.ChangedPromotions, id)
+			}
+			delete(previous, id)
+		}
+	}
+
+	for _, definition := range before {
+		id := definition["id"].(string)
+		if _, ok := previous[id]; ok {
+			diff.RemovedPromotions = append(diff.RemovedPromotions, id)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package datasource
+
+import (
+	"github.com/alfcope/checkouttest/config"
+	"github.com/alfcope/checkouttest/errors"
+	"github.com/alfcope/checkouttest/model"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const reloadProducts = `[
+  {"code": "VOUCHER", "name": "Cabify Voucher", "price": 500},
+  {"code": "TSHIRT", "name": "Cabify T-Shirt", "price": 2000}
+]`
+
+const reloadPromotions = `[
+  {"id": "bulk", "code": "BULK", "promos": [{"product": "TSHIRT", "rules": [{"buy": 3, "price": 1900}]}]},
+  {"id": "free", "code": "FREE_ITEMS", "promos": [{"product": "VOUCHER", "rules": [{"buy": 2, "free": 1}]}]}
+]`
+
+func writeDataFiles(t *testing.T, dir, products, promotions string) config.DataConfig {
+	dataConfig := config.DataConfig{
+		Products:   filepath.Join(dir, "products.json"),
+		Promotions: filepath.Join(dir, "promotions.json"),
+	}
+
+	if err := ioutil.WriteFile(dataConfig.Products, []byte(products), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(dataConfig.Promotions, []byte(promotions), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return dataConfig
+}
+
+func TestReload(t *testing.T) {
+	// Given
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ds, err := InitInMemoryDatasource(writeDataFiles(t, dir, reloadProducts, reloadPromotions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	basket := model.NewBasket("B1")
+	_ = ds.AddBasket(basket)
+
+	dataConfig := writeDataFiles(t, dir, `[
+  {"code": "TSHIRT", "name": "Cabify T-Shirt", "price": 2200},
+  {"code": "MUG", "name": "Cabify Coffee Mug", "price": 750}
+]`, `[
+  {"id": "bulk", "code": "BULK", "promos": [{"product": "TSHIRT", "rules": [{"buy": 3, "price": 2000}]}]},
+  {"id": "mug", "code": "BULK", "promos": [{"product": "MUG", "rules": [{"buy": 2, "price": 600}]}]}
+]`)
+
+	// When
+	diff, err := ds.Reload(dataConfig)
+
+	// Then
+	if err != nil {
+		t.Fatalf("Unexpected error reloading: %v", err)
+	}
+
+	expected := CatalogueDiff{
+		AddedProducts:   []model.ProductCode{"MUG"},
+		RemovedProducts: []model.ProductCode{"VOUCHER"},
+		ChangedProducts: []ProductChange{{
+			Before: model.Product{Code: "TSHIRT", Name: "Cabify T-Shirt", Price: model.NewMoney(2000, "EUR")},
+			After:  model.Product{Code: "TSHIRT", Name: "Cabify T-Shirt", Price: model.NewMoney(2200, "EUR")},
+		}},
+		AddedPromotions:   []string{"mug"},
+		RemovedPromotions: []string{"free"},
+		ChangedPromotions: []string{"bulk"},
+	}
+	if !reflect.DeepEqual(expected, diff) {
+		t.Errorf("Wanted diff %+v, got %+v", expected, diff)
+	}
+
+	if product, _ := ds.GetProduct("TSHIRT"); product.Price.Amount != 2200 {
+		t.Errorf("Wanted new TSHIRT price 2200, got %v", product.Price)
+	}
+	if promotions := ds.GetPromotions(); len(promotions) != 2 || promotions[1].GetId() != "mug" {
+		t.Errorf("Wanted new promotions to be active, got %v", promotions)
+	}
+	if b, err := ds.GetBasket("B1"); err != nil || b != basket {
+		t.Errorf("Baskets should be kept on reload")
+	}
+}
+
+func TestReloadPromotionsWithoutId(t *testing.T) {
+	// Given
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dataConfig := writeDataFiles(t, dir, reloadProducts, `[
+  {"code": "BULK", "promos": [{"product": "TSHIRT", "rules": [{"buy": 3, "price": 1900}]}]},
+  {"code": "FREE_ITEMS", "promos": [{"product": "VOUCHER", "rules": [{"buy": 2, "free": 1}]}]}
+]`)
+	ds, err := InitInMemoryDatasource(dataConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := ds.GetPromotions()
+
+	// When
+	diff, err := ds.Reload(dataConfig)
+
+	// Then
+	if err != nil {
+		t.Fatalf("Unexpected error reloading: %v", err)
+	}
+	if !reflect.DeepEqual(CatalogueDiff{}, diff) {
+		t.Errorf("Wanted no changes reloading the same files, got %+v", diff)
+	}
+
+	after := ds.GetPromotions()
+	if before[0].GetId() == before[1].GetId() {
+		t.Errorf("Wanted different ids for different promotions, got %v", before[0].GetId())
+	}
+	for i := range before {
+		if before[i].GetId() != after[i].GetId() {
+			t.Errorf("Wanted id %v kept on reload, got %v", before[i].GetId(), after[i].GetId())
+		}
+	}
+}
+
+func TestPromotionsWithDuplicates(t *testing.T) {
+	// Given
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dataConfig := writeDataFiles(t, dir, reloadProducts, `[
+  {"code": "BULK", "promos": [{"product": "TSHIRT", "rules": [{"buy": 3, "price": 1900}]}]},
+  {"code": "BULK", "promos": [{"product": "TSHIRT", "rules": [{"buy": 3, "price": 1900}]}]},
+  {"id": "free", "code": "FREE_ITEMS", "promos": [{"product": "VOUCHER", "rules": [{"buy": 2, "free": 1}]}]},
+  {"id": "free", "code": "FREE_ITEMS", "promos": [{"product": "VOUCHER", "rules": [{"buy": 3, "free": 1}]}]}
+]`)
+
+	// When
+	ds, err := InitInMemoryDatasource(dataConfig)
+
+	// Then
+	if err != nil {
+		t.Fatalf("Unexpected error loading duplicated promotions: %v", err)
+	}
+
+	promotions := ds.GetPromotions()
+	if len(promotions) != 3 {
+		t.Fatalf("Wanted the promotion with a duplicated id skipped, got %v", promotions)
+	}
+	if promotions[0].GetId() == promotions[1].GetId() {
+		t.Errorf("Wanted different ids for identical promotions, got %v", promotions[0].GetId())
+	}
+	if definition, _ := ds.GetPromotionDefinition("free"); !reflect.DeepEqual(definition["promos"],
+		[]interface{}{map[string]interface{}{"product": "VOUCHER",
+			"rules": []interface{}{map[string]interface{}{"buy": float64(2), "free": float64(1)}}}}) {
+		t.Errorf("Wanted the first promotion with a duplicated id kept, got %v", definition)
+	}
+}
+
+func TestReloadInvalidFiles(t *testing.T) {
+	var reloadCases = []struct {
+		name       string
+		products   string
+		promotions string
+	}{
+		{"Invalid product", `[{"code": "TSHIRT", "name": "Cabify T-Shirt", "price": -1}]`, reloadPromotions},
+		{"Duplicated product", `[{"code": "TSHIRT", "name": "T1", "price": 1}, {"code": "TSHIRT", "name": "T2", "price": 2}]`, reloadPromotions},
+		{"Malformed products", `[{"code": "TSHIRT"`, reloadPromotions},
+		{"Unknown promotion type", reloadProducts, `[{"code": "FAKE", "promos": []}]`},
+		{"Invalid promotion", reloadProducts, `[{"code": "BULK", "promos": [{"product": "TSHIRT", "rules": []}]}]`},
+		{"Invalid promotion rule", reloadProducts, `[
+  {"code": "BULK", "promos": [{"product": "TSHIRT", "rules": [{"buy": 3, "price": 1900}, {"buy": 0, "price": 1800}]}]}
+]`},
+		{"Duplicated promotion id", reloadProducts, `[
+  {"id": "bulk", "code": "BULK", "promos": [{"product": "TSHIRT", "rules": [{"buy": 3, "price": 1900}]}]},
+  {"id": "bulk", "code": "BULK", "promos": [{"product": "VOUCHER", "rules": [{"buy": 3, "price": 400}]}]}
+]`},
+	}
+
+	for _, test := range reloadCases {
+		t.Run(test.name, func(t *testing.T) {
+			// Given
+			dir, err := ioutil.TempDir("", "reload")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			ds, err := InitInMemoryDatasource(writeDataFiles(t, dir, reloadProducts, reloadPromotions))
+			if err != nil {
+				t.Fatal(err)
+			}
+			dataConfig := writeDataFiles(t, dir, test.products, test.promotions)
+
+			// When
+			_, err = ds.Reload(dataConfig)
+
+			// Then
+			if err == nil {
+				t.Fatal("Wanted an error reloading invalid files")
+			}
+			if len(ds.GetProducts()) != 2 || len(ds.GetPromotions()) != 2 {
+				t.Errorf("Catalogue and promotions should not change on a failed reload")
+			}
+			if _, ok := err.(*errors.PromotionNotFound); ok {
+				t.Errorf("Unknown promotion types should be reported as invalid promotions")
+			}
+		})
+	}
+}
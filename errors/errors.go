@@ -8,6 +8,10 @@ type ProductNotFound struct {
 	Code string
 }
 
+type ProductAlreadyExists struct {
+	Code string
+}
+
 type PromotionNotFound struct {
 	Code string
 }
@@ -21,6 +25,72 @@ type BasketNotFound struct {
 	Id string
 }
 
+type BasketExpired struct {
+	Id string
+}
+
+type ProductNotInBasket struct {
+	BasketId string
+	Code     string
+}
+
+type CouponNotFound struct {
+	Code string
+}
+
+type CouponExpired struct {
+	Code string
+}
+
+type CouponExhausted struct {
+	Code string
+}
+
+type CouponAlreadyApplied struct {
+	BasketId string
+	Code     string
+}
+
+type CouponNotInBasket struct {
+	BasketId string
+	Code     string
+}
+
+type BasketCheckedOut struct {
+	Id      string
+	OrderId string
+}
+
+type OrderNotFound struct {
+	Id string
+}
+
+type OutOfStock struct {
+	Code      string
+	Requested int
+	Available int
+}
+
+type BasketForbidden struct {
+	Id       string
+	Customer string
+}
+
+type OrderStateInvalid struct {
+	Id     string
+	State  string
+	Action string
+}
+
+type PaymentDeclined struct {
+	OrderId string
+	Reason  string
+}
+
+type PaymentTimeout struct {
+	OrderId string
+}
+
 type PrimaryKeyError struct {
 	Id string
 }
@@ -38,6 +108,10 @@ func NewProductNotFound(code string) *ProductNotFound {
 	return &ProductNotFound{Code: code}
 }
 
+func NewProductAlreadyExists(code string) *ProductAlreadyExists {
+	return &ProductAlreadyExists{Code: code}
+}
+
 func NewPromotionNotFound(code string) *PromotionNotFound {
 	return &PromotionNotFound{
 		Code: code,
@@ -55,6 +129,88 @@ func NewBasketNotFound(id string) *BasketNotFound {
 	return &BasketNotFound{Id: id}
 }
 
+func NewBasketExpired(id string) *BasketExpired {
+	return &BasketExpired{Id: id}
+}
+
+func NewProductNotInBasket(basketId, code string) *ProductNotInBasket {
+	return &ProductNotInBasket{
+		BasketId: basketId,
+		Code:     code,
+	}
+}
+
+func NewCouponNotFound(code string) *CouponNotFound {
+	return &CouponNotFound{Code: code}
+}
+
+func NewCouponExpired(code string) *CouponExpired {
+	return &CouponExpired{Code: code}
+}
+
+func NewCouponExhausted(code string) *CouponExhausted {
+	return &CouponExhausted{Code: code}
+}
+
+func NewCouponAlreadyApplied(basketId, code string) *CouponAlreadyApplied {
+	return &CouponAlreadyApplied{
+		BasketId: basketId,
+		Code:     code,
+	}
+}
+
+func NewCouponNotInBasket(basketId, code string) *CouponNotInBasket {
+	return &CouponNotInBasket{
+		BasketId: basketId,
+		Code:     code,
+	}
+}
+
+func NewBasketCheckedOut(id, orderId string) *BasketCheckedOut {
+	return &BasketCheckedOut{
+		Id:      id,
+		OrderId: orderId,
+	}
+}
+
+func NewOrderNotFound(id string) *OrderNotFound {
+	return &OrderNotFound{Id: id}
+}
+
+func NewOutOfStock(code string, requested, available int) *OutOfStock {
+	return &OutOfStock{
+		Code:      code,
+		Requested: requested,
+		Available: available,
+	}
+}
+
+func NewBasketForbidden(id, customer string) *BasketForbidden {
+	return &BasketForbidden{
+		Id:       id,
+		Customer: customer,
+	}
+}
+
+func NewOrderStateInvalid(id, state, action string) *OrderStateInvalid {
+	return &OrderStateInvalid{
+		Id:     id,
+		State:  state,
+		Action: action,
+	}
+}
+
+func NewPaymentDeclined(orderId, reason string) *PaymentDeclined {
+	return &PaymentDeclined{
+		OrderId: orderId,
+		Reason:  reason,
+	}
+}
+
+func NewPaymentTimeout(orderId string) *PaymentTimeout {
+	return &PaymentTimeout{OrderId: orderId}
+}
+
 func NewPrimaryKeyError(id string) *PrimaryKeyError {
 	return &PrimaryKeyError{Id: id}
 }
@@ -77,6 +233,10 @@ func (p *ProductNotFound) Error() string {
 	return fmt.Sprintf("Product %v not found", p.Code)
 }
 
+func (p *ProductAlreadyExists) Error() string {
+	return fmt.Sprintf("Product %v already exists", p.Code)
+}
+
 func (p *PromotionNotFound) Error() string {
 	return fmt.Sprintf("Promotion %v not found", p.Code)
 }
@@ -85,10 +245,66 @@ func (b *BasketNotFound) Error() string {
 	return fmt.Sprintf("Basket %v not found", b.Id)
 }
 
+func (b *BasketExpired) Error() string {
+	return fmt.Sprintf("Basket %v expired", b.Id)
+}
+
+func (p *ProductNotInBasket) Error() string {
+	return fmt.Sprintf("Product %v not found in basket %v", p.Code, p.BasketId)
+}
+
 func (p *PromotionInvalid) Error() string {
 	return fmt.Sprintf("Promotion %v invalid: %v", p.Code, p.Msg)
 }
 
+func (c *CouponNotFound) Error() string {
+	return fmt.Sprintf("Coupon %v not found", c.Code)
+}
+
+func (c *CouponExpired) Error() string {
+	return fmt.Sprintf("Coupon %v expired", c.Code)
+}
+
+func (c *CouponExhausted) Error() string {
+	return fmt.Sprintf("Coupon %v has no uses left", c.Code)
+}
+
+func (c *CouponAlreadyApplied) Error() string {
+	return fmt.Sprintf("Coupon %v already applied to basket %v", c.Code, c.BasketId)
+}
+
+func (c *CouponNotInBasket) Error() string {
+	return fmt.Sprintf("Coupon %v not found in basket %v", c.Code, c.BasketId)
+}
+
+func (b *BasketCheckedOut) Error() string {
+	return fmt.Sprintf("Basket %v already checked out as order %v", b.Id, b.OrderId)
+}
+
+func (o *OrderNotFound) Error() string {
+	return fmt.Sprintf("Order %v not found", o.Id)
+}
+
+func (o *OutOfStock) Error() string {
+	return fmt.Sprintf("Product %v out of stock: %v units requested, %v available", o.Code, o.Requested, o.Available)
+}
+
+func (b *BasketForbidden) Error() string {
+	return fmt.Sprintf("Basket %v does not belong to customer %v", b.Id, b.Customer)
+}
+
+func (o *OrderStateInvalid) Error() string {
+	return fmt.Sprintf("Order %v can not be %v while %v", o.Id, o.Action, o.State)
+}
+
+func (p *PaymentDeclined) Error() string {
+	return fmt.Sprintf("Payment of order %v declined: %v", p.OrderId, p.Reason)
+}
+
+func (p *PaymentTimeout) Error() string {
+	return fmt.Sprintf("Payment of order %v timed out", p.OrderId)
+}
+
 func (p *PrimaryKeyError) Error() string {
 	return fmt.Sprintf("Primary key already exists: %v", p.Id)
 }
@@ -3,6 +3,7 @@ package integration
 import (
 	"fmt"
 	"github.com/alfcope/checkouttest/cli"
+	"github.com/alfcope/checkouttest/model"
 	"github.com/stretchr/testify/suite"
 	"net/http"
 	"regexp"
@@ -31,6 +32,13 @@ func (suite *CheckoutServiceClientITSuite) SetupSuite() {
 	suite.client = cli.NewCheckoutClient("http://localhost:7070", 1)
 }
 
+func (suite *CheckoutServiceClientITSuite) TestGetProducts() {
+	products, err := suite.client.GetProducts()
+
+	suite.Nil(err)
+	suite.Equal(3, len(products))
+}
+
 func (suite *CheckoutServiceClientITSuite) TestAddBasket() {
 	id, err := suite.client.AddBasket()
 
@@ -63,6 +71,21 @@ func (suite *CheckoutServiceClientITSuite) TestAddProductMultipleTimes() {
 	}
 }
 
+func (suite *CheckoutServiceClientITSuite) TestAddItemsWithNonExistingProduct() {
+	id, err := suite.client.AddBasket()
+	if err != nil {
+		suite.T().Errorf("error creating basket: %v", err.Error())
+	}
+
+	err = suite.client.AddItems(id, map[string]int{"VOUCHER": 3, "FAKE": 1})
+	suite.EqualError(err, fmt.Sprintf("%d %s", http.StatusNotFound, http.StatusText(http.StatusNotFound)))
+
+	price, err := suite.client.GetPrice(id)
+
+	suite.Nil(err)
+	suite.Equal(model.NewMoney(0, "EUR"), price)
+}
+
 func (suite *CheckoutServiceClientITSuite) TestGetPrice() {
 	id, err := suite.client.AddBasket()
 	if err != nil {
@@ -81,7 +104,7 @@ func (suite *CheckoutServiceClientITSuite) TestGetPrice() {
 	price, err := suite.client.GetPrice(id)
 
 	suite.Nil(err)
-	suite.True(float64(3250)/100 == price)
+	suite.Equal(model.NewMoney(3250, "EUR"), price)
 
 	// With promotions
 	products = []string{"VOUCHER", "VOUCHER", "TSHIRT", "TSHIRT"}
@@ -96,7 +119,7 @@ func (suite *CheckoutServiceClientITSuite) TestGetPrice() {
 	price, err = suite.client.GetPrice(id)
 
 	suite.Nil(err)
-	suite.True(float64(7450)/100 == price)
+	suite.Equal(model.NewMoney(7450, "EUR"), price)
 }
 
 func (suite *CheckoutServiceClientITSuite) TestDeleteBasket() {
@@ -17,6 +17,12 @@ type CheckoutServerStub struct {
 type StubContext struct {
 	responseStatusCode int
 	payload            interface{}
+	// Headers of the last request received
+	requestHeaders http.Header
+	// Requests throttled before responding the stub, and the wait they are told
+	throttled  int
+	retryAfter string
+	requests   int
 }
 
 func NewCheckServerStub(path string) *CheckoutServerStub {
@@ -41,10 +47,21 @@ func (c *CheckoutServerStub) initServer(urlPath string) *httptest.Server {
 func (c *CheckoutServerStub) initializeRoutes(urlPath string) *mux.Router {
 	r := mux.NewRouter()
 	fmt.Printf("%v/baskets/\n", urlPath)
+	r.HandleFunc(fmt.Sprintf("%v/products/", urlPath), c.returnStub()).Methods("GET").Headers("Accept", "application/json")
 	r.HandleFunc(fmt.Sprintf("%v/baskets/", urlPath), c.returnStub()).Methods("POST").Headers("Accept", "application/json")
 	r.HandleFunc(fmt.Sprintf("%v/baskets/{id}/items/", urlPath), c.returnStub()).Methods("POST").Headers("Content-Type", "application/json")
+	r.HandleFunc(fmt.Sprintf("%v/baskets/{id}/items/batch", urlPath), c.returnStub()).Methods("POST").Headers("Content-Type", "application/json")
+	r.HandleFunc(fmt.Sprintf("%v/baskets/{id}/items/{code}", urlPath), c.returnStub()).Methods("PUT").Headers("Content-Type", "application/json")
+	r.HandleFunc(fmt.Sprintf("%v/baskets/{id}/items/{code}", urlPath), c.returnStub()).Methods("DELETE")
+	r.HandleFunc(fmt.Sprintf("%v/baskets/{id}/coupons/", urlPath), c.returnStub()).Methods("POST").Headers("Content-Type", "application/json")
+	r.HandleFunc(fmt.Sprintf("%v/baskets/{id}/coupons/{code}", urlPath), c.returnStub()).Methods("DELETE")
 	r.HandleFunc(fmt.Sprintf("%v/baskets/{id}", urlPath), c.returnStub()).Methods("GET").Queries("price", "").Headers("Accept", "application/json")
+	r.HandleFunc(fmt.Sprintf("%v/baskets/{id}", urlPath), c.returnStub()).Methods("GET").Headers("Accept", "application/json")
+	r.HandleFunc(fmt.Sprintf("%v/baskets/{id}/receipt", urlPath), c.returnStub()).Methods("GET").Headers("Accept", "application/json")
+	r.HandleFunc(fmt.Sprintf("%v/baskets/{id}/checkout", urlPath), c.returnStub()).Methods("POST").Headers("Accept", "application/json")
 	r.HandleFunc(fmt.Sprintf("%v/baskets/{id}", urlPath), c.returnStub()).Methods("DELETE")
+	r.HandleFunc(fmt.Sprintf("%v/orders/{id}", urlPath), c.returnStub()).Methods("GET").Headers("Accept", "application/json")
+	r.HandleFunc(fmt.Sprintf("%v/orders/{id}/refund", urlPath), c.returnStub()).Methods("POST").Headers("Accept", "application/json")
 
 	return r
 }
@@ -62,8 +79,36 @@ func (c *CheckoutServerStub) StubResponse(statusCode int, payload interface{}) {
 	c.context.payload = payload
 }
 
+// StubThrottled rejects the next requests with 429, telling them to retry after the
+// given wait, before responding the stubbed response
+func (c *CheckoutServerStub) StubThrottled(requests int, retryAfter string) {
+	c.context.throttled = requests
+	c.context.retryAfter = retryAfter
+	c.context.requests = 0
+}
+
+// Requests returns the number of requests received since the last StubThrottled
+func (c *CheckoutServerStub) Requests() int {
+	return c.context.requests
+}
+
+// RequestHeader returns a header of the last request received
+func (c *CheckoutServerStub) RequestHeader(name string) string {
+	return c.context.requestHeaders.Get(name)
+}
+
 func (c *CheckoutServerStub) returnStub() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		c.context.requestHeaders = r.Header
+		c.context.requests++
+
+		if c.context.throttled > 0 {
+			c.context.throttled--
+			w.Header().Set("Retry-After", c.context.retryAfter)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
 		w.WriteHeader(c.context.responseStatusCode)
 
 		if c.context.payload != nil {
@@ -3,6 +3,7 @@ package mocks
 import (
 	"github.com/alfcope/checkouttest/model"
 	"github.com/stretchr/testify/mock"
+	"time"
 )
 
 type DatasourceMock struct {
@@ -26,12 +27,115 @@ func (d *DatasourceMock) GetProduct(code model.ProductCode) (model.Product, erro
 	return args.Get(0).(model.Product), err
 }
 
+func (d *DatasourceMock) GetProducts() []model.Product {
+	args := d.Called()
+
+	return args.Get(0).([]model.Product)
+}
+
+func (d *DatasourceMock) AddProduct(product model.Product) error {
+	args := d.Called(product)
+
+	var err error
+	if args.Get(0) == nil {
+		err = nil
+	} else {
+		err = args.Get(0).(error)
+	}
+
+	return err
+}
+
+func (d *DatasourceMock) UpdateProduct(product model.Product) error {
+	args := d.Called(product)
+
+	var err error
+	if args.Get(0) == nil {
+		err = nil
+	} else {
+		err = args.Get(0).(error)
+	}
+
+	return err
+}
+
+func (d *DatasourceMock) DeleteProduct(code model.ProductCode) error {
+	args := d.Called(code)
+
+	var err error
+	if args.Get(0) == nil {
+		err = nil
+	} else {
+		err = args.Get(0).(error)
+	}
+
+	return err
+}
+
 func (d *DatasourceMock) GetPromotions() []model.Promotion {
 	args := d.Called()
 
 	return args.Get(0).([]model.Promotion)
 }
 
+func (d *DatasourceMock) GetPromotionDefinitions() []map[string]interface{} {
+	args := d.Called()
+
+	return args.Get(0).([]map[string]interface{})
+}
+
+func (d *DatasourceMock) GetPromotionDefinition(id string) (map[string]interface{}, error) {
+	args := d.Called(id)
+
+	var err error
+	if args.Get(1) == nil {
+		err = nil
+	} else {
+		err = args.Get(1).(error)
+	}
+
+	return args.Get(0).(map[string]interface{}), err
+}
+
+func (d *DatasourceMock) AddPromotion(definition map[string]interface{}) (string, error) {
+	args := d.Called(definition)
+
+	var err error
+	if args.Get(1) == nil {
+		err = nil
+	} else {
+		err = args.Get(1).(error)
+	}
+
+	return args.String(0), err
+}
+
+func (d *DatasourceMock) UpdatePromotion(id string, definition map[string]interface{}) error {
+	args := d.Called(id, definition)
+
+	var err error
+	if args.Get(0) == nil {
+		err = nil
+	} else {
+		err = args.Get(0).(error)
+	}
+
+	return err
+}
+
+func (d *DatasourceMock) DeletePromotion(id string) error {
+	args := d.Called(id)
+
+	var err error
+	if args.Get(0) == nil {
+		err = nil
+	} else {
+		err = args.Get(0).(error)
+	}
+
+	return err
+}
+
 func (d *DatasourceMock) GetBasket(id string) (*model.Basket, error) {
 	args := d.Called(id)
 
@@ -58,6 +162,145 @@ func (d *DatasourceMock) AddBasket(basket *model.Basket) error {
 	return err
 }
 
-func (d *DatasourceMock) DeleteBasket(basketId string) {
-	d.Called(basketId)
+// UpdateBasket applies the update to the basket returned by the GetBasket mock,
+// so tests only need to set expectations on GetBasket
+func (d *DatasourceMock) UpdateBasket(id string, update func(*model.Basket) error) error {
+	basket, err := d.GetBasket(id)
+	if err != nil {
+		return err
+	}
+
+	return update(basket)
+}
+
+func (d *DatasourceMock) DeleteBasket(basketId string) *model.Basket {
+	args := d.Called(basketId)
+
+	if len(args) == 0 || args.Get(0) == nil {
+		return nil
+	}
+
+	return args.Get(0).(*model.Basket)
+}
+
+func (d *DatasourceMock) DeleteBasketsUpdatedBefore(updatedBefore time.Time) []*model.Basket {
+	args := d.Called(updatedBefore)
+
+	return args.Get(0).([]*model.Basket)
+}
+
+func (d *DatasourceMock) GetBasketsByOwner(owner string) []*model.Basket {
+	args := d.Called(owner)
+
+	return args.Get(0).([]*model.Basket)
+}
+
+func (d *DatasourceMock) UseCoupon(code string, now time.Time) error {
+	args := d.Called(code, now)
+
+	if args.Get(0) != nil {
+		return args.Get(0).(error)
+	}
+
+	return nil
+}
+
+func (d *DatasourceMock) ReleaseCoupon(code string) {
+	d.Called(code)
+}
+
+func (d *DatasourceMock) GetStock(code model.ProductCode) (model.Stock, error) {
+	args := d.Called(code)
+
+	var err error
+	if args.Get(1) != nil {
+		err = args.Get(1).(error)
+	}
+
+	return args.Get(0).(model.Stock), err
+}
+
+// UpdateStock applies the update to the stock returned by the GetStock mock, and
+// records the updated stock as the argument of the call. Without expectations on
+// GetStock the stock is not tracked, so tests not about stock need none
+func (d *DatasourceMock) UpdateStock(code model.ProductCode, update func(*model.Stock) error) error {
+	if !d.expects("GetStock") {
+		stock := model.Stock{Code: code}
+		return update(&stock)
+	}
+
+	stock, err := d.GetStock(code)
+	if err != nil {
+		return err
+	}
+
+	if err := update(&stock); err != nil {
+		return err
+	}
+
+	args := d.Called(stock)
+
+	if args.Get(0) != nil {
+		return args.Get(0).(error)
+	}
+
+	return nil
+}
+
+func (d *DatasourceMock) expects(method string) bool {
+	for _, call := range d.ExpectedCalls {
+		if call.Method == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *DatasourceMock) AddOrder(order model.Order) error {
+	args := d.Called(order)
+
+	if args.Get(0) != nil {
+		return args.Get(0).(error)
+	}
+
+	return nil
+}
+
+func (d *DatasourceMock) GetOrder(id string) (model.Order, error) {
+	args := d.Called(id)
+
+	var err error
+	if args.Get(1) != nil {
+		err = args.Get(1).(error)
+	}
+
+	return args.Get(0).(model.Order), err
+}
+
+// UpdateOrder applies the update to the order returned by the GetOrder mock, and
+// records the updated order as the argument of the call
+func (d *DatasourceMock) UpdateOrder(id string, update func(*model.Order) error) error {
+	order, err := d.GetOrder(id)
+	if err != nil {
+		return err
+	}
+
+	if err := update(&order); err != nil {
+		return err
+	}
+
+	args := d.Called(order)
+
+	if args.Get(0) != nil {
+		return args.Get(0).(error)
+	}
+
+	return nil
+}
+
+func (d *DatasourceMock) GetOrders(offset, limit int) ([]model.Order, int) {
+	args := d.Called(offset, limit)
+
+	return args.Get(0).([]model.Order), args.Int(1)
 }
@@ -1,12 +1,26 @@
 package model
 
 import (
+	"github.com/alfcope/checkouttest/errors"
+	"sort"
 	"sync"
+	"time"
 )
 
 type Basket struct {
-	Id    string
-	lines map[ProductCode]Line
+	Id string
+	// Id of the customer owning the basket, empty for anonymous baskets
+	owner string
+	// Currency the basket is priced in. Its lines keep the currency of the catalogue
+	currency Currency
+	lines    map[ProductCode]Line
+	// Codes of the coupons applied, in the order they were applied
+	coupons []string
+	// Id of the order the basket was checked out as. Checked out baskets can not change
+	orderId string
+
+	createdAt time.Time
+	updatedAt time.Time
 
 	rwMux sync.RWMutex
 }
@@ -16,23 +30,212 @@ type Line struct {
 	amount int
 }
 
+func NewLine(p Product, amount int) Line {
+	return Line{
+		Product: p,
+		amount:  amount,
+	}
+}
+
+func (l *Line) Amount() int {
+	return l.amount
+}
+
+func (l *Line) Validate() error {
+	err := l.Product.Validate()
+	if err != nil {
+		return err
+	}
+
+	if l.amount <= 0 {
+		return errors.NewValidationError([]*errors.ValidationErrorDescription{
+			errors.NewValidationErrorDescription("quantity", "Invalid product quantity")})
+	}
+
+	return nil
+}
+
 func NewBasket(id string) *Basket {
+	return NewBasketInCurrency(id, DefaultCurrency)
+}
+
+// NewBasketInCurrency creates an empty anonymous basket priced in the given currency
+func NewBasketInCurrency(id string, currency Currency) *Basket {
+	return NewCustomerBasket(id, "", currency)
+}
+
+// NewCustomerBasket creates an empty basket owned by the given customer, priced in
+// the given currency
+func NewCustomerBasket(id string, owner string, currency Currency) *Basket {
+	now := time.Now().UTC()
+
 	return &Basket{
-		Id:    id,
-		lines: make(map[ProductCode]Line),
-		rwMux: sync.RWMutex{},
+		Id:        id,
+		owner:     owner,
+		currency:  currency,
+		lines:     make(map[ProductCode]Line),
+		createdAt: now,
+		updatedAt: now,
+		rwMux:     sync.RWMutex{},
+	}
+}
+
+// RestoreBasket rebuilds a basket as it was stored, keeping its owner, currency, lines,
+// coupons, order and dates
+func RestoreBasket(id string, owner string, currency Currency, lines []Line, coupons []string, orderId string,
+	createdAt, updatedAt time.Time) *Basket {
+	basket := &Basket{
+		Id:        id,
+		owner:     owner,
+		currency:  currency,
+		lines:     make(map[ProductCode]Line, len(lines)),
+		coupons:   append([]string(nil), coupons...),
+		orderId:   orderId,
+		createdAt: createdAt,
+		updatedAt: updatedAt,
+		rwMux:     sync.RWMutex{},
+	}
+
+	for _, l := range lines {
+		basket.lines[l.Code] = l
+	}
+
+	return basket
+}
+
+// Owner returns the id of the customer owning the basket, empty if it is anonymous
+func (b *Basket) Owner() string {
+	b.rwMux.RLock()
+	defer b.rwMux.RUnlock()
+
+	return b.owner
+}
+
+// CanAccess tells if the customer can read or change the basket. Anonymous baskets
+// can be accessed by anyone
+func (b *Basket) CanAccess(customer string) bool {
+	b.rwMux.RLock()
+	defer b.rwMux.RUnlock()
+
+	return b.owner == "" || b.owner == customer
+}
+
+// Currency returns the currency the basket is priced in
+func (b *Basket) Currency() Currency {
+	b.rwMux.RLock()
+	defer b.rwMux.RUnlock()
+
+	return b.currency
+}
+
+// OrderId returns the id of the order the basket was checked out as, empty if it was not
+func (b *Basket) OrderId() string {
+	b.rwMux.RLock()
+	defer b.rwMux.RUnlock()
+
+	return b.orderId
+}
+
+// CheckOut freezes the basket as the given order, so it can not change anymore
+func (b *Basket) CheckOut(orderId string) error {
+	b.rwMux.Lock()
+	defer b.rwMux.Unlock()
+
+	if b.orderId != "" {
+		return errors.NewBasketCheckedOut(b.Id, b.orderId)
+	}
+
+	b.orderId = orderId
+	b.updatedAt = time.Now().UTC()
+
+	return nil
+}
+
+// CancelCheckOut unfreezes a basket whose order could not be placed
+func (b *Basket) CancelCheckOut() {
+	b.rwMux.Lock()
+	defer b.rwMux.Unlock()
+
+	b.orderId = ""
+	b.updatedAt = time.Now().UTC()
+}
+
+func (b *Basket) CreatedAt() time.Time {
+	b.rwMux.RLock()
+	defer b.rwMux.RUnlock()
+
+	return b.createdAt
+}
+
+func (b *Basket) UpdatedAt() time.Time {
+	b.rwMux.RLock()
+	defer b.rwMux.RUnlock()
+
+	return b.updatedAt
+}
+
+// IsExpired tells whether the basket has not been modified for longer than the ttl.
+// Baskets never expire with a zero ttl
+func (b *Basket) IsExpired(now time.Time, ttl time.Duration) bool {
+	return ttl > 0 && now.Sub(b.UpdatedAt()) > ttl
+}
+
+// Lines returns a copy of the basket lines sorted by product code
+func (b *Basket) Lines() []Line {
+	b.rwMux.RLock()
+	defer b.rwMux.RUnlock()
+
+	lines := make([]Line, 0, len(b.lines))
+	for _, code := range b.sortedCodes() {
+		lines = append(lines, b.lines[code])
 	}
+
+	return lines
+}
+
+// ProductAmount returns the units of the product in the basket
+func (b *Basket) ProductAmount(code ProductCode) int {
+	b.rwMux.RLock()
+	defer b.rwMux.RUnlock()
+
+	return b.lines[code].amount
+}
+
+func (b *Basket) sortedCodes() []ProductCode {
+	codes := make([]string, 0, len(b.lines))
+	for pcode := range b.lines {
+		codes = append(codes, string(pcode))
+	}
+	sort.Strings(codes)
+
+	productCodes := make([]ProductCode, 0, len(codes))
+	for _, code := range codes {
+		productCodes = append(productCodes, ProductCode(code))
+	}
+
+	return productCodes
 }
 
 func (b *Basket) AddProduct(p Product) error {
 	b.rwMux.Lock()
 	defer b.rwMux.Unlock()
 
+	if b.orderId != "" {
+		return errors.NewBasketCheckedOut(b.Id, b.orderId)
+	}
+
 	err := p.Validate()
 	if err != nil {
 		return err
 	}
 
+	err = b.checkCurrency(p)
+	if err != nil {
+		return err
+	}
+
+	b.updatedAt = time.Now().UTC()
+
 	if l, ok := b.lines[p.Code]; ok {
 		l.amount++
 		b.lines[p.Code] = l
@@ -47,32 +250,306 @@ func (b *Basket) AddProduct(p Product) error {
 	return nil
 }
 
-func (b *Basket) CalculatePrice(offers []Promotion) float64 {
-	var productInOffer = make(map[ProductCode]*[]int)
-	var price = 0
-
+// AddProducts adds several units of different products at once. Either all of them
+// are added or, if any product or amount is invalid, the basket is left untouched
+func (b *Basket) AddProducts(lines []Line) error {
 	b.rwMux.Lock()
 	defer b.rwMux.Unlock()
 
-	if offers != nil && len(offers) > 0 {
-		for _, p := range offers {
-			p.Resolve(b.lines, productInOffer)
+	if b.orderId != "" {
+		return errors.NewBasketCheckedOut(b.Id, b.orderId)
+	}
+
+	for _, l := range lines {
+		err := l.Validate()
+		if err != nil {
+			return err
+		}
+
+		err = b.checkCurrency(l.Product)
+		if err != nil {
+			return err
+		}
+
+		if l.Price.Currency != lines[0].Price.Currency {
+			return currencyMismatchError()
+		}
+	}
+
+	b.updatedAt = time.Now().UTC()
+
+	for _, l := range lines {
+		if current, ok := b.lines[l.Code]; ok {
+			current.amount += l.amount
+			b.lines[l.Code] = current
+			continue
 		}
+
+		b.lines[l.Code] = l
+	}
+
+	return nil
+}
+
+// SetProductAmount sets the number of units of a product in the basket.
+// Setting zero units removes the product line
+func (b *Basket) SetProductAmount(p Product, amount int) error {
+	b.rwMux.Lock()
+	defer b.rwMux.Unlock()
+
+	if b.orderId != "" {
+		return errors.NewBasketCheckedOut(b.Id, b.orderId)
+	}
+
+	if amount < 0 {
+		return errors.NewValidationError([]*errors.ValidationErrorDescription{
+			errors.NewValidationErrorDescription("quantity", "Invalid product quantity")})
 	}
 
+	if amount == 0 {
+		delete(b.lines, p.Code)
+		b.updatedAt = time.Now().UTC()
+		return nil
+	}
+
+	err := p.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = b.checkCurrency(p)
+	if err != nil {
+		return err
+	}
+
+	b.updatedAt = time.Now().UTC()
+	b.lines[p.Code] = Line{
+		Product: p,
+		amount:  amount,
+	}
+
+	return nil
+}
+
+// checkCurrency makes sure the lines of the basket are all priced in the same currency,
+// as promotions add up their prices. The line of the product itself is not checked, as
+// it is replaced
+func (b *Basket) checkCurrency(p Product) error {
 	for pcode, line := range b.lines {
-		inOfferCounter := 0
-		if inOffer, ok := productInOffer[pcode]; ok {
-			if inOffer != nil && len(*inOffer) > 0 {
-				inOfferCounter = len(*inOffer)
-				for _, offerPrice := range *inOffer {
-					price += offerPrice
+		if pcode != p.Code && line.Price.Currency != p.Price.Currency {
+			return currencyMismatchError()
+		}
+	}
+
+	return nil
+}
+
+func currencyMismatchError() error {
+	return errors.NewValidationError([]*errors.ValidationErrorDescription{
+		errors.NewValidationErrorDescription("price", "Product price in a different currency than the basket lines")})
+}
+
+// linesCurrency returns the currency of the basket lines, the currency of the basket
+// when it is empty
+func (b *Basket) linesCurrency() Currency {
+	for _, line := range b.lines {
+		return line.Price.Currency
+	}
+
+	return b.currency
+}
+
+// RemoveProduct removes the whole line of a product from the basket
+func (b *Basket) RemoveProduct(code ProductCode) error {
+	b.rwMux.Lock()
+	defer b.rwMux.Unlock()
+
+	if b.orderId != "" {
+		return errors.NewBasketCheckedOut(b.Id, b.orderId)
+	}
+
+	if _, ok := b.lines[code]; !ok {
+		return errors.NewProductNotInBasket(b.Id, string(code))
+	}
+
+	delete(b.lines, code)
+	b.updatedAt = time.Now().UTC()
+
+	return nil
+}
+
+// Coupons returns the codes of the coupons applied to the basket
+func (b *Basket) Coupons() []string {
+	b.rwMux.RLock()
+	defer b.rwMux.RUnlock()
+
+	return append(make([]string, 0, len(b.coupons)), b.coupons...)
+}
+
+// AddCoupon applies a coupon to the basket, so the promotions gated by its code apply
+func (b *Basket) AddCoupon(code string) error {
+	b.rwMux.Lock()
+	defer b.rwMux.Unlock()
+
+	if b.orderId != "" {
+		return errors.NewBasketCheckedOut(b.Id, b.orderId)
+	}
+
+	if b.hasCoupon(code) {
+		return errors.NewCouponAlreadyApplied(b.Id, code)
+	}
+
+	b.coupons = append(b.coupons, code)
+	b.updatedAt = time.Now().UTC()
+
+	return nil
+}
+
+// RemoveCoupon removes a coupon from the basket
+func (b *Basket) RemoveCoupon(code string) error {
+	b.rwMux.Lock()
+	defer b.rwMux.Unlock()
+
+	if b.orderId != "" {
+		return errors.NewBasketCheckedOut(b.Id, b.orderId)
+	}
+
+	for i, applied := range b.coupons {
+		if applied == code {
+			b.coupons = append(b.coupons[:i], b.coupons[i+1:]...)
+			b.updatedAt = time.Now().UTC()
+			return nil
+		}
+	}
+
+	return errors.NewCouponNotInBasket(b.Id, code)
+}
+
+func (b *Basket) hasCoupon(code string) bool {
+	for _, applied := range b.coupons {
+		if applied == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CalculatePrice applies the promotions by priority and returns the itemized receipt of the basket.
+// Promotions gated by a coupon only apply when its code was applied to the basket.
+// Every promotion claims the units it applies to, so those are not available for the next ones,
+// and skips the products claimed by promotions it cannot be applied along with.
+// Then basket promotions discount the total of the lines
+func (b *Basket) CalculatePrice(offers []Promotion) Receipt {
+	return b.CalculatePriceWithStrategy(offers, PriorityOrdered)
+}
+
+// CalculatePriceWithStrategy returns the itemized receipt of the basket, choosing the line
+// promotions to apply with the given strategy. Basket promotions always discount the total
+// of the lines afterwards, by priority. The receipt is in the currency of the lines
+func (b *Basket) CalculatePriceWithStrategy(offers []Promotion, strategy PricingStrategy) Receipt {
+	b.rwMux.Lock()
+	defer b.rwMux.Unlock()
+
+	// Promotions gated by a coupon only apply if it was applied to the basket
+	ungated := make([]Promotion, 0, len(offers))
+	for _, p := range offers {
+		if code := p.GetSettings().Coupon.Code; code == "" || b.hasCoupon(code) {
+			ungated = append(ungated, p)
+		}
+	}
+	offers = ungated
+
+	if strategy == BestForCustomer {
+		return b.receipt(bestOffers(b.lines, offers), offers)
+	}
+
+	return b.receipt(orderedOffers(offers), offers)
+}
+
+// receipt resolves the line offers in order and then applies the basket promotions.
+// The rules coming from the same promotion are reported together on every line
+func (b *Basket) receipt(lineOffers []offer, offers []Promotion) Receipt {
+	var resolver = newOfferResolver(b.lines, offers)
+	var appliedPromotions = make(map[ProductCode][]AppliedPromotion)
+	var appliedSources = make(map[ProductCode][]int)
+	var currency = b.linesCurrency()
+
+	for _, o := range lineOffers {
+		claimed := make(map[ProductCode]int, len(resolver.inOffer))
+		for pcode, inOffer := range resolver.inOffer {
+			claimed[pcode] = len(*inOffer)
+		}
+
+		for _, pcode := range resolver.resolve(o) {
+			inOffer := resolver.inOffer[pcode]
+
+			applied := AppliedPromotion{Id: o.GetId(), Type: o.GetType(), Discount: NewMoney(0, currency)}
+			for _, offerPrice := range (*inOffer)[claimed[pcode]:] {
+				applied.Units++
+				applied.Discount.Amount += b.lines[pcode].Price.Amount - offerPrice
+			}
+
+			merged := false
+			for i, source := range appliedSources[pcode] {
+				if source == o.source {
+					appliedPromotions[pcode][i].Units += applied.Units
+					appliedPromotions[pcode][i].Discount.Amount += applied.Discount.Amount
+					merged = true
 				}
 			}
+			if !merged {
+				appliedPromotions[pcode] = append(appliedPromotions[pcode], applied)
+				appliedSources[pcode] = append(appliedSources[pcode], o.source)
+			}
+		}
+	}
+
+	receipt := Receipt{Lines: make([]ReceiptLine, 0, len(b.lines)), Subtotal: NewMoney(0, currency)}
+	for _, pcode := range b.sortedCodes() {
+		line := b.lines[pcode]
+
+		receiptLine := ReceiptLine{
+			Product:    line.Product,
+			Quantity:   line.amount,
+			Subtotal:   NewMoney(line.amount*line.Price.Amount, currency),
+			Promotions: appliedPromotions[pcode],
 		}
 
-		price += (line.amount - inOfferCounter) * line.Price
+		receiptLine.Total = receiptLine.Subtotal
+		for _, applied := range receiptLine.Promotions {
+			receiptLine.Total.Amount -= applied.Discount.Amount
+		}
+
+		receipt.Lines = append(receipt.Lines, receiptLine)
+		receipt.Subtotal.Amount += receiptLine.Total.Amount
+	}
+
+	// Basket promotions are applied by priority, each one over the total left by the previous
+	// ones and unless an incompatible one was applied before
+	receipt.Total = receipt.Subtotal
+	var basketSources []int
+	for _, o := range prioritizedOffers(offers) {
+		basketPromotion, ok := o.Promotion.(BasketPromotion)
+		if !ok {
+			continue
+		}
+
+		compatible := true
+		for _, source := range basketSources {
+			compatible = compatible && o.GetSettings().compatibleWith(offers[source].GetSettings())
+		}
+		if !compatible {
+			continue
+		}
+
+		if discount := basketPromotion.ResolveBasket(receipt.Total.Amount); discount > 0 {
+			receipt.Discounts = append(receipt.Discounts, AppliedDiscount{Id: o.GetId(), Type: o.GetType(),
+				Discount: NewMoney(discount, currency)})
+			receipt.Total.Amount -= discount
+			basketSources = append(basketSources, o.source)
+		}
 	}
 
-	return float64(price) / 100
+	return receipt
 }
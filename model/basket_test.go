@@ -4,14 +4,16 @@ import (
 	"fmt"
 	"github.com/alfcope/checkouttest/errors"
 	"github.com/google/uuid"
+	"reflect"
 	"testing"
+	"time"
 )
 
 // Adding invalid product
 func TestAddFirstProduct(t *testing.T) {
 	basket := NewBasket(uuid.New().String())
 
-	err := basket.AddProduct(Product{"P1", "Product 1", -10})
+	err := basket.AddProduct(Product{Code: "P1", Name: "Product 1", Price: NewMoney(-10, "EUR")})
 	if err != nil {
 		if _, ok := err.(*errors.ValidationError); !ok {
 			t.Errorf("Expected validation error but got %T", err)
@@ -29,7 +31,7 @@ func TestAddFirstProduct(t *testing.T) {
 func TestAddProduct(t *testing.T) {
 	basket := NewBasket(uuid.New().String())
 
-	err := basket.AddProduct(Product{"P1", "Product 1", 800})
+	err := basket.AddProduct(Product{Code: "P1", Name: "Product 1", Price: NewMoney(800, "EUR")})
 	if err != nil {
 		t.Error("Unexpected error ", err.Error())
 	}
@@ -53,7 +55,7 @@ func TestAddProductMultipleTimes(t *testing.T) {
 	var times = 3
 
 	for i := 0; i < times; i++ {
-		err := basket.AddProduct(Product{"P1", "Product 1", 800})
+		err := basket.AddProduct(Product{Code: "P1", Name: "Product 1", Price: NewMoney(800, "EUR")})
 		if err != nil {
 			t.Error("Unexpected error ", err.Error())
 		}
@@ -77,8 +79,8 @@ func TestAddMultipleProducts(t *testing.T) {
 	basket := NewBasket(uuid.New().String())
 
 	for i := 1; i < 4; i++ {
-		err := basket.AddProduct(Product{ProductCode(fmt.Sprintf("P%d", i)),
-			fmt.Sprintf("Product %d", i), 100 * i})
+		err := basket.AddProduct(Product{Code: ProductCode(fmt.Sprintf("P%d", i)),
+			Name: fmt.Sprintf("Product %d", i), Price: NewMoney(100*i, "EUR")})
 		if err != nil {
 			t.Error("Unexpected error ", err.Error())
 		}
@@ -95,57 +97,371 @@ func TestAddMultipleProducts(t *testing.T) {
 	}
 }
 
+// Reading the lines of a basket
+func TestBasketLines(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+	createdAt := basket.CreatedAt()
+
+	if !createdAt.Equal(basket.UpdatedAt()) {
+		t.Errorf("A new basket should have equal created and updated times")
+	}
+
+	err := basket.AddProducts([]Line{NewLine(Product{Code: "P2", Name: "Product 2", Price: NewMoney(300, "EUR")}, 10),
+		NewLine(Product{Code: "P1", Name: "Product 1", Price: NewMoney(800, "EUR")}, 2)})
+	if err != nil {
+		t.Error("Unexpected error ", err.Error())
+	}
+
+	expected := []Line{{Product{Code: "P1", Name: "Product 1", Price: NewMoney(800, "EUR")}, 2}, {Product{Code: "P2", Name: "Product 2", Price: NewMoney(300, "EUR")}, 10}}
+	if lines := basket.Lines(); !reflect.DeepEqual(expected, lines) {
+		t.Errorf("Wanted lines %v but got %v", expected, lines)
+	}
+
+	if basket.UpdatedAt().Before(createdAt) {
+		t.Errorf("Updated time %v before creation time %v", basket.UpdatedAt(), createdAt)
+	}
+	if !basket.CreatedAt().Equal(createdAt) {
+		t.Errorf("Creation time should not change")
+	}
+}
+
+// Adding several products at once
+func TestRestoreBasket(t *testing.T) {
+	createdAt := time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC)
+	updatedAt := createdAt.Add(time.Hour)
+	lines := []Line{NewLine(Product{Code: "P1", Name: "Product 1", Price: NewMoney(800, "EUR")}, 2), NewLine(Product{Code: "P2", Name: "Product 2", Price: NewMoney(300, "EUR")}, 10)}
+
+	basket := RestoreBasket("B1", "C1", "USD", lines, []string{"SUMMER"}, "", createdAt, updatedAt)
+
+	if basket.Owner() != "C1" {
+		t.Errorf("Wanted owner %v but got %v", "C1", basket.Owner())
+	}
+	if basket.Currency() != "USD" {
+		t.Errorf("Wanted currency %v but got %v", "USD", basket.Currency())
+	}
+	if restored := basket.Lines(); !reflect.DeepEqual(lines, restored) {
+		t.Errorf("Wanted lines %v but got %v", lines, restored)
+	}
+	if coupons := basket.Coupons(); !reflect.DeepEqual([]string{"SUMMER"}, coupons) {
+		t.Errorf("Wanted coupons %v but got %v", []string{"SUMMER"}, coupons)
+	}
+	if !basket.CreatedAt().Equal(createdAt) || !basket.UpdatedAt().Equal(updatedAt) {
+		t.Errorf("Wanted dates %v and %v but got %v and %v", createdAt, updatedAt, basket.CreatedAt(), basket.UpdatedAt())
+	}
+	if err := basket.AddProduct(Product{Code: "P1", Name: "Product 1", Price: NewMoney(800, "EUR")}); err != nil || basket.Lines()[0].Amount() != 3 {
+		t.Errorf("A restored basket should accept new products")
+	}
+}
+
+func TestBasketAccess(t *testing.T) {
+	cases := []struct {
+		owner    string
+		customer string
+		access   bool
+	}{
+		{"", "", true},
+		{"", "C1", true},
+		{"C1", "C1", true},
+		{"C1", "C2", false},
+		{"C1", "", false},
+	}
+
+	for _, tc := range cases {
+		basket := NewCustomerBasket(uuid.New().String(), tc.owner, DefaultCurrency)
+
+		if access := basket.CanAccess(tc.customer); access != tc.access {
+			t.Errorf("Basket of %q accessed by %q: wanted %v but got %v", tc.owner, tc.customer, tc.access, access)
+		}
+	}
+}
+
+func TestBasketCoupons(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+
+	if err := basket.AddCoupon("SUMMER"); err != nil {
+		t.Errorf("Unexpected error adding a coupon: %v", err)
+	}
+	if err := basket.AddCoupon("WELCOME"); err != nil {
+		t.Errorf("Unexpected error adding a coupon: %v", err)
+	}
+	if _, ok := basket.AddCoupon("SUMMER").(*errors.CouponAlreadyApplied); !ok {
+		t.Errorf("A coupon should not be applied twice")
+	}
+	if err := basket.RemoveCoupon("SUMMER"); err != nil {
+		t.Errorf("Unexpected error removing a coupon: %v", err)
+	}
+	if _, ok := basket.RemoveCoupon("SUMMER").(*errors.CouponNotInBasket); !ok {
+		t.Errorf("A coupon not applied should not be removed")
+	}
+
+	if coupons := basket.Coupons(); !reflect.DeepEqual([]string{"WELCOME"}, coupons) {
+		t.Errorf("Wanted coupons %v but got %v", []string{"WELCOME"}, coupons)
+	}
+}
+
+func TestBasketCheckOut(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+	_ = basket.AddProduct(Product{Code: "P1", Name: "Product 1", Price: NewMoney(800, "EUR")})
+	_ = basket.AddCoupon("SUMMER")
+
+	if err := basket.CheckOut("O1"); err != nil {
+		t.Errorf("Unexpected error checking out a basket: %v", err)
+	}
+	if basket.OrderId() != "O1" {
+		t.Errorf("Wanted order %v but got %v", "O1", basket.OrderId())
+	}
+	if _, ok := basket.CheckOut("O2").(*errors.BasketCheckedOut); !ok {
+		t.Errorf("A basket should not be checked out twice")
+	}
+
+	// A checked out basket is frozen
+	product := Product{Code: "P1", Name: "Product 1", Price: NewMoney(800, "EUR")}
+	for name, err := range map[string]error{
+		"AddProduct":       basket.AddProduct(product),
+		"AddProducts":      basket.AddProducts([]Line{NewLine(product, 2)}),
+		"SetProductAmount": basket.SetProductAmount(product, 5),
+		"RemoveProduct":    basket.RemoveProduct("P1"),
+		"AddCoupon":        basket.AddCoupon("WELCOME"),
+		"RemoveCoupon":     basket.RemoveCoupon("SUMMER"),
+	} {
+		if _, ok := err.(*errors.BasketCheckedOut); !ok {
+			t.Errorf("%v should fail on a checked out basket, got %v", name, err)
+		}
+	}
+	if lines := basket.Lines(); len(lines) != 1 || lines[0].Amount() != 1 {
+		t.Errorf("A checked out basket should keep its lines, got %v", lines)
+	}
+
+	basket.CancelCheckOut()
+	if err := basket.AddProduct(product); err != nil || basket.OrderId() != "" {
+		t.Errorf("A basket whose checkout is cancelled should accept new products")
+	}
+}
+
+func TestBasketPriceWithCoupons(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+	basket.lines = map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 3}}
+
+	summer := NewPercentagePromotion(map[ProductCode][]PercentageOfferRule{"P1": {{1, 10}}})
+	summer.Coupon = Coupon{Code: "SUMMER"}
+	welcome := NewThresholdPromotion([]ThresholdRule{{Above: 0, Amount: 500}})
+	welcome.Coupon = Coupon{Code: "WELCOME"}
+	offers := []Promotion{summer, welcome}
+
+	if total := basket.CalculatePrice(offers).Total.Amount; total != 3000 {
+		t.Errorf("Wanted total %v without coupons but got %v", 3000, total)
+	}
+
+	_ = basket.AddCoupon("SUMMER")
+	if total := basket.CalculatePrice(offers).Total.Amount; total != 2700 {
+		t.Errorf("Wanted total %v with a coupon but got %v", 2700, total)
+	}
+
+	_ = basket.AddCoupon("WELCOME")
+	if total := basket.CalculatePrice(offers).Total.Amount; total != 2200 {
+		t.Errorf("Wanted total %v with both coupons but got %v", 2200, total)
+	}
+}
+
+func TestBasketIsExpired(t *testing.T) {
+	updatedAt := time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC)
+	basket := RestoreBasket("B1", "", "EUR", []Line{}, nil, "", updatedAt, updatedAt)
+
+	var expiryCases = []struct {
+		name    string
+		now     time.Time
+		ttl     time.Duration
+		expired bool
+	}{
+		{"Within ttl", updatedAt.Add(time.Hour), 2 * time.Hour, false},
+		{"Exactly the ttl", updatedAt.Add(2 * time.Hour), 2 * time.Hour, false},
+		{"Past ttl", updatedAt.Add(2*time.Hour + time.Second), 2 * time.Hour, true},
+		{"Zero ttl", updatedAt.Add(1000 * time.Hour), 0, false},
+	}
+
+	for _, test := range expiryCases {
+		t.Run(test.name, func(t *testing.T) {
+			if expired := basket.IsExpired(test.now, test.ttl); expired != test.expired {
+				t.Errorf("Wanted expired %v, got %v", test.expired, expired)
+			}
+		})
+	}
+}
+
+func TestAddProducts(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+
+	err := basket.AddProduct(Product{Code: "P1", Name: "Product 1", Price: NewMoney(800, "EUR")})
+	if err != nil {
+		t.Error("Unexpected error ", err.Error())
+	}
+
+	err = basket.AddProducts([]Line{NewLine(Product{Code: "P1", Name: "Product 1", Price: NewMoney(800, "EUR")}, 2),
+		NewLine(Product{Code: "P2", Name: "Product 2", Price: NewMoney(300, "EUR")}, 10)})
+	if err != nil {
+		t.Error("Unexpected error ", err.Error())
+	}
+
+	if line, ok := basket.lines["P1"]; !ok || line.amount != 3 {
+		t.Errorf("Got line %v when wanted amount 3", line)
+	}
+	if line, ok := basket.lines["P2"]; !ok || line.amount != 10 {
+		t.Errorf("Got line %v when wanted amount 10", line)
+	}
+}
+
+// Adding several products at once when one of them is invalid
+func TestAddProductsInvalidLine(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+
+	err := basket.AddProducts([]Line{NewLine(Product{Code: "P1", Name: "Product 1", Price: NewMoney(800, "EUR")}, 2),
+		NewLine(Product{Code: "P2", Name: "Product 2", Price: NewMoney(300, "EUR")}, 0)})
+	if _, ok := err.(*errors.ValidationError); !ok {
+		t.Errorf("Expected validation error but got %T", err)
+	}
+
+	if len(basket.lines) > 0 {
+		t.Errorf("There should not be any line")
+	}
+}
+
+// Setting the quantity of a product
+func TestSetProductAmount(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+
+	err := basket.AddProduct(Product{Code: "P1", Name: "Product 1", Price: NewMoney(800, "EUR")})
+	if err != nil {
+		t.Error("Unexpected error ", err.Error())
+	}
+
+	err = basket.SetProductAmount(Product{Code: "P1", Name: "Product 1", Price: NewMoney(800, "EUR")}, 5)
+	if err != nil {
+		t.Error("Unexpected error ", err.Error())
+	}
+	err = basket.SetProductAmount(Product{Code: "P2", Name: "Product 2", Price: NewMoney(300, "EUR")}, 2)
+	if err != nil {
+		t.Error("Unexpected error ", err.Error())
+	}
+
+	if line, ok := basket.lines["P1"]; !ok || line.amount != 5 {
+		t.Errorf("Got line %v when wanted amount 5", line)
+	}
+	if line, ok := basket.lines["P2"]; !ok || line.amount != 2 {
+		t.Errorf("Got line %v when wanted amount 2", line)
+	}
+
+	err = basket.SetProductAmount(Product{Code: "P1", Name: "Product 1", Price: NewMoney(800, "EUR")}, 0)
+	if err != nil {
+		t.Error("Unexpected error ", err.Error())
+	}
+	if _, ok := basket.lines["P1"]; ok {
+		t.Error("Product line should have been removed")
+	}
+}
+
+// Setting an invalid quantity of a product
+func TestSetProductInvalidAmount(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+
+	err := basket.SetProductAmount(Product{Code: "P1", Name: "Product 1", Price: NewMoney(800, "EUR")}, -1)
+	if _, ok := err.(*errors.ValidationError); !ok {
+		t.Errorf("Expected validation error but got %T", err)
+	}
+
+	if len(basket.lines) > 0 {
+		t.Errorf("There should not be any line")
+	}
+}
+
+// Removing products
+func TestRemoveProduct(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+
+	for i := 0; i < 3; i++ {
+		err := basket.AddProduct(Product{Code: "P1", Name: "Product 1", Price: NewMoney(800, "EUR")})
+		if err != nil {
+			t.Error("Unexpected error ", err.Error())
+		}
+	}
+
+	err := basket.RemoveProduct("P2")
+	if _, ok := err.(*errors.ProductNotInBasket); !ok {
+		t.Errorf("Expected product not in basket error but got %T", err)
+	}
+
+	err = basket.RemoveProduct("P1")
+	if err != nil {
+		t.Error("Unexpected error ", err.Error())
+	}
+
+	if len(basket.lines) > 0 {
+		t.Errorf("There should not be any line")
+	}
+}
+
 var basketPriceCases = []struct {
 	lines  map[ProductCode]Line
 	offers []Promotion
-	price  float64
+	total  int
 }{
 	{ // No active offers
-		map[ProductCode]Line{"P1": {Product{"P1", "Prod name 1", 1000}, 3}},
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 3}},
 		[]Promotion{},
-		float64(1000*3) / 100,
+		1000 * 3,
 	}, { // Empty basket
 		map[ProductCode]Line{},
 		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 820}}})},
-		float64(0),
+		0,
 	}, { // Basket without any products in offer
-		map[ProductCode]Line{"P1": {Product{"P1", "Prod name 1", 1000}, 3}},
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 3}},
 		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P2": {{3, 820}}})},
-		float64(1000*3) / 100,
+		1000 * 3,
 	}, { // Basket with all products matching an offer
-		map[ProductCode]Line{"P1": {Product{"P1", "Prod name 1", 1000}, 3}},
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 3}},
 		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 820}}})},
-		float64(820*3) / 100,
+		820 * 3,
 	}, { // Basket with products matching an offer several times
-		map[ProductCode]Line{"P1": {Product{"P1", "Prod name 1", 1000}, 9}},
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 9}},
 		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 820}}})},
-		float64(820*9) / 100,
+		820 * 9,
 	}, { // Basket with products matching an offer several times plus extra number
-		map[ProductCode]Line{"P1": {Product{"P1", "Prod name 1", 1000}, 7}},
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 7}},
 		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 820}}})},
-		float64(820*7) / 100,
+		820 * 7,
 	}, { // Basket with same products matching different offers
-		map[ProductCode]Line{"P1": {Product{"P1", "Prod name 1", 1000}, 5}},
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 5}},
 		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 820}, {2, 930}}})},
-		float64(820*5) / 100,
+		820 * 5,
 	}, { // Basket with different products matching different offers
-		map[ProductCode]Line{"P1": {Product{"P1", "Prod name 1", 1030}, 3},
-			"P2": {Product{"P2", "Prod name 2", 1545}, 3}},
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1030, "EUR")}, 3},
+			"P2": {Product{Code: "P2", Name: "Prod name 2", Price: NewMoney(1545, "EUR")}, 3}},
 		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 900}}}),
 			NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P2": {{3, 1}}})},
-		float64(900*3+1545*2) / 100,
+		900*3 + 1545*2,
 	}, { // Basket with different products matching same offer with rules for that products
-		map[ProductCode]Line{"P1": {Product{"P1", "Prod name 1", 1030}, 3},
-			"P2": {Product{"P2", "Prod name 2", 1545}, 4}},
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1030, "EUR")}, 3},
+			"P2": {Product{Code: "P2", Name: "Prod name 2", Price: NewMoney(1545, "EUR")}, 4}},
 		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 900}}, "P2": {{3, 1210}}})},
-		float64(900*3+1210*4) / 100,
+		900*3 + 1210*4,
 	}, { // Basket with different products matching same offer with rules for that products
-		map[ProductCode]Line{"P1": {Product{"P1", "Prod name 1", 500}, 3},
-			"P2": {Product{"P2", "Prod name 2", 2000}, 3},
-			"P3": {Product{"P3", "Prod name 3", 750}, 1}},
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(500, "EUR")}, 3},
+			"P2": {Product{Code: "P2", Name: "Prod name 2", Price: NewMoney(2000, "EUR")}, 3},
+			"P3": {Product{Code: "P3", Name: "Prod name 3", Price: NewMoney(750, "EUR")}, 1}},
 		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P2": {{3, 1900}}}),
 			NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{2, 1}}})},
-		float64(500*2+1900*3+750) / 100,
+		500*2 + 1900*3 + 750,
+	}, { // Basket with a percentage discount on top of free items
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(500, "EUR")}, 3},
+			"P3": {Product{Code: "P3", Name: "Prod name 3", Price: NewMoney(750, "EUR")}, 2}},
+		[]Promotion{NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{2, 1}}}),
+			NewPercentagePromotion(map[ProductCode][]PercentageOfferRule{"P1": {{1, 20}}, "P3": {{2, 20}}})},
+		500 + 400 + 600*2,
+	}, { // Basket with a bundle of different products and units left for other promotions
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(2000, "EUR")}, 4},
+			"P2": {Product{Code: "P2", Name: "Prod name 2", Price: NewMoney(750, "EUR")}, 1}},
+		[]Promotion{NewBundlePromotion([]Bundle{{Items: map[ProductCode]int{"P1": 1, "P2": 1}, Price: 2500}}),
+			NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 1900}}})},
+		2500 + 1900*3,
 	},
 }
 
@@ -155,10 +471,152 @@ func TestBasketPrices(t *testing.T) {
 		basket := NewBasket(uuid.New().String())
 		basket.lines = tb.lines
 
-		p := basket.CalculatePrice(tb.offers)
-		fmt.Printf(" ------------ Price: %v\n", p)
-		if p != tb.price {
-			t.Errorf("Wanted %v but got %v", tb.price, p)
+		receipt := basket.CalculatePrice(tb.offers)
+		fmt.Printf(" ------------ Price: %v\n", receipt.Total)
+		if receipt.Total.Amount != tb.total {
+			t.Errorf("Wanted %v but got %v", tb.total, receipt.Total)
+		}
+	}
+}
+
+func TestBasketReceipt(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+	basket.lines = map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(500, "EUR")}, 3},
+		"P2": {Product{Code: "P2", Name: "Prod name 2", Price: NewMoney(2000, "EUR")}, 3},
+		"P3": {Product{Code: "P3", Name: "Prod name 3", Price: NewMoney(750, "EUR")}, 1}}
+
+	receipt := basket.CalculatePrice([]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P2": {{3, 1900}}}),
+		NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{2, 1}}})})
+
+	expected := []ReceiptLine{
+		{Product: Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(500, "EUR")}, Quantity: 3, Subtotal: NewMoney(1500, "EUR"),
+			Promotions: []AppliedPromotion{{Type: "FREE_ITEMS", Units: 2, Discount: NewMoney(500, "EUR")}}, Total: NewMoney(1000, "EUR")},
+		{Product: Product{Code: "P2", Name: "Prod name 2", Price: NewMoney(2000, "EUR")}, Quantity: 3, Subtotal: NewMoney(6000, "EUR"),
+			Promotions: []AppliedPromotion{{Type: "BULK", Units: 3, Discount: NewMoney(300, "EUR")}}, Total: NewMoney(5700, "EUR")},
+		{Product: Product{Code: "P3", Name: "Prod name 3", Price: NewMoney(750, "EUR")}, Quantity: 1, Subtotal: NewMoney(750, "EUR"),
+			Promotions: nil, Total: NewMoney(750, "EUR")},
+	}
+
+	if !reflect.DeepEqual(expected, receipt.Lines) {
+		t.Errorf("Wanted lines %v but got %v", expected, receipt.Lines)
+	}
+	if receipt.Total.Amount != 1000+5700+750 {
+		t.Errorf("Wanted total %v but got %v", 1000+5700+750, receipt.Total)
+	}
+}
+
+func TestBasketReceiptWithBasketDiscounts(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+	basket.lines = map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(2000, "EUR")}, 3}}
+
+	threshold := NewThresholdPromotion([]ThresholdRule{{Above: 5000, Amount: 1000}})
+	threshold.Id = "ten-off"
+
+	receipt := basket.CalculatePrice([]Promotion{threshold,
+		NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 1900}}}),
+		NewThresholdPromotion([]ThresholdRule{{Above: 4000, Percentage: 5}})})
+
+	expected := []AppliedDiscount{{Id: "ten-off", Type: "THRESHOLD", Discount: NewMoney(1000, "EUR")}, {Type: "THRESHOLD", Discount: NewMoney(235, "EUR")}}
+	if !reflect.DeepEqual(expected, receipt.Discounts) {
+		t.Errorf("Wanted discounts %v but got %v", expected, receipt.Discounts)
+	}
+	if receipt.Subtotal.Amount != 5700 {
+		t.Errorf("Wanted subtotal %v but got %v", 5700, receipt.Subtotal)
+	}
+	if receipt.Total.Amount != 5700-1000-235 {
+		t.Errorf("Wanted total %v but got %v", 5700-1000-235, receipt.Total)
+	}
+}
+
+// withSettings sets the priority, group and stacking of a promotion
+func withSettings(p Promotion, priority int, group string, stackable bool) Promotion {
+	settings := PromotionSettings{Priority: priority, Group: group, Stackable: stackable}
+
+	switch promotion := p.(type) {
+	case *BulkPromotion:
+		promotion.PromotionSettings = settings
+	case *FreeItemsPromotion:
+		promotion.PromotionSettings = settings
+	case *ThresholdPromotion:
+		promotion.PromotionSettings = settings
+	}
+
+	return p
+}
+
+var promotionSettingsCases = []struct {
+	lines  map[ProductCode]Line
+	offers []Promotion
+	total  int
+}{
+	{ // Free items and bulk stacking on the same product
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 5}},
+		[]Promotion{NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{3, 1}}}),
+			NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{2, 900}}})},
+		1000*2 + 900*2,
+	}, { // Free items and bulk in the same group
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 5}},
+		[]Promotion{withSettings(NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{3, 1}}}), 0, "P1", true),
+			withSettings(NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{2, 900}}}), 0, "P1", true)},
+		1000*2 + 1000*2,
+	}, { // Free items and bulk in the same group for different products
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 3},
+			"P2": {Product{Code: "P2", Name: "Prod name 2", Price: NewMoney(500, "EUR")}, 2}},
+		[]Promotion{withSettings(NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{3, 1}}}), 0, "summer", true),
+			withSettings(NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P2": {{2, 450}}}), 0, "summer", true)},
+		1000*2 + 450*2,
+	}, { // Bulk not stackable after free items
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 5}},
+		[]Promotion{NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{3, 1}}}),
+			withSettings(NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{2, 900}}}), 0, "", false)},
+		1000*2 + 1000*2,
+	}, { // Free items not stackable before bulk
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 5}},
+		[]Promotion{withSettings(NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{3, 1}}}), 0, "", false),
+			NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{2, 900}}})},
+		1000*2 + 1000*2,
+	}, { // Bulk with a higher priority applied first
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 5}},
+		[]Promotion{NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{3, 1}}}),
+			withSettings(NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{2, 900}}}), 1, "", true)},
+		900 * 5,
+	}, { // Basket promotions in the same group, the one with a higher priority applied
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 6}},
+		[]Promotion{withSettings(NewThresholdPromotion([]ThresholdRule{{Above: 5000, Amount: 1000}}), 0, "basket", true),
+			withSettings(NewThresholdPromotion([]ThresholdRule{{Above: 5000, Percentage: 10}}), 1, "basket", true)},
+		6000 - 600,
+	}, { // Basket promotion not stackable after another one
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 6}},
+		[]Promotion{NewThresholdPromotion([]ThresholdRule{{Above: 5000, Amount: 1000}}),
+			withSettings(NewThresholdPromotion([]ThresholdRule{{Above: 4000, Percentage: 10}}), 0, "", false)},
+		6000 - 1000,
+	},
+}
+
+func TestBasketPricesWithPromotionSettings(t *testing.T) {
+	for _, tc := range promotionSettingsCases {
+		basket := NewBasket(uuid.New().String())
+		basket.lines = tc.lines
+
+		if receipt := basket.CalculatePrice(tc.offers); receipt.Total.Amount != tc.total {
+			t.Errorf("Wanted %v but got %v", tc.total, receipt.Total)
 		}
 	}
 }
+
+func TestBestPriceWithPromotionGroups(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+	basket.lines = map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 5}}
+
+	stacking := []Promotion{NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{3, 1}}}),
+		NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{2, 700}}})}
+	exclusive := []Promotion{withSettings(NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{3, 1}}}), 0, "P1", true),
+		withSettings(NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{2, 700}}}), 0, "P1", true)}
+
+	if total := basket.CalculatePriceWithStrategy(stacking, BestForCustomer).Total.Amount; total != 1000*2+700*2 {
+		t.Errorf("Wanted stacking total %v but got %v", 1000*2+700*2, total)
+	}
+	if total := basket.CalculatePriceWithStrategy(exclusive, BestForCustomer).Total.Amount; total != 700*5 {
+		t.Errorf("Wanted exclusive total %v but got %v", 700*5, total)
+	}
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"time"
+)
+
+// Coupon gates a promotion, which only applies to the baskets the coupon code was
+// applied to. The zero value is a promotion applying to every basket
+type Coupon struct {
+	Code string
+	// Number of baskets the coupon can be applied to at the same time, unlimited
+	// when zero
+	MaxUses int
+	// The coupon can not be applied to more baskets from then on, although it keeps
+	// applying to the baskets it was applied to before. Zero never expires
+	ExpiresAt time.Time
+}
+
+func (c Coupon) IsExpired(now time.Time) bool {
+	return !c.ExpiresAt.IsZero() && !now.Before(c.ExpiresAt)
+}
+
+// FindCoupon returns the coupon with the given code. When several promotions share
+// a code, the first one defines its limits
+func FindCoupon(promotions []Promotion, code string) (Coupon, bool) {
+	for _, p := range promotions {
+		if coupon := p.GetSettings().Coupon; coupon.Code != "" && coupon.Code == code {
+			return coupon, true
+		}
+	}
+
+	return Coupon{}, false
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCouponIsExpired(t *testing.T) {
+	now := time.Date(2021, time.November, 26, 10, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		coupon  Coupon
+		expired bool
+	}{
+		{Coupon{Code: "NEVER"}, false},
+		{Coupon{Code: "LATER", ExpiresAt: now.Add(time.Second)}, false},
+		{Coupon{Code: "NOW", ExpiresAt: now}, true},
+	}
+
+	for _, tc := range cases {
+		if expired := tc.coupon.IsExpired(now); expired != tc.expired {
+			t.Errorf("%v: wanted expired %v but got %v", tc.coupon.Code, tc.expired, expired)
+		}
+	}
+}
+
+func TestFindCoupon(t *testing.T) {
+	automatic := NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 900}}})
+	first := NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{2, 1}}})
+	first.Coupon = Coupon{Code: "SUMMER", MaxUses: 10}
+	second := NewPercentagePromotion(map[ProductCode][]PercentageOfferRule{"P1": {{1, 10}}})
+	second.Coupon = Coupon{Code: "SUMMER", MaxUses: 20}
+	promotions := []Promotion{automatic, first, second}
+
+	if coupon, ok := FindCoupon(promotions, "SUMMER"); !ok || coupon.MaxUses != 10 {
+		t.Errorf("Wanted the coupon of the first promotion but got %v", coupon)
+	}
+	if _, ok := FindCoupon(promotions, ""); ok {
+		t.Errorf("Promotions without coupon should not be found by an empty code")
+	}
+	if _, ok := FindCoupon(promotions, "WINTER"); ok {
+		t.Errorf("Unknown coupons should not be found")
+	}
+}
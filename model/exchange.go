@@ -0,0 +1,146 @@
+package model
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// ExchangeRates converts amounts between currencies through a base currency. The
+// zero value only converts amounts to their own currency
+type ExchangeRates struct {
+	Base Currency
+	// Units of every currency a unit of the base currency is worth
+	rates map[Currency]*big.Rat
+}
+
+// NewExchangeRates reads the rates of the currencies against the base as exact
+// decimal strings, such as 1.0825
+func NewExchangeRates(base Currency, rates map[Currency]string) (ExchangeRates, error) {
+	if !base.IsValid() {
+		return ExchangeRates{}, fmt.Errorf("invalid base currency %q", base)
+	}
+
+	exchange := ExchangeRates{Base: base, rates: map[Currency]*big.Rat{base: big.NewRat(1, 1)}}
+	for currency, rate := range rates {
+		if !currency.IsValid() {
+			return ExchangeRates{}, fmt.Errorf("invalid currency %q", currency)
+		}
+
+		value, ok := new(big.Rat).SetString(rate)
+		if !ok || value.Sign() <= 0 {
+			return ExchangeRates{}, fmt.Errorf("invalid %v exchange rate %q", currency, rate)
+		}
+		exchange.rates[currency] = value
+	}
+
+	return exchange, nil
+}
+
+// Supports tells whether amounts can be converted to and from the currency
+func (e ExchangeRates) Supports(currency Currency) bool {
+	_, ok := e.rates[currency]
+	return ok
+}
+
+// Convert returns the amount in the given currency, rounded to the nearest minor
+// unit and half a unit away from zero
+func (e ExchangeRates) Convert(m Money, to Currency) (Money, error) {
+	if m.Currency == to {
+		return m, nil
+	}
+
+	from, ok := e.rates[m.Currency]
+	if !ok {
+		return Money{}, fmt.Errorf("no exchange rate for %v", m.Currency)
+	}
+	rate, ok := e.rates[to]
+	if !ok {
+		return Money{}, fmt.Errorf("no exchange rate for %v", to)
+	}
+
+	value := new(big.Rat).SetInt64(int64(m.Amount))
+	value.Mul(value, rate)
+	value.Quo(value, from)
+	value.Mul(value, new(big.Rat).SetFrac(pow10(to.Digits()), pow10(m.Currency.Digits())))
+
+	return NewMoney(roundHalfAway(value), to), nil
+}
+
+// ConvertReceipt returns the receipt with its amounts in the given currency. Unit
+// prices, promotion discounts and basket discounts are converted one by one, and the
+// rest of the amounts added up again from them, so the receipt stays consistent
+func (e ExchangeRates) ConvertReceipt(r Receipt, to Currency) (Receipt, error) {
+	if r.Total.Currency == to {
+		return r, nil
+	}
+
+	converted := Receipt{
+		Lines:     make([]ReceiptLine, 0, len(r.Lines)),
+		Subtotal:  NewMoney(0, to),
+		Discounts: make([]AppliedDiscount, 0, len(r.Discounts)),
+	}
+
+	for _, line := range r.Lines {
+		price, err := e.Convert(line.Price, to)
+		if err != nil {
+			return Receipt{}, err
+		}
+
+		convertedLine := line
+		convertedLine.Price = price
+		convertedLine.Subtotal = NewMoney(price.Amount*line.Quantity, to)
+		convertedLine.Promotions = make([]AppliedPromotion, 0, len(line.Promotions))
+		convertedLine.Total = convertedLine.Subtotal
+
+		for _, applied := range line.Promotions {
+			if applied.Discount, err = e.Convert(applied.Discount, to); err != nil {
+				return Receipt{}, err
+			}
+
+			convertedLine.Promotions = append(convertedLine.Promotions, applied)
+			convertedLine.Total.Amount -= applied.Discount.Amount
+		}
+		if line.Promotions == nil {
+			convertedLine.Promotions = nil
+		}
+
+		converted.Lines = append(converted.Lines, convertedLine)
+		converted.Subtotal.Amount += convertedLine.Total.Amount
+	}
+
+	converted.Total = converted.Subtotal
+	for _, applied := range r.Discounts {
+		discount, err := e.Convert(applied.Discount, to)
+		if err != nil {
+			return Receipt{}, err
+		}
+
+		applied.Discount = discount
+		converted.Discounts = append(converted.Discounts, applied)
+		converted.Total.Amount -= discount.Amount
+	}
+	if r.Discounts == nil {
+		converted.Discounts = nil
+	}
+
+	return converted, nil
+}
+
+func pow10(exponent int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)
+}
+
+func roundHalfAway(value *big.Rat) int {
+	num := new(big.Int).Abs(value.Num())
+	den := value.Denom()
+
+	// (2 * num + den) / (2 * den) rounds half up the absolute value
+	num.Mul(num, big.NewInt(2)).Add(num, den)
+	num.Quo(num, new(big.Int).Mul(den, big.NewInt(2)))
+
+	if value.Sign() < 0 {
+		return -int(num.Int64())
+	}
+
+	return int(num.Int64())
+}
@@ -0,0 +1,117 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"reflect"
+	"testing"
+)
+
+func TestConvertMoney(t *testing.T) {
+	rates, err := NewExchangeRates("EUR", map[Currency]string{"USD": "1.0825", "JPY": "161.5", "GBP": "0.85"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	cases := []struct {
+		money     Money
+		to        Currency
+		converted Money
+		valid     bool
+	}{
+		{NewMoney(1000, "EUR"), "EUR", NewMoney(1000, "EUR"), true},
+		{NewMoney(1000, "EUR"), "USD", NewMoney(1083, "USD"), true}, // 10.825 rounded half up
+		{NewMoney(-1000, "EUR"), "USD", NewMoney(-1083, "USD"), true},
+		{NewMoney(1000, "EUR"), "JPY", NewMoney(1615, "JPY"), true},
+		{NewMoney(1083, "USD"), "EUR", NewMoney(1000, "EUR"), true},
+		{NewMoney(850, "GBP"), "USD", NewMoney(1083, "USD"), true}, // Through the base currency
+		{NewMoney(1000, "EUR"), "CHF", Money{}, false},
+		{NewMoney(1000, "CHF"), "EUR", Money{}, false},
+	}
+
+	for _, tc := range cases {
+		converted, err := rates.Convert(tc.money, tc.to)
+
+		if (err == nil) != tc.valid {
+			t.Errorf("%v to %v: wanted valid %v but got error %v", tc.money, tc.to, tc.valid, err)
+			continue
+		}
+		if tc.valid && converted != tc.converted {
+			t.Errorf("%v to %v: wanted %v but got %v", tc.money, tc.to, tc.converted, converted)
+		}
+	}
+}
+
+func TestNewExchangeRates(t *testing.T) {
+	cases := []struct {
+		base  Currency
+		rates map[Currency]string
+		valid bool
+	}{
+		{"EUR", map[Currency]string{"USD": "1.08"}, true},
+		{"EUR", nil, true},
+		{"euro", nil, false},
+		{"EUR", map[Currency]string{"usd": "1.08"}, false},
+		{"EUR", map[Currency]string{"USD": "0"}, false},
+		{"EUR", map[Currency]string{"USD": "one"}, false},
+	}
+
+	for _, tc := range cases {
+		if _, err := NewExchangeRates(tc.base, tc.rates); (err == nil) != tc.valid {
+			t.Errorf("%v %v: wanted valid %v but got error %v", tc.base, tc.rates, tc.valid, err)
+		}
+	}
+}
+
+func TestConvertReceipt(t *testing.T) {
+	rates, _ := NewExchangeRates("EUR", map[Currency]string{"USD": "1.0825"})
+
+	basket := NewBasketInCurrency(uuid.New().String(), "USD")
+	basket.lines = map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(500, "EUR")}, 3},
+		"P2": {Product{Code: "P2", Name: "Prod name 2", Price: NewMoney(2000, "EUR")}, 3}}
+
+	receipt := basket.CalculatePrice([]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P2": {{3, 1900}}}),
+		NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{2, 1}}}),
+		NewThresholdPromotion([]ThresholdRule{{Above: 5000, Amount: 1000}})})
+
+	converted, err := rates.ConvertReceipt(receipt, basket.Currency())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	expected := Receipt{
+		Lines: []ReceiptLine{
+			{Product: Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(541, "USD")}, Quantity: 3, Subtotal: NewMoney(1623, "USD"),
+				Promotions: []AppliedPromotion{{Type: "FREE_ITEMS", Units: 2, Discount: NewMoney(541, "USD")}}, Total: NewMoney(1082, "USD")},
+			{Product: Product{Code: "P2", Name: "Prod name 2", Price: NewMoney(2165, "USD")}, Quantity: 3, Subtotal: NewMoney(6495, "USD"),
+				Promotions: []AppliedPromotion{{Type: "BULK", Units: 3, Discount: NewMoney(325, "USD")}}, Total: NewMoney(6170, "USD")},
+		},
+		Subtotal:  NewMoney(7252, "USD"),
+		Discounts: []AppliedDiscount{{Type: "THRESHOLD", Discount: NewMoney(1083, "USD")}},
+		Total:     NewMoney(6169, "USD"),
+	}
+
+	if !reflect.DeepEqual(expected, converted) {
+		t.Errorf("Wanted receipt %v but got %v", expected, converted)
+	}
+}
+
+func TestBasketLinesInSameCurrency(t *testing.T) {
+	basket := NewBasketInCurrency(uuid.New().String(), "USD")
+
+	if err := basket.AddProduct(Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(500, "EUR")}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := basket.AddProduct(Product{Code: "P2", Name: "Prod name 2", Price: NewMoney(500, "GBP")}); err == nil {
+		t.Errorf("Products priced in different currencies should not be mixed")
+	}
+	if err := basket.AddProducts([]Line{NewLine(Product{Code: "P2", Name: "Prod name 2", Price: NewMoney(500, "GBP")}, 1)}); err == nil {
+		t.Errorf("Products priced in different currencies should not be mixed")
+	}
+	if err := basket.SetProductAmount(Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(500, "GBP")}, 2); err != nil {
+		t.Errorf("The only line of the basket should be replaced, but got %v", err)
+	}
+
+	if receipt := basket.CalculatePrice(nil); receipt.Total != NewMoney(1000, "GBP") {
+		t.Errorf("Wanted total %v but got %v", NewMoney(1000, "GBP"), receipt.Total)
+	}
+}
@@ -0,0 +1,154 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Currency is an ISO 4217 currency code
+type Currency string
+
+// DefaultCurrency is the currency of the baskets created without one, and of the
+// prices written as bare amounts of minor units
+const DefaultCurrency Currency = "EUR"
+
+// minorUnits holds the number of decimals of the currencies not using two
+var minorUnits = map[Currency]int{
+	"BHD": 3, "CLP": 0, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0, "KWD": 3, "OMR": 3, "TND": 3, "VND": 0,
+}
+
+// IsValid tells whether the code is made of three upper case letters
+func (c Currency) IsValid() bool {
+	if len(c) != 3 {
+		return false
+	}
+
+	for _, r := range c {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Digits returns the number of decimals of the currency, that is the number of
+// minor units in a unit as a power of ten
+func (c Currency) Digits() int {
+	if digits, ok := minorUnits[c]; ok {
+		return digits
+	}
+
+	return 2
+}
+
+// Money is an amount of minor units of a currency, cents for euros
+type Money struct {
+	Amount   int
+	Currency Currency
+}
+
+func NewMoney(amount int, currency Currency) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ParseMoney reads an exact decimal amount of the currency, such as 12.5 or -0.05.
+// Amounts with more decimals than the currency has are rejected
+func ParseMoney(amount string, currency Currency) (Money, error) {
+	if !currency.IsValid() {
+		return Money{}, fmt.Errorf("invalid currency %q", currency)
+	}
+
+	digits := currency.Digits()
+	units, decimals := amount, ""
+	if point := strings.IndexByte(amount, '.'); point >= 0 {
+		units, decimals = amount[:point], amount[point+1:]
+		if len(decimals) == 0 || len(decimals) > digits || strings.TrimLeft(decimals, "0123456789") != "" {
+			return Money{}, fmt.Errorf("invalid %v amount %q", currency, amount)
+		}
+	}
+
+	negative := strings.HasPrefix(units, "-")
+	value, err := strconv.ParseUint(strings.TrimPrefix(units, "-"), 10, 63)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid %v amount %q", currency, amount)
+	}
+
+	minor := int(value)
+	for i := 0; i < digits; i++ {
+		minor *= 10
+		if i < len(decimals) {
+			minor += int(decimals[i] - '0')
+		}
+	}
+	if negative {
+		minor = -minor
+	}
+
+	return NewMoney(minor, currency), nil
+}
+
+// Decimal returns the exact amount in units of the currency, such as 12.50
+func (m Money) Decimal() string {
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+
+	digits := m.Currency.Digits()
+	if digits == 0 {
+		return sign + strconv.Itoa(amount)
+	}
+
+	minor := strconv.Itoa(amount)
+	if len(minor) <= digits {
+		minor = strings.Repeat("0", digits-len(minor)+1) + minor
+	}
+
+	return sign + minor[:len(minor)-digits] + "." + minor[len(minor)-digits:]
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + string(m.Currency)
+}
+
+type moneyJSON struct {
+	Amount   string   `json:"amount"`
+	Currency Currency `json:"currency"`
+}
+
+// MarshalJSON writes the amount as an exact decimal string along with its currency
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{Amount: m.Decimal(), Currency: m.Currency})
+}
+
+// UnmarshalJSON reads an amount written as an exact decimal string along with its
+// currency. A bare number is read as minor units of the default currency, the way
+// prices were written before they had a currency. The zero value is read back as is
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var minor int
+	if err := json.Unmarshal(data, &minor); err == nil {
+		*m = NewMoney(minor, DefaultCurrency)
+		return nil
+	}
+
+	var decoded moneyJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if decoded == (moneyJSON{Amount: Money{}.Decimal()}) {
+		*m = Money{}
+		return nil
+	}
+
+	parsed, err := ParseMoney(decoded.Amount, decoded.Currency)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
@@ -0,0 +1,81 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var moneyCases = []struct {
+	amount   string
+	currency Currency
+	money    Money
+	decimal  string
+	valid    bool
+}{
+	{"12.50", "EUR", NewMoney(1250, "EUR"), "12.50", true},
+	{"12.5", "EUR", NewMoney(1250, "EUR"), "12.50", true},
+	{"12", "EUR", NewMoney(1200, "EUR"), "12.00", true},
+	{"0.05", "EUR", NewMoney(5, "EUR"), "0.05", true},
+	{"-0.05", "EUR", NewMoney(-5, "EUR"), "-0.05", true},
+	{"1250", "JPY", NewMoney(1250, "JPY"), "1250", true},
+	{"1.250", "KWD", NewMoney(1250, "KWD"), "1.250", true},
+	{"12.505", "EUR", Money{}, "", false}, // More decimals than the currency has
+	{"12.", "EUR", Money{}, "", false},
+	{".5", "EUR", Money{}, "", false},
+	{"12,50", "EUR", Money{}, "", false},
+	{"1e3", "EUR", Money{}, "", false},
+	{"12.5", "eur", Money{}, "", false}, // Invalid currency
+}
+
+func TestParseMoney(t *testing.T) {
+	for _, tc := range moneyCases {
+		money, err := ParseMoney(tc.amount, tc.currency)
+
+		if (err == nil) != tc.valid {
+			t.Errorf("%q: wanted valid %v but got error %v", tc.amount, tc.valid, err)
+			continue
+		}
+		if !tc.valid {
+			continue
+		}
+		if money != tc.money {
+			t.Errorf("%q: wanted %v but got %v", tc.amount, tc.money, money)
+		}
+		if decimal := money.Decimal(); decimal != tc.decimal {
+			t.Errorf("%q: wanted decimal %v but got %v", tc.amount, tc.decimal, decimal)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	cases := []struct {
+		json  string
+		money Money
+		valid bool
+	}{
+		{`{"amount":"19.99","currency":"USD"}`, NewMoney(1999, "USD"), true},
+		{`500`, NewMoney(500, DefaultCurrency), true}, // Minor units written before prices had a currency
+		{`{"amount":"19.999","currency":"USD"}`, Money{}, false},
+		{`{"amount":"19.99"}`, Money{}, false},
+		{`{"amount":"0.00","currency":""}`, Money{}, true}, // The zero value, as it is encoded
+		{`"19.99"`, Money{}, false},
+	}
+
+	for _, tc := range cases {
+		var money Money
+		err := json.Unmarshal([]byte(tc.json), &money)
+
+		if (err == nil) != tc.valid {
+			t.Errorf("%v: wanted valid %v but got error %v", tc.json, tc.valid, err)
+			continue
+		}
+		if tc.valid && money != tc.money {
+			t.Errorf("%v: wanted %v but got %v", tc.json, tc.money, money)
+		}
+	}
+
+	encoded, err := json.Marshal(NewMoney(-1005, "GBP"))
+	if err != nil || string(encoded) != `{"amount":"-10.05","currency":"GBP"}` {
+		t.Errorf("Unexpected encoding %s, %v", encoded, err)
+	}
+}
@@ -0,0 +1,99 @@
+package model
+
+import (
+	"github.com/alfcope/checkouttest/errors"
+	"time"
+)
+
+// OrderState tells where an order is in its payment: orders are placed pending,
+// become paid once their payment is captured and refunded once it is given back.
+// Orders are refunding while the payment provider gives it back, and paid again if
+// it fails. Orders whose payment can not be captured are cancelled
+type OrderState string
+
+const (
+	OrderPending   OrderState = "pending"
+	OrderPaid      OrderState = "paid"
+	OrderRefunding OrderState = "refunding"
+	OrderRefunded  OrderState = "refunded"
+	OrderCancelled OrderState = "cancelled"
+)
+
+// Order is a checked out basket. It keeps the prices and promotions the basket had
+// when it was checked out, so later changes of the catalogue do not alter it
+type Order struct {
+	Id       string
+	BasketId string
+	// Customer who owned the basket, empty if it was anonymous
+	Customer string
+	Coupons  []string
+	Receipt  Receipt
+	State    OrderState
+	// Payment is the id the payment provider gave to the authorization of the payment
+	Payment string
+	// Orders are listed by creation time, the most recent first
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// NewOrder creates a pending order for the receipt, paid with the given authorization
+func NewOrder(id string, basketId string, customer string, coupons []string, receipt Receipt, payment string, createdAt time.Time) Order {
+	return Order{
+		Id:        id,
+		BasketId:  basketId,
+		Customer:  customer,
+		Coupons:   append([]string(nil), coupons...),
+		Receipt:   receipt,
+		State:     OrderPending,
+		Payment:   payment,
+		CreatedAt: createdAt.UTC(),
+		UpdatedAt: createdAt.UTC(),
+	}
+}
+
+// Currency returns the currency the order was priced in
+func (o Order) Currency() Currency {
+	return o.Receipt.Total.Currency
+}
+
+// CanAccess tells if the customer can read the order. Orders of anonymous baskets
+// can be read by anyone
+func (o Order) CanAccess(customer string) bool {
+	return o.Customer == "" || o.Customer == customer
+}
+
+// Pay marks a pending order as paid
+func (o *Order) Pay(now time.Time) error {
+	return o.transition(OrderPending, OrderPaid, "paid", now)
+}
+
+// StartRefund marks a paid order as refunding, so it is not refunded twice
+func (o *Order) StartRefund(now time.Time) error {
+	return o.transition(OrderPaid, OrderRefunding, "refunded", now)
+}
+
+// Refund marks a refunding order as refunded
+func (o *Order) Refund(now time.Time) error {
+	return o.transition(OrderRefunding, OrderRefunded, "refunded", now)
+}
+
+// CancelRefund marks a refunding order as paid again
+func (o *Order) CancelRefund(now time.Time) error {
+	return o.transition(OrderRefunding, OrderPaid, "paid", now)
+}
+
+// Cancel marks a pending order as cancelled
+func (o *Order) Cancel(now time.Time) error {
+	return o.transition(OrderPending, OrderCancelled, "cancelled", now)
+}
+
+func (o *Order) transition(from, to OrderState, action string, now time.Time) error {
+	if o.State != from {
+		return errors.NewOrderStateInvalid(o.Id, string(o.State), action)
+	}
+
+	o.State = to
+	o.UpdatedAt = now.UTC()
+
+	return nil
+}
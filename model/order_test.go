@@ -0,0 +1,76 @@
+package model
+
+import (
+	"github.com/alfcope/checkouttest/errors"
+	"testing"
+	"time"
+)
+
+func TestOrderStates(t *testing.T) {
+	createdAt := time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC)
+	paidAt := createdAt.Add(time.Minute)
+	order := NewOrder("O1", "B1", "", nil, Receipt{}, "A1", createdAt)
+
+	if order.State != OrderPending {
+		t.Errorf("Wanted a new order %v but got %v", OrderPending, order.State)
+	}
+	if _, ok := order.StartRefund(paidAt).(*errors.OrderStateInvalid); !ok {
+		t.Errorf("A pending order should not be refunded")
+	}
+	if err := order.Pay(paidAt); err != nil || order.State != OrderPaid || !order.UpdatedAt.Equal(paidAt) {
+		t.Errorf("Unexpected paid order %+v, %v", order, err)
+	}
+	if _, ok := order.Pay(paidAt).(*errors.OrderStateInvalid); !ok {
+		t.Errorf("An order should not be paid twice")
+	}
+	if _, ok := order.Refund(paidAt).(*errors.OrderStateInvalid); !ok {
+		t.Errorf("An order should be refunding before it is refunded")
+	}
+	if err := order.StartRefund(paidAt); err != nil || order.State != OrderRefunding {
+		t.Errorf("Unexpected refunding order %+v, %v", order, err)
+	}
+	if _, ok := order.StartRefund(paidAt).(*errors.OrderStateInvalid); !ok {
+		t.Errorf("An order should not be refunding twice")
+	}
+	if err := order.CancelRefund(paidAt); err != nil || order.State != OrderPaid {
+		t.Errorf("Unexpected order paid again %+v, %v", order, err)
+	}
+	_ = order.StartRefund(paidAt)
+	if err := order.Refund(paidAt); err != nil || order.State != OrderRefunded {
+		t.Errorf("Unexpected refunded order %+v, %v", order, err)
+	}
+	if _, ok := order.StartRefund(paidAt).(*errors.OrderStateInvalid); !ok {
+		t.Errorf("An order should not be refunded twice")
+	}
+	if _, ok := order.Cancel(paidAt).(*errors.OrderStateInvalid); !ok {
+		t.Errorf("An order paid should not be cancelled")
+	}
+
+	cancelled := NewOrder("O2", "B2", "", nil, Receipt{}, "A2", createdAt)
+	if err := cancelled.Cancel(paidAt); err != nil || cancelled.State != OrderCancelled {
+		t.Errorf("Unexpected cancelled order %+v, %v", cancelled, err)
+	}
+	if _, ok := cancelled.Pay(paidAt).(*errors.OrderStateInvalid); !ok {
+		t.Errorf("A cancelled order should not be paid")
+	}
+}
+
+func TestOrderCanAccess(t *testing.T) {
+	cases := []struct {
+		owner    string
+		customer string
+		access   bool
+	}{
+		{"C1", "C1", true},
+		{"C1", "C2", false},
+		{"C1", "", false},
+		{"", "C2", true},
+	}
+
+	for _, tc := range cases {
+		order := NewOrder("O1", "B1", tc.owner, nil, Receipt{}, "A1", time.Now())
+		if access := order.CanAccess(tc.customer); access != tc.access {
+			t.Errorf("Order of %q read by %q: wanted access %v but got %v", tc.owner, tc.customer, tc.access, access)
+		}
+	}
+}
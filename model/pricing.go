@@ -0,0 +1,448 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PricingStrategy decides how competing line promotions are applied to a basket
+type PricingStrategy string
+
+const (
+	// PriorityOrdered applies the promotions by priority, and their rules in the order
+	// they are defined. Every one claims the units it applies to before the next ones
+	PriorityOrdered PricingStrategy = "priority"
+	// BestForCustomer applies the combination of promotion rules giving the lowest
+	// price. Ties are broken in favour of the combination closer to the priority order
+	BestForCustomer PricingStrategy = "best"
+)
+
+// maxCompetingOffers bounds the number of rules compared together when looking for
+// the best price, as many orders of them may be evaluated. Larger groups of rules
+// competing for the same products are applied in priority order
+const maxCompetingOffers = 8
+
+// ParsePricingStrategy returns the strategy with the given name, priority ordered
+// when empty
+func ParsePricingStrategy(name string) (PricingStrategy, error) {
+	switch PricingStrategy(name) {
+	case "", PriorityOrdered:
+		return PriorityOrdered, nil
+	case BestForCustomer:
+		return BestForCustomer, nil
+	default:
+		return "", fmt.Errorf("unknown pricing strategy %q", name)
+	}
+}
+
+// offer is a promotion, or a single rule of it, applied to the basket lines. Source
+// is the position of the promotion it comes from
+type offer struct {
+	Promotion
+	source int
+}
+
+// splittablePromotion is implemented by promotions made of independent rules, which
+// compete with the rules of other promotions for the same units
+type splittablePromotion interface {
+	// splitRules returns a promotion for every rule, keeping the promotion settings
+	splitRules() []Promotion
+}
+
+// prioritizedOffers returns the promotions by priority, keeping the order they are
+// defined in when the priority is the same
+func prioritizedOffers(promotions []Promotion) []offer {
+	offers := make([]offer, 0, len(promotions))
+	for i, p := range promotions {
+		offers = append(offers, offer{Promotion: p, source: i})
+	}
+
+	sort.SliceStable(offers, func(i, j int) bool {
+		return offers[i].GetSettings().Priority > offers[j].GetSettings().Priority
+	})
+
+	return offers
+}
+
+// orderedOffers returns the line promotions by priority
+func orderedOffers(promotions []Promotion) []offer {
+	offers := make([]offer, 0, len(promotions))
+	for _, o := range prioritizedOffers(promotions) {
+		if _, ok := o.Promotion.(BasketPromotion); ok {
+			continue
+		}
+
+		offers = append(offers, o)
+	}
+
+	return offers
+}
+
+// offerResolver claims units of the lines for the offers, honouring the groups and
+// stacking of the promotions they come from
+type offerResolver struct {
+	lines      map[ProductCode]Line
+	promotions []Promotion
+	inOffer    map[ProductCode]*[]int
+	// Positions of the promotions applied to every product
+	applied map[ProductCode][]int
+}
+
+func newOfferResolver(lines map[ProductCode]Line, promotions []Promotion) *offerResolver {
+	return &offerResolver{
+		lines:      lines,
+		promotions: promotions,
+		inOffer:    make(map[ProductCode]*[]int),
+		applied:    make(map[ProductCode][]int),
+	}
+}
+
+// resolve applies the offer to the lines without incompatible promotions applied,
+// returning the products it claimed units of
+func (r *offerResolver) resolve(o offer) []ProductCode {
+	lines := r.lines
+	settings := o.GetSettings()
+
+	for pCode, sources := range r.applied {
+		for _, source := range sources {
+			if source == o.source || settings.compatibleWith(r.promotions[source].GetSettings()) {
+				continue
+			}
+
+			if len(lines) == len(r.lines) {
+				lines = make(map[ProductCode]Line, len(r.lines))
+				for code, line := range r.lines {
+					lines[code] = line
+				}
+			}
+			delete(lines, pCode)
+			break
+		}
+	}
+
+	claimed := claimedProducts(lines, r.inOffer, o.Promotion)
+	for _, pCode := range claimed {
+		if !containsSource(r.applied[pCode], o.source) {
+			r.applied[pCode] = append(r.applied[pCode], o.source)
+		}
+	}
+
+	return claimed
+}
+
+func (r *offerResolver) copy() *offerResolver {
+	copied := newOfferResolver(r.lines, r.promotions)
+	for pCode, prices := range r.inOffer {
+		pricesCopy := append([]int(nil), *prices...)
+		copied.inOffer[pCode] = &pricesCopy
+	}
+	for pCode, sources := range r.applied {
+		copied.applied[pCode] = append([]int(nil), sources...)
+	}
+
+	return copied
+}
+
+func containsSource(sources []int, source int) bool {
+	for _, s := range sources {
+		if s == source {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bestOffers returns the sequence of promotion rules giving the lowest price for the
+// lines. Rules not sharing any product do not compete, so they are searched apart
+func bestOffers(lines map[ProductCode]Line, promotions []Promotion) []offer {
+	candidates := make([]offer, 0, len(promotions))
+	products := make([][]ProductCode, 0, len(promotions))
+
+	for _, o := range orderedOffers(promotions) {
+		rules := []Promotion{o.Promotion}
+		if splittable, ok := o.Promotion.(splittablePromotion); ok {
+			rules = splittable.splitRules()
+		}
+
+		for _, rule := range rules {
+			// Rules not applying to the lines on their own never apply after others
+			claimed := newOfferResolver(lines, promotions).resolve(offer{Promotion: rule, source: o.source})
+			if len(claimed) == 0 {
+				continue
+			}
+
+			candidates = append(candidates, offer{Promotion: rule, source: o.source})
+			products = append(products, claimed)
+		}
+	}
+
+	best := make([]offer, 0, len(candidates))
+	for _, group := range competingGroups(products) {
+		groupOffers := make([]offer, 0, len(group))
+		for _, i := range group {
+			groupOffers = append(groupOffers, candidates[i])
+		}
+
+		if len(groupOffers) > maxCompetingOffers {
+			best = append(best, groupOffers...)
+			continue
+		}
+
+		search := newPricingSearch(lines, groupOffers)
+		search.run(make([]int, 0, len(groupOffers)), make([]bool, len(groupOffers)), newOfferResolver(lines, promotions))
+
+		for _, i := range search.bestPath {
+			best = append(best, groupOffers[i])
+		}
+	}
+
+	return best
+}
+
+// competingGroups groups the rules sharing products, directly or through other
+// rules. Groups, and the rules in them, keep the priority order
+func competingGroups(products [][]ProductCode) [][]int {
+	parent := make([]int, len(products))
+	for i := range parent {
+		parent[i] = i
+	}
+
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	owner := make(map[ProductCode]int)
+	for i, codes := range products {
+		for _, pCode := range codes {
+			if j, ok := owner[pCode]; ok {
+				ri, rj := find(i), find(j)
+				if ri < rj {
+					parent[rj] = ri
+				} else {
+					parent[ri] = rj
+				}
+				continue
+			}
+			owner[pCode] = i
+		}
+	}
+
+	groups := make([][]int, 0)
+	position := make(map[int]int)
+	for i := range products {
+		root := find(i)
+		if _, ok := position[root]; !ok {
+			position[root] = len(groups)
+			groups = append(groups, nil)
+		}
+		groups[position[root]] = append(groups[position[root]], i)
+	}
+
+	return groups
+}
+
+// pricingSearch evaluates the sequences of rules applying to the lines, keeping the
+// first one found with the lowest price. Sequences are explored in priority order.
+// Sequences leading to a state explored before at no higher price are not followed,
+// as the rules left can not lower it any further than they did then
+type pricingSearch struct {
+	lines  map[ProductCode]Line
+	codes  []ProductCode
+	offers []offer
+
+	// Lowest price every state was explored at
+	explored  map[string]int
+	bestPrice int
+	bestPath  []int
+}
+
+func newPricingSearch(lines map[ProductCode]Line, offers []offer) *pricingSearch {
+	codes := make([]ProductCode, 0, len(lines))
+	for pCode := range lines {
+		codes = append(codes, pCode)
+	}
+	sortProductCodes(codes)
+
+	return &pricingSearch{
+		lines:     lines,
+		codes:     codes,
+		offers:    offers,
+		explored:  make(map[string]int),
+		bestPrice: linesPrice(lines, map[ProductCode]*[]int{}),
+	}
+}
+
+func (s *pricingSearch) run(path []int, used []bool, resolver *offerResolver) {
+	price := linesPrice(s.lines, resolver.inOffer)
+
+	state := s.state(used, resolver)
+	if explored, ok := s.explored[state]; ok && explored <= price {
+		return
+	}
+	s.explored[state] = price
+
+	if price < s.bestPrice {
+		s.bestPrice = price
+		s.bestPath = append([]int(nil), path...)
+	}
+
+	for i, o := range s.offers {
+		if used[i] {
+			continue
+		}
+
+		next := resolver.copy()
+		if len(next.resolve(o)) == 0 {
+			continue
+		}
+
+		used[i] = true
+		s.run(append(path, i), used, next)
+		used[i] = false
+	}
+}
+
+// state identifies what the rules left can do: which ones are left, and the units of
+// every product claimed and the promotions they were claimed by
+func (s *pricingSearch) state(used []bool, resolver *offerResolver) string {
+	var state strings.Builder
+	for _, u := range used {
+		if u {
+			state.WriteByte('1')
+		} else {
+			state.WriteByte('0')
+		}
+	}
+
+	for _, pCode := range s.codes {
+		prices, ok := resolver.inOffer[pCode]
+		if !ok {
+			continue
+		}
+
+		sources := append([]int(nil), resolver.applied[pCode]...)
+		sort.Ints(sources)
+
+		state.WriteString(" " + string(pCode) + ":" + strconv.Itoa(len(*prices)))
+		for _, source := range sources {
+			state.WriteString("," + strconv.Itoa(source))
+		}
+	}
+
+	return state.String()
+}
+
+// claimedProducts resolves the promotion, returning the products it claimed units of
+func claimedProducts(lines map[ProductCode]Line, inOffer map[ProductCode]*[]int, p Promotion) []ProductCode {
+	claimed := make(map[ProductCode]int, len(inOffer))
+	for pCode, prices := range inOffer {
+		claimed[pCode] = len(*prices)
+	}
+
+	p.Resolve(lines, inOffer)
+
+	products := make([]ProductCode, 0)
+	for pCode, prices := range inOffer {
+		if len(*prices) > claimed[pCode] {
+			products = append(products, pCode)
+		}
+	}
+	sortProductCodes(products)
+
+	return products
+}
+
+// linesPrice returns the price of the lines, the units claimed by promotions at
+// their offer price and the rest at their regular price
+func linesPrice(lines map[ProductCode]Line, inOffer map[ProductCode]*[]int) int {
+	total := 0
+	for pCode, line := range lines {
+		units := line.amount
+		if prices, ok := inOffer[pCode]; ok {
+			for _, price := range *prices {
+				total += price
+			}
+			units -= len(*prices)
+		}
+
+		total += units * line.Price.Amount
+	}
+
+	return total
+}
+
+func sortProductCodes(codes []ProductCode) {
+	sort.Slice(codes, func(i, j int) bool {
+		return codes[i] < codes[j]
+	})
+}
+
+func (b BulkPromotion) splitRules() []Promotion {
+	rules := make([]Promotion, 0, len(b.offers))
+	codes := make([]ProductCode, 0, len(b.offers))
+	for pCode := range b.offers {
+		codes = append(codes, pCode)
+	}
+	sortProductCodes(codes)
+
+	for _, pCode := range codes {
+		for _, rule := range b.offers[pCode] {
+			rules = append(rules, &BulkPromotion{PromotionSettings: b.PromotionSettings,
+				offers: map[ProductCode][]BulkOfferRule{pCode: {rule}}})
+		}
+	}
+
+	return rules
+}
+
+func (f FreeItemsPromotion) splitRules() []Promotion {
+	rules := make([]Promotion, 0, len(f.offers))
+	codes := make([]ProductCode, 0, len(f.offers))
+	for pCode := range f.offers {
+		codes = append(codes, pCode)
+	}
+	sortProductCodes(codes)
+
+	for _, pCode := range codes {
+		for _, rule := range f.offers[pCode] {
+			rules = append(rules, &FreeItemsPromotion{PromotionSettings: f.PromotionSettings,
+				offers: map[ProductCode][]FreeItemsOfferRule{pCode: {rule}}})
+		}
+	}
+
+	return rules
+}
+
+func (p PercentagePromotion) splitRules() []Promotion {
+	rules := make([]Promotion, 0, len(p.offers))
+	codes := make([]ProductCode, 0, len(p.offers))
+	for pCode := range p.offers {
+		codes = append(codes, pCode)
+	}
+	sortProductCodes(codes)
+
+	for _, pCode := range codes {
+		for _, rule := range p.offers[pCode] {
+			rules = append(rules, &PercentagePromotion{PromotionSettings: p.PromotionSettings,
+				offers: map[ProductCode][]PercentageOfferRule{pCode: {rule}}})
+		}
+	}
+
+	return rules
+}
+
+func (b BundlePromotion) splitRules() []Promotion {
+	rules := make([]Promotion, 0, len(b.bundles))
+	for _, bundle := range b.bundles {
+		rules = append(rules, &BundlePromotion{PromotionSettings: b.PromotionSettings, bundles: []Bundle{bundle}})
+	}
+
+	return rules
+}
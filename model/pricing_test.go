@@ -0,0 +1,164 @@
+package model
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"reflect"
+	"testing"
+)
+
+var pricingStrategyCases = []struct {
+	lines         map[ProductCode]Line
+	offers        []Promotion
+	priorityTotal int // Total applying the promotions in order
+	bestTotal     int // Total applying the best combination for the customer
+}{
+	{ // Empty basket
+		map[ProductCode]Line{},
+		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 820}}})},
+		0,
+		0,
+	}, { // Competing rules of the same promotion
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 5}},
+		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{2, 930}, {3, 820}}})},
+		930 * 5,
+		820 * 5,
+	}, { // Competing promotions, the best one first
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 4}},
+		[]Promotion{NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{2, 1}}}),
+			NewPercentagePromotion(map[ProductCode][]PercentageOfferRule{"P1": {{1, 30}}})},
+		1000 * 2,
+		1000 * 2,
+	}, { // Competing promotions, the best one last
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 4}},
+		[]Promotion{NewPercentagePromotion(map[ProductCode][]PercentageOfferRule{"P1": {{1, 30}}}),
+			NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{2, 1}}})},
+		700 * 4,
+		1000 * 2,
+	}, { // Bundle competing with a promotion of one of its products
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(2000, "EUR")}, 3},
+			"P2": {Product{Code: "P2", Name: "Prod name 2", Price: NewMoney(750, "EUR")}, 1}},
+		[]Promotion{NewBundlePromotion([]Bundle{{Items: map[ProductCode]int{"P1": 1, "P2": 1}, Price: 2500}}),
+			NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 1900}}})},
+		2500 + 2000*2,
+		1900*3 + 750,
+	}, { // Promotions of different products do not compete
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 3},
+			"P2": {Product{Code: "P2", Name: "Prod name 2", Price: NewMoney(500, "EUR")}, 2}},
+		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 900}}, "P2": {{2, 450}}}),
+			NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P2": {{2, 1}}})},
+		900*3 + 450*2,
+		900*3 + 500,
+	}, { // Rules raising the price are not applied
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 2}},
+		[]Promotion{NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{1, 1200}}})},
+		1200 * 2,
+		1000 * 2,
+	}, { // Basket promotions apply over the best price of the lines
+		map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 5}},
+		[]Promotion{NewThresholdPromotion([]ThresholdRule{{Above: 4000, Amount: 500}}),
+			NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{2, 930}, {3, 820}}})},
+		930*5 - 500,
+		820*5 - 500,
+	},
+}
+
+func TestPricingStrategies(t *testing.T) {
+	for _, tc := range pricingStrategyCases {
+		basket := NewBasket(uuid.New().String())
+		basket.lines = tc.lines
+
+		if total := basket.CalculatePriceWithStrategy(tc.offers, PriorityOrdered).Total.Amount; total != tc.priorityTotal {
+			t.Errorf("Wanted priority ordered total %v but got %v", tc.priorityTotal, total)
+		}
+		if total := basket.CalculatePriceWithStrategy(tc.offers, BestForCustomer).Total.Amount; total != tc.bestTotal {
+			t.Errorf("Wanted best for customer total %v but got %v", tc.bestTotal, total)
+		}
+	}
+}
+
+func TestBestPriceTieBreaking(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+	basket.lines = map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 3}}
+
+	first := NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 900}}})
+	first.Id = "first"
+	second := NewPercentagePromotion(map[ProductCode][]PercentageOfferRule{"P1": {{3, 10}}})
+	second.Id = "second"
+
+	for _, offers := range [][]Promotion{{first, second}, {second, first}} {
+		receipt := basket.CalculatePriceWithStrategy(offers, BestForCustomer)
+
+		expected := []AppliedPromotion{{Id: offers[0].GetId(), Type: offers[0].GetType(), Units: 3, Discount: NewMoney(300, "EUR")}}
+		if !reflect.DeepEqual(expected, receipt.Lines[0].Promotions) {
+			t.Errorf("Wanted promotions %v but got %v", expected, receipt.Lines[0].Promotions)
+		}
+	}
+}
+
+func TestBestPriceReceiptMergesRules(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+	basket.lines = map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(500, "EUR")}, 5}}
+
+	receipt := basket.CalculatePriceWithStrategy([]Promotion{
+		NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{3, 1}, {2, 1}}})}, BestForCustomer)
+
+	expected := []AppliedPromotion{{Type: "FREE_ITEMS", Units: 5, Discount: NewMoney(1000, "EUR")}}
+	if !reflect.DeepEqual(expected, receipt.Lines[0].Promotions) {
+		t.Errorf("Wanted promotions %v but got %v", expected, receipt.Lines[0].Promotions)
+	}
+	if receipt.Total.Amount != 1500 {
+		t.Errorf("Wanted total %v but got %v", 1500, receipt.Total)
+	}
+}
+
+// BenchmarkBestPrice prices a basket with as many rules compared together as allowed,
+// all of them applying whatever the order they are applied in
+func BenchmarkBestPrice(b *testing.B) {
+	basket := NewBasket(uuid.New().String())
+	basket.lines = make(map[ProductCode]Line)
+	bundle := Bundle{Items: make(map[ProductCode]int), Price: 3000}
+	offers := make([]Promotion, 0, maxCompetingOffers)
+
+	// Free items of every product but the last one, and a bundle of all of them. A
+	// single bundle fits, leaving units for the free items of every product
+	for i := 1; i <= maxCompetingOffers; i++ {
+		pCode := ProductCode(fmt.Sprintf("P%v", i))
+		bundle.Items[pCode] = 1
+
+		if i == maxCompetingOffers {
+			basket.lines[pCode] = Line{Product{Code: pCode, Name: fmt.Sprintf("Prod name %v", i), Price: NewMoney(100*i, "EUR")}, 1}
+			continue
+		}
+
+		basket.lines[pCode] = Line{Product{Code: pCode, Name: fmt.Sprintf("Prod name %v", i), Price: NewMoney(100*i, "EUR")}, 10}
+		offers = append(offers, NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{pCode: {{3, 1}}}))
+	}
+	offers = append(offers, NewBundlePromotion([]Bundle{bundle}))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		basket.CalculatePriceWithStrategy(offers, BestForCustomer)
+	}
+}
+
+func TestParsePricingStrategy(t *testing.T) {
+	cases := []struct {
+		name     string
+		strategy PricingStrategy
+		valid    bool
+	}{
+		{"", PriorityOrdered, true},
+		{"priority", PriorityOrdered, true},
+		{"best", BestForCustomer, true},
+		{"cheapest", "", false},
+	}
+
+	for _, tc := range cases {
+		strategy, err := ParsePricingStrategy(tc.name)
+
+		if strategy != tc.strategy || (err == nil) != tc.valid {
+			t.Errorf("%q: wanted %v (valid %v) but got %v, %v", tc.name, tc.strategy, tc.valid, strategy, err)
+		}
+	}
+}
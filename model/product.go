@@ -8,9 +8,12 @@ import (
 type ProductCode string
 
 type Product struct {
-	Code  ProductCode `json:"code"`
-	Name  string      `json:"name"`
-	Price int         `json:"price"`
+	Code ProductCode `json:"code"`
+	Name string      `json:"name"`
+	// Price including taxes
+	Price Money `json:"price"`
+	// TaxCategory selects the tax rate of the product, the standard one when empty
+	TaxCategory TaxCategory `json:"taxCategory,omitempty"`
 }
 
 func (p *Product) Validate() error {
@@ -21,7 +24,7 @@ func (p *Product) Validate() error {
 		validationErrorDescriptions = append(validationErrorDescriptions, errors.NewValidationErrorDescription("code", "Invalid product code"))
 	}
 
-	if p.Price <= 0 {
+	if p.Price.Amount <= 0 || !p.Price.Currency.IsValid() {
 		validationErrorDescriptions = append(validationErrorDescriptions, errors.NewValidationErrorDescription("price", "Invalid product price"))
 	}
 
@@ -10,19 +10,22 @@ var productCases = []struct {
 	fieldErrors map[string]string
 }{
 	{ // Code is mandatory
-		product:     Product{Code: "", Name: "Product 1", Price: 1000},
+		product:     Product{Code: "", Name: "Product 1", Price: NewMoney(1000, "EUR")},
 		fieldErrors: map[string]string{"code": "Invalid product code"},
 	}, { // Name is not mandatory
-		product:     Product{Code: "P1", Name: "", Price: 1000},
+		product:     Product{Code: "P1", Name: "", Price: NewMoney(1000, "EUR")},
 		fieldErrors: nil,
 	}, { // Price equals Zero
-		product:     Product{Code: "P1", Name: "", Price: 0},
+		product:     Product{Code: "P1", Name: "", Price: NewMoney(0, "EUR")},
 		fieldErrors: map[string]string{"price": "Invalid product price"},
 	}, { // Price negative
-		product:     Product{Code: "P1", Name: "", Price: -1},
+		product:     Product{Code: "P1", Name: "", Price: NewMoney(-1, "EUR")},
+		fieldErrors: map[string]string{"price": "Invalid product price"},
+	}, { // Price without a valid currency
+		product:     Product{Code: "P1", Name: "", Price: NewMoney(1000, "euro")},
 		fieldErrors: map[string]string{"price": "Invalid product price"},
 	}, { // Multiple errors
-		product: Product{Code: "", Name: "", Price: -1},
+		product: Product{Code: "", Name: "", Price: NewMoney(-1, "EUR")},
 		fieldErrors: map[string]string{"code": "Invalid product code",
 			"price": "Invalid product price"},
 	},
@@ -1,19 +1,73 @@
 package model
 
+import (
+	"sort"
+)
+
 type PromotionType string
 
 type Promotion interface {
+	GetId() string
+	GetSettings() PromotionSettings
 	GetType() PromotionType
 	Resolve(map[ProductCode]Line, map[ProductCode]*[]int)
 }
 
+// BasketPromotion is implemented by promotions discounting the whole basket. They
+// are applied once every line promotion has been resolved, over the basket total
+type BasketPromotion interface {
+	Promotion
+	// ResolveBasket returns the discount for a basket with the given total
+	ResolveBasket(total int) int
+}
+
+// PromotionSettings holds the attributes shared by every type of promotion
+type PromotionSettings struct {
+	Id string
+	// Promotions with a higher priority are applied first. Promotions with the same
+	// priority keep the order they are defined in
+	Priority int
+	// Promotions in the same exclusivity group never apply to the same product, nor
+	// together to the basket total
+	Group string
+	// Promotions not stackable never apply to a product, nor to the basket total,
+	// along with any other promotion
+	Stackable bool
+	Schedule  Schedule
+	Coupon    Coupon
+}
+
+// DefaultPromotionSettings returns the settings of a stackable promotion without
+// any priority or group
+func DefaultPromotionSettings() PromotionSettings {
+	return PromotionSettings{Stackable: true}
+}
+
+func (s PromotionSettings) GetId() string {
+	return s.Id
+}
+
+func (s PromotionSettings) GetSettings() PromotionSettings {
+	return s
+}
+
+// compatibleWith tells whether a promotion with these settings can apply along with
+// a promotion with the other settings
+func (s PromotionSettings) compatibleWith(other PromotionSettings) bool {
+	return s.Stackable && other.Stackable && (s.Group == "" || s.Group != other.Group)
+}
+
 type BulkPromotion struct {
+	PromotionSettings
+
 	//A map in case different bulk promotions are defined for different products
 	//Key: ProductCode
 	//Value: different possible conditions by product, for example => 3 - $19 | 5 - $15
 	offers map[ProductCode][]BulkOfferRule
 }
 
+// BulkOfferRule sets the price of every unit when buying enough of them. The price is
+// in minor units of the currency of the product
 type BulkOfferRule struct {
 	Buy   int
 	Price int
@@ -21,7 +75,8 @@ type BulkOfferRule struct {
 
 func NewBulkPromotion(offers map[ProductCode][]BulkOfferRule) *BulkPromotion {
 	return &BulkPromotion{
-		offers: offers,
+		PromotionSettings: DefaultPromotionSettings(),
+		offers:            offers,
 	}
 }
 
@@ -60,6 +115,8 @@ func (b BulkPromotion) Resolve(lines map[ProductCode]Line, inOffer map[ProductCo
 }
 
 type FreeItemsPromotion struct {
+	PromotionSettings
+
 	//A map in case different bulk promotions are defined for different products
 	//Key: ProductCode
 	//Value: slice with potentially different combinations of buy X get Y free
@@ -72,7 +129,7 @@ type FreeItemsOfferRule struct {
 }
 
 func NewFreeItemsPromotion(offers map[ProductCode][]FreeItemsOfferRule) *FreeItemsPromotion {
-	return &FreeItemsPromotion{offers: offers}
+	return &FreeItemsPromotion{PromotionSettings: DefaultPromotionSettings(), offers: offers}
 }
 
 func (f FreeItemsPromotion) GetType() PromotionType {
@@ -103,7 +160,7 @@ func (f FreeItemsPromotion) Resolve(lines map[ProductCode]Line, inOffer map[Prod
 						if i < rule.Free*promotions {
 							*inOffer[pCode] = append(*inOffer[pCode], 0)
 						} else {
-							*inOffer[pCode] = append(*inOffer[pCode], line.Product.Price)
+							*inOffer[pCode] = append(*inOffer[pCode], line.Product.Price.Amount)
 						}
 					}
 				}
@@ -111,3 +168,208 @@ func (f FreeItemsPromotion) Resolve(lines map[ProductCode]Line, inOffer map[Prod
 		}
 	}
 }
+
+type PercentagePromotion struct {
+	PromotionSettings
+
+	//A map in case different percentage promotions are defined for different products
+	//Key: ProductCode
+	//Value: different possible conditions by product, for example => 2 or more - 20% off
+	offers map[ProductCode][]PercentageOfferRule
+}
+
+type PercentageOfferRule struct {
+	// Minimum number of units to apply the discount
+	Buy        int
+	Percentage int
+}
+
+func NewPercentagePromotion(offers map[ProductCode][]PercentageOfferRule) *PercentagePromotion {
+	return &PercentagePromotion{PromotionSettings: DefaultPromotionSettings(), offers: offers}
+}
+
+func (p PercentagePromotion) GetType() PromotionType {
+	return "PERCENTAGE"
+}
+
+// UnitPrice returns the price of a unit once the discount is applied. The discount
+// of every unit is rounded to the nearest cent, half a cent rounding in favour of
+// the customer
+func (r PercentageOfferRule) UnitPrice(price int) int {
+	return price - (price*r.Percentage+50)/100
+}
+
+func (p PercentagePromotion) Resolve(lines map[ProductCode]Line, inOffer map[ProductCode]*[]int) {
+	for pCode, rules := range p.offers {
+		if line, ok := lines[pCode]; ok {
+
+			for _, rule := range rules {
+				amountAvailable := line.amount
+				alreadyInOffer, ok := inOffer[pCode]
+
+				if ok {
+					amountAvailable = amountAvailable - len(*alreadyInOffer)
+				}
+
+				if amountAvailable > 0 && amountAvailable >= rule.Buy {
+					if !ok || alreadyInOffer == nil {
+						inOffer[pCode] = &[]int{}
+					}
+
+					for i := 0; i < amountAvailable; i++ {
+						*inOffer[pCode] = append(*inOffer[pCode], rule.UnitPrice(line.Product.Price.Amount))
+					}
+				}
+			}
+		}
+	}
+}
+
+type BundlePromotion struct {
+	PromotionSettings
+
+	//Bundles are matched in order, each of them as many times as possible
+	bundles []Bundle
+}
+
+// Bundle is a set of units of different products sold together at a fixed price, in
+// minor units of the currency of the products
+type Bundle struct {
+	//Key: ProductCode
+	//Value: units of the product in the bundle
+	Items map[ProductCode]int
+	Price int
+}
+
+func NewBundlePromotion(bundles []Bundle) *BundlePromotion {
+	return &BundlePromotion{PromotionSettings: DefaultPromotionSettings(), bundles: bundles}
+}
+
+func (b BundlePromotion) GetType() PromotionType {
+	return "BUNDLE"
+}
+
+func (b BundlePromotion) Resolve(lines map[ProductCode]Line, inOffer map[ProductCode]*[]int) {
+	for _, bundle := range b.bundles {
+		prices := bundle.unitPrices(lines)
+		if prices == nil {
+			continue
+		}
+
+		// Number of complete bundles with the units not claimed yet by other promotions
+		matches := -1
+		for pCode, units := range bundle.Items {
+			amountAvailable := lines[pCode].amount
+			if alreadyInOffer, ok := inOffer[pCode]; ok {
+				amountAvailable = amountAvailable - len(*alreadyInOffer)
+			}
+
+			if matches < 0 || amountAvailable/units < matches {
+				matches = amountAvailable / units
+			}
+		}
+
+		for i := 0; i < matches; i++ {
+			for pCode, unitPrices := range prices {
+				if _, ok := inOffer[pCode]; !ok {
+					inOffer[pCode] = &[]int{}
+				}
+
+				*inOffer[pCode] = append(*inOffer[pCode], unitPrices...)
+			}
+		}
+	}
+}
+
+// unitPrices splits the bundle price between its units proportionally to their
+// regular prices. Amounts are rounded down but the last unit, in product code order,
+// which takes the remaining cents, so the units always add up to the bundle price.
+// Returns nil if any product is not in the basket or the bundle is not cheaper
+// than its units
+func (b Bundle) unitPrices(lines map[ProductCode]Line) map[ProductCode][]int {
+	codes := make([]string, 0, len(b.Items))
+	regularPrice := 0
+	for pCode, units := range b.Items {
+		line, ok := lines[pCode]
+		if !ok || units <= 0 {
+			return nil
+		}
+
+		codes = append(codes, string(pCode))
+		regularPrice += line.Price.Amount * units
+	}
+
+	if len(codes) == 0 || regularPrice <= b.Price {
+		return nil
+	}
+	sort.Strings(codes)
+
+	prices := make(map[ProductCode][]int, len(codes))
+	assigned := 0
+	for i, code := range codes {
+		pCode := ProductCode(code)
+		unitPrice := lines[pCode].Price.Amount * b.Price / regularPrice
+
+		for unit := 0; unit < b.Items[pCode]; unit++ {
+			if i == len(codes)-1 && unit == b.Items[pCode]-1 {
+				unitPrice = b.Price - assigned
+			}
+
+			prices[pCode] = append(prices[pCode], unitPrice)
+			assigned += unitPrice
+		}
+	}
+
+	return prices
+}
+
+// ThresholdPromotion discounts the whole basket when its total is above a threshold.
+// It does not claim any units, so it is applied on top of the line promotions
+type ThresholdPromotion struct {
+	PromotionSettings
+
+	rules []ThresholdRule
+}
+
+// ThresholdRule discounts either a fixed amount or a whole percentage of the basket
+// total when it is above a threshold. Amounts are in minor units of the currency of
+// the basket lines
+type ThresholdRule struct {
+	Above      int
+	Amount     int
+	Percentage int
+}
+
+func NewThresholdPromotion(rules []ThresholdRule) *ThresholdPromotion {
+	return &ThresholdPromotion{PromotionSettings: DefaultPromotionSettings(), rules: rules}
+}
+
+func (t ThresholdPromotion) GetType() PromotionType {
+	return "THRESHOLD"
+}
+
+// Resolve does nothing, as threshold promotions do not apply to the basket lines
+func (t ThresholdPromotion) Resolve(map[ProductCode]Line, map[ProductCode]*[]int) {
+}
+
+// ResolveBasket applies the rule with the highest threshold below the total. The
+// discount never exceeds the total
+func (t ThresholdPromotion) ResolveBasket(total int) int {
+	var best *ThresholdRule
+	for i, rule := range t.rules {
+		if total > rule.Above && (best == nil || rule.Above > best.Above) {
+			best = &t.rules[i]
+		}
+	}
+
+	if best == nil {
+		return 0
+	}
+
+	discount := best.Amount + (total*best.Percentage+50)/100
+	if discount > total {
+		return total
+	}
+
+	return discount
+}
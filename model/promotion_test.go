@@ -1,6 +1,7 @@
 package model
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -19,40 +20,40 @@ var promotionCases = []struct {
 		0,
 		-1,
 	}, { // Different products without matching any promotion
-		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: 1000}, amount: 1},
-			"P2": {Product: Product{Code: "P2", Name: "bbbb", Price: 1200}, amount: 1},
-			"P3": {Product: Product{Code: "P3", Name: "cccc", Price: 1500}, amount: 1}},
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(1000, "EUR")}, amount: 1},
+			"P2": {Product: Product{Code: "P2", Name: "bbbb", Price: NewMoney(1200, "EUR")}, amount: 1},
+			"P3": {Product: Product{Code: "P3", Name: "cccc", Price: NewMoney(1500, "EUR")}, amount: 1}},
 		NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P2": {{Buy: 2, Price: 1000}}}),
 		3,
 		0,
 		-1,
 	}, { // Exact amount of items for a promotion
-		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: 1000}, amount: 3}},
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(1000, "EUR")}, amount: 3}},
 		NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{Buy: 3, Price: 850}}}),
 		0,
 		3,
 		-1,
 	}, { // Spare items
-		map[ProductCode]Line{"P2": {Product: Product{Code: "P2", Name: "bbbb", Price: 1200}, amount: 3}},
+		map[ProductCode]Line{"P2": {Product: Product{Code: "P2", Name: "bbbb", Price: NewMoney(1200, "EUR")}, amount: 3}},
 		NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P2": {{Buy: 2, Price: 1000}}}),
 		0,
 		3,
 		-1,
 	}, { // Exact amount of same items matching two different rules
-		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: 1000}, amount: 7}},
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(1000, "EUR")}, amount: 7}},
 		NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{Buy: 5, Price: 650}, {Buy: 2, Price: 850}}}),
 		0,
 		7,
 		-1,
 	}, {
-		map[ProductCode]Line{"P3": {Product: Product{Code: "P3", Name: "cccc", Price: 1500}, amount: 15}},
+		map[ProductCode]Line{"P3": {Product: Product{Code: "P3", Name: "cccc", Price: NewMoney(1500, "EUR")}, amount: 15}},
 		NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P3": {{Buy: 4, Price: 1100}}}),
 		0,
 		15,
 		-1,
 	}, { // Exact amount of two different items matching two different rules
-		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: 1500}, amount: 3},
-			"P2": {Product: Product{Code: "P2", Name: "bbbb", Price: 1200}, amount: 3}},
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(1500, "EUR")}, amount: 3},
+			"P2": {Product: Product{Code: "P2", Name: "bbbb", Price: NewMoney(1200, "EUR")}, amount: 3}},
 		NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{Buy: 3, Price: 1300}},
 			"P2": {{Buy: 3, Price: 1000}}}),
 		0,
@@ -67,40 +68,40 @@ var promotionCases = []struct {
 		0,
 		0,
 	}, { // Different products without matching any promotion
-		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: 1000}, amount: 1},
-			"P2": {Product: Product{Code: "P2", Name: "bbbb", Price: 1200}, amount: 1},
-			"P3": {Product: Product{Code: "P3", Name: "cccc", Price: 1500}, amount: 1}},
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(1000, "EUR")}, amount: 1},
+			"P2": {Product: Product{Code: "P2", Name: "bbbb", Price: NewMoney(1200, "EUR")}, amount: 1},
+			"P3": {Product: Product{Code: "P3", Name: "cccc", Price: NewMoney(1500, "EUR")}, amount: 1}},
 		NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P2": {{Buy: 2, Free: 1}}}),
 		3,
 		0,
 		0,
 	}, { // Exact amount of items for a promotion
-		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: 1000}, amount: 3}},
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(1000, "EUR")}, amount: 3}},
 		NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{Buy: 3, Free: 1}}}),
 		0,
 		3,
 		1,
 	}, {
-		map[ProductCode]Line{"P2": {Product: Product{Code: "P2", Name: "bbbb", Price: 1200}, amount: 3}},
+		map[ProductCode]Line{"P2": {Product: Product{Code: "P2", Name: "bbbb", Price: NewMoney(1200, "EUR")}, amount: 3}},
 		NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P2": {{Buy: 2, Free: 1}}}),
 		1,
 		2,
 		1,
 	}, { // Exact amount of same items matching two different rules
-		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: 1000}, amount: 7}},
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(1000, "EUR")}, amount: 7}},
 		NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{Buy: 5, Free: 3}, {Buy: 2, Free: 1}}}),
 		0,
 		7,
 		4,
 	}, {
-		map[ProductCode]Line{"P3": {Product: Product{Code: "P3", Name: "cccc", Price: 1500}, amount: 15}},
+		map[ProductCode]Line{"P3": {Product: Product{Code: "P3", Name: "cccc", Price: NewMoney(1500, "EUR")}, amount: 15}},
 		NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P3": {{Buy: 4, Free: 1}}}),
 		3,
 		12,
 		3,
 	}, { // Exact amount of two different items matching two different rules for one promotion
-		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: 1500}, amount: 3},
-			"P2": {Product: Product{Code: "P2", Name: "bbbb", Price: 1200}, amount: 3}},
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(1500, "EUR")}, amount: 3},
+			"P2": {Product: Product{Code: "P2", Name: "bbbb", Price: NewMoney(1200, "EUR")}, amount: 3}},
 		NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{Buy: 3, Free: 1}},
 			"P2": {{Buy: 3, Free: 1}}}),
 		0,
@@ -151,3 +152,180 @@ func TestPromotions(t *testing.T) {
 
 	}
 }
+
+var percentageCases = []struct {
+	basketLines map[ProductCode]Line // Items in the basket
+	promo       Promotion            // Promotion to apply
+	prices      map[ProductCode][]int
+}{
+	{ // Edge case: empty basket - without lines
+		make(map[ProductCode]Line),
+		NewPercentagePromotion(map[ProductCode][]PercentageOfferRule{"P1": {{Buy: 1, Percentage: 20}}}),
+		map[ProductCode][]int{},
+	}, { // Less items than the minimum
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(750, "EUR")}, amount: 1}},
+		NewPercentagePromotion(map[ProductCode][]PercentageOfferRule{"P1": {{Buy: 2, Percentage: 20}}}),
+		map[ProductCode][]int{},
+	}, { // Exact discount
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(750, "EUR")}, amount: 2}},
+		NewPercentagePromotion(map[ProductCode][]PercentageOfferRule{"P1": {{Buy: 2, Percentage: 20}}}),
+		map[ProductCode][]int{"P1": {600, 600}},
+	}, { // Discount rounded down: 33% of 199 is 65.67 cents
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(199, "EUR")}, amount: 1}},
+		NewPercentagePromotion(map[ProductCode][]PercentageOfferRule{"P1": {{Buy: 1, Percentage: 33}}}),
+		map[ProductCode][]int{"P1": {133}},
+	}, { // Half a cent in favour of the customer: 15% of 10 is 1.5 cents
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(10, "EUR")}, amount: 1}},
+		NewPercentagePromotion(map[ProductCode][]PercentageOfferRule{"P1": {{Buy: 1, Percentage: 15}}}),
+		map[ProductCode][]int{"P1": {8}},
+	}, { // Free units
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(999, "EUR")}, amount: 1}},
+		NewPercentagePromotion(map[ProductCode][]PercentageOfferRule{"P1": {{Buy: 1, Percentage: 100}}}),
+		map[ProductCode][]int{"P1": {0}},
+	}, { // First rule matching wins
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(1000, "EUR")}, amount: 3},
+			"P2": {Product: Product{Code: "P2", Name: "bbbb", Price: NewMoney(500, "EUR")}, amount: 6}},
+		NewPercentagePromotion(map[ProductCode][]PercentageOfferRule{"P1": {{Buy: 5, Percentage: 30}, {Buy: 2, Percentage: 20}},
+			"P2": {{Buy: 5, Percentage: 30}, {Buy: 2, Percentage: 20}}}),
+		map[ProductCode][]int{"P1": {800, 800, 800}, "P2": {350, 350, 350, 350, 350, 350}},
+	},
+}
+
+func TestPercentagePromotion(t *testing.T) {
+	for _, tc := range percentageCases {
+		inOffer := make(map[ProductCode]*[]int)
+
+		tc.promo.Resolve(tc.basketLines, inOffer)
+
+		prices := make(map[ProductCode][]int, len(inOffer))
+		for pCode, items := range inOffer {
+			prices[pCode] = *items
+		}
+
+		if !reflect.DeepEqual(tc.prices, prices) {
+			t.Errorf("got prices %v, wanted %v", prices, tc.prices)
+		}
+	}
+}
+
+func TestPercentageAfterOtherPromotion(t *testing.T) {
+	lines := map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(1000, "EUR")}, amount: 5}}
+	inOffer := map[ProductCode]*[]int{"P1": {0, 0}}
+
+	NewPercentagePromotion(map[ProductCode][]PercentageOfferRule{"P1": {{Buy: 3, Percentage: 10}}}).Resolve(lines, inOffer)
+
+	expected := []int{0, 0, 900, 900, 900}
+	if !reflect.DeepEqual(expected, *inOffer["P1"]) {
+		t.Errorf("got prices %v, wanted %v", *inOffer["P1"], expected)
+	}
+}
+
+var bundleCases = []struct {
+	basketLines map[ProductCode]Line // Items in the basket
+	inOffer     map[ProductCode][]int
+	promo       Promotion // Promotion to apply
+	prices      map[ProductCode][]int
+}{
+	{ // Edge case: empty basket - without lines
+		make(map[ProductCode]Line),
+		map[ProductCode][]int{},
+		NewBundlePromotion([]Bundle{{Items: map[ProductCode]int{"P1": 1, "P2": 1}, Price: 2500}}),
+		map[ProductCode][]int{},
+	}, { // Missing a product of the bundle
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(2000, "EUR")}, amount: 2}},
+		map[ProductCode][]int{},
+		NewBundlePromotion([]Bundle{{Items: map[ProductCode]int{"P1": 1, "P2": 1}, Price: 2500}}),
+		map[ProductCode][]int{},
+	}, { // Bundle price split proportionally to regular prices
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(2000, "EUR")}, amount: 1},
+			"P2": {Product: Product{Code: "P2", Name: "bbbb", Price: NewMoney(750, "EUR")}, amount: 1}},
+		map[ProductCode][]int{},
+		NewBundlePromotion([]Bundle{{Items: map[ProductCode]int{"P1": 1, "P2": 1}, Price: 2500}}),
+		map[ProductCode][]int{"P1": {1818}, "P2": {682}},
+	}, { // Bundle matched several times with spare units
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(2000, "EUR")}, amount: 3},
+			"P2": {Product: Product{Code: "P2", Name: "bbbb", Price: NewMoney(750, "EUR")}, amount: 2}},
+		map[ProductCode][]int{},
+		NewBundlePromotion([]Bundle{{Items: map[ProductCode]int{"P1": 1, "P2": 1}, Price: 2500}}),
+		map[ProductCode][]int{"P1": {1818, 1818}, "P2": {682, 682}},
+	}, { // Several units of a product in the bundle
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(500, "EUR")}, amount: 2},
+			"P2": {Product: Product{Code: "P2", Name: "bbbb", Price: NewMoney(1000, "EUR")}, amount: 1}},
+		map[ProductCode][]int{},
+		NewBundlePromotion([]Bundle{{Items: map[ProductCode]int{"P1": 2, "P2": 1}, Price: 1000}}),
+		map[ProductCode][]int{"P1": {250, 250}, "P2": {500}},
+	}, { // Units claimed by other promotions are not counted
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(2000, "EUR")}, amount: 2},
+			"P2": {Product: Product{Code: "P2", Name: "bbbb", Price: NewMoney(750, "EUR")}, amount: 2}},
+		map[ProductCode][]int{"P2": {0}},
+		NewBundlePromotion([]Bundle{{Items: map[ProductCode]int{"P1": 1, "P2": 1}, Price: 2500}}),
+		map[ProductCode][]int{"P1": {1818}, "P2": {0, 682}},
+	}, { // Bundle more expensive than its units
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(1000, "EUR")}, amount: 1},
+			"P2": {Product: Product{Code: "P2", Name: "bbbb", Price: NewMoney(750, "EUR")}, amount: 1}},
+		map[ProductCode][]int{},
+		NewBundlePromotion([]Bundle{{Items: map[ProductCode]int{"P1": 1, "P2": 1}, Price: 2500}}),
+		map[ProductCode][]int{},
+	}, { // Bundles matched in order
+		map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(1000, "EUR")}, amount: 1},
+			"P2": {Product: Product{Code: "P2", Name: "bbbb", Price: NewMoney(1000, "EUR")}, amount: 1},
+			"P3": {Product: Product{Code: "P3", Name: "cccc", Price: NewMoney(1000, "EUR")}, amount: 1}},
+		map[ProductCode][]int{},
+		NewBundlePromotion([]Bundle{{Items: map[ProductCode]int{"P1": 1, "P2": 1}, Price: 1000},
+			{Items: map[ProductCode]int{"P2": 1, "P3": 1}, Price: 500}}),
+		map[ProductCode][]int{"P1": {500}, "P2": {500}},
+	},
+}
+
+func TestBundlePromotion(t *testing.T) {
+	for _, tc := range bundleCases {
+		inOffer := make(map[ProductCode]*[]int)
+		for pCode, prices := range tc.inOffer {
+			claimed := append([]int{}, prices...)
+			inOffer[pCode] = &claimed
+		}
+
+		tc.promo.Resolve(tc.basketLines, inOffer)
+
+		prices := make(map[ProductCode][]int, len(inOffer))
+		for pCode, items := range inOffer {
+			prices[pCode] = *items
+		}
+
+		if !reflect.DeepEqual(tc.prices, prices) {
+			t.Errorf("got prices %v, wanted %v", prices, tc.prices)
+		}
+	}
+}
+
+var thresholdCases = []struct {
+	rules    []ThresholdRule
+	total    int
+	discount int
+}{
+	{[]ThresholdRule{{Above: 5000, Amount: 1000}}, 4000, 0},                                                              // Below the threshold
+	{[]ThresholdRule{{Above: 5000, Amount: 1000}}, 5000, 0},                                                              // Exactly the threshold
+	{[]ThresholdRule{{Above: 5000, Amount: 1000}}, 5001, 1000},                                                           // Fixed amount
+	{[]ThresholdRule{{Above: 10000, Percentage: 5}}, 12345, 617},                                                         // Percentage rounded to the nearest cent
+	{[]ThresholdRule{{Above: 0, Percentage: 5}}, 10, 1},                                                                  // Half a cent in favour of the customer
+	{[]ThresholdRule{{Above: 0, Amount: 1000}}, 500, 500},                                                                // Never above the total
+	{[]ThresholdRule{{Above: 0, Amount: 1000}}, 0, 0},                                                                    // Empty basket
+	{[]ThresholdRule{{Above: 5000, Amount: 500}, {Above: 10000, Amount: 1500}, {Above: 7500, Amount: 1000}}, 9000, 1000}, // Highest threshold reached
+	{[]ThresholdRule{{Above: 5000, Amount: 500}, {Above: 10000, Amount: 1500}, {Above: 7500, Amount: 1000}}, 20000, 1500},
+}
+
+func TestThresholdPromotion(t *testing.T) {
+	for _, tc := range thresholdCases {
+		promotion := NewThresholdPromotion(tc.rules)
+
+		if discount := promotion.ResolveBasket(tc.total); discount != tc.discount {
+			t.Errorf("got discount %v for total %v, wanted %v", discount, tc.total, tc.discount)
+		}
+
+		inOffer := make(map[ProductCode]*[]int)
+		promotion.Resolve(map[ProductCode]Line{"P1": {Product: Product{Code: "P1", Name: "aaaa", Price: NewMoney(1000, "EUR")}, amount: 1}}, inOffer)
+		if len(inOffer) != 0 {
+			t.Errorf("threshold promotions should not claim units, got %v", inOffer)
+		}
+	}
+}
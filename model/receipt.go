@@ -0,0 +1,45 @@
+package model
+
+// Receipt is the itemized price breakdown of a basket. All the amounts are in the
+// same currency
+type Receipt struct {
+	Lines []ReceiptLine
+	// Price of the lines once their promotions have been applied
+	Subtotal  Money
+	Discounts []AppliedDiscount
+	// Price of the basket once the basket discounts have been applied
+	Total Money
+	// Net and tax parts of the total, set once taxes are applied
+	Net Money
+	Tax Money
+}
+
+type ReceiptLine struct {
+	Product
+	Quantity int
+	// Price of all the units without any promotion
+	Subtotal   Money
+	Promotions []AppliedPromotion
+	// Price of all the units once the promotions have been applied
+	Total Money
+	// Price of the line once its share of the basket discounts is taken, and its net
+	// and tax parts. They are set once taxes are applied
+	Gross Money
+	Net   Money
+	Tax   Money
+}
+
+// AppliedPromotion describes how much a promotion saved on a basket line
+type AppliedPromotion struct {
+	Id       string
+	Type     PromotionType
+	Units    int
+	Discount Money
+}
+
+// AppliedDiscount describes how much a promotion saved on the whole basket
+type AppliedDiscount struct {
+	Id       string
+	Type     PromotionType
+	Discount Money
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"time"
+)
+
+// Schedule limits when a promotion is active. The zero value is always active
+type Schedule struct {
+	// The promotion is active from ValidFrom, included, to ValidUntil, excluded.
+	// Zero times leave the period open
+	ValidFrom  time.Time
+	ValidUntil time.Time
+	// Days of the week the promotion is active, every day when empty
+	Weekdays []time.Weekday
+	// Hours of the day the promotion is active, from FromHour to UntilHour excluded.
+	// The hours wrap around midnight when FromHour is greater, and the promotion is
+	// active all day when both are equal
+	FromHour  int
+	UntilHour int
+}
+
+// IsActive tells whether the schedule includes the given time. Weekdays and hours
+// are checked in the location of the time
+func (s Schedule) IsActive(now time.Time) bool {
+	if !s.ValidFrom.IsZero() && now.Before(s.ValidFrom) {
+		return false
+	}
+	if !s.ValidUntil.IsZero() && !now.Before(s.ValidUntil) {
+		return false
+	}
+
+	if len(s.Weekdays) > 0 {
+		active := false
+		for _, weekday := range s.Weekdays {
+			active = active || weekday == now.Weekday()
+		}
+		if !active {
+			return false
+		}
+	}
+
+	hour := now.Hour()
+	switch {
+	case s.FromHour < s.UntilHour:
+		return hour >= s.FromHour && hour < s.UntilHour
+	case s.FromHour > s.UntilHour:
+		return hour >= s.FromHour || hour < s.UntilHour
+	default:
+		return true
+	}
+}
+
+// ActivePromotions returns the promotions whose schedule includes the given time,
+// keeping their order
+func ActivePromotions(promotions []Promotion, now time.Time) []Promotion {
+	active := make([]Promotion, 0, len(promotions))
+	for _, p := range promotions {
+		if p.GetSettings().Schedule.IsActive(now) {
+			active = append(active, p)
+		}
+	}
+
+	return active
+}
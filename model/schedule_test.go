@@ -0,0 +1,87 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+// Friday 26th November 2021, 10:30 UTC
+var blackFriday = time.Date(2021, time.November, 26, 10, 30, 0, 0, time.UTC)
+
+var scheduleCases = []struct {
+	schedule Schedule
+	now      time.Time
+	active   bool
+}{
+	{ // Always active
+		Schedule{},
+		blackFriday,
+		true,
+	}, { // Before the period starts
+		Schedule{ValidFrom: blackFriday.Add(time.Hour)},
+		blackFriday,
+		false,
+	}, { // When the period starts
+		Schedule{ValidFrom: blackFriday, ValidUntil: blackFriday.Add(time.Hour)},
+		blackFriday,
+		true,
+	}, { // When the period ends
+		Schedule{ValidFrom: blackFriday.Add(-time.Hour), ValidUntil: blackFriday},
+		blackFriday,
+		false,
+	}, { // Another day of the week
+		Schedule{Weekdays: []time.Weekday{time.Saturday, time.Sunday}},
+		blackFriday,
+		false,
+	}, { // The day of the week
+		Schedule{Weekdays: []time.Weekday{time.Monday, time.Friday}},
+		blackFriday,
+		true,
+	}, { // Within the hours
+		Schedule{FromHour: 10, UntilHour: 11},
+		blackFriday,
+		true,
+	}, { // After the hours
+		Schedule{FromHour: 8, UntilHour: 10},
+		blackFriday,
+		false,
+	}, { // Hours around midnight
+		Schedule{FromHour: 22, UntilHour: 6},
+		blackFriday,
+		false,
+	}, { // Hours around midnight, after midnight
+		Schedule{FromHour: 22, UntilHour: 6},
+		blackFriday.Add(-6 * time.Hour),
+		true,
+	}, { // Within the period and the hours but another day of the week
+		Schedule{ValidFrom: blackFriday.Add(-24 * time.Hour), ValidUntil: blackFriday.Add(24 * time.Hour),
+			Weekdays: []time.Weekday{time.Thursday}, FromHour: 9, UntilHour: 21},
+		blackFriday,
+		false,
+	},
+}
+
+func TestScheduleIsActive(t *testing.T) {
+	for _, tc := range scheduleCases {
+		if active := tc.schedule.IsActive(tc.now); active != tc.active {
+			t.Errorf("%+v at %v: wanted active %v but got %v", tc.schedule, tc.now, tc.active, active)
+		}
+	}
+}
+
+func TestActivePromotions(t *testing.T) {
+	always := NewBulkPromotion(map[ProductCode][]BulkOfferRule{"P1": {{3, 900}}})
+	always.Id = "always"
+	future := NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{2, 1}}})
+	future.Id = "future"
+	future.Schedule = Schedule{ValidFrom: blackFriday.Add(time.Hour)}
+	today := NewPercentagePromotion(map[ProductCode][]PercentageOfferRule{"P1": {{1, 10}}})
+	today.Id = "today"
+	today.Schedule = Schedule{Weekdays: []time.Weekday{time.Friday}}
+
+	active := ActivePromotions([]Promotion{always, future, today}, blackFriday)
+
+	if len(active) != 2 || active[0].GetId() != "always" || active[1].GetId() != "today" {
+		t.Errorf("Wanted promotions always and today but got %v", active)
+	}
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"github.com/alfcope/checkouttest/errors"
+)
+
+// Stock counts the units of a product on hand and how many of them are reserved by
+// baskets. Products whose stock is not tracked never run out
+type Stock struct {
+	Code     ProductCode
+	Tracked  bool
+	OnHand   int
+	Reserved int
+}
+
+// Available returns the units that can still be reserved
+func (s Stock) Available() int {
+	return s.OnHand - s.Reserved
+}
+
+// SetOnHand starts tracking the stock with the given units, which can not be less
+// than the units already reserved
+func (s *Stock) SetOnHand(units int) error {
+	if units < 0 || units < s.Reserved {
+		return errors.NewValidationError([]*errors.ValidationErrorDescription{
+			errors.NewValidationErrorDescription("quantity", "Quantity below the reserved units")})
+	}
+
+	s.Tracked = true
+	s.OnHand = units
+
+	return nil
+}
+
+// Reserve takes units for a basket, failing if not enough of them are available
+func (s *Stock) Reserve(units int) error {
+	if !s.Tracked {
+		return nil
+	}
+
+	if units > s.Available() {
+		return errors.NewOutOfStock(string(s.Code), units, s.Available())
+	}
+	s.Reserved += units
+
+	return nil
+}
+
+// Release gives back units reserved by a basket
+func (s *Stock) Release(units int) {
+	if !s.Tracked {
+		return
+	}
+
+	s.Reserved -= units
+	if s.Reserved < 0 {
+		s.Reserved = 0
+	}
+}
+
+// Commit takes units reserved by a basket out of the stock, once they are sold
+func (s *Stock) Commit(units int) {
+	if !s.Tracked {
+		return
+	}
+
+	s.Release(units)
+	s.OnHand -= units
+	if s.OnHand < s.Reserved {
+		s.OnHand = s.Reserved
+	}
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"github.com/alfcope/checkouttest/errors"
+	"testing"
+)
+
+func TestUntrackedStock(t *testing.T) {
+	stock := Stock{Code: "P1"}
+
+	if err := stock.Reserve(1000); err != nil {
+		t.Errorf("An untracked product should never run out, got %v", err)
+	}
+	stock.Commit(1000)
+
+	if stock != (Stock{Code: "P1"}) {
+		t.Errorf("An untracked stock should not change, got %+v", stock)
+	}
+}
+
+func TestStockReservations(t *testing.T) {
+	stock := Stock{Code: "P1"}
+	if err := stock.SetOnHand(5); err != nil {
+		t.Fatalf("Unexpected error setting the stock: %v", err)
+	}
+
+	if err := stock.Reserve(3); err != nil {
+		t.Errorf("Unexpected error reserving units: %v", err)
+	}
+	if outOfStock, ok := stock.Reserve(3).(*errors.OutOfStock); !ok || outOfStock.Available != 2 {
+		t.Errorf("Wanted out of stock with 2 units available, got %v", outOfStock)
+	}
+	if _, ok := stock.SetOnHand(2).(*errors.ValidationError); !ok {
+		t.Errorf("The units on hand should not be less than the reserved ones")
+	}
+
+	stock.Release(1)
+	stock.Commit(2)
+
+	if stock.OnHand != 3 || stock.Reserved != 0 || stock.Available() != 3 {
+		t.Errorf("Wanted 3 units on hand and none reserved, got %+v", stock)
+	}
+}
@@ -0,0 +1,149 @@
+package model
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// TaxCategory groups the products taxed at the same rate
+type TaxCategory string
+
+// DefaultTaxCategory is the category of the products without one
+const DefaultTaxCategory TaxCategory = "standard"
+
+// TaxRounding decides when the taxes of a receipt are rounded to minor units
+type TaxRounding string
+
+const (
+	// PerLineRounding rounds the tax of every line, the total tax adding them up
+	PerLineRounding TaxRounding = "line"
+	// PerTotalRounding rounds the tax of the lines taxed at the same rate together, so
+	// the total tax may differ from the sum of the line taxes
+	PerTotalRounding TaxRounding = "total"
+)
+
+// ParseTaxRounding returns the rounding policy with the given name, per line when empty
+func ParseTaxRounding(name string) (TaxRounding, error) {
+	switch TaxRounding(name) {
+	case "", PerLineRounding:
+		return PerLineRounding, nil
+	case PerTotalRounding:
+		return PerTotalRounding, nil
+	default:
+		return "", fmt.Errorf("unknown tax rounding %q", name)
+	}
+}
+
+// TaxRates holds the tax rate of every product category of a region. Prices include
+// taxes, so the tax is taken out of them. The zero value taxes nothing
+type TaxRates struct {
+	// Percentage of the net price by category
+	rates    map[TaxCategory]*big.Rat
+	rounding TaxRounding
+}
+
+// NewTaxRates reads the rates of the categories as exact decimal percentages, such as
+// 21 or 5.5. Category names are not case sensitive
+func NewTaxRates(rates map[TaxCategory]string, rounding TaxRounding) (TaxRates, error) {
+	taxes := TaxRates{rates: make(map[TaxCategory]*big.Rat, len(rates)), rounding: rounding}
+	for category, rate := range rates {
+		value, ok := new(big.Rat).SetString(rate)
+		if !ok || value.Sign() < 0 {
+			return TaxRates{}, fmt.Errorf("invalid %v tax rate %q", category, rate)
+		}
+		taxes.rates[TaxCategory(strings.ToLower(string(category)))] = value
+	}
+
+	return taxes, nil
+}
+
+// Supports tells whether the category has a tax rate, every category having one
+// when no rates are set
+func (t TaxRates) Supports(category TaxCategory) bool {
+	_, err := t.rate(category)
+	return err == nil
+}
+
+// rate returns the percentage the category is taxed at
+func (t TaxRates) rate(category TaxCategory) (*big.Rat, error) {
+	if t.rates == nil {
+		return new(big.Rat), nil
+	}
+	if category == "" {
+		category = DefaultTaxCategory
+	}
+
+	rate, ok := t.rates[TaxCategory(strings.ToLower(string(category)))]
+	if !ok {
+		return nil, fmt.Errorf("no tax rate for category %v", category)
+	}
+
+	return rate, nil
+}
+
+// Apply splits the price of every line and of the whole receipt into net and tax. The
+// basket discounts are shared out among the lines in proportion to their totals, the
+// last line taking the remaining minor units, so the gross of the lines adds up to the
+// receipt total
+func (t TaxRates) Apply(r Receipt) (Receipt, error) {
+	currency := r.Total.Currency
+	discount := r.Subtotal.Amount - r.Total.Amount
+
+	taxed := r
+	taxed.Lines = make([]ReceiptLine, 0, len(r.Lines))
+	taxed.Tax = NewMoney(0, currency)
+
+	// Gross of the lines taxed at every rate, to round them together
+	grossByRate := make(map[string]*big.Rat)
+	rates := make(map[string]*big.Rat)
+
+	shared := 0
+	for i, line := range r.Lines {
+		rate, err := t.rate(line.TaxCategory)
+		if err != nil {
+			return Receipt{}, err
+		}
+
+		share := 0
+		switch {
+		case i == len(r.Lines)-1:
+			share = discount - shared
+		case r.Subtotal.Amount != 0:
+			share = discount * line.Total.Amount / r.Subtotal.Amount
+		}
+		shared += share
+
+		line.Gross = NewMoney(line.Total.Amount-share, currency)
+		line.Tax = NewMoney(includedTax(big.NewRat(int64(line.Gross.Amount), 1), rate), currency)
+		line.Net = NewMoney(line.Gross.Amount-line.Tax.Amount, currency)
+		taxed.Lines = append(taxed.Lines, line)
+
+		taxed.Tax.Amount += line.Tax.Amount
+
+		key := rate.RatString()
+		if _, ok := grossByRate[key]; !ok {
+			grossByRate[key], rates[key] = new(big.Rat), rate
+		}
+		grossByRate[key].Add(grossByRate[key], big.NewRat(int64(line.Gross.Amount), 1))
+	}
+
+	if t.rounding == PerTotalRounding {
+		taxed.Tax.Amount = 0
+		for key, gross := range grossByRate {
+			taxed.Tax.Amount += includedTax(gross, rates[key])
+		}
+	}
+	taxed.Net = NewMoney(r.Total.Amount-taxed.Tax.Amount, currency)
+
+	return taxed, nil
+}
+
+// includedTax returns the tax included in a gross amount taxed at the percentage,
+// rounded to the nearest minor unit
+func includedTax(gross, percentage *big.Rat) int {
+	tax := new(big.Rat).Mul(gross, percentage)
+	tax.Quo(tax, new(big.Rat).Add(percentage, big.NewRat(100, 1)))
+
+	return roundHalfAway(tax)
+}
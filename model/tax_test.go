@@ -0,0 +1,176 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"testing"
+)
+
+func TestApplyTaxes(t *testing.T) {
+	cases := []struct {
+		name     string
+		lines    map[ProductCode]Line
+		offers   []Promotion
+		rounding TaxRounding
+		// Expected gross, net and tax of every line, in product code order
+		lineTaxes [][3]int
+		net       int
+		tax       int
+	}{
+		{
+			"Tax rounded per line",
+			map[ProductCode]Line{
+				"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(100, "EUR")}, 1},
+				"P2": {Product{Code: "P2", Name: "Prod name 2", Price: NewMoney(100, "EUR")}, 1},
+				"P3": {Product{Code: "P3", Name: "Prod name 3", Price: NewMoney(100, "EUR")}, 1}},
+			nil,
+			PerLineRounding,
+			[][3]int{{100, 83, 17}, {100, 83, 17}, {100, 83, 17}},
+			249,
+			51,
+		}, {
+			"Tax rounded per total",
+			map[ProductCode]Line{
+				"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(100, "EUR")}, 1},
+				"P2": {Product{Code: "P2", Name: "Prod name 2", Price: NewMoney(100, "EUR")}, 1},
+				"P3": {Product{Code: "P3", Name: "Prod name 3", Price: NewMoney(100, "EUR")}, 1}},
+			nil,
+			PerTotalRounding,
+			[][3]int{{100, 83, 17}, {100, 83, 17}, {100, 83, 17}},
+			248,
+			52,
+		}, {
+			"Tax after line promotions",
+			map[ProductCode]Line{
+				"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR"), TaxCategory: "Reduced"}, 3}},
+			[]Promotion{NewFreeItemsPromotion(map[ProductCode][]FreeItemsOfferRule{"P1": {{3, 1}}})},
+			PerLineRounding,
+			[][3]int{{2000, 1818, 182}},
+			1818,
+			182,
+		}, {
+			"Basket discounts shared out among the lines",
+			map[ProductCode]Line{
+				"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(2000, "EUR")}, 3},
+				"P2": {Product{Code: "P2", Name: "Prod name 2", Price: NewMoney(1000, "EUR"), TaxCategory: "reduced"}, 4}},
+			[]Promotion{NewThresholdPromotion([]ThresholdRule{{Above: 5000, Percentage: 10}})},
+			PerLineRounding,
+			[][3]int{{5400, 4463, 937}, {3600, 3273, 327}},
+			7736,
+			1264,
+		}, {
+			"Exempt products",
+			map[ProductCode]Line{
+				"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(500, "EUR"), TaxCategory: "exempt"}, 2}},
+			nil,
+			PerTotalRounding,
+			[][3]int{{1000, 1000, 0}},
+			1000,
+			0,
+		},
+	}
+
+	for _, tc := range cases {
+		taxes, err := NewTaxRates(map[TaxCategory]string{"standard": "21", "reduced": "10", "exempt": "0"}, tc.rounding)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		basket := NewBasket(uuid.New().String())
+		basket.lines = tc.lines
+
+		receipt, err := taxes.Apply(basket.CalculatePrice(tc.offers))
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", tc.name, err)
+			continue
+		}
+
+		for i, line := range receipt.Lines {
+			if taxes := [3]int{line.Gross.Amount, line.Net.Amount, line.Tax.Amount}; taxes != tc.lineTaxes[i] {
+				t.Errorf("%v: wanted gross, net and tax %v for %v but got %v", tc.name, tc.lineTaxes[i], line.Code, taxes)
+			}
+		}
+		if receipt.Net.Amount != tc.net || receipt.Tax.Amount != tc.tax {
+			t.Errorf("%v: wanted net %v and tax %v but got %v and %v", tc.name, tc.net, tc.tax, receipt.Net, receipt.Tax)
+		}
+		if receipt.Net.Amount+receipt.Tax.Amount != receipt.Total.Amount {
+			t.Errorf("%v: net %v and tax %v do not add up to total %v", tc.name, receipt.Net, receipt.Tax, receipt.Total)
+		}
+	}
+}
+
+func TestApplyTaxesWithoutRates(t *testing.T) {
+	basket := NewBasket(uuid.New().String())
+	basket.lines = map[ProductCode]Line{"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR")}, 2}}
+
+	receipt, err := TaxRates{}.Apply(basket.CalculatePrice(nil))
+
+	if err != nil || receipt.Tax != NewMoney(0, "EUR") || receipt.Net != NewMoney(2000, "EUR") {
+		t.Errorf("Wanted no taxes but got net %v and tax %v, %v", receipt.Net, receipt.Tax, err)
+	}
+}
+
+func TestApplyTaxesUnknownCategory(t *testing.T) {
+	taxes, _ := NewTaxRates(map[TaxCategory]string{"standard": "21"}, PerLineRounding)
+
+	basket := NewBasket(uuid.New().String())
+	basket.lines = map[ProductCode]Line{
+		"P1": {Product{Code: "P1", Name: "Prod name 1", Price: NewMoney(1000, "EUR"), TaxCategory: "luxury"}, 1}}
+
+	if _, err := taxes.Apply(basket.CalculatePrice(nil)); err == nil {
+		t.Errorf("Products of categories without a rate should fail")
+	}
+}
+
+func TestNewTaxRates(t *testing.T) {
+	cases := []struct {
+		rates map[TaxCategory]string
+		valid bool
+	}{
+		{map[TaxCategory]string{"standard": "21", "reduced": "5.5"}, true},
+		{map[TaxCategory]string{"standard": "-1"}, false},
+		{map[TaxCategory]string{"standard": "21%"}, false},
+	}
+
+	for _, tc := range cases {
+		if _, err := NewTaxRates(tc.rates, PerLineRounding); (err == nil) != tc.valid {
+			t.Errorf("%v: wanted valid %v but got error %v", tc.rates, tc.valid, err)
+		}
+	}
+}
+
+func TestParseTaxRounding(t *testing.T) {
+	cases := []struct {
+		name     string
+		rounding TaxRounding
+		valid    bool
+	}{
+		{"", PerLineRounding, true},
+		{"line", PerLineRounding, true},
+		{"total", PerTotalRounding, true},
+		{"invoice", "", false},
+	}
+
+	for _, tc := range cases {
+		rounding, err := ParseTaxRounding(tc.name)
+
+		if rounding != tc.rounding || (err == nil) != tc.valid {
+			t.Errorf("%q: wanted %v (valid %v) but got %v, %v", tc.name, tc.rounding, tc.valid, rounding, err)
+		}
+	}
+}
+
+func TestTaxRatesSupports(t *testing.T) {
+	taxes, err := NewTaxRates(map[TaxCategory]string{"standard": "21", "Reduced": "10"}, PerLineRounding)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for category, supported := range map[TaxCategory]bool{"": true, "standard": true, "REDUCED": true, "luxury": false} {
+		if taxes.Supports(category) != supported {
+			t.Errorf("Wanted category %q supported %v", category, supported)
+		}
+	}
+	if !(TaxRates{}).Supports("luxury") {
+		t.Errorf("Wanted every category supported without rates")
+	}
+}
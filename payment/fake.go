@@ -0,0 +1,151 @@
+package payment
+
+import (
+	"fmt"
+	"github.com/alfcope/checkouttest/errors"
+	"github.com/alfcope/checkouttest/model"
+	"github.com/google/uuid"
+	"sync"
+)
+
+// Outcome is the answer of the fake provider to every request
+type Outcome string
+
+const (
+	Succeed Outcome = "succeed"
+	Decline Outcome = "decline"
+	Timeout Outcome = "timeout"
+)
+
+// ParseOutcome reads the outcome of the fake provider, succeed when empty
+func ParseOutcome(outcome string) (Outcome, error) {
+	switch Outcome(outcome) {
+	case "", Succeed:
+		return Succeed, nil
+	case Decline, Timeout:
+		return Outcome(outcome), nil
+	}
+
+	return "", fmt.Errorf("unknown payment outcome %v", outcome)
+}
+
+// FakeProvider is a local payment gateway for tests. It keeps its authorizations in
+// memory and answers every request with the outcome it is configured with
+type FakeProvider struct {
+	outcome Outcome
+
+	authorizations map[string]*fakeAuthorization
+	mux            sync.Mutex
+}
+
+type fakeAuthorization struct {
+	orderId  string
+	amount   model.Money
+	captured bool
+	refunded bool
+	voided   bool
+}
+
+func NewFakeProvider(outcome Outcome) *FakeProvider {
+	return &FakeProvider{
+		outcome:        outcome,
+		authorizations: make(map[string]*fakeAuthorization),
+		mux:            sync.Mutex{},
+	}
+}
+
+// SetOutcome changes the answer to the next requests
+func (f *FakeProvider) SetOutcome(outcome Outcome) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	f.outcome = outcome
+}
+
+func (f *FakeProvider) Authorize(orderId string, amount model.Money) (string, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if err := f.answer(orderId); err != nil {
+		return "", err
+	}
+
+	id := uuid.New().String()
+	f.authorizations[id] = &fakeAuthorization{orderId: orderId, amount: amount}
+
+	return id, nil
+}
+
+// Capture collects the authorized amount, which can not be exceeded
+func (f *FakeProvider) Capture(authorization string, amount model.Money) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	a, ok := f.authorizations[authorization]
+	if !ok {
+		return fmt.Errorf("unknown authorization %v", authorization)
+	}
+	if err := f.answer(a.orderId); err != nil {
+		return err
+	}
+	if a.voided {
+		return errors.NewPaymentDeclined(a.orderId, "Authorization voided")
+	}
+	if a.captured || amount.Currency != a.amount.Currency || amount.Amount > a.amount.Amount {
+		return errors.NewPaymentDeclined(a.orderId, "Capture exceeds the authorized amount")
+	}
+
+	a.captured = true
+	return nil
+}
+
+// Refund gives back a captured amount, once
+func (f *FakeProvider) Refund(authorization string, amount model.Money) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	a, ok := f.authorizations[authorization]
+	if !ok {
+		return fmt.Errorf("unknown authorization %v", authorization)
+	}
+	if err := f.answer(a.orderId); err != nil {
+		return err
+	}
+	if !a.captured || a.refunded || amount.Currency != a.amount.Currency || amount.Amount > a.amount.Amount {
+		return errors.NewPaymentDeclined(a.orderId, "Refund exceeds the captured amount")
+	}
+
+	a.refunded = true
+	return nil
+}
+
+// Void releases an authorization, unless it was captured
+func (f *FakeProvider) Void(authorization string) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	a, ok := f.authorizations[authorization]
+	if !ok {
+		return fmt.Errorf("unknown authorization %v", authorization)
+	}
+	if err := f.answer(a.orderId); err != nil {
+		return err
+	}
+	if a.captured {
+		return errors.NewPaymentDeclined(a.orderId, "Captured payments can not be voided")
+	}
+
+	a.voided = true
+	return nil
+}
+
+func (f *FakeProvider) answer(orderId string) error {
+	switch f.outcome {
+	case Decline:
+		return errors.NewPaymentDeclined(orderId, "Card declined")
+	case Timeout:
+		return errors.NewPaymentTimeout(orderId)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package payment
+
+import (
+	"github.com/alfcope/checkouttest/config"
+	"github.com/alfcope/checkouttest/errors"
+	"github.com/alfcope/checkouttest/model"
+	"testing"
+)
+
+func TestFakeProviderPayment(t *testing.T) {
+	provider := NewFakeProvider(Succeed)
+	amount := model.NewMoney(2050, "EUR")
+
+	authorization, err := provider.Authorize("O1", amount)
+	if err != nil || authorization == "" {
+		t.Fatalf("Unexpected error authorizing a payment: %v", err)
+	}
+
+	if err := provider.Refund(authorization, amount); err == nil {
+		t.Errorf("A payment not captured should not be refunded")
+	}
+	if err := provider.Capture(authorization, model.NewMoney(2051, "EUR")); err == nil {
+		t.Errorf("A capture should not exceed the authorized amount")
+	}
+	if err := provider.Capture(authorization, amount); err != nil {
+		t.Errorf("Unexpected error capturing a payment: %v", err)
+	}
+	if err := provider.Refund(authorization, amount); err != nil {
+		t.Errorf("Unexpected error refunding a payment: %v", err)
+	}
+	if err := provider.Refund(authorization, amount); err == nil {
+		t.Errorf("A payment should not be refunded twice")
+	}
+	if err := provider.Capture("unknown", amount); err == nil {
+		t.Errorf("An unknown authorization should not be captured")
+	}
+	if err := provider.Void(authorization); err == nil {
+		t.Errorf("A captured payment should not be voided")
+	}
+
+	voided, _ := provider.Authorize("O2", amount)
+	if err := provider.Void(voided); err != nil {
+		t.Errorf("Unexpected error voiding a payment: %v", err)
+	}
+	if err := provider.Capture(voided, amount); err == nil {
+		t.Errorf("A voided payment should not be captured")
+	}
+}
+
+func TestFakeProviderOutcomes(t *testing.T) {
+	cases := []struct {
+		outcome Outcome
+		check   func(error) bool
+	}{
+		{Succeed, func(err error) bool { return err == nil }},
+		{Decline, func(err error) bool { _, ok := err.(*errors.PaymentDeclined); return ok }},
+		{Timeout, func(err error) bool { _, ok := err.(*errors.PaymentTimeout); return ok }},
+	}
+
+	for _, tc := range cases {
+		provider := NewFakeProvider(tc.outcome)
+
+		_, err := provider.Authorize("O1", model.NewMoney(100, "EUR"))
+		if !tc.check(err) {
+			t.Errorf("%v: unexpected authorization result %v", tc.outcome, err)
+		}
+	}
+
+	// The outcome applies to the requests made after changing it
+	provider := NewFakeProvider(Succeed)
+	authorization, _ := provider.Authorize("O1", model.NewMoney(100, "EUR"))
+	provider.SetOutcome(Timeout)
+	if _, ok := provider.Capture(authorization, model.NewMoney(100, "EUR")).(*errors.PaymentTimeout); !ok {
+		t.Errorf("Wanted the capture to time out")
+	}
+}
+
+func TestNewPaymentProvider(t *testing.T) {
+	cases := []struct {
+		config config.PaymentConfig
+		valid  bool
+	}{
+		{config.PaymentConfig{}, true},
+		{config.PaymentConfig{Provider: "fake", Outcome: "decline"}, true},
+		{config.PaymentConfig{Provider: "fake", Outcome: "explode"}, false},
+		{config.PaymentConfig{Provider: "stripe"}, false},
+	}
+
+	for _, tc := range cases {
+		_, err := NewPaymentProvider(tc.config)
+		if (err == nil) != tc.valid {
+			t.Errorf("%+v: wanted valid %v but got error %v", tc.config, tc.valid, err)
+		}
+	}
+}
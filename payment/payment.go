@@ -0,0 +1,35 @@
+package payment
+
+import (
+	"fmt"
+	"github.com/alfcope/checkouttest/config"
+	"github.com/alfcope/checkouttest/model"
+)
+
+// PaymentProvider collects the money of the orders. Payments are authorized when the
+// order is placed and captured right after, and can be refunded once captured.
+// Authorizations never captured are voided. Failed payments are reported with
+// PaymentDeclined or PaymentTimeout errors
+type PaymentProvider interface {
+	// Authorize reserves the amount for the order, returning the id of the authorization
+	Authorize(orderId string, amount model.Money) (string, error)
+	Capture(authorization string, amount model.Money) error
+	Refund(authorization string, amount model.Money) error
+	// Void releases the amount of an authorization not captured
+	Void(authorization string) error
+}
+
+// NewPaymentProvider initializes the payment provider selected in the configuration
+func NewPaymentProvider(config config.PaymentConfig) (PaymentProvider, error) {
+	switch config.Provider {
+	case "", "fake":
+		outcome, err := ParseOutcome(config.Outcome)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewFakeProvider(outcome), nil
+	}
+
+	return nil, fmt.Errorf("unknown payment provider %v", config.Provider)
+}
@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"github.com/alfcope/checkouttest/config"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Scope is a set of routes a caller can be granted. Admins are granted every scope
+type Scope string
+
+const (
+	Shopper Scope = "shopper"
+	Admin   Scope = "admin"
+)
+
+const (
+	// ApiKeyHeader carries the static api keys
+	ApiKeyHeader = "X-Api-Key"
+	// CustomerHeader carries the id of the customer when authentication is disabled
+	CustomerHeader = "X-Customer-Id"
+
+	minSecretLength = 32
+)
+
+// ParseScope reads a scope granted to a caller
+func ParseScope(scope string) (Scope, error) {
+	switch Scope(scope) {
+	case Shopper, Admin:
+		return Scope(scope), nil
+	}
+
+	return "", fmt.Errorf("unknown scope %q", scope)
+}
+
+// Identity is the caller of a request. Anonymous callers have no subject nor scopes
+type Identity struct {
+	// Subject is the customer or client the credentials were issued to
+	Subject string
+	Scopes  []Scope
+	// ApiKey the caller authenticated with, if any
+	ApiKey string
+}
+
+func (i Identity) IsAnonymous() bool {
+	return i.Subject == "" && len(i.Scopes) == 0
+}
+
+// HasScope tells if the identity was granted the scope
+func (i Identity) HasScope(scope Scope) bool {
+	for _, s := range i.Scopes {
+		if s == scope || s == Admin {
+			return true
+		}
+	}
+
+	return false
+}
+
+type contextKey int
+
+const identityKey contextKey = iota
+
+// WithIdentity returns a copy of the request made by the identity
+func WithIdentity(r *http.Request, identity Identity) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), identityKey, identity))
+}
+
+// FromRequest returns the identity that made the request, if it was authenticated
+func FromRequest(r *http.Request) (Identity, bool) {
+	identity, ok := r.Context().Value(identityKey).(Identity)
+	return identity, ok
+}
+
+// Authenticator identifies the callers of the api by their bearer tokens, JWTs signed
+// with HMAC SHA-256, or their static api keys
+type Authenticator struct {
+	enabled bool
+	secret  []byte
+	apiKeys map[string]Identity
+	now     func() time.Time
+}
+
+func NewAuthenticator(config config.AuthConfig) (*Authenticator, error) {
+	authenticator := &Authenticator{
+		enabled: config.Enabled,
+		secret:  []byte(config.Secret),
+		apiKeys: make(map[string]Identity, len(config.ApiKeys)),
+		now:     time.Now,
+	}
+
+	if !config.Enabled {
+		return authenticator, nil
+	}
+
+	if config.Secret != "" && len(config.Secret) < minSecretLength {
+		return nil, fmt.Errorf("auth secret must be at least %v bytes long", minSecretLength)
+	}
+
+	for _, apiKey := range config.ApiKeys {
+		if apiKey.Key == "" {
+			return nil, fmt.Errorf("empty api key of %q", apiKey.Subject)
+		}
+
+		identity := Identity{Subject: apiKey.Subject, Scopes: make([]Scope, 0, len(apiKey.Scopes))}
+		for _, s := range apiKey.Scopes {
+			scope, err := ParseScope(s)
+			if err != nil {
+				return nil, err
+			}
+			identity.Scopes = append(identity.Scopes, scope)
+		}
+		authenticator.apiKeys[apiKey.Key] = identity
+	}
+
+	if config.Secret == "" && len(authenticator.apiKeys) == 0 {
+		return nil, fmt.Errorf("auth enabled without a secret nor api keys")
+	}
+
+	return authenticator, nil
+}
+
+// Authenticate identifies the caller of the request. Requests without credentials
+// are anonymous, and fail only if their credentials are invalid. With authentication
+// disabled every caller is granted every scope
+func (a *Authenticator) Authenticate(r *http.Request) (Identity, error) {
+	if !a.enabled {
+		return Identity{Subject: strings.TrimSpace(r.Header.Get(CustomerHeader)), Scopes: []Scope{Admin}}, nil
+	}
+
+	if key := r.Header.Get(ApiKeyHeader); key != "" {
+		return a.apiKeyIdentity(key)
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		return Identity{}, nil
+	}
+
+	if len(authorization) < 7 || !strings.EqualFold(authorization[:7], "Bearer ") {
+		return Identity{}, fmt.Errorf("unsupported authorization scheme")
+	}
+	if len(a.secret) == 0 {
+		return Identity{}, fmt.Errorf("bearer tokens not accepted")
+	}
+
+	claims, err := ParseToken(a.secret, strings.TrimSpace(authorization[7:]), a.now())
+	if err != nil {
+		return Identity{}, err
+	}
+
+	identity := Identity{Subject: claims.Subject, Scopes: make([]Scope, 0)}
+	for _, s := range strings.Fields(claims.Scope) {
+		// Scopes unknown to the api are ignored
+		if scope, err := ParseScope(s); err == nil {
+			identity.Scopes = append(identity.Scopes, scope)
+		}
+	}
+
+	return identity, nil
+}
+
+// apiKeyIdentity finds the identity of the key, comparing all of them in constant time
+func (a *Authenticator) apiKeyIdentity(key string) (Identity, error) {
+	var identity Identity
+	found := false
+
+	for k, i := range a.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			identity = i
+			found = true
+		}
+	}
+
+	if !found {
+		return Identity{}, fmt.Errorf("unknown api key")
+	}
+	identity.ApiKey = key
+
+	return identity, nil
+}
+
+// Middleware authenticates every request, rejecting with 401 those with invalid
+// credentials. Routes check the scopes of the caller with Require
+func (a *Authenticator) Middleware(nextHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := a.Authenticate(r)
+		if err != nil {
+			logging.GetLoggerWithFields(r).Errorf("Authentication failed: %v", err)
+			unauthorized(w)
+			return
+		}
+
+		nextHandler.ServeHTTP(w, WithIdentity(r, identity))
+	})
+}
+
+// Require only lets through the requests of callers granted the scope. Anonymous
+// callers are rejected with 401, and callers without the scope with 403
+func Require(scope Scope, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := FromRequest(r)
+		if !ok || identity.IsAnonymous() {
+			logging.GetLoggerWithFields(r).Error("Missing credentials")
+			unauthorized(w)
+			return
+		}
+
+		if !identity.HasScope(scope) {
+			logging.GetLoggerWithFields(r).Errorf("%v not granted the %v scope", identity.Subject, scope)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="checkout"`)
+	w.WriteHeader(http.StatusUnauthorized)
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"github.com/alfcope/checkouttest/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewAuthenticator(t *testing.T) {
+	cases := []struct {
+		config config.AuthConfig
+		valid  bool
+	}{
+		{config.AuthConfig{}, true},
+		{config.AuthConfig{Enabled: true, Secret: string(secret)}, true},
+		{config.AuthConfig{Enabled: true, ApiKeys: []config.ApiKeyConfig{{Key: "K1", Subject: "ops", Scopes: []string{"admin"}}}}, true},
+		{config.AuthConfig{Enabled: true}, false},
+		{config.AuthConfig{Enabled: true, Secret: "short"}, false},
+		{config.AuthConfig{Enabled: true, ApiKeys: []config.ApiKeyConfig{{Key: "K1", Scopes: []string{"root"}}}}, false},
+		{config.AuthConfig{Enabled: true, ApiKeys: []config.ApiKeyConfig{{Subject: "ops", Scopes: []string{"admin"}}}}, false},
+	}
+
+	for _, tc := range cases {
+		_, err := NewAuthenticator(tc.config)
+		if (err == nil) != tc.valid {
+			t.Errorf("%+v: wanted valid %v but got error %v", tc.config, tc.valid, err)
+		}
+	}
+}
+
+func TestRequireScopes(t *testing.T) {
+	authenticator, _ := NewAuthenticator(config.AuthConfig{
+		Enabled: true,
+		Secret:  string(secret),
+		ApiKeys: []config.ApiKeyConfig{{Key: "K1", Subject: "ops", Scopes: []string{"admin"}}},
+	})
+	now := time.Now()
+	shopper, _ := SignToken(secret, Claims{Subject: "C1", Scope: "shopper", ExpiresAt: now.Add(time.Hour).Unix()})
+	expired, _ := SignToken(secret, Claims{Subject: "C1", Scope: "shopper", ExpiresAt: now.Add(-time.Hour).Unix()})
+
+	cases := []struct {
+		name   string
+		scope  Scope
+		header string
+		value  string
+		status int
+	}{
+		{"anonymous", Shopper, "", "", http.StatusUnauthorized},
+		{"shopper token", Shopper, "Authorization", "Bearer " + shopper, http.StatusOK},
+		{"shopper token on admin route", Admin, "Authorization", "Bearer " + shopper, http.StatusForbidden},
+		{"expired token", Shopper, "Authorization", "Bearer " + expired, http.StatusUnauthorized},
+		{"basic authorization", Shopper, "Authorization", "Basic dXNlcjpwYXNz", http.StatusUnauthorized},
+		{"admin key", Admin, ApiKeyHeader, "K1", http.StatusOK},
+		{"admin key on shopper route", Shopper, ApiKeyHeader, "K1", http.StatusOK},
+		{"unknown key", Shopper, ApiKeyHeader, "K2", http.StatusUnauthorized},
+	}
+
+	for _, tc := range cases {
+		handler := authenticator.Middleware(Require(tc.scope, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})))
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		if tc.header != "" {
+			req.Header.Set(tc.header, tc.value)
+		}
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tc.status {
+			t.Errorf("%v: wanted status %v but got %v", tc.name, tc.status, rr.Code)
+		}
+	}
+}
+
+func TestAuthenticateIdentity(t *testing.T) {
+	enabled, _ := NewAuthenticator(config.AuthConfig{Enabled: true, Secret: string(secret)})
+	disabled, _ := NewAuthenticator(config.AuthConfig{})
+	token, _ := SignToken(secret, Claims{Subject: "C1", Scope: "shopper unknown"})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(CustomerHeader, "C2")
+
+	// The customer header is not trusted when authentication is enabled
+	identity, err := enabled.Authenticate(req)
+	if err != nil || identity.Subject != "C1" || len(identity.Scopes) != 1 || !identity.HasScope(Shopper) {
+		t.Errorf("Wanted shopper C1 but got %+v, %v", identity, err)
+	}
+
+	identity, err = disabled.Authenticate(req)
+	if err != nil || identity.Subject != "C2" || !identity.HasScope(Admin) {
+		t.Errorf("Wanted C2 granted every scope but got %+v, %v", identity, err)
+	}
+}
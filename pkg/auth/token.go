@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Claims are the fields of a bearer token the api reads. Scopes are separated by
+// spaces, and the token is valid from NotBefore until ExpiresAt when they are set
+type Claims struct {
+	Subject   string `json:"sub"`
+	Scope     string `json:"scope"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+type tokenHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+}
+
+const signingAlgorithm = "HS256"
+
+var encoding = base64.RawURLEncoding
+
+// SignToken issues a JWT with the claims, signed with HMAC SHA-256
+func SignToken(secret []byte, claims Claims) (string, error) {
+	header, err := json.Marshal(tokenHeader{Algorithm: signingAlgorithm, Type: "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := encoding.EncodeToString(header) + "." + encoding.EncodeToString(payload)
+
+	return unsigned + "." + encoding.EncodeToString(sign(secret, unsigned)), nil
+}
+
+// ParseToken verifies the signature and validity period of a JWT signed with HMAC
+// SHA-256, returning its claims. Tokens signed with any other algorithm are rejected
+func ParseToken(secret []byte, token string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, fmt.Errorf("malformed token")
+	}
+
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, err
+	}
+	if header.Algorithm != signingAlgorithm {
+		return Claims{}, fmt.Errorf("unsupported token algorithm %q", header.Algorithm)
+	}
+
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, fmt.Errorf("malformed token signature")
+	}
+	if !hmac.Equal(signature, sign(secret, parts[0]+"."+parts[1])) {
+		return Claims{}, fmt.Errorf("invalid token signature")
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, err
+	}
+
+	if claims.ExpiresAt != 0 && !now.Before(time.Unix(claims.ExpiresAt, 0)) {
+		return Claims{}, fmt.Errorf("token expired")
+	}
+	if claims.NotBefore != 0 && now.Before(time.Unix(claims.NotBefore, 0)) {
+		return Claims{}, fmt.Errorf("token not valid yet")
+	}
+
+	return claims, nil
+}
+
+func sign(secret []byte, unsigned string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+
+	return mac.Sum(nil)
+}
+
+func decodeSegment(segment string, value interface{}) error {
+	decoded, err := encoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("malformed token")
+	}
+
+	if err := json.Unmarshal(decoded, value); err != nil {
+		return fmt.Errorf("malformed token")
+	}
+
+	return nil
+}
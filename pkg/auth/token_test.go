@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+func TestSignAndParseToken(t *testing.T) {
+	now := time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC)
+	claims := Claims{Subject: "C1", Scope: "shopper", ExpiresAt: now.Add(time.Hour).Unix(), IssuedAt: now.Unix()}
+
+	token, err := SignToken(secret, claims)
+	if err != nil {
+		t.Fatalf("Unexpected error signing a token: %v", err)
+	}
+
+	parsed, err := ParseToken(secret, token, now)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing a token: %v", err)
+	}
+	if parsed != claims {
+		t.Errorf("Wanted claims %+v but got %+v", claims, parsed)
+	}
+}
+
+func TestParseInvalidToken(t *testing.T) {
+	now := time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC)
+	valid, _ := SignToken(secret, Claims{Subject: "C1", Scope: "admin"})
+	expired, _ := SignToken(secret, Claims{Subject: "C1", ExpiresAt: now.Unix()})
+	early, _ := SignToken(secret, Claims{Subject: "C1", NotBefore: now.Add(time.Minute).Unix()})
+	otherKey, _ := SignToken([]byte("fedcba9876543210fedcba9876543210"), Claims{Subject: "C1"})
+	parts := strings.Split(valid, ".")
+	// Unsigned tokens must never be accepted
+	unsigned := encoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+	tampered := parts[0] + "." + encoding.EncodeToString([]byte(`{"sub":"C2","scope":"admin"}`)) + "." + parts[2]
+
+	cases := map[string]string{
+		"expired":      expired,
+		"not yet":      early,
+		"other key":    otherKey,
+		"unsigned":     unsigned,
+		"tampered":     tampered,
+		"malformed":    "abc.def",
+		"bad encoding": "a!.b!.c!",
+	}
+
+	for name, token := range cases {
+		if _, err := ParseToken(secret, token, now); err == nil {
+			t.Errorf("%v: the token should be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"github.com/alfcope/checkouttest/config"
+	"github.com/alfcope/checkouttest/pkg/auth"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// KeyHeader carries the key identifying a request and its retries
+	KeyHeader = "Idempotency-Key"
+	// ReplayedHeader marks the responses replayed to duplicated requests
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+	// sweepInterval is how often the responses out of the window are dropped
+	sweepInterval = time.Minute
+)
+
+// entry is the first request sent with a key, and its response once it is done
+type entry struct {
+	fingerprint [sha256.Size]byte
+	createdAt   time.Time
+	done        bool
+	status      int
+	header      http.Header
+	body        []byte
+}
+
+// Store keeps the responses to the requests sent with an idempotency key, replaying
+// them to the duplicates received within the window. Keys are scoped by the caller
+type Store struct {
+	window time.Duration
+	routes map[string]struct{}
+
+	entries    map[string]*entry
+	entriesMux sync.Mutex
+	sweptAt    time.Time
+	now        func() time.Time
+}
+
+// NewStore keeps the responses of the routes, given by method and path template
+// as registered: POST /api/v1/baskets/
+func NewStore(config config.IdempotencyConfig, routes ...string) *Store {
+	store := &Store{
+		window:  config.Window,
+		routes:  make(map[string]struct{}, len(routes)),
+		entries: make(map[string]*entry),
+		now:     time.Now,
+	}
+
+	for _, route := range routes {
+		store.routes[route] = struct{}{}
+	}
+
+	return store
+}
+
+// Middleware replays the response to the first request sent with a key to its
+// duplicates. Duplicates received while the first request is processed are rejected
+// with 409, and requests reusing a key for a different request with 422. Server
+// errors are not kept, so the request can be retried. It must run after the
+// authentication middleware to scope the keys by caller
+func (s *Store) Middleware(nextHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(KeyHeader)
+		if s.window <= 0 || key == "" || !s.keeps(r) {
+			nextHandler.ServeHTTP(w, r)
+			return
+		}
+
+		logger := logging.GetLoggerWithFields(r)
+
+		if len(key) > maxKeyLength {
+			logger.Errorf("Idempotency key longer than %v characters", maxKeyLength)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logger.Errorf("Error reading request body: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		scopedKey := caller(r) + " " + key
+		fingerprint := sha256.Sum256([]byte(r.Method + " " + r.URL.RequestURI() + "\n" + string(body)))
+
+		first, found := s.begin(scopedKey, fingerprint)
+		if found {
+			switch {
+			case first.fingerprint != fingerprint:
+				logger.Errorf("Idempotency key %v reused for a different request", key)
+				w.WriteHeader(http.StatusUnprocessableEntity)
+			case !first.done:
+				logger.Errorf("Request with idempotency key %v still in progress", key)
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusConflict)
+			default:
+				replay(w, first)
+			}
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		done := false
+		defer func() {
+			// The handler panicked: the request can be retried
+			if !done {
+				s.forget(scopedKey)
+			}
+		}()
+
+		nextHandler.ServeHTTP(recorder, r)
+		done = true
+
+		s.finish(scopedKey, recorder)
+	})
+}
+
+// keeps tells if the responses of the route of the request are kept
+func (s *Store) keeps(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return false
+	}
+
+	_, ok := s.routes[strings.ToUpper(r.Method)+" "+template]
+	return ok
+}
+
+// begin records the request with the key, unless it was received before. Then it
+// returns a copy of the first request
+func (s *Store) begin(key string, fingerprint [sha256.Size]byte) (entry, bool) {
+	s.entriesMux.Lock()
+	defer s.entriesMux.Unlock()
+
+	now := s.now()
+	if now.Sub(s.sweptAt) >= sweepInterval {
+		s.sweep(now)
+	}
+
+	if e, ok := s.entries[key]; ok && now.Sub(e.createdAt) < s.window {
+		return *e, true
+	}
+
+	s.entries[key] = &entry{fingerprint: fingerprint, createdAt: now}
+
+	return entry{}, false
+}
+
+// finish keeps the response to the request with the key, or forgets the request if
+// it failed with a server error
+func (s *Store) finish(key string, recorder *responseRecorder) {
+	if recorder.status >= http.StatusInternalServerError {
+		s.forget(key)
+		return
+	}
+
+	header := make(http.Header, len(recorder.Header()))
+	for name, values := range recorder.Header() {
+		header[name] = append([]string(nil), values...)
+	}
+
+	s.entriesMux.Lock()
+	defer s.entriesMux.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		e.done = true
+		e.status = recorder.status
+		e.header = header
+		e.body = recorder.body.Bytes()
+	}
+}
+
+func (s *Store) forget(key string) {
+	s.entriesMux.Lock()
+	defer s.entriesMux.Unlock()
+
+	delete(s.entries, key)
+}
+
+// sweep drops the requests received before the window
+func (s *Store) sweep(now time.Time) {
+	for key, e := range s.entries {
+		if now.Sub(e.createdAt) >= s.window {
+			delete(s.entries, key)
+		}
+	}
+	s.sweptAt = now
+}
+
+// caller scopes the keys by the subject of the request, if any
+func caller(r *http.Request) string {
+	if identity, ok := auth.FromRequest(r); ok {
+		return identity.Subject
+	}
+
+	return ""
+}
+
+func replay(w http.ResponseWriter, e entry) {
+	for name, values := range e.header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(e.status)
+
+	_, _ = w.Write(e.body)
+}
+
+// responseRecorder copies the response written by a handler
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,145 @@
+package idempotency
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/alfcope/checkouttest/config"
+	"github.com/alfcope/checkouttest/pkg/auth"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newRouter serves the handler behind the store middleware on a route it keeps and
+// on one it does not
+func newRouter(store *Store, handler http.HandlerFunc) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(store.Middleware)
+	router.Handle("/baskets/{id}/items/", handler).Methods("POST")
+	router.Handle("/baskets/{id}/coupons/", handler).Methods("POST")
+
+	return router
+}
+
+func send(router *mux.Router, path, key, subject, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", path, bytes.NewBufferString(body))
+	if key != "" {
+		req.Header.Set(KeyHeader, key)
+	}
+	req = auth.WithIdentity(req, auth.Identity{Subject: subject})
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestReplayDuplicates(t *testing.T) {
+	store := NewStore(config.IdempotencyConfig{Window: time.Hour}, "POST /baskets/{id}/items/")
+	now := time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	calls := 0
+	status := http.StatusCreated
+	router := newRouter(store, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = fmt.Fprintf(w, `{"call":%d}`, calls)
+	})
+
+	cases := []struct {
+		name     string
+		path     string
+		key      string
+		subject  string
+		body     string
+		status   int
+		calls    int
+		replayed bool
+	}{
+		{"first request", "/baskets/B1/items/", "K1", "C1", `{"code":"PEN"}`, http.StatusCreated, 1, false},
+		{"duplicate", "/baskets/B1/items/", "K1", "C1", `{"code":"PEN"}`, http.StatusCreated, 1, true},
+		{"key reused for another product", "/baskets/B1/items/", "K1", "C1", `{"code":"MUG"}`, http.StatusUnprocessableEntity, 1, false},
+		{"key reused for another basket", "/baskets/B2/items/", "K1", "C1", `{"code":"PEN"}`, http.StatusUnprocessableEntity, 1, false},
+		{"key of another customer", "/baskets/B1/items/", "K1", "C2", `{"code":"PEN"}`, http.StatusCreated, 2, false},
+		{"without key", "/baskets/B1/items/", "", "C1", `{"code":"PEN"}`, http.StatusCreated, 3, false},
+		{"route not kept", "/baskets/B1/coupons/", "K2", "C1", `{"code":"PROMO"}`, http.StatusCreated, 4, false},
+		{"route not kept again", "/baskets/B1/coupons/", "K2", "C1", `{"code":"PROMO"}`, http.StatusCreated, 5, false},
+	}
+
+	for _, tc := range cases {
+		rr := send(router, tc.path, tc.key, tc.subject, tc.body)
+
+		if rr.Code != tc.status || calls != tc.calls {
+			t.Errorf("%v: wanted status %v after %v calls but got %v after %v", tc.name, tc.status, tc.calls, rr.Code, calls)
+		}
+		if replayed := rr.Header().Get(ReplayedHeader) == "true"; replayed != tc.replayed {
+			t.Errorf("%v: wanted replayed %v", tc.name, tc.replayed)
+		}
+		if tc.replayed && (rr.Body.String() != `{"call":1}` || rr.Header().Get("Content-Type") != "application/json") {
+			t.Errorf("%v: wanted the first response replayed but got %q", tc.name, rr.Body.String())
+		}
+	}
+
+	// Server errors are not kept, so the request can be retried
+	status = http.StatusInternalServerError
+	send(router, "/baskets/B1/items/", "K3", "C1", `{"code":"PEN"}`)
+	status = http.StatusCreated
+	if rr := send(router, "/baskets/B1/items/", "K3", "C1", `{"code":"PEN"}`); rr.Code != http.StatusCreated || calls != 7 {
+		t.Errorf("Wanted the retry of a server error processed but got %v after %v calls", rr.Code, calls)
+	}
+
+	// Responses are replayed only within the window
+	now = now.Add(time.Hour)
+	if rr := send(router, "/baskets/B1/items/", "K1", "C1", `{"code":"PEN"}`); rr.Code != http.StatusCreated || calls != 8 {
+		t.Errorf("Wanted a key out of the window processed again but got %v after %v calls", rr.Code, calls)
+	}
+	if len(store.entries) != 1 {
+		t.Errorf("Wanted the keys out of the window swept but got %v keys", len(store.entries))
+	}
+}
+
+func TestDuplicateInProgress(t *testing.T) {
+	store := NewStore(config.IdempotencyConfig{Window: time.Hour}, "POST /baskets/{id}/items/")
+	started := make(chan struct{})
+	release := make(chan struct{})
+	router := newRouter(store, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	first := make(chan int)
+	go func() {
+		first <- send(router, "/baskets/B1/items/", "K1", "C1", `{"code":"PEN"}`).Code
+	}()
+	<-started
+
+	rr := send(router, "/baskets/B1/items/", "K1", "C1", `{"code":"PEN"}`)
+	close(release)
+
+	if rr.Code != http.StatusConflict || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Wanted a duplicate in progress rejected with 409 and Retry-After but got %v", rr.Code)
+	}
+	if code := <-first; code != http.StatusCreated {
+		t.Errorf("Wanted the first request processed but got %v", code)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	store := NewStore(config.IdempotencyConfig{}, "POST /baskets/{id}/items/")
+	calls := 0
+	router := newRouter(store, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	send(router, "/baskets/B1/items/", "K1", "C1", `{"code":"PEN"}`)
+	send(router, "/baskets/B1/items/", "K1", "C1", `{"code":"PEN"}`)
+
+	if calls != 2 {
+		t.Errorf("Wanted every request processed without a window but got %v calls", calls)
+	}
+}
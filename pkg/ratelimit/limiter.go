@@ -0,0 +1,206 @@
+package ratelimit
+
+import (
+	"fmt"
+	"github.com/alfcope/checkouttest/config"
+	"github.com/alfcope/checkouttest/pkg/auth"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/gorilla/mux"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often the buckets of idle clients are dropped
+const sweepInterval = time.Minute
+
+// limit lets through rate requests per second, in bursts of up to burst requests
+type limit struct {
+	rate  float64
+	burst float64
+}
+
+func newLimit(requests int, period time.Duration, burst int) (limit, error) {
+	if requests <= 0 || period <= 0 {
+		return limit{}, fmt.Errorf("rate limit needs a positive number of requests and period")
+	}
+	if burst < 0 {
+		return limit{}, fmt.Errorf("negative rate limit burst %v", burst)
+	}
+	if burst == 0 {
+		burst = requests
+	}
+
+	return limit{rate: float64(requests) / period.Seconds(), burst: float64(burst)}, nil
+}
+
+// bucket holds the tokens left to a client, refilled at the rate of its limit
+type bucket struct {
+	limit     limit
+	tokens    float64
+	updatedAt time.Time
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(b.limit.burst, b.tokens+now.Sub(b.updatedAt).Seconds()*b.limit.rate)
+	b.updatedAt = now
+}
+
+// take spends a token, or returns how long until there is one
+func (b *bucket) take(now time.Time) (bool, time.Duration) {
+	b.refill(now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - b.tokens) / b.limit.rate * float64(time.Second))
+}
+
+// Limiter rate limits the requests of every client with a token bucket. Clients are
+// identified by the api key they authenticated with, or otherwise by their address.
+// Routes with their own limit are counted apart from the rest of requests
+type Limiter struct {
+	enabled    bool
+	trustProxy bool
+	limit      limit
+	routes     map[string]limit
+
+	buckets    map[string]*bucket
+	bucketsMux sync.Mutex
+	sweptAt    time.Time
+	now        func() time.Time
+}
+
+func NewLimiter(config config.RateLimitConfig) (*Limiter, error) {
+	limiter := &Limiter{
+		enabled:    config.Enabled,
+		trustProxy: config.TrustProxy,
+		routes:     make(map[string]limit, len(config.Routes)),
+		buckets:    make(map[string]*bucket),
+		now:        time.Now,
+	}
+
+	if !config.Enabled {
+		return limiter, nil
+	}
+
+	var err error
+	if limiter.limit, err = newLimit(config.Requests, config.Period, config.Burst); err != nil {
+		return nil, err
+	}
+
+	for _, route := range config.Routes {
+		if route.Method == "" || route.Path == "" {
+			return nil, fmt.Errorf("rate limited route needs a method and a path")
+		}
+
+		routeLimit, err := newLimit(route.Requests, route.Period, route.Burst)
+		if err != nil {
+			return nil, fmt.Errorf("%v %v: %v", route.Method, route.Path, err)
+		}
+		limiter.routes[routeKey(route.Method, route.Path)] = routeLimit
+	}
+
+	return limiter, nil
+}
+
+// Allow spends a request of the client on the route, or returns how long it has to
+// wait before trying again
+func (l *Limiter) Allow(client, method, path string) (bool, time.Duration) {
+	if !l.enabled {
+		return true, 0
+	}
+
+	key := client
+	clientLimit := l.limit
+	if routeLimit, ok := l.routes[routeKey(method, path)]; ok {
+		key = routeKey(method, path) + " " + client
+		clientLimit = routeLimit
+	}
+
+	l.bucketsMux.Lock()
+	defer l.bucketsMux.Unlock()
+
+	now := l.now()
+	if now.Sub(l.sweptAt) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limit: clientLimit, tokens: clientLimit.burst, updatedAt: now}
+		l.buckets[key] = b
+	}
+
+	return b.take(now)
+}
+
+// sweep drops the buckets refilled since their last request, as new ones are alike
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.refill(now); b.tokens >= b.limit.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.sweptAt = now
+}
+
+// Middleware rejects with 429 the requests of clients over their limit, telling them
+// in the Retry-After header how many seconds to wait. It must run after the
+// authentication middleware to identify the clients by their api keys
+func (l *Limiter) Middleware(nextHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				path = template
+			}
+		}
+
+		client := l.client(r)
+		if ok, wait := l.Allow(client, r.Method, path); !ok {
+			logging.GetLoggerWithFields(r).Errorf("Rate limit exceeded by %v", client)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		nextHandler.ServeHTTP(w, r)
+	})
+}
+
+// client identifies the caller by its api key, if it authenticated with one, or by
+// its address
+func (l *Limiter) client(r *http.Request) string {
+	if identity, ok := auth.FromRequest(r); ok && identity.ApiKey != "" {
+		return "key:" + identity.ApiKey
+	}
+
+	// The proxy appends the address it received the request from, the only one the
+	// client can not make up
+	if l.trustProxy {
+		if forwarded := r.Header["X-Forwarded-For"]; len(forwarded) > 0 {
+			addresses := strings.Split(forwarded[len(forwarded)-1], ",")
+			if address := strings.TrimSpace(addresses[len(addresses)-1]); address != "" {
+				return "ip:" + address
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+func routeKey(method, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"github.com/alfcope/checkouttest/config"
+	"github.com/alfcope/checkouttest/pkg/auth"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var rateLimit = config.RateLimitConfig{
+	Enabled:  true,
+	Requests: 60,
+	Period:   time.Minute,
+	Burst:    2,
+	Routes:   []config.RouteLimitConfig{{Method: "post", Path: "/baskets/", Requests: 1, Period: time.Minute}},
+}
+
+func TestNewLimiter(t *testing.T) {
+	cases := []struct {
+		config config.RateLimitConfig
+		valid  bool
+	}{
+		{config.RateLimitConfig{}, true},
+		{rateLimit, true},
+		{config.RateLimitConfig{Enabled: true, Period: time.Minute}, false},
+		{config.RateLimitConfig{Enabled: true, Requests: 10}, false},
+		{config.RateLimitConfig{Enabled: true, Requests: 10, Period: time.Minute, Burst: -1}, false},
+		{config.RateLimitConfig{Enabled: true, Requests: 10, Period: time.Minute,
+			Routes: []config.RouteLimitConfig{{Path: "/baskets/", Requests: 1, Period: time.Minute}}}, false},
+		{config.RateLimitConfig{Enabled: true, Requests: 10, Period: time.Minute,
+			Routes: []config.RouteLimitConfig{{Method: "POST", Path: "/baskets/"}}}, false},
+	}
+
+	for _, tc := range cases {
+		_, err := NewLimiter(tc.config)
+		if (err == nil) != tc.valid {
+			t.Errorf("%+v: wanted valid %v but got error %v", tc.config, tc.valid, err)
+		}
+	}
+}
+
+func TestAllow(t *testing.T) {
+	limiter, _ := NewLimiter(rateLimit)
+	now := time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	// A burst of requests is let through until the bucket is empty
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.Allow("C1", "GET", "/products/"); !ok {
+			t.Fatalf("Request %v of the burst should be allowed", i)
+		}
+	}
+	ok, wait := limiter.Allow("C1", "GET", "/products/")
+	if ok || wait != time.Second {
+		t.Errorf("Wanted to wait 1s but got allowed %v, wait %v", ok, wait)
+	}
+
+	// Clients and routes with their own limit have their own buckets
+	if ok, _ := limiter.Allow("C2", "GET", "/products/"); !ok {
+		t.Errorf("Other clients should not be limited")
+	}
+	if ok, _ := limiter.Allow("C1", "POST", "/baskets/"); !ok {
+		t.Errorf("Routes with their own limit should not be counted with the rest")
+	}
+	if ok, wait := limiter.Allow("C1", "POST", "/baskets/"); ok || wait != time.Minute {
+		t.Errorf("Wanted to wait 1m but got allowed %v, wait %v", ok, wait)
+	}
+
+	// Tokens are refilled at the rate of the limit
+	now = now.Add(time.Second)
+	if ok, _ := limiter.Allow("C1", "GET", "/products/"); !ok {
+		t.Errorf("A token should be refilled after a second")
+	}
+
+	// Idle clients are swept once their buckets are full again
+	now = now.Add(sweepInterval)
+	limiter.Allow("C3", "GET", "/products/")
+	if len(limiter.buckets) != 1 {
+		t.Errorf("Wanted the buckets of idle clients swept but got %v buckets", len(limiter.buckets))
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	limiter, _ := NewLimiter(rateLimit)
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		apiKey     string
+		status     int
+	}{
+		{"first request", "10.0.0.1:1234", "", http.StatusOK},
+		{"other port", "10.0.0.1:5678", "", http.StatusOK},
+		{"over the limit", "10.0.0.1:1234", "", http.StatusTooManyRequests},
+		{"other address", "10.0.0.2:1234", "", http.StatusOK},
+		{"api key", "10.0.0.1:1234", "K1", http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		req, _ := http.NewRequest("GET", "/products/", nil)
+		req.RemoteAddr = tc.remoteAddr
+		if tc.apiKey != "" {
+			req = auth.WithIdentity(req, auth.Identity{Subject: "ops", ApiKey: tc.apiKey})
+		}
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tc.status {
+			t.Errorf("%v: wanted status %v but got %v", tc.name, tc.status, rr.Code)
+		}
+		if tc.status == http.StatusTooManyRequests && rr.Header().Get("Retry-After") != "1" {
+			t.Errorf("%v: wanted to retry after 1s but got %q", tc.name, rr.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestClientBehindProxy(t *testing.T) {
+	limiter, _ := NewLimiter(config.RateLimitConfig{Enabled: true, Requests: 1, Period: time.Minute, TrustProxy: true})
+
+	cases := []struct {
+		name      string
+		forwarded []string
+		client    string
+	}{
+		{"appended by the proxy", []string{"203.0.113.7"}, "ip:203.0.113.7"},
+		{"made up by the client", []string{"198.51.100.1, 203.0.113.7"}, "ip:203.0.113.7"},
+		{"in several headers", []string{"198.51.100.1", "203.0.113.7"}, "ip:203.0.113.7"},
+		{"without header", nil, "ip:10.0.0.1"},
+	}
+
+	for _, tc := range cases {
+		req, _ := http.NewRequest("GET", "/products/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		for _, forwarded := range tc.forwarded {
+			req.Header.Add("X-Forwarded-For", forwarded)
+		}
+
+		if client := limiter.client(req); client != tc.client {
+			t.Errorf("%v: wanted client %v but got %v", tc.name, tc.client, client)
+		}
+	}
+}
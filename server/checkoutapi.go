@@ -6,12 +6,19 @@ import (
 	"github.com/alfcope/checkouttest/api"
 	"github.com/alfcope/checkouttest/config"
 	"github.com/alfcope/checkouttest/datasource"
+	"github.com/alfcope/checkouttest/model"
+	"github.com/alfcope/checkouttest/payment"
+	"github.com/alfcope/checkouttest/pkg/auth"
+	"github.com/alfcope/checkouttest/pkg/idempotency"
 	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/alfcope/checkouttest/pkg/ratelimit"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -19,33 +26,131 @@ import (
 type checkoutApi struct {
 	routes *mux.Router
 
-	controller *api.CheckoutController
-	service    *api.CheckoutService
+	ds            datasource.Datasource
+	dataConfig    config.DataConfig
+	basketsConfig config.BasketsConfig
+
+	controller          *api.CheckoutController
+	service             *api.CheckoutService
+	catalogueController *api.CatalogueController
+	promotionController *api.PromotionController
+	orderController     *api.OrderController
+	customerController  *api.CustomerController
 }
 
 // Creates an instance of the api endpoints
 func NewCheckoutApi(configuration config.Configuration) (*checkoutApi, error) {
 
-	ds, err := datasource.InitInMemoryDatasource(configuration.Data)
+	ds, err := datasource.NewDatasource(configuration.Data)
 	if err != nil {
 		fmt.Println("Error initiating datasource: ", err.Error())
 		return nil, err
 	}
 
-	checkoutService := api.NewCheckoutService(ds)
+	strategy, err := model.ParsePricingStrategy(configuration.Pricing.Strategy)
+	if err != nil {
+		fmt.Println("Error reading pricing configuration: ", err.Error())
+		return nil, err
+	}
+
+	currency := model.DefaultCurrency
+	if configuration.Pricing.Currency != "" {
+		currency = model.Currency(configuration.Pricing.Currency)
+	}
+
+	rates := model.ExchangeRates{}
+	if configuration.Data.ExchangeRates != "" {
+		rates, err = datasource.ReadExchangeRates(configuration.Data.ExchangeRates)
+		if err != nil {
+			fmt.Println("Error reading exchange rates: ", err.Error())
+			return nil, err
+		}
+	}
+
+	if !currency.IsValid() || (rates.Base != "" && !rates.Supports(currency)) {
+		err = fmt.Errorf("unsupported currency %q", currency)
+		fmt.Println("Error reading pricing configuration: ", err.Error())
+		return nil, err
+	}
+
+	taxes, err := taxRates(configuration.Tax)
+	if err != nil {
+		fmt.Println("Error reading tax configuration: ", err.Error())
+		return nil, err
+	}
+
+	payments, err := payment.NewPaymentProvider(configuration.Payment)
+	if err != nil {
+		fmt.Println("Error initiating payment provider: ", err.Error())
+		return nil, err
+	}
+
+	checkoutService := api.NewCheckoutService(ds, api.WithBasketTTL(configuration.Baskets.TTL),
+		api.WithPricingStrategy(strategy), api.WithCurrency(currency), api.WithExchangeRates(rates),
+		api.WithTaxRates(taxes), api.WithPaymentProvider(payments))
+
+	authenticator, err := auth.NewAuthenticator(configuration.Auth)
+	if err != nil {
+		fmt.Println("Error reading auth configuration: ", err.Error())
+		return nil, err
+	}
+
+	limiter, err := ratelimit.NewLimiter(configuration.RateLimit)
+	if err != nil {
+		fmt.Println("Error reading rate limit configuration: ", err.Error())
+		return nil, err
+	}
+
+	// Requests whose retries would add again what the first one added
+	idempotent := idempotency.NewStore(configuration.Idempotency,
+		"POST /api/v1/baskets/", "POST /api/v1/baskets/{id}/items/")
 
 	routes := mux.NewRouter()
 	apiRoute := routes.PathPrefix("/api/v1").Subrouter().StrictSlash(true)
+	apiRoute.Use(authenticator.Middleware, limiter.Middleware, idempotent.Middleware)
 
 	api.AddHealthCheckRoute(apiRoute)
+	api.AddMetricsRoute(apiRoute)
 
 	return &checkoutApi{
-		routes:     apiRoute,
-		controller: api.NewCheckoutController(apiRoute, checkoutService),
-		service:    &checkoutService,
+		routes:              apiRoute,
+		ds:                  ds,
+		dataConfig:          configuration.Data,
+		basketsConfig:       configuration.Baskets,
+		controller:          api.NewCheckoutController(apiRoute, checkoutService),
+		service:             &checkoutService,
+		catalogueController: api.NewCatalogueController(apiRoute, api.NewCatalogueService(ds, taxes)),
+		promotionController: api.NewPromotionController(apiRoute, api.NewPromotionService(ds)),
+		orderController:     api.NewOrderController(apiRoute, checkoutService),
+		customerController:  api.NewCustomerController(apiRoute, checkoutService),
 	}, nil
 }
 
+// taxRates returns the tax rates of the configured region, none without a region
+func taxRates(taxConfig config.TaxConfig) (model.TaxRates, error) {
+	if taxConfig.Region == "" {
+		return model.TaxRates{}, nil
+	}
+
+	rounding, err := model.ParseTaxRounding(taxConfig.Rounding)
+	if err != nil {
+		return model.TaxRates{}, err
+	}
+
+	// Keys are read in lower case from the configuration file
+	regionRates, ok := taxConfig.Regions[strings.ToLower(taxConfig.Region)]
+	if !ok {
+		return model.TaxRates{}, fmt.Errorf("no tax rates for region %q", taxConfig.Region)
+	}
+
+	rates := make(map[model.TaxCategory]string, len(regionRates))
+	for category, rate := range regionRates {
+		rates[model.TaxCategory(category)] = rate
+	}
+
+	return model.NewTaxRates(rates, rounding)
+}
+
 // Start the http server
 func (c checkoutApi) RunServer(port int) {
 
@@ -58,6 +163,16 @@ func (c checkoutApi) RunServer(port int) {
 
 	idleConnsClosed := make(chan struct{})
 
+	if c.basketsConfig.TTL > 0 {
+		sweepBaskets(*c.service, c.basketsConfig.SweepInterval, idleConnsClosed)
+	}
+
+	if reloader, ok := c.ds.(datasource.Reloader); ok {
+		if err := watchData(reloader, c.dataConfig, idleConnsClosed); err != nil {
+			logging.Logger.Errorf("Data files will not be reloaded: %v", err)
+		}
+	}
+
 	go func() {
 		sigint := make(chan os.Signal, 1)
 
@@ -78,7 +193,7 @@ func (c checkoutApi) RunServer(port int) {
 	corsHandler := handlers.CORS(
 		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
 		handlers.AllowedOrigins([]string{"*"}),
-		handlers.AllowedHeaders([]string{"Content-Type", "X-Requested-With", "Authorization"}))
+		handlers.AllowedHeaders([]string{"Content-Type", "X-Requested-With", "Authorization", auth.ApiKeyHeader, auth.CustomerHeader, idempotency.KeyHeader}))
 
 	server.Handler = corsHandler(c.routes)
 
@@ -90,4 +205,10 @@ func (c checkoutApi) RunServer(port int) {
 	}
 
 	<-idleConnsClosed
+
+	if closer, ok := c.ds.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			logging.Logger.Errorf("Error closing datasource: %v", err)
+		}
+	}
 }
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"github.com/alfcope/checkouttest/config"
+	"github.com/alfcope/checkouttest/datasource"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// Editors usually write a file in several steps, events closer than this are
+// handled as a single change
+const reloadDelay = 500 * time.Millisecond
+
+// watchData reloads the products and promotions files whenever they change or a
+// SIGHUP signal is received, until done is closed
+func watchData(ds datasource.Reloader, dataConfig config.DataConfig, done <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	// Directories are watched instead of the files, as saving a file by replacing it
+	// would remove the watch of the file itself
+	files := make(map[string]bool)
+	for _, path := range []string{dataConfig.Products, dataConfig.Promotions} {
+		path = filepath.Clean(path)
+		files[path] = true
+
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			_ = watcher.Close()
+			return err
+		}
+	}
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(sighup)
+		defer watcher.Close()
+
+		timer := time.NewTimer(reloadDelay)
+		timer.Stop()
+
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if files[filepath.Clean(event.Name)] && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+					timer.Reset(reloadDelay)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logging.Logger.Errorf("Error watching data files: %v", err)
+			case <-sighup:
+				reloadData(ds, dataConfig, "signal")
+			case <-timer.C:
+				reloadData(ds, dataConfig, "file")
+			case <-done:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+func reloadData(ds datasource.Reloader, dataConfig config.DataConfig, trigger string) {
+	logger := logging.Logger.WithFields(logrus.Fields{
+		"trigger":    trigger,
+		"products":   dataConfig.Products,
+		"promotions": dataConfig.Promotions,
+	})
+
+	diff, err := ds.Reload(dataConfig)
+	if err != nil {
+		logger.Errorf("Data files not reloaded, keeping the current catalogue: %v", err)
+		return
+	}
+
+	if diff.IsEmpty() {
+		logger.Info("Data files reloaded without changes")
+		return
+	}
+
+	for _, change := range diff.ChangedProducts {
+		logger.WithFields(logrus.Fields{
+			"code":   change.After.Code,
+			"before": change.Before,
+			"after":  change.After,
+		}).Info("Product changed")
+	}
+
+	logger.WithFields(logrus.Fields{
+		"productsAdded":     diff.AddedProducts,
+		"productsRemoved":   diff.RemovedProducts,
+		"productsChanged":   len(diff.ChangedProducts),
+		"promotionsAdded":   diff.AddedPromotions,
+		"promotionsRemoved": diff.RemovedPromotions,
+		"promotionsChanged": diff.ChangedPromotions,
+	}).Info("Data files reloaded")
+}
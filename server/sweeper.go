@@ -0,0 +1,32 @@
+package server
+
+import (
+	"github.com/alfcope/checkouttest/api"
+	"github.com/alfcope/checkouttest/pkg/logging"
+	"time"
+)
+
+const defaultSweepInterval = time.Minute
+
+// sweepBaskets evicts the expired baskets periodically, until done is closed
+func sweepBaskets(service api.CheckoutService, interval time.Duration, done <-chan struct{}) {
+	if interval <= 0 {
+		interval = defaultSweepInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if evicted := service.DeleteExpiredBaskets(); evicted > 0 {
+					logging.Logger.WithField("evicted", evicted).Info("Expired baskets evicted")
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+}